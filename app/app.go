@@ -1,53 +1,103 @@
 package app
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"log/slog"
 
 	"cloud.google.com/go/firestore"
 	clients "github.com/kriku/kpukbot/internal/clients/telegram"
+	"github.com/kriku/kpukbot/internal/config"
+	"github.com/kriku/kpukbot/internal/handlers"
 	repositories "github.com/kriku/kpukbot/internal/repository/messages"
+	"github.com/kriku/kpukbot/internal/repository/processed"
+	"github.com/kriku/kpukbot/internal/services/callbacks"
 	"github.com/kriku/kpukbot/internal/services/chats"
+	"github.com/kriku/kpukbot/internal/services/media"
 	"github.com/kriku/kpukbot/internal/services/orchestrator"
+	"github.com/kriku/kpukbot/internal/services/updates"
 	"github.com/kriku/kpukbot/internal/strategies"
 )
 
 type App struct {
+	Config             *config.Config
 	Logger             *slog.Logger
 	MessengerClient    clients.MessengerClient
 	MessagesRepository repositories.MessagesRepository
 	Orchestrator       *orchestrator.OrchestratorService
 	FirestoreClient    *firestore.Client
+	SQLiteDB           *sql.DB
 	ChatsService       *chats.ChatsService
 	Strategies         []strategies.ResponseStrategy
+	UpdateWorker       *updates.Worker
+	ProcessedUpdates   processed.ProcessedUpdatesRepository
+	Commands           *handlers.CommandRouter
+	Callbacks          *callbacks.CallbackRouter
+	Membership         *handlers.MembershipHandler
+	Media              *media.MediaService
 }
 
 func NewApp(
+	cfg *config.Config,
 	lo *slog.Logger,
 	mc clients.MessengerClient,
 	mr repositories.MessagesRepository,
 	orch *orchestrator.OrchestratorService,
 	fc *firestore.Client,
+	db *sql.DB,
 	cs *chats.ChatsService,
 	strats []strategies.ResponseStrategy,
+	uw *updates.Worker,
+	pu processed.ProcessedUpdatesRepository,
+	cr *handlers.CommandRouter,
+	cb *callbacks.CallbackRouter,
+	mh *handlers.MembershipHandler,
+	ms *media.MediaService,
 ) App {
-	// Set the telegram client in the orchestrator to resolve circular dependency
+	// Set the telegram client in the orchestrator, the commands, the callbacks, the membership
+	// handler and the media service to resolve circular dependency
 	orch.SetTelegramClient(mc)
+	cr.SetMessengerClient(mc)
+	cb.SetMessengerClient(mc)
+	mh.SetMessengerClient(mc)
+	ms.SetMessengerClient(mc)
 
 	return App{
+		Config:             cfg,
 		Logger:             lo,
 		MessengerClient:    mc,
 		MessagesRepository: mr,
 		Orchestrator:       orch,
 		FirestoreClient:    fc,
+		SQLiteDB:           db,
 		ChatsService:       cs,
 		Strategies:         strats,
+		UpdateWorker:       uw,
+		ProcessedUpdates:   pu,
+		Commands:           cr,
+		Callbacks:          cb,
+		Membership:         mh,
+		Media:              ms,
+	}
+}
+
+// RegisterCommands publishes the bot commands to the Telegram command menu, a failure only
+// leaves the menu outdated
+func (a *App) RegisterCommands(ctx context.Context) {
+	if err := a.Commands.RegisterCommands(ctx); err != nil {
+		a.Logger.WarnContext(ctx, "Failed to register bot commands", "error", err)
 	}
 }
 
 // Close closes all resources
 func (a *App) Close() error {
+	var errs []error
 	if a.FirestoreClient != nil {
-		return a.FirestoreClient.Close()
+		errs = append(errs, a.FirestoreClient.Close())
+	}
+	if a.SQLiteDB != nil {
+		errs = append(errs, a.SQLiteDB.Close())
 	}
-	return nil
+	return errors.Join(errs...)
 }
@@ -2,13 +2,24 @@ package app
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 
 	"cloud.google.com/go/firestore"
 	"github.com/kriku/kpukbot/internal/config"
+	"github.com/kriku/kpukbot/internal/repository/sqlite"
 )
 
+// NewFirestoreClient creates a Firestore client, or returns nil when another storage backend is configured
 func NewFirestoreClient(ctx context.Context, c *config.Config) (*firestore.Client, error) {
+	switch c.StorageBackend {
+	case config.StorageBackendFirestore:
+	case config.StorageBackendMemory, config.StorageBackendSQLite:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported storage backend: %q", c.StorageBackend)
+	}
+
 	client, err := firestore.NewClient(ctx, c.FilestoreConfig.ProjectID)
 
 	if err != nil {
@@ -17,3 +28,17 @@ func NewFirestoreClient(ctx context.Context, c *config.Config) (*firestore.Clien
 
 	return client, nil
 }
+
+// NewSQLiteDB opens the SQLite database and applies migrations, or returns nil when another storage backend is configured
+func NewSQLiteDB(ctx context.Context, c *config.Config) (*sql.DB, error) {
+	if c.StorageBackend != config.StorageBackendSQLite {
+		return nil, nil
+	}
+
+	db, err := sqlite.Open(ctx, c.SQLiteConfig.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	return db, nil
+}
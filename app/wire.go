@@ -5,59 +5,153 @@ package app
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"log/slog"
+	"net/http"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	"github.com/go-telegram/bot"
 	"github.com/google/wire"
 
 	"github.com/kriku/kpukbot/internal/clients/gemini"
+	"github.com/kriku/kpukbot/internal/clients/openai"
 	clients "github.com/kriku/kpukbot/internal/clients/telegram"
 	"github.com/kriku/kpukbot/internal/config"
 	"github.com/kriku/kpukbot/internal/handlers"
 	"github.com/kriku/kpukbot/internal/logger"
 	chatsRepo "github.com/kriku/kpukbot/internal/repository/chats"
 	messagesRepo "github.com/kriku/kpukbot/internal/repository/messages"
+	processedRepo "github.com/kriku/kpukbot/internal/repository/processed"
 	threadsRepo "github.com/kriku/kpukbot/internal/repository/threads"
+	updatesRepo "github.com/kriku/kpukbot/internal/repository/updates"
+	usageRepo "github.com/kriku/kpukbot/internal/repository/usage"
 	usersRepo "github.com/kriku/kpukbot/internal/repository/users"
+	"github.com/kriku/kpukbot/internal/services/callbacks"
 	"github.com/kriku/kpukbot/internal/services/chats"
+	"github.com/kriku/kpukbot/internal/services/media"
 	"github.com/kriku/kpukbot/internal/services/messages"
 	"github.com/kriku/kpukbot/internal/services/orchestrator"
 	"github.com/kriku/kpukbot/internal/services/response"
 	"github.com/kriku/kpukbot/internal/services/threading"
+	"github.com/kriku/kpukbot/internal/services/updates"
+	"github.com/kriku/kpukbot/internal/services/usage"
 	"github.com/kriku/kpukbot/internal/services/users"
 	"github.com/kriku/kpukbot/internal/strategies"
 )
 
 // Provider functions
 
-// ProvideGeminiClient provides a Gemini client (real or mock based on config)
-func ProvideGeminiClient(ctx context.Context, cfg *config.Config, logger *slog.Logger) (gemini.Client, error) {
+// ProvideLLMClient provides the LLM client of the configured provider (real or mock based on config),
+// token usage of real clients is accounted by the usage service
+func ProvideLLMClient(ctx context.Context, cfg *config.Config, usageService *usage.UsageService, logger *slog.Logger) (gemini.Client, error) {
 	if cfg.UseMockGemini {
 		logger.Info("Using mock Gemini client for local testing")
 		return gemini.NewMockClient(logger), nil
 	}
-	return gemini.NewGeminiClient(ctx, cfg.GeminiAPIKey, logger)
+
+	var client gemini.Client
+	profile := cfg.Profile(config.ModelProfileDefault)
+	switch cfg.LLMProvider {
+	case config.LLMProviderGemini:
+		c, err := gemini.NewGeminiClient(ctx, cfg.GeminiAPIKey, profile, usageService, logger)
+		if err != nil {
+			return nil, err
+		}
+		client = c
+	case config.LLMProviderOpenAI:
+		client = openai.NewOpenAIClient(cfg.OpenAIConfig, profile, &http.Client{Timeout: 2 * time.Minute}, usageService, logger)
+	default:
+		return nil, fmt.Errorf("unsupported llm provider: %q", cfg.LLMProvider)
+	}
+
+	// Transient provider errors are retried, a failing provider trips the circuit breaker
+	return gemini.NewResilientClient(client, cfg.LLMRetryConfig, logger), nil
+}
+
+// ProvideMessagesRepository provides a messages repository for the configured storage backend
+func ProvideMessagesRepository(cfg *config.Config, client *firestore.Client, db *sql.DB) messagesRepo.MessagesRepository {
+	switch cfg.StorageBackend {
+	case config.StorageBackendMemory:
+		return messagesRepo.NewMemoryMessagesRepository()
+	case config.StorageBackendSQLite:
+		return messagesRepo.NewSQLiteMessagesRepository(db)
+	default:
+		return messagesRepo.NewFirestoreMessagesRepository(client)
+	}
 }
 
-// ProvideMessagesRepository provides a messages repository
-func ProvideMessagesRepository(client *firestore.Client) messagesRepo.MessagesRepository {
-	return messagesRepo.NewFirestoreMessagesRepository(client)
+// ProvideThreadsRepository provides a threads repository for the configured storage backend
+func ProvideThreadsRepository(cfg *config.Config, client *firestore.Client, db *sql.DB) threadsRepo.ThreadsRepository {
+	switch cfg.StorageBackend {
+	case config.StorageBackendMemory:
+		return threadsRepo.NewMemoryThreadsRepository()
+	case config.StorageBackendSQLite:
+		return threadsRepo.NewSQLiteThreadsRepository(db)
+	default:
+		return threadsRepo.NewFirestoreThreadsRepository(client)
+	}
 }
 
-// ProvideThreadsRepository provides a threads repository
-func ProvideThreadsRepository(client *firestore.Client) threadsRepo.ThreadsRepository {
-	return threadsRepo.NewFirestoreThreadsRepository(client)
+// ProvideUsersRepository provides a users repository for the configured storage backend
+func ProvideUsersRepository(cfg *config.Config, client *firestore.Client, db *sql.DB) usersRepo.UsersRepository {
+	switch cfg.StorageBackend {
+	case config.StorageBackendMemory:
+		return usersRepo.NewMemoryUsersRepository()
+	case config.StorageBackendSQLite:
+		return usersRepo.NewSQLiteUsersRepository(db)
+	default:
+		return usersRepo.NewFirestoreUsersRepository(client)
+	}
 }
 
-// ProvideUsersRepository provides a users repository
-func ProvideUsersRepository(client *firestore.Client) usersRepo.UsersRepository {
-	return usersRepo.NewFirestoreUsersRepository(client)
+// ProvideChatsRepository provides a chats repository for the configured storage backend
+func ProvideChatsRepository(cfg *config.Config, client *firestore.Client, db *sql.DB) chatsRepo.ChatsRepository {
+	switch cfg.StorageBackend {
+	case config.StorageBackendMemory:
+		return chatsRepo.NewMemoryChatsRepository()
+	case config.StorageBackendSQLite:
+		return chatsRepo.NewSQLiteChatsRepository(db)
+	default:
+		return chatsRepo.NewFirestoreChatsRepository(client)
+	}
 }
 
-// ProvideChatsRepository provides a chats repository
-func ProvideChatsRepository(client *firestore.Client) chatsRepo.ChatsRepository {
-	return chatsRepo.NewFirestoreChatsRepository(client)
+// ProvideUsageRepository provides a usage repository for the configured storage backend
+func ProvideUsageRepository(cfg *config.Config, client *firestore.Client, db *sql.DB) usageRepo.UsageRepository {
+	switch cfg.StorageBackend {
+	case config.StorageBackendMemory:
+		return usageRepo.NewMemoryUsageRepository()
+	case config.StorageBackendSQLite:
+		return usageRepo.NewSQLiteUsageRepository(db)
+	default:
+		return usageRepo.NewFirestoreUsageRepository(client)
+	}
+}
+
+// ProvideUpdatesRepository provides the update queue for the configured storage backend
+func ProvideUpdatesRepository(cfg *config.Config, client *firestore.Client, db *sql.DB) updatesRepo.UpdatesRepository {
+	switch cfg.StorageBackend {
+	case config.StorageBackendMemory:
+		return updatesRepo.NewMemoryUpdatesRepository()
+	case config.StorageBackendSQLite:
+		return updatesRepo.NewSQLiteUpdatesRepository(db)
+	default:
+		return updatesRepo.NewFirestoreUpdatesRepository(client)
+	}
+}
+
+// ProvideProcessedUpdatesRepository provides the deduplication records of Telegram updates
+func ProvideProcessedUpdatesRepository(cfg *config.Config, client *firestore.Client, db *sql.DB) processedRepo.ProcessedUpdatesRepository {
+	switch cfg.StorageBackend {
+	case config.StorageBackendMemory:
+		return processedRepo.NewMemoryProcessedUpdatesRepository()
+	case config.StorageBackendSQLite:
+		return processedRepo.NewSQLiteProcessedUpdatesRepository(db)
+	default:
+		return processedRepo.NewFirestoreProcessedUpdatesRepository(client)
+	}
 }
 
 // ProvideUsersService provides the users service
@@ -75,53 +169,138 @@ func ProvideMessagesService(repository messagesRepo.MessagesRepository, logger *
 	return messages.NewTelegramMessagesService(repository, logger)
 }
 
-// ProvideStrategies provides all response strategies
-func ProvideStrategies(geminiClient gemini.Client, usersService *users.UsersService, chatsService *chats.ChatsService, messagesService *messages.TelegramMessagesService, logger *slog.Logger) []strategies.ResponseStrategy {
+// ProvideUsageService provides the LLM usage accounting service
+func ProvideUsageService(repository usageRepo.UsageRepository, cfg *config.Config, logger *slog.Logger) *usage.UsageService {
+	return usage.NewUsageService(repository, cfg, logger)
+}
+
+// ProvideStrategies provides all response strategies, user facing answers use the smart model profile
+func ProvideStrategies(cfg *config.Config, geminiClient gemini.Client, usersService *users.UsersService, chatsService *chats.ChatsService, messagesService *messages.TelegramMessagesService, logger *slog.Logger) []strategies.ResponseStrategy {
 	return []strategies.ResponseStrategy{
 		strategies.NewIntroductionStrategy(geminiClient, usersService, chatsService, logger),
-		strategies.NewQuestionStrategy(geminiClient, usersService, chatsService, messagesService, logger),
+		strategies.NewQuestionStrategy(geminiClient, usersService, chatsService, logger),
 		strategies.NewAssessmentStrategy(geminiClient, usersService, messagesService, logger),
-		strategies.NewGeneralStrategy(geminiClient, logger),
+		strategies.NewGeneralStrategy(
+			geminiClient.WithProfile(cfg.Profile(config.ModelProfileSmart)),
+			geminiClient.WithProfile(cfg.Profile(config.ModelProfileFast)), // Economy mode near the chat budget
+			logger,
+		),
 	}
 }
 
-// ProvideClassifierService provides the classifier service
+// ProvideClassifierService provides the classifier service running on the fast model profile
 func ProvideClassifierService(
+	cfg *config.Config,
 	geminiClient gemini.Client,
 	threadsRepository threadsRepo.ThreadsRepository,
 	messagesRepository messagesRepo.MessagesRepository,
 	logger *slog.Logger,
 ) *threading.ClassifierService {
-	return threading.NewClassifierService(geminiClient, threadsRepository, messagesRepository, logger)
+	return threading.NewClassifierService(geminiClient.WithProfile(cfg.Profile(config.ModelProfileFast)), threadsRepository, messagesRepository, logger)
 }
 
-// ProvideAnalyzerService provides the analyzer service
+// ProvideAnalyzerService provides the analyzer service, response gating runs on the fast model profile
 func ProvideAnalyzerService(
+	cfg *config.Config,
 	geminiClient gemini.Client,
 	strategies []strategies.ResponseStrategy,
 	logger *slog.Logger,
 ) *response.AnalyzerService {
-	return response.NewAnalyzerService(geminiClient, strategies, logger)
+	return response.NewAnalyzerService(geminiClient.WithProfile(cfg.Profile(config.ModelProfileFast)), strategies, logger)
 }
 
 // ProvideOrchestratorService provides the orchestrator service
 func ProvideOrchestratorService(
+	cfg *config.Config,
 	classifier *threading.ClassifierService,
 	analyzer *response.AnalyzerService,
 	messagesRepository messagesRepo.MessagesRepository,
+	messagesService *messages.TelegramMessagesService,
 	usersService *users.UsersService,
+	chatsService *chats.ChatsService,
+	usageService *usage.UsageService,
+	mediaService *media.MediaService,
 	logger *slog.Logger,
 ) *orchestrator.OrchestratorService {
 	// Note: TelegramClient will be set later in NewApp to avoid circular dependency
-	return orchestrator.NewOrchestratorService(classifier, analyzer, messagesRepository, usersService, nil, logger)
+	return orchestrator.NewOrchestratorService(classifier, analyzer, messagesRepository, messagesService, usersService, chatsService, usageService, mediaService, nil, cfg.MessageEdits, logger)
+}
+
+// ProvideTranscriber provides the transcriber of voice messages running on the fast model profile
+func ProvideTranscriber(cfg *config.Config, geminiClient gemini.Client) media.Transcriber {
+	return media.NewLLMTranscriber(geminiClient.WithProfile(cfg.Profile(config.ModelProfileFast)))
+}
+
+// ProvideMediaService provides the media service, images are described and attachments summarized
+// on the fast model profile
+func ProvideMediaService(
+	cfg *config.Config,
+	geminiClient gemini.Client,
+	transcriber media.Transcriber,
+	messagesRepository messagesRepo.MessagesRepository,
+	logger *slog.Logger,
+) *media.MediaService {
+	return media.NewMediaService(
+		geminiClient.WithProfile(cfg.Profile(config.ModelProfileFast)),
+		transcriber,
+		media.NewLinkClient(30*time.Second),
+		messagesRepository,
+		logger,
+	)
+}
+
+// ProvideCallbackRouter provides the router of inline keyboard buttons with the buttons of strategies registered
+func ProvideCallbackRouter(strats []strategies.ResponseStrategy, logger *slog.Logger) *callbacks.CallbackRouter {
+	router := callbacks.NewCallbackRouter(logger)
+	for _, strategy := range strats {
+		if s, ok := strategy.(strategies.CallbackStrategy); ok {
+			s.RegisterCallbacks(router)
+		}
+	}
+	return router
+}
+
+// ProvideCommandRouter provides the router of in-chat bot commands with all commands registered
+func ProvideCommandRouter(
+	callbackRouter *callbacks.CallbackRouter,
+	chatsService *chats.ChatsService,
+	usersService *users.UsersService,
+	messagesService *messages.TelegramMessagesService,
+	logger *slog.Logger,
+) *handlers.CommandRouter {
+	router := handlers.NewCommandRouter(callbackRouter, logger)
+	router.Register(handlers.NewQueueCommands(chatsService, usersService, router, logger).Commands()...)
+	router.Register(handlers.NewSettingsCommands(chatsService, router, logger).Commands()...)
+	router.Register(handlers.NewMessageCommands(messagesService, router, logger).Commands()...)
+	return router
 }
 
 // ProvideOrchestratorHandler provides the orchestrator handler
 func ProvideOrchestratorHandler(
+	cfg *config.Config,
 	orch *orchestrator.OrchestratorService,
+	commands *handlers.CommandRouter,
+	callbackRouter *callbacks.CallbackRouter,
+	membership *handlers.MembershipHandler,
+	processed processedRepo.ProcessedUpdatesRepository,
+	logger *slog.Logger,
+) *handlers.OrchestratorHandler {
+	return handlers.NewOrchestratorHandler(orch, commands, callbackRouter, membership, processed, cfg.Idempotency, logger)
+}
+
+// ProvideBotHandler provides the default handler of the Telegram bot
+func ProvideBotHandler(handler *handlers.OrchestratorHandler) bot.HandlerFunc {
+	return handler.Handle
+}
+
+// ProvideUpdateWorker provides the workers of queued webhook updates
+func ProvideUpdateWorker(
+	cfg *config.Config,
+	queue updatesRepo.UpdatesRepository,
+	handler *handlers.OrchestratorHandler,
 	logger *slog.Logger,
-) bot.HandlerFunc {
-	return handlers.NewOrchestratorHandler(orch, logger)
+) *updates.Worker {
+	return updates.NewWorker(queue, handler, cfg.UpdateQueue, logger)
 }
 
 var baseSet = wire.NewSet(
@@ -131,17 +310,21 @@ var baseSet = wire.NewSet(
 	// Logger
 	logger.NewLogger,
 
-	// Firestore client
+	// Storage clients
 	NewFirestoreClient,
+	NewSQLiteDB,
 
-	// Gemini client
-	ProvideGeminiClient,
+	// LLM client
+	ProvideLLMClient,
 
 	// Repositories
 	ProvideMessagesRepository,
 	ProvideThreadsRepository,
 	ProvideUsersRepository,
 	ProvideChatsRepository,
+	ProvideUsageRepository,
+	ProvideUpdatesRepository,
+	ProvideProcessedUpdatesRepository,
 
 	// Services
 	ProvideStrategies,
@@ -151,9 +334,17 @@ var baseSet = wire.NewSet(
 	ProvideChatsService,
 	ProvideOrchestratorService,
 	ProvideMessagesService,
+	ProvideUsageService,
+	ProvideTranscriber,
+	ProvideMediaService,
 
-	// Handler
+	// Handlers
+	ProvideCallbackRouter,
+	ProvideCommandRouter,
+	handlers.NewMembershipHandler,
 	ProvideOrchestratorHandler,
+	ProvideBotHandler,
+	ProvideUpdateWorker,
 
 	// Telegram client
 	clients.NewTelegramClient,
@@ -9,90 +9,198 @@ package app
 import (
 	"cloud.google.com/go/firestore"
 	"context"
+	"database/sql"
+	"fmt"
 	"github.com/go-telegram/bot"
 	"github.com/google/wire"
 	"github.com/kriku/kpukbot/internal/clients/gemini"
+	"github.com/kriku/kpukbot/internal/clients/openai"
 	"github.com/kriku/kpukbot/internal/clients/telegram"
 	"github.com/kriku/kpukbot/internal/config"
 	"github.com/kriku/kpukbot/internal/handlers"
 	"github.com/kriku/kpukbot/internal/logger"
 	"github.com/kriku/kpukbot/internal/repository/chats"
 	"github.com/kriku/kpukbot/internal/repository/messages"
+	"github.com/kriku/kpukbot/internal/repository/processed"
 	"github.com/kriku/kpukbot/internal/repository/threads"
+	"github.com/kriku/kpukbot/internal/repository/updates"
+	usage2 "github.com/kriku/kpukbot/internal/repository/usage"
 	"github.com/kriku/kpukbot/internal/repository/users"
+	"github.com/kriku/kpukbot/internal/services/callbacks"
 	chats2 "github.com/kriku/kpukbot/internal/services/chats"
+	"github.com/kriku/kpukbot/internal/services/media"
 	messages2 "github.com/kriku/kpukbot/internal/services/messages"
 	"github.com/kriku/kpukbot/internal/services/orchestrator"
 	"github.com/kriku/kpukbot/internal/services/response"
 	"github.com/kriku/kpukbot/internal/services/threading"
+	updates2 "github.com/kriku/kpukbot/internal/services/updates"
+	"github.com/kriku/kpukbot/internal/services/usage"
 	users2 "github.com/kriku/kpukbot/internal/services/users"
 	"github.com/kriku/kpukbot/internal/strategies"
 	"log/slog"
+	"net/http"
+	"time"
 )
 
 // Injectors from wire.go:
 
 func InitApp(ctx context.Context) (App, error) {
-	slogLogger := logger.NewLogger()
 	configConfig := config.NewConfig()
-	client, err := ProvideGeminiClient(ctx, configConfig, slogLogger)
+	slogLogger := logger.NewLogger()
+	client, err := NewFirestoreClient(ctx, configConfig)
+	if err != nil {
+		return App{}, err
+	}
+	db, err := NewSQLiteDB(ctx, configConfig)
 	if err != nil {
 		return App{}, err
 	}
-	firestoreClient, err := NewFirestoreClient(ctx, configConfig)
+	usageRepository := ProvideUsageRepository(configConfig, client, db)
+	usageService := ProvideUsageService(usageRepository, configConfig, slogLogger)
+	geminiClient, err := ProvideLLMClient(ctx, configConfig, usageService, slogLogger)
 	if err != nil {
 		return App{}, err
 	}
-	threadsRepository := ProvideThreadsRepository(firestoreClient)
-	messagesRepository := ProvideMessagesRepository(firestoreClient)
-	classifierService := ProvideClassifierService(client, threadsRepository, messagesRepository, slogLogger)
-	usersRepository := ProvideUsersRepository(firestoreClient)
+	threadsRepository := ProvideThreadsRepository(configConfig, client, db)
+	messagesRepository := ProvideMessagesRepository(configConfig, client, db)
+	classifierService := ProvideClassifierService(configConfig, geminiClient, threadsRepository, messagesRepository, slogLogger)
+	usersRepository := ProvideUsersRepository(configConfig, client, db)
 	usersService := ProvideUsersService(usersRepository, slogLogger)
-	chatsRepository := ProvideChatsRepository(firestoreClient)
+	chatsRepository := ProvideChatsRepository(configConfig, client, db)
 	chatsService := ProvideChatsService(chatsRepository, slogLogger)
 	telegramMessagesService := ProvideMessagesService(messagesRepository, slogLogger)
-	v := ProvideStrategies(client, usersService, chatsService, telegramMessagesService, slogLogger)
-	analyzerService := ProvideAnalyzerService(client, v, slogLogger)
-	orchestratorService := ProvideOrchestratorService(classifierService, analyzerService, messagesRepository, usersService, slogLogger)
-	handlerFunc := ProvideOrchestratorHandler(orchestratorService, slogLogger)
+	v := ProvideStrategies(configConfig, geminiClient, usersService, chatsService, telegramMessagesService, slogLogger)
+	analyzerService := ProvideAnalyzerService(configConfig, geminiClient, v, slogLogger)
+	transcriber := ProvideTranscriber(configConfig, geminiClient)
+	mediaService := ProvideMediaService(configConfig, geminiClient, transcriber, messagesRepository, slogLogger)
+	orchestratorService := ProvideOrchestratorService(configConfig, classifierService, analyzerService, messagesRepository, telegramMessagesService, usersService, chatsService, usageService, mediaService, slogLogger)
+	callbackRouter := ProvideCallbackRouter(v, slogLogger)
+	commandRouter := ProvideCommandRouter(callbackRouter, chatsService, usersService, telegramMessagesService, slogLogger)
+	membershipHandler := handlers.NewMembershipHandler(chatsService, usersService, slogLogger)
+	processedUpdatesRepository := ProvideProcessedUpdatesRepository(configConfig, client, db)
+	orchestratorHandler := ProvideOrchestratorHandler(configConfig, orchestratorService, commandRouter, callbackRouter, membershipHandler, processedUpdatesRepository, slogLogger)
+	handlerFunc := ProvideBotHandler(orchestratorHandler)
 	messengerClient, err := telegram.NewTelegramClient(ctx, configConfig, handlerFunc)
 	if err != nil {
 		return App{}, err
 	}
-	app := NewApp(slogLogger, messengerClient, messagesRepository, orchestratorService, firestoreClient, chatsService, v)
+	updatesRepository := ProvideUpdatesRepository(configConfig, client, db)
+	worker := ProvideUpdateWorker(configConfig, updatesRepository, orchestratorHandler, slogLogger)
+	app := NewApp(configConfig, slogLogger, messengerClient, messagesRepository, orchestratorService, client, db, chatsService, v, worker, processedUpdatesRepository, commandRouter, callbackRouter, membershipHandler, mediaService)
 	return app, nil
 }
 
 // wire.go:
 
-// ProvideGeminiClient provides a Gemini client (real or mock based on config)
-func ProvideGeminiClient(ctx context.Context, cfg *config.Config, logger2 *slog.Logger) (gemini.Client, error) {
+// ProvideLLMClient provides the LLM client of the configured provider (real or mock based on config),
+// token usage of real clients is accounted by the usage service
+func ProvideLLMClient(ctx context.Context, cfg *config.Config, usageService *usage.UsageService, logger2 *slog.Logger) (gemini.Client, error) {
 	if cfg.UseMockGemini {
 		logger2.
 			Info("Using mock Gemini client for local testing")
 		return gemini.NewMockClient(logger2), nil
 	}
-	return gemini.NewGeminiClient(ctx, cfg.GeminiAPIKey, logger2)
+
+	var client gemini.Client
+	profile := cfg.Profile(config.ModelProfileDefault)
+	switch cfg.LLMProvider {
+	case config.LLMProviderGemini:
+		c, err := gemini.NewGeminiClient(ctx, cfg.GeminiAPIKey, profile, usageService, logger2)
+		if err != nil {
+			return nil, err
+		}
+		client = c
+	case config.LLMProviderOpenAI:
+		client = openai.NewOpenAIClient(cfg.OpenAIConfig, profile, &http.Client{Timeout: 2 * time.Minute}, usageService, logger2)
+	default:
+		return nil, fmt.Errorf("unsupported llm provider: %q", cfg.LLMProvider)
+	}
+
+	return gemini.NewResilientClient(client, cfg.LLMRetryConfig, logger2), nil
+}
+
+// ProvideMessagesRepository provides a messages repository for the configured storage backend
+func ProvideMessagesRepository(cfg *config.Config, client *firestore.Client, db *sql.DB) messages.MessagesRepository {
+	switch cfg.StorageBackend {
+	case config.StorageBackendMemory:
+		return messages.NewMemoryMessagesRepository()
+	case config.StorageBackendSQLite:
+		return messages.NewSQLiteMessagesRepository(db)
+	default:
+		return messages.NewFirestoreMessagesRepository(client)
+	}
 }
 
-// ProvideMessagesRepository provides a messages repository
-func ProvideMessagesRepository(client *firestore.Client) messages.MessagesRepository {
-	return messages.NewFirestoreMessagesRepository(client)
+// ProvideThreadsRepository provides a threads repository for the configured storage backend
+func ProvideThreadsRepository(cfg *config.Config, client *firestore.Client, db *sql.DB) threads.ThreadsRepository {
+	switch cfg.StorageBackend {
+	case config.StorageBackendMemory:
+		return threads.NewMemoryThreadsRepository()
+	case config.StorageBackendSQLite:
+		return threads.NewSQLiteThreadsRepository(db)
+	default:
+		return threads.NewFirestoreThreadsRepository(client)
+	}
+}
+
+// ProvideUsersRepository provides a users repository for the configured storage backend
+func ProvideUsersRepository(cfg *config.Config, client *firestore.Client, db *sql.DB) users.UsersRepository {
+	switch cfg.StorageBackend {
+	case config.StorageBackendMemory:
+		return users.NewMemoryUsersRepository()
+	case config.StorageBackendSQLite:
+		return users.NewSQLiteUsersRepository(db)
+	default:
+		return users.NewFirestoreUsersRepository(client)
+	}
 }
 
-// ProvideThreadsRepository provides a threads repository
-func ProvideThreadsRepository(client *firestore.Client) threads.ThreadsRepository {
-	return threads.NewFirestoreThreadsRepository(client)
+// ProvideChatsRepository provides a chats repository for the configured storage backend
+func ProvideChatsRepository(cfg *config.Config, client *firestore.Client, db *sql.DB) chats.ChatsRepository {
+	switch cfg.StorageBackend {
+	case config.StorageBackendMemory:
+		return chats.NewMemoryChatsRepository()
+	case config.StorageBackendSQLite:
+		return chats.NewSQLiteChatsRepository(db)
+	default:
+		return chats.NewFirestoreChatsRepository(client)
+	}
 }
 
-// ProvideUsersRepository provides a users repository
-func ProvideUsersRepository(client *firestore.Client) users.UsersRepository {
-	return users.NewFirestoreUsersRepository(client)
+// ProvideUsageRepository provides a usage repository for the configured storage backend
+func ProvideUsageRepository(cfg *config.Config, client *firestore.Client, db *sql.DB) usage2.UsageRepository {
+	switch cfg.StorageBackend {
+	case config.StorageBackendMemory:
+		return usage2.NewMemoryUsageRepository()
+	case config.StorageBackendSQLite:
+		return usage2.NewSQLiteUsageRepository(db)
+	default:
+		return usage2.NewFirestoreUsageRepository(client)
+	}
 }
 
-// ProvideChatsRepository provides a chats repository
-func ProvideChatsRepository(client *firestore.Client) chats.ChatsRepository {
-	return chats.NewFirestoreChatsRepository(client)
+// ProvideUpdatesRepository provides the update queue for the configured storage backend
+func ProvideUpdatesRepository(cfg *config.Config, client *firestore.Client, db *sql.DB) updates.UpdatesRepository {
+	switch cfg.StorageBackend {
+	case config.StorageBackendMemory:
+		return updates.NewMemoryUpdatesRepository()
+	case config.StorageBackendSQLite:
+		return updates.NewSQLiteUpdatesRepository(db)
+	default:
+		return updates.NewFirestoreUpdatesRepository(client)
+	}
+}
+
+// ProvideProcessedUpdatesRepository provides the deduplication records of Telegram updates
+func ProvideProcessedUpdatesRepository(cfg *config.Config, client *firestore.Client, db *sql.DB) processed.ProcessedUpdatesRepository {
+	switch cfg.StorageBackend {
+	case config.StorageBackendMemory:
+		return processed.NewMemoryProcessedUpdatesRepository()
+	case config.StorageBackendSQLite:
+		return processed.NewSQLiteProcessedUpdatesRepository(db)
+	default:
+		return processed.NewFirestoreProcessedUpdatesRepository(client)
+	}
 }
 
 // ProvideUsersService provides the users service
@@ -110,53 +218,135 @@ func ProvideMessagesService(repository messages.MessagesRepository, logger2 *slo
 	return messages2.NewTelegramMessagesService(repository, logger2)
 }
 
-// ProvideStrategies provides all response strategies
-func ProvideStrategies(geminiClient gemini.Client, usersService *users2.UsersService, chatsService *chats2.ChatsService, messagesService *messages2.TelegramMessagesService, logger2 *slog.Logger) []strategies.ResponseStrategy {
-	return []strategies.ResponseStrategy{strategies.NewIntroductionStrategy(geminiClient, usersService, chatsService, logger2), strategies.NewQuestionStrategy(geminiClient, usersService, chatsService, messagesService, logger2), strategies.NewAssessmentStrategy(geminiClient, usersService, messagesService, logger2), strategies.NewGeneralStrategy(geminiClient, logger2)}
+// ProvideUsageService provides the LLM usage accounting service
+func ProvideUsageService(repository usage2.UsageRepository, cfg *config.Config, logger2 *slog.Logger) *usage.UsageService {
+	return usage.NewUsageService(repository, cfg, logger2)
 }
 
-// ProvideClassifierService provides the classifier service
+// ProvideStrategies provides all response strategies, user facing answers use the smart model profile
+func ProvideStrategies(cfg *config.Config, geminiClient gemini.Client, usersService *users2.UsersService, chatsService *chats2.ChatsService, messagesService *messages2.TelegramMessagesService, logger2 *slog.Logger) []strategies.ResponseStrategy {
+	return []strategies.ResponseStrategy{strategies.NewIntroductionStrategy(geminiClient, usersService, chatsService, logger2), strategies.NewQuestionStrategy(geminiClient, usersService, chatsService, logger2), strategies.NewAssessmentStrategy(geminiClient, usersService, messagesService, logger2), strategies.NewGeneralStrategy(
+		geminiClient.WithProfile(cfg.Profile(config.ModelProfileSmart)),
+		geminiClient.WithProfile(cfg.Profile(config.ModelProfileFast)), logger2,
+	),
+	}
+}
+
+// ProvideClassifierService provides the classifier service running on the fast model profile
 func ProvideClassifierService(
+	cfg *config.Config,
 	geminiClient gemini.Client,
 	threadsRepository threads.ThreadsRepository,
 	messagesRepository messages.MessagesRepository, logger2 *slog.Logger,
 ) *threading.ClassifierService {
-	return threading.NewClassifierService(geminiClient, threadsRepository, messagesRepository, logger2)
+	return threading.NewClassifierService(geminiClient.WithProfile(cfg.Profile(config.ModelProfileFast)), threadsRepository, messagesRepository, logger2)
 }
 
-// ProvideAnalyzerService provides the analyzer service
+// ProvideAnalyzerService provides the analyzer service, response gating runs on the fast model profile
 func ProvideAnalyzerService(
+	cfg *config.Config,
 	geminiClient gemini.Client, strategies2 []strategies.ResponseStrategy, logger2 *slog.Logger,
 ) *response.AnalyzerService {
-	return response.NewAnalyzerService(geminiClient, strategies2, logger2)
+	return response.NewAnalyzerService(geminiClient.WithProfile(cfg.Profile(config.ModelProfileFast)), strategies2, logger2)
 }
 
 // ProvideOrchestratorService provides the orchestrator service
 func ProvideOrchestratorService(
+	cfg *config.Config,
 	classifier *threading.ClassifierService,
 	analyzer *response.AnalyzerService,
 	messagesRepository messages.MessagesRepository,
-	usersService *users2.UsersService, logger2 *slog.Logger,
+	messagesService *messages2.TelegramMessagesService,
+	usersService *users2.UsersService,
+	chatsService *chats2.ChatsService,
+	usageService *usage.UsageService,
+	mediaService *media.MediaService, logger2 *slog.Logger,
 ) *orchestrator.OrchestratorService {
 
-	return orchestrator.NewOrchestratorService(classifier, analyzer, messagesRepository, usersService, nil, logger2)
+	return orchestrator.NewOrchestratorService(classifier, analyzer, messagesRepository, messagesService, usersService, chatsService, usageService, mediaService, nil, cfg.MessageEdits, logger2)
+}
+
+// ProvideTranscriber provides the transcriber of voice messages running on the fast model profile
+func ProvideTranscriber(cfg *config.Config, geminiClient gemini.Client) media.Transcriber {
+	return media.NewLLMTranscriber(geminiClient.WithProfile(cfg.Profile(config.ModelProfileFast)))
+}
+
+// ProvideMediaService provides the media service, images are described and attachments summarized
+// on the fast model profile
+func ProvideMediaService(
+	cfg *config.Config,
+	geminiClient gemini.Client,
+	transcriber media.Transcriber,
+	messagesRepository messages.MessagesRepository, logger2 *slog.Logger,
+) *media.MediaService {
+	return media.NewMediaService(
+		geminiClient.WithProfile(cfg.Profile(config.ModelProfileFast)),
+		transcriber, media.NewLinkClient(30*time.Second), messagesRepository, logger2,
+	)
+}
+
+// ProvideCallbackRouter provides the router of inline keyboard buttons with the buttons of strategies registered
+func ProvideCallbackRouter(strats []strategies.ResponseStrategy, logger2 *slog.Logger) *callbacks.CallbackRouter {
+	router := callbacks.NewCallbackRouter(logger2)
+	for _, strategy := range strats {
+		if s, ok := strategy.(strategies.CallbackStrategy); ok {
+			s.RegisterCallbacks(router)
+		}
+	}
+	return router
+}
+
+// ProvideCommandRouter provides the router of in-chat bot commands with all commands registered
+func ProvideCommandRouter(
+	callbackRouter *callbacks.CallbackRouter,
+	chatsService *chats2.ChatsService,
+	usersService *users2.UsersService,
+	messagesService *messages2.TelegramMessagesService, logger2 *slog.Logger,
+) *handlers.CommandRouter {
+	router := handlers.NewCommandRouter(callbackRouter, logger2)
+	router.Register(handlers.NewQueueCommands(chatsService, usersService, router, logger2).Commands()...)
+	router.Register(handlers.NewSettingsCommands(chatsService, router, logger2).Commands()...)
+	router.Register(handlers.NewMessageCommands(messagesService, router, logger2).Commands()...)
+	return router
 }
 
 // ProvideOrchestratorHandler provides the orchestrator handler
 func ProvideOrchestratorHandler(
-	orch *orchestrator.OrchestratorService, logger2 *slog.Logger,
-) bot.HandlerFunc {
-	return handlers.NewOrchestratorHandler(orch, logger2)
+	cfg *config.Config,
+	orch *orchestrator.OrchestratorService,
+	commands *handlers.CommandRouter,
+	callbackRouter *callbacks.CallbackRouter,
+	membership *handlers.MembershipHandler, processed2 processed.ProcessedUpdatesRepository, logger2 *slog.Logger,
+) *handlers.OrchestratorHandler {
+	return handlers.NewOrchestratorHandler(orch, commands, callbackRouter, membership, processed2, cfg.Idempotency, logger2)
+}
+
+// ProvideBotHandler provides the default handler of the Telegram bot
+func ProvideBotHandler(handler *handlers.OrchestratorHandler) bot.HandlerFunc {
+	return handler.Handle
+}
+
+// ProvideUpdateWorker provides the workers of queued webhook updates
+func ProvideUpdateWorker(
+	cfg *config.Config,
+	queue updates.UpdatesRepository,
+	handler *handlers.OrchestratorHandler, logger2 *slog.Logger,
+) *updates2.Worker {
+	return updates2.NewWorker(queue, handler, cfg.UpdateQueue, logger2)
 }
 
 var baseSet = wire.NewSet(config.NewConfig, logger.NewLogger, NewFirestoreClient,
+	NewSQLiteDB,
 
-	ProvideGeminiClient,
+	ProvideLLMClient,
 
 	ProvideMessagesRepository,
 	ProvideThreadsRepository,
 	ProvideUsersRepository,
 	ProvideChatsRepository,
+	ProvideUsageRepository,
+	ProvideUpdatesRepository,
+	ProvideProcessedUpdatesRepository,
 
 	ProvideStrategies,
 	ProvideClassifierService,
@@ -165,6 +355,12 @@ var baseSet = wire.NewSet(config.NewConfig, logger.NewLogger, NewFirestoreClient
 	ProvideChatsService,
 	ProvideOrchestratorService,
 	ProvideMessagesService,
+	ProvideUsageService,
+	ProvideTranscriber,
+	ProvideMediaService,
 
-	ProvideOrchestratorHandler, telegram.NewTelegramClient, NewApp,
+	ProvideCallbackRouter,
+	ProvideCommandRouter, handlers.NewMembershipHandler, ProvideOrchestratorHandler,
+	ProvideBotHandler,
+	ProvideUpdateWorker, telegram.NewTelegramClient, NewApp,
 )
@@ -20,5 +20,7 @@ func main() {
 	a.Logger.Info("Starting Telegram bot with Gemini integration...")
 	a.Logger.Info("Orchestrator initialized successfully")
 
+	a.RegisterCommands(ctx)
+
 	a.MessengerClient.Start(ctx)
 }
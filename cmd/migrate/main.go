@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/kriku/kpukbot/app"
+	"github.com/kriku/kpukbot/internal/config"
+	"github.com/kriku/kpukbot/internal/logger"
+	"github.com/kriku/kpukbot/internal/repository/messages"
+)
+
+// One-off migration of Firestore data to chat scoped message keys
+func main() {
+	ctx := context.Background()
+	l := logger.NewLogger()
+	c := config.NewConfig()
+
+	if c.StorageBackend != config.StorageBackendFirestore {
+		l.Info("Nothing to migrate, storage backend is not firestore", "backend", c.StorageBackend)
+		return
+	}
+
+	client, err := app.NewFirestoreClient(ctx, c)
+	if err != nil {
+		log.Fatalf("Failed to create firestore client: %v", err)
+	}
+	defer client.Close()
+
+	moved, err := messages.MigrateFirestoreMessageKeys(ctx, client)
+	if err != nil {
+		log.Fatalf("Failed to migrate messages: %v", err)
+	}
+
+	l.Info("Migrated messages to chat scoped keys", "moved", moved)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os/signal"
+	"syscall"
+
+	"github.com/kriku/kpukbot/app"
+	"github.com/kriku/kpukbot/internal/server"
+)
+
+// Serves the Telegram webhook, triggers and health checks until SIGTERM or SIGINT
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	a, err := app.InitApp(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to initialize application: %v", err)
+	}
+	defer a.Close()
+
+	a.RegisterCommands(ctx)
+
+	cfg := a.Config.ServerConfig
+	if err := server.New(a).Run(ctx, ":"+cfg.Port, cfg.ShutdownTimeout); err != nil {
+		a.Logger.Error("Server stopped with error", "error", err)
+	}
+}
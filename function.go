@@ -2,127 +2,56 @@ package kpukbot
 
 import (
 	"context"
-	"encoding/json"
-	"io"
 	"log"
 	"net/http"
-	"strings"
-	"time"
+	"sync"
 
 	"github.com/kriku/kpukbot/app"
-	"github.com/kriku/kpukbot/internal/strategies"
+	"github.com/kriku/kpukbot/internal/server"
 )
 
-// TriggerRequest represents the structure for custom trigger requests
-type TriggerRequest struct {
-	Trigger string `json:"trigger"`
-}
+var (
+	handlerMu sync.Mutex
+	handler   http.Handler
+)
 
+// HandleTelegramWebhook is the function entrypoint, the app is built on the first request and
+// reused by every later request of the instance
 func HandleTelegramWebhook(res http.ResponseWriter, req *http.Request) {
-	ctx := context.Background()
-
-	a, err := app.InitApp(ctx)
+	h, err := getHandler()
 	if err != nil {
 		log.Printf("Failed to initialize application: %v", err)
 		res.WriteHeader(http.StatusInternalServerError)
 		res.Write([]byte("initialization error"))
 		return
 	}
-	defer a.Close()
-
-
-	// Check if this is a custom trigger request
-	if req.Method == "POST" && req.Header.Get("Content-Type") == "application/json" {
-		body, err := io.ReadAll(req.Body)
 
-		a.Logger.InfoContext(ctx, "Handling incoming request", "body", body)
+	h.ServeHTTP(res, req)
+}
 
-		if err == nil {
-			var triggerReq TriggerRequest
+// getHandler builds the app once, a failed build is retried by the next request
+func getHandler() (http.Handler, error) {
+	handlerMu.Lock()
+	defer handlerMu.Unlock()
 
-			if json.Unmarshal(body, &triggerReq) == nil && triggerReq.Trigger == "question" {
-				a.Logger.InfoContext(ctx, "Trigger question")
-				handleQuestionTrigger(ctx, res, req, a)
-				return
-			}
-		}
-		// Reset body for telegram webhook handling
-		req.Body = io.NopCloser(strings.NewReader(string(body)))
+	if handler != nil {
+		return handler, nil
 	}
 
-	// Handle as telegram webhook
-	res.WriteHeader(http.StatusOK)
-	res.Write([]byte("ok"))
-
-	handleCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
-	defer cancel()
-
-	a.MessengerClient.HandleWebhook(handleCtx, res, req)
-}
-
-// handleQuestionTrigger handles the question trigger request
-func handleQuestionTrigger(ctx context.Context, res http.ResponseWriter, req *http.Request, a app.App) {
-	log.Printf("Processing question trigger request")
-
-	// Get all chats
-	chats, err := a.ChatsService.GetAllChats(ctx)
+	a, err := app.InitApp(context.Background())
 	if err != nil {
-		log.Printf("Failed to get all chats: %v", err)
-		res.WriteHeader(http.StatusInternalServerError)
-		res.Write([]byte("failed to get chats"))
-		return
+		return nil, err
 	}
 
-	// Process each chat
-	questionsAsked := 0
-	for _, chat := range chats {
-		if !chat.IsActive {
-			continue
-		}
-
-		// Find the question strategy (we'll need to access it from the orchestrator)
-		questionStrategy := findQuestionStrategy(a)
-		if questionStrategy == nil {
-			log.Printf("Question strategy not found")
-			continue
-		}
+	a.RegisterCommands(context.Background())
 
-		// Ask question to the next user in queue for this chat
-		question, userID, err := questionStrategy.AskQuestionToUser(ctx, chat.ID)
-		if err != nil {
-			log.Printf("Failed to ask question in chat %d: %v", chat.ID, err)
-			continue
-		}
-
-		if userID > 0 && question != "" {
-			// Send the question to the chat using the messenger client
-			_, err = a.MessengerClient.SendMessage(ctx, chat.ID, question)
-			if err != nil {
-				log.Printf("Failed to send question to chat %d: %v", chat.ID, err)
-			} else {
-				questionsAsked++
-				log.Printf("Asked question to user %d in chat %d", userID, chat.ID)
-			}
-		}
+	// Functions get no CPU once the response is sent, queued updates would stall. Updates are
+	// processed within the request, the queue needs the long-lived server
+	if a.Config.UpdateQueue.Enabled {
+		a.Logger.Warn("UPDATE_QUEUE is only supported by the long-lived server, processing updates synchronously")
+		a.Config.UpdateQueue.Enabled = false
 	}
 
-	res.Header().Set("Content-Type", "application/json")
-	res.WriteHeader(http.StatusOK)
-	json.NewEncoder(res).Encode(map[string]interface{}{
-		"status":          "success",
-		"questions_asked": questionsAsked,
-		"chats_processed": len(chats),
-	})
-}
-
-// findQuestionStrategy finds the question strategy from the available strategies
-func findQuestionStrategy(a app.App) *strategies.QuestionStrategy {
-	for _, strategy := range a.Strategies {
-		if strategy.Name() == "question" {
-			if questionStrategy, ok := strategy.(*strategies.QuestionStrategy); ok {
-				return questionStrategy
-			}
-		}
-	}
-	return nil
+	handler = server.New(a).Handler()
+	return handler, nil
 }
@@ -4,27 +4,35 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strings"
 
+	"github.com/kriku/kpukbot/internal/config"
 	"google.golang.org/genai"
 )
 
+// Client generates content with a language model, implementations are provider specific
 type Client interface {
-	GenerateContent(ctx context.Context, prompt string, config *genai.GenerateContentConfig) (string, error)
-	GenerateContentWithHistory(ctx context.Context, history []Message, prompt string) (string, error)
+	GenerateContent(ctx context.Context, req Request) (string, error)
+	// WithProfile returns a client sharing the connection that uses another model profile
+	WithProfile(profile config.ModelProfile) Client
 	Close() error
 }
 
 type Message struct {
-	Role    string // "user" or "model"
+	Role    string // RoleUser or RoleModel
 	Content string
+	Media   []Media // Inline attachments sent after the content, e.g. images
 }
 
 type GeminiClient struct {
-	client *genai.Client
-	logger *slog.Logger
+	client   *genai.Client
+	profile  config.ModelProfile
+	recorder UsageRecorder
+	logger   *slog.Logger
 }
 
-func NewGeminiClient(ctx context.Context, apiKey string, logger *slog.Logger) (Client, error) {
+// NewGeminiClient creates a Gemini API client, recorder receives the token usage of every call and may be nil
+func NewGeminiClient(ctx context.Context, apiKey string, profile config.ModelProfile, recorder UsageRecorder, logger *slog.Logger) (Client, error) {
 	client, err := genai.NewClient(ctx, &genai.ClientConfig{
 		APIKey:  apiKey,
 		Backend: genai.BackendGeminiAPI,
@@ -34,78 +42,114 @@ func NewGeminiClient(ctx context.Context, apiKey string, logger *slog.Logger) (C
 	}
 
 	return &GeminiClient{
-		client: client,
-		logger: logger.With("client", "gemini"),
+		client:   client,
+		profile:  profile,
+		recorder: recorder,
+		logger:   logger.With("client", "gemini"),
 	}, nil
 }
 
-func (g *GeminiClient) GenerateContent(ctx context.Context, prompt string, config *genai.GenerateContentConfig) (string, error) {
-	g.logger.DebugContext(ctx, "Generating content", "prompt_length", len(prompt))
+func (g *GeminiClient) WithProfile(profile config.ModelProfile) Client {
+	return &GeminiClient{
+		client:   g.client,
+		profile:  profile,
+		recorder: g.recorder,
+		logger:   g.logger,
+	}
+}
 
-	// Create content from the prompt
-	contents := genai.Text(prompt)
+// generationConfig builds the Gemini config of a request, request parameters win over the profile defaults
+func (g *GeminiClient) generationConfig(req Request) *genai.GenerateContentConfig {
+	cfg := &genai.GenerateContentConfig{
+		Temperature:     req.Temperature,
+		TopK:            g.profile.TopK,
+		TopP:            g.profile.TopP,
+		MaxOutputTokens: req.MaxTokens,
+	}
 
-	// Use default config if none provided
-	if config == nil {
-		config = &genai.GenerateContentConfig{
-			Temperature:     genai.Ptr(float32(0.7)),
-			TopK:            genai.Ptr(float32(40)),
-			TopP:            genai.Ptr(float32(0.95)),
-			MaxOutputTokens: 2048,
-		}
+	if cfg.Temperature == nil {
+		cfg.Temperature = g.profile.Temperature
+	}
+	if cfg.MaxOutputTokens == 0 {
+		cfg.MaxOutputTokens = g.profile.MaxOutputTokens
 	}
 
-	resp, err := g.client.Models.GenerateContent(ctx, "gemini-2.5-flash", contents, config)
-	if err != nil {
-		g.logger.ErrorContext(ctx, "Failed to generate content", "error", err)
-		return "", fmt.Errorf("failed to generate content: %w", err)
+	if req.SystemInstruction != "" {
+		cfg.SystemInstruction = genai.NewContentFromText(req.SystemInstruction, genai.RoleUser)
 	}
 
-	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no content generated")
+	if req.Schema != nil {
+		cfg.ResponseMIMEType = "application/json"
+		cfg.ResponseSchema = toGenaiSchema(req.Schema)
 	}
 
-	result := resp.Text()
-	g.logger.DebugContext(ctx, "Content generated", "response_length", len(result))
+	return cfg
+}
 
-	return result, nil
+// toGenaiSchema converts a provider neutral schema to the Gemini one
+func toGenaiSchema(s *Schema) *genai.Schema {
+	if s == nil {
+		return nil
+	}
+
+	out := &genai.Schema{
+		Type:        genai.Type(strings.ToUpper(string(s.Type))),
+		Description: s.Description,
+		Items:       toGenaiSchema(s.Items),
+		Required:    s.Required,
+		Enum:        s.Enum,
+		MaxLength:   s.MaxLength,
+		Minimum:     s.Minimum,
+		Maximum:     s.Maximum,
+	}
+	if len(s.Properties) > 0 {
+		out.Properties = make(map[string]*genai.Schema, len(s.Properties))
+		for name, property := range s.Properties {
+			out.Properties[name] = toGenaiSchema(property)
+		}
+	}
+
+	return out
 }
 
-func (g *GeminiClient) GenerateContentWithHistory(ctx context.Context, history []Message, prompt string) (string, error) {
-	g.logger.DebugContext(ctx, "Generating content with history",
-		"history_length", len(history),
-		"prompt_length", len(prompt))
-
-	// Convert history to genai.Content format
-	var contents []*genai.Content
-	for _, msg := range history {
-		role := "user"
-		if msg.Role == "model" {
-			role = "model"
+// toGenaiContents converts the messages of a request, media become inline data parts
+func toGenaiContents(messages []Message) []*genai.Content {
+	contents := make([]*genai.Content, 0, len(messages))
+	for _, msg := range messages {
+		role := genai.Role(genai.RoleUser)
+		if msg.Role == RoleModel {
+			role = genai.RoleModel
 		}
-		contents = append(contents, &genai.Content{
-			Parts: []*genai.Part{genai.NewPartFromText(msg.Content)},
-			Role:  role,
-		})
+
+		parts := []*genai.Part{genai.NewPartFromText(msg.Content)}
+		for _, media := range msg.Media {
+			parts = append(parts, genai.NewPartFromBytes(media.Data, media.MIMEType))
+		}
+		contents = append(contents, genai.NewContentFromParts(parts, role))
 	}
+	return contents
+}
+
+func (g *GeminiClient) GenerateContent(ctx context.Context, req Request) (string, error) {
+	g.logger.DebugContext(ctx, "Generating content",
+		"model", g.profile.Model,
+		"messages", len(req.Messages))
 
-	// Create a chat session with history
-	chat, err := g.client.Chats.Create(ctx, "gemini-2.5-flash", &genai.GenerateContentConfig{
-		Temperature:     genai.Ptr(float32(0.7)),
-		TopK:            genai.Ptr(float32(40)),
-		TopP:            genai.Ptr(float32(0.95)),
-		MaxOutputTokens: 2048,
-	}, contents)
+	resp, err := g.client.Models.GenerateContent(ctx, g.profile.Model, toGenaiContents(req.Messages), g.generationConfig(req))
 	if err != nil {
-		g.logger.ErrorContext(ctx, "Failed to create chat session", "error", err)
-		return "", fmt.Errorf("failed to create chat session: %w", err)
+		g.logger.ErrorContext(ctx, "Failed to generate content", "error", err)
+		return "", fmt.Errorf("failed to generate content: %w", err)
 	}
 
-	// Send the new message
-	resp, err := chat.SendMessage(ctx, *genai.NewPartFromText(prompt))
-	if err != nil {
-		g.logger.ErrorContext(ctx, "Failed to send message in chat", "error", err)
-		return "", fmt.Errorf("failed to send message: %w", err)
+	// Tokens are billed even when the answer turns out to be empty
+	if resp.UsageMetadata != nil {
+		RecordUsage(ctx, g.recorder, Usage{
+			Model:          g.profile.Model,
+			CallSite:       req.CallSite,
+			PromptTokens:   int64(resp.UsageMetadata.PromptTokenCount),
+			ResponseTokens: int64(resp.UsageMetadata.CandidatesTokenCount),
+			TotalTokens:    int64(resp.UsageMetadata.TotalTokenCount),
+		})
 	}
 
 	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
@@ -113,7 +157,7 @@ func (g *GeminiClient) GenerateContentWithHistory(ctx context.Context, history [
 	}
 
 	result := resp.Text()
-	g.logger.DebugContext(ctx, "Content generated with history", "response_length", len(result))
+	g.logger.DebugContext(ctx, "Content generated", "response_length", len(result))
 
 	return result, nil
 }
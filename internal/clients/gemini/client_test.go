@@ -0,0 +1,80 @@
+package gemini
+
+import (
+	"testing"
+
+	"github.com/kriku/kpukbot/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genai"
+)
+
+func TestGeminiClient_GenerationConfig(t *testing.T) {
+	client := &GeminiClient{profile: config.ModelProfile{
+		Model:           "gemini-test",
+		Temperature:     genai.Ptr(float32(0.7)),
+		TopP:            genai.Ptr(float32(0.95)),
+		MaxOutputTokens: 2048,
+	}}
+
+	t.Run("profile defaults for a plain request", func(t *testing.T) {
+		cfg := client.generationConfig(Request{Messages: NewPrompt("hi")})
+		assert.Equal(t, float32(0.7), *cfg.Temperature)
+		assert.Equal(t, float32(0.95), *cfg.TopP)
+		assert.Nil(t, cfg.TopK)
+		assert.Equal(t, int32(2048), cfg.MaxOutputTokens)
+		assert.Nil(t, cfg.SystemInstruction)
+		assert.Empty(t, cfg.ResponseMIMEType)
+	})
+
+	t.Run("request parameters win", func(t *testing.T) {
+		cfg := client.generationConfig(Request{
+			SystemInstruction: "Be brief",
+			Temperature:       genai.Ptr(float32(0.1)),
+			MaxTokens:         100,
+		})
+		assert.Equal(t, float32(0.1), *cfg.Temperature)
+		assert.Equal(t, float32(0.95), *cfg.TopP)
+		assert.Equal(t, int32(100), cfg.MaxOutputTokens)
+		require.NotNil(t, cfg.SystemInstruction)
+		assert.Equal(t, "Be brief", cfg.SystemInstruction.Parts[0].Text)
+		assert.Equal(t, genai.RoleUser, cfg.SystemInstruction.Role)
+	})
+
+	t.Run("schema requests json", func(t *testing.T) {
+		maxLength := int64(10)
+		cfg := client.generationConfig(Request{Schema: &Schema{
+			Type: TypeObject,
+			Properties: map[string]*Schema{
+				"theme": {Type: TypeString, MaxLength: &maxLength},
+				"tags":  {Type: TypeArray, Items: &Schema{Type: TypeString}},
+			},
+			Required: []string{"theme"},
+		}})
+		assert.Equal(t, "application/json", cfg.ResponseMIMEType)
+		require.NotNil(t, cfg.ResponseSchema)
+		assert.Equal(t, genai.TypeObject, cfg.ResponseSchema.Type)
+		assert.Equal(t, genai.TypeString, cfg.ResponseSchema.Properties["theme"].Type)
+		assert.Equal(t, &maxLength, cfg.ResponseSchema.Properties["theme"].MaxLength)
+		assert.Equal(t, genai.TypeString, cfg.ResponseSchema.Properties["tags"].Items.Type)
+		assert.Equal(t, []string{"theme"}, cfg.ResponseSchema.Required)
+	})
+}
+
+func TestToGenaiContents(t *testing.T) {
+	contents := toGenaiContents([]Message{
+		{Role: RoleUser, Content: "hi"},
+		{Role: RoleModel, Content: "hello"},
+		{Role: RoleUser, Content: "what is this?", Media: []Media{{MIMEType: "image/jpeg", Data: []byte("jpeg")}}},
+	})
+	require.Len(t, contents, 3)
+
+	assert.Equal(t, genai.RoleUser, contents[0].Role)
+	assert.Equal(t, genai.RoleModel, contents[1].Role)
+
+	require.Len(t, contents[2].Parts, 2)
+	assert.Equal(t, "what is this?", contents[2].Parts[0].Text)
+	require.NotNil(t, contents[2].Parts[1].InlineData)
+	assert.Equal(t, "image/jpeg", contents[2].Parts[1].InlineData.MIMEType)
+	assert.Equal(t, []byte("jpeg"), contents[2].Parts[1].InlineData.Data)
+}
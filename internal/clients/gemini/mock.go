@@ -6,7 +6,7 @@ import (
 	"log/slog"
 	"strings"
 
-	"google.golang.org/genai"
+	"github.com/kriku/kpukbot/internal/config"
 )
 
 // MockClient is a mock implementation of the Client interface for local testing
@@ -21,31 +21,28 @@ func NewMockClient(logger *slog.Logger) Client {
 	}
 }
 
-func (m *MockClient) GenerateContent(ctx context.Context, prompt string, config *genai.GenerateContentConfig) (string, error) {
-	m.logger.DebugContext(ctx, "Mock: Generating content", "prompt_length", len(prompt))
+func (m *MockClient) GenerateContent(ctx context.Context, req Request) (string, error) {
+	var prompt string
+	if len(req.Messages) > 0 {
+		prompt = req.Messages[len(req.Messages)-1].Content
+	}
+
+	m.logger.DebugContext(ctx, "Mock: Generating content",
+		"messages", len(req.Messages),
+		"prompt_length", len(prompt))
 
-	// Generate a mock response based on the prompt content
+	// Generate a mock response based on the prompt content, acknowledging any history
 	response := m.generateMockResponse(prompt)
+	if len(req.Messages) > 1 {
+		response = "Based on our conversation, " + response
+	}
 
 	m.logger.DebugContext(ctx, "Mock: Content generated", "response_length", len(response))
 	return response, nil
 }
 
-func (m *MockClient) GenerateContentWithHistory(ctx context.Context, history []Message, prompt string) (string, error) {
-	m.logger.DebugContext(ctx, "Mock: Generating content with history",
-		"history_length", len(history),
-		"prompt_length", len(prompt))
-
-	// Generate a mock response that acknowledges the history
-	var historyContext strings.Builder
-	if len(history) > 0 {
-		historyContext.WriteString("Based on our conversation, ")
-	}
-
-	response := historyContext.String() + m.generateMockResponse(prompt)
-
-	m.logger.DebugContext(ctx, "Mock: Content generated with history", "response_length", len(response))
-	return response, nil
+func (m *MockClient) WithProfile(profile config.ModelProfile) Client {
+	return m
 }
 
 func (m *MockClient) Close() error {
@@ -63,6 +60,15 @@ func (m *MockClient) generateMockResponse(prompt string) string {
 	case strings.Contains(promptLower, "analyze whether the following message is a user introduction"):
 		return m.mockIntroductionAnalysisResponse(prompt)
 
+	case strings.Contains(promptLower, "transcribe the speech of the attached recording"):
+		return "This is a mock transcript of the voice message."
+
+	case strings.Contains(promptLower, "summarize the following content shared in a group chat"):
+		return "A mock summary of the shared content."
+
+	case strings.Contains(promptLower, "describe the attached image"):
+		return "A mock description of the attached image."
+
 	case strings.Contains(promptLower, "analyze the following message and determine"):
 		return m.mockThreadClassificationResponse()
 
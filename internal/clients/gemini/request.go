@@ -0,0 +1,92 @@
+package gemini
+
+// Message roles
+const (
+	RoleUser  = "user"
+	RoleModel = "model"
+)
+
+// Request is a provider neutral generation request
+type Request struct {
+	SystemInstruction string
+	Messages          []Message // Conversation in chronological order, the last message is the prompt
+	Schema            *Schema   // JSON schema of the response, nil for a plain text answer
+	Temperature       *float32  // Overrides the model profile when set
+	MaxTokens         int32     // Overrides the model profile when set
+	CallSite          string    // Name of the calling component for usage accounting, e.g. classifier
+}
+
+// Media is inline binary data of a message, e.g. a photo
+type Media struct {
+	MIMEType string
+	Data     []byte
+}
+
+// NewPrompt builds the messages of a single turn request, media are attached to the prompt
+func NewPrompt(prompt string, media ...Media) []Message {
+	return []Message{{Role: RoleUser, Content: prompt, Media: media}}
+}
+
+// SchemaType is the JSON type of a schema node
+type SchemaType string
+
+const (
+	TypeObject  SchemaType = "object"
+	TypeArray   SchemaType = "array"
+	TypeString  SchemaType = "string"
+	TypeNumber  SchemaType = "number"
+	TypeInteger SchemaType = "integer"
+	TypeBoolean SchemaType = "boolean"
+)
+
+// Schema describes the JSON structure of a response, the subset of JSON Schema supported by all providers
+type Schema struct {
+	Type        SchemaType
+	Description string
+	Properties  map[string]*Schema
+	Items       *Schema
+	Required    []string
+	Enum        []string
+	MaxLength   *int64
+	Minimum     *float64
+	Maximum     *float64
+}
+
+// JSONSchema converts the schema to a standard JSON Schema document
+func (s *Schema) JSONSchema() map[string]any {
+	if s == nil {
+		return nil
+	}
+
+	out := map[string]any{"type": string(s.Type)}
+	if s.Description != "" {
+		out["description"] = s.Description
+	}
+	if len(s.Properties) > 0 {
+		properties := make(map[string]any, len(s.Properties))
+		for name, property := range s.Properties {
+			properties[name] = property.JSONSchema()
+		}
+		out["properties"] = properties
+	}
+	if s.Items != nil {
+		out["items"] = s.Items.JSONSchema()
+	}
+	if len(s.Required) > 0 {
+		out["required"] = s.Required
+	}
+	if len(s.Enum) > 0 {
+		out["enum"] = s.Enum
+	}
+	if s.MaxLength != nil {
+		out["maxLength"] = *s.MaxLength
+	}
+	if s.Minimum != nil {
+		out["minimum"] = *s.Minimum
+	}
+	if s.Maximum != nil {
+		out["maximum"] = *s.Maximum
+	}
+
+	return out
+}
@@ -0,0 +1,205 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/config"
+	"google.golang.org/genai"
+)
+
+// ErrUnavailable is returned when the model could not be reached after retries or while the
+// circuit breaker is open, callers may degrade gracefully instead of failing
+var ErrUnavailable = errors.New("llm unavailable")
+
+// statusCoder is implemented by provider errors carrying an HTTP status code
+type statusCoder interface {
+	HTTPStatus() int
+}
+
+// IsRetryable reports whether an error is transient and the call is worth repeating
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.Code)
+	}
+	var coder statusCoder
+	if errors.As(err, &coder) {
+		return retryableStatus(coder.HTTPStatus())
+	}
+
+	// Network failures such as timeouts and refused connections
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// ResilientClient decorates a Client with retries, jittered exponential backoff and a circuit breaker
+type ResilientClient struct {
+	next    Client
+	cfg     config.LLMRetryConfig
+	breaker *circuitBreaker
+	logger  *slog.Logger
+}
+
+// NewResilientClient wraps a client, all profiles derived from it share one circuit breaker
+func NewResilientClient(next Client, cfg config.LLMRetryConfig, logger *slog.Logger) Client {
+	return &ResilientClient{
+		next:    next,
+		cfg:     cfg,
+		breaker: &circuitBreaker{threshold: cfg.FailureThreshold, openFor: cfg.OpenDuration, now: time.Now},
+		logger:  logger.With("client", "llm-resilient"),
+	}
+}
+
+func (r *ResilientClient) WithProfile(profile config.ModelProfile) Client {
+	return &ResilientClient{
+		next:    r.next.WithProfile(profile),
+		cfg:     r.cfg,
+		breaker: r.breaker,
+		logger:  r.logger,
+	}
+}
+
+func (r *ResilientClient) GenerateContent(ctx context.Context, req Request) (string, error) {
+	if !r.breaker.allow() {
+		return "", fmt.Errorf("%w: circuit breaker is open", ErrUnavailable)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < max(1, r.cfg.MaxAttempts); attempt++ {
+		if attempt > 0 {
+			delay := r.backoff(attempt)
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+				r.logger.WarnContext(ctx, "Not enough time left for another attempt", "attempt", attempt, "error", lastErr)
+				break
+			}
+
+			r.logger.WarnContext(ctx, "Retrying LLM call", "attempt", attempt+1, "delay", delay, "error", lastErr)
+			select {
+			case <-ctx.Done():
+				r.breaker.release()
+				return "", ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		response, err := r.next.GenerateContent(ctx, req)
+		if err == nil {
+			r.breaker.success()
+			return response, nil
+		}
+		if ctx.Err() != nil {
+			r.breaker.release()
+			return "", err
+		}
+		if !IsRetryable(err) {
+			// The provider answered, the request itself is at fault
+			r.breaker.success()
+			return "", err
+		}
+		lastErr = err
+	}
+
+	if r.breaker.failure() {
+		r.logger.ErrorContext(ctx, "Circuit breaker opened", "open_for", r.cfg.OpenDuration, "error", lastErr)
+	}
+	return "", fmt.Errorf("%w: %w", ErrUnavailable, lastErr)
+}
+
+// backoff returns the jittered delay before the given attempt, between half and the full exponential delay
+func (r *ResilientClient) backoff(attempt int) time.Duration {
+	delay := r.cfg.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > r.cfg.MaxDelay {
+		delay = r.cfg.MaxDelay
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+func (r *ResilientClient) Close() error {
+	return r.next.Close()
+}
+
+// circuitBreaker opens after threshold consecutive failed calls and lets a single
+// probe call through once openFor has passed
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	openFor   time.Duration
+	now       func() time.Time
+
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func (b *circuitBreaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+}
+
+// release ends a probe call that finished without telling anything about the provider
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// failure records a failed call and reports whether the circuit opened because of it
+func (b *circuitBreaker) failure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.openFor)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genai"
+)
+
+// stubClient returns the queued errors first and then succeeds
+type stubClient struct {
+	errs  []error
+	calls int
+}
+
+func (c *stubClient) GenerateContent(ctx context.Context, req Request) (string, error) {
+	c.calls++
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return "", err
+	}
+	return "ok", nil
+}
+
+func (c *stubClient) WithProfile(profile config.ModelProfile) Client { return c }
+func (c *stubClient) Close() error                                   { return nil }
+
+func newTestResilientClient(next Client, threshold int) *ResilientClient {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	return NewResilientClient(next, config.LLMRetryConfig{
+		MaxAttempts:      3,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         5 * time.Millisecond,
+		FailureThreshold: threshold,
+		OpenDuration:     time.Hour,
+	}, logger).(*ResilientClient)
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, IsRetryable(genai.APIError{Code: http.StatusTooManyRequests}))
+	assert.True(t, IsRetryable(genai.APIError{Code: http.StatusServiceUnavailable}))
+	assert.False(t, IsRetryable(genai.APIError{Code: http.StatusBadRequest}))
+	assert.False(t, IsRetryable(context.DeadlineExceeded))
+	assert.False(t, IsRetryable(errors.New("no content generated")))
+}
+
+func TestResilientClient_RetriesTransientErrors(t *testing.T) {
+	stub := &stubClient{errs: []error{
+		genai.APIError{Code: http.StatusTooManyRequests},
+		genai.APIError{Code: http.StatusServiceUnavailable},
+	}}
+	client := newTestResilientClient(stub, 5)
+
+	response, err := client.GenerateContent(context.Background(), Request{})
+	require.NoError(t, err)
+	assert.Equal(t, "ok", response)
+	assert.Equal(t, 3, stub.calls)
+}
+
+func TestResilientClient_DoesNotRetryPermanentErrors(t *testing.T) {
+	stub := &stubClient{errs: []error{genai.APIError{Code: http.StatusBadRequest}}}
+	client := newTestResilientClient(stub, 5)
+
+	_, err := client.GenerateContent(context.Background(), Request{})
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, ErrUnavailable))
+	assert.Equal(t, 1, stub.calls)
+}
+
+func TestResilientClient_OpensCircuit(t *testing.T) {
+	unavailable := genai.APIError{Code: http.StatusServiceUnavailable}
+	stub := &stubClient{errs: []error{unavailable, unavailable, unavailable, unavailable, unavailable, unavailable}}
+	client := newTestResilientClient(stub, 2)
+
+	for i := 0; i < 2; i++ {
+		_, err := client.GenerateContent(context.Background(), Request{})
+		assert.ErrorIs(t, err, ErrUnavailable)
+	}
+	assert.Equal(t, 6, stub.calls)
+
+	// open circuit fails fast, also for other profiles
+	_, err := client.WithProfile(config.ModelProfile{}).GenerateContent(context.Background(), Request{})
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.Equal(t, 6, stub.calls)
+
+	// a successful probe after the open period closes the circuit again
+	now := time.Now()
+	client.breaker.now = func() time.Time { return now.Add(2 * time.Hour) }
+	response, err := client.GenerateContent(context.Background(), Request{})
+	require.NoError(t, err)
+	assert.Equal(t, "ok", response)
+	assert.Equal(t, 0, client.breaker.failures)
+}
+
+func TestResilientClient_RespectsDeadline(t *testing.T) {
+	stub := &stubClient{errs: []error{genai.APIError{Code: http.StatusServiceUnavailable}}}
+	client := newTestResilientClient(stub, 5)
+	client.cfg.BaseDelay = time.Hour
+	client.cfg.MaxDelay = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := client.GenerateContent(ctx, Request{})
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.Equal(t, 1, stub.calls)
+}
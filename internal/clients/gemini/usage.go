@@ -0,0 +1,44 @@
+package gemini
+
+import "context"
+
+// Usage is the token usage a provider reported for one call
+type Usage struct {
+	Model          string
+	CallSite       string // Request.CallSite of the call
+	PromptTokens   int64
+	ResponseTokens int64
+	TotalTokens    int64
+}
+
+// UsageRecorder receives the usage of every successful call, it must not block the caller for long
+type UsageRecorder interface {
+	RecordUsage(ctx context.Context, usage Usage)
+}
+
+// UsageScope attributes LLM calls to the chat, user and thread they are made for
+type UsageScope struct {
+	ChatID   int64
+	UserID   int64
+	ThreadID string
+}
+
+type usageScopeKey struct{}
+
+// WithUsageScope returns a context attributing LLM calls made with it to the scope
+func WithUsageScope(ctx context.Context, scope UsageScope) context.Context {
+	return context.WithValue(ctx, usageScopeKey{}, scope)
+}
+
+// UsageScopeFrom returns the usage scope of the context, if any
+func UsageScopeFrom(ctx context.Context) (UsageScope, bool) {
+	scope, ok := ctx.Value(usageScopeKey{}).(UsageScope)
+	return scope, ok
+}
+
+// RecordUsage hands usage to the recorder, clients without a recorder pass nil
+func RecordUsage(ctx context.Context, recorder UsageRecorder, usage Usage) {
+	if recorder != nil {
+		recorder.RecordUsage(ctx, usage)
+	}
+}
@@ -0,0 +1,291 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/kriku/kpukbot/internal/clients/gemini"
+	"github.com/kriku/kpukbot/internal/config"
+)
+
+// maxErrorBody limits how much of an error response is kept in APIError
+const maxErrorBody = 4096
+
+// ErrUnsupportedMedia is returned for media the chat completions API does not take, such as the
+// OGG voice notes and MP4 video notes of Telegram
+var ErrUnsupportedMedia = errors.New("unsupported media")
+
+// audioFormats are the input audio formats of the chat completions API by MIME type
+var audioFormats = map[string]string{
+	"audio/wav":   "wav",
+	"audio/wave":  "wav",
+	"audio/x-wav": "wav",
+	"audio/mpeg":  "mp3",
+	"audio/mp3":   "mp3",
+}
+
+// APIError is returned when the API responds with a non 2xx status
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+// HTTPStatus lets callers classify the error without depending on this package
+func (e *APIError) HTTPStatus() int {
+	return e.StatusCode
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("openai api error: status %d: %s", e.StatusCode, e.Body)
+}
+
+// Client implements gemini.Client against an OpenAI compatible chat completions API
+type Client struct {
+	baseURL    string
+	apiKey     string
+	profile    config.ModelProfile
+	httpClient *http.Client
+	recorder   gemini.UsageRecorder
+	logger     *slog.Logger
+}
+
+// NewOpenAIClient creates a client for an OpenAI compatible API such as llama.cpp, Ollama or vLLM,
+// recorder receives the token usage of every call and may be nil
+func NewOpenAIClient(c config.OpenAIConfig, profile config.ModelProfile, httpClient *http.Client, recorder gemini.UsageRecorder, logger *slog.Logger) gemini.Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(c.BaseURL, "/"),
+		apiKey:     c.APIKey,
+		profile:    profile,
+		httpClient: httpClient,
+		recorder:   recorder,
+		logger:     logger.With("client", "openai"),
+	}
+}
+
+func (c *Client) WithProfile(profile config.ModelProfile) gemini.Client {
+	return &Client{
+		baseURL:    c.baseURL,
+		apiKey:     c.apiKey,
+		profile:    profile,
+		httpClient: c.httpClient,
+		recorder:   c.recorder,
+		logger:     c.logger,
+	}
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// requestMessage is a message of a request, its content is a string or, with images, a list of
+// contentPart
+type requestMessage struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"`
+}
+
+type imageURL struct {
+	URL string `json:"url"`
+}
+
+type inputAudio struct {
+	Data   string `json:"data"`   // Base64 encoded
+	Format string `json:"format"` // e.g. wav or mp3
+}
+
+type inputFile struct {
+	FileData string `json:"file_data"` // Data URL
+}
+
+type contentPart struct {
+	Type       string      `json:"type"`
+	Text       string      `json:"text,omitempty"`
+	ImageURL   *imageURL   `json:"image_url,omitempty"`
+	InputAudio *inputAudio `json:"input_audio,omitempty"`
+	File       *inputFile  `json:"file,omitempty"`
+}
+
+type jsonSchemaFormat struct {
+	Name   string         `json:"name"`
+	Schema map[string]any `json:"schema"`
+}
+
+type responseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *jsonSchemaFormat `json:"json_schema,omitempty"`
+}
+
+type chatRequest struct {
+	Model          string           `json:"model,omitempty"`
+	Messages       []requestMessage `json:"messages"`
+	Temperature    *float32         `json:"temperature,omitempty"`
+	TopP           *float32         `json:"top_p,omitempty"`
+	MaxTokens      int32            `json:"max_tokens,omitempty"`
+	ResponseFormat *responseFormat  `json:"response_format,omitempty"`
+}
+
+type chatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int64 `json:"prompt_tokens"`
+		CompletionTokens int64 `json:"completion_tokens"`
+		TotalTokens      int64 `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// chatRequest builds the chat completions request, request parameters win over the profile defaults
+func (c *Client) chatRequest(req gemini.Request) (chatRequest, error) {
+	body := chatRequest{
+		Model:       c.profile.Model,
+		Temperature: req.Temperature,
+		TopP:        c.profile.TopP,
+		MaxTokens:   req.MaxTokens,
+	}
+
+	if body.Temperature == nil {
+		body.Temperature = c.profile.Temperature
+	}
+	if body.MaxTokens == 0 {
+		body.MaxTokens = c.profile.MaxOutputTokens
+	}
+
+	if req.SystemInstruction != "" {
+		body.Messages = append(body.Messages, requestMessage{Role: "system", Content: req.SystemInstruction})
+	}
+	for _, msg := range req.Messages {
+		role := "user"
+		if msg.Role == gemini.RoleModel {
+			role = "assistant"
+		}
+		content, err := messageContent(msg)
+		if err != nil {
+			return chatRequest{}, err
+		}
+		body.Messages = append(body.Messages, requestMessage{Role: role, Content: content})
+	}
+
+	if req.Schema != nil {
+		body.ResponseFormat = &responseFormat{
+			Type:       "json_schema",
+			JSONSchema: &jsonSchemaFormat{Name: "response", Schema: req.Schema.JSONSchema()},
+		}
+	}
+
+	return body, nil
+}
+
+// messageContent returns the text of a message, media are sent next to it as images, input
+// audio or files. Only WAV and MP3 audio is accepted and video not at all, other recordings
+// would have to be converted first
+func messageContent(msg gemini.Message) (any, error) {
+	if len(msg.Media) == 0 {
+		return msg.Content, nil
+	}
+
+	parts := []contentPart{{Type: "text", Text: msg.Content}}
+	for _, media := range msg.Media {
+		data := base64.StdEncoding.EncodeToString(media.Data)
+		dataURL := "data:" + media.MIMEType + ";base64," + data
+
+		switch {
+		case strings.HasPrefix(media.MIMEType, "image/"):
+			parts = append(parts, contentPart{Type: "image_url", ImageURL: &imageURL{URL: dataURL}})
+		case strings.HasPrefix(media.MIMEType, "audio/"):
+			format, ok := audioFormats[media.MIMEType]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s, only WAV and MP3 audio is accepted", ErrUnsupportedMedia, media.MIMEType)
+			}
+			parts = append(parts, contentPart{Type: "input_audio", InputAudio: &inputAudio{Data: data, Format: format}})
+		case strings.HasPrefix(media.MIMEType, "video/"):
+			return nil, fmt.Errorf("%w: %s, video is not accepted", ErrUnsupportedMedia, media.MIMEType)
+		default:
+			parts = append(parts, contentPart{Type: "file", File: &inputFile{FileData: dataURL}})
+		}
+	}
+	return parts, nil
+}
+
+func (c *Client) GenerateContent(ctx context.Context, req gemini.Request) (string, error) {
+	c.logger.DebugContext(ctx, "Generating content",
+		"model", c.profile.Model,
+		"messages", len(req.Messages))
+
+	body, err := c.chatRequest(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to build request: %w", err)
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		c.logger.ErrorContext(ctx, "Failed to generate content", "error", err)
+		return "", fmt.Errorf("failed to generate content: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		err := &APIError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+		c.logger.ErrorContext(ctx, "Failed to generate content", "error", err)
+		return "", fmt.Errorf("failed to generate content: %w", err)
+	}
+
+	var completion chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	// Local servers may omit usage, and the model when the profile does not name one
+	if completion.Usage != nil {
+		model := c.profile.Model
+		if model == "" {
+			model = completion.Model
+		}
+		gemini.RecordUsage(ctx, c.recorder, gemini.Usage{
+			Model:          model,
+			CallSite:       req.CallSite,
+			PromptTokens:   completion.Usage.PromptTokens,
+			ResponseTokens: completion.Usage.CompletionTokens,
+			TotalTokens:    completion.Usage.TotalTokens,
+		})
+	}
+
+	if len(completion.Choices) == 0 || completion.Choices[0].Message.Content == "" {
+		return "", fmt.Errorf("no content generated")
+	}
+
+	result := completion.Choices[0].Message.Content
+	c.logger.DebugContext(ctx, "Content generated", "response_length", len(result))
+
+	return result, nil
+}
+
+func (c *Client) Close() error {
+	c.httpClient.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,164 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/kriku/kpukbot/internal/clients/gemini"
+	"github.com/kriku/kpukbot/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_GenerateContent(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"{\"ok\":true}"}}],` +
+			`"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15}}`))
+	}))
+	defer server.Close()
+
+	temperature := float32(0.2)
+	recorder := &usageRecorder{}
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	client := NewOpenAIClient(
+		config.OpenAIConfig{BaseURL: server.URL + "/v1/", APIKey: "secret"},
+		config.ModelProfile{Model: "local-model", Temperature: &temperature, MaxOutputTokens: 512},
+		server.Client(),
+		recorder,
+		logger,
+	)
+
+	response, err := client.GenerateContent(context.Background(), gemini.Request{
+		SystemInstruction: "Answer in JSON",
+		Messages: []gemini.Message{
+			{Role: gemini.RoleUser, Content: "question"},
+			{Role: gemini.RoleModel, Content: "answer"},
+			{Role: gemini.RoleUser, Content: "follow up"},
+		},
+		Schema: &gemini.Schema{
+			Type:       gemini.TypeObject,
+			Properties: map[string]*gemini.Schema{"ok": {Type: gemini.TypeBoolean}},
+		},
+		CallSite: "classifier",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `{"ok":true}`, response)
+
+	assert.Equal(t, "local-model", got["model"])
+	assert.InDelta(t, 0.2, got["temperature"], 0.0001)
+	assert.Equal(t, float64(512), got["max_tokens"])
+
+	messages := got["messages"].([]any)
+	require.Len(t, messages, 4)
+	assert.Equal(t, "system", messages[0].(map[string]any)["role"])
+	assert.Equal(t, "assistant", messages[2].(map[string]any)["role"])
+
+	format := got["response_format"].(map[string]any)
+	assert.Equal(t, "json_schema", format["type"])
+	schema := format["json_schema"].(map[string]any)["schema"].(map[string]any)
+	assert.Equal(t, "object", schema["type"])
+
+	require.Len(t, recorder.usage, 1)
+	assert.Equal(t, gemini.Usage{
+		Model:          "local-model",
+		CallSite:       "classifier",
+		PromptTokens:   12,
+		ResponseTokens: 3,
+		TotalTokens:    15,
+	}, recorder.usage[0])
+}
+
+func TestClient_GenerateContent_APIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	client := NewOpenAIClient(config.OpenAIConfig{BaseURL: server.URL}, config.ModelProfile{}, server.Client(), nil, logger)
+
+	_, err := client.GenerateContent(context.Background(), gemini.Request{Messages: gemini.NewPrompt("hi")})
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+	assert.Equal(t, "overloaded", apiErr.Body)
+}
+
+func TestClient_ChatRequest_Media(t *testing.T) {
+	client := &Client{}
+
+	body, err := client.chatRequest(gemini.Request{
+		Messages: gemini.NewPrompt("what is this?", gemini.Media{MIMEType: "image/png", Data: []byte("png")}),
+	})
+	require.NoError(t, err)
+	require.Len(t, body.Messages, 1)
+	assert.Equal(t, []contentPart{
+		{Type: "text", Text: "what is this?"},
+		{Type: "image_url", ImageURL: &imageURL{URL: "data:image/png;base64,cG5n"}},
+	}, body.Messages[0].Content)
+
+	body, err = client.chatRequest(gemini.Request{
+		Messages: gemini.NewPrompt("transcribe", gemini.Media{MIMEType: "audio/wav", Data: []byte("wav")}),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, contentPart{Type: "input_audio", InputAudio: &inputAudio{Data: "d2F2", Format: "wav"}}, body.Messages[0].Content.([]contentPart)[1])
+
+	body, err = client.chatRequest(gemini.Request{
+		Messages: gemini.NewPrompt("transcribe", gemini.Media{MIMEType: "audio/mpeg", Data: []byte("mp3")}),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, contentPart{Type: "input_audio", InputAudio: &inputAudio{Data: "bXAz", Format: "mp3"}}, body.Messages[0].Content.([]contentPart)[1])
+
+	body, err = client.chatRequest(gemini.Request{
+		Messages: gemini.NewPrompt("summarize", gemini.Media{MIMEType: "application/pdf", Data: []byte("pdf")}),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, contentPart{Type: "file", File: &inputFile{FileData: "data:application/pdf;base64,cGRm"}}, body.Messages[0].Content.([]contentPart)[1])
+
+	// Messages without media keep a plain string content
+	body, err = client.chatRequest(gemini.Request{Messages: gemini.NewPrompt("hi")})
+	require.NoError(t, err)
+	assert.Equal(t, "hi", body.Messages[0].Content)
+}
+
+func TestClient_GenerateContent_UnsupportedMedia(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	client := NewOpenAIClient(config.OpenAIConfig{BaseURL: server.URL}, config.ModelProfile{}, server.Client(), nil, logger)
+
+	// Telegram voice notes are OGG and video notes MP4, neither can be sent
+	for _, mimeType := range []string{"audio/ogg", "video/mp4"} {
+		_, err := client.GenerateContent(context.Background(), gemini.Request{
+			Messages: gemini.NewPrompt("transcribe", gemini.Media{MIMEType: mimeType, Data: []byte("note")}),
+		})
+		assert.ErrorIs(t, err, ErrUnsupportedMedia, mimeType)
+		assert.ErrorContains(t, err, mimeType)
+		assert.False(t, gemini.IsRetryable(err))
+	}
+	assert.Zero(t, requests)
+}
+
+type usageRecorder struct {
+	usage []gemini.Usage
+}
+
+func (r *usageRecorder) RecordUsage(ctx context.Context, usage gemini.Usage) {
+	r.usage = append(r.usage, usage)
+}
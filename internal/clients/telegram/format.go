@@ -0,0 +1,358 @@
+package telegram
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// MaxMessageLength is the Telegram limit of a message text in UTF-16 code units
+const MaxMessageLength = 4096
+
+var (
+	headingPattern    = regexp.MustCompile(`^#{1,6}\s+(.*)$`)
+	bulletPattern     = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	blockquotePattern = regexp.MustCompile(`^>\s?(.*)$`)
+)
+
+// MarkdownToHTML converts the Markdown written by LLMs to Telegram HTML. Headings become bold
+// lines, list markers become bullets and markers without a closing counterpart are kept as text
+func MarkdownToHTML(markdown string) string {
+	var out []string
+	var quote []string
+	lines := strings.Split(markdown, "\n")
+
+	flushQuote := func() {
+		if len(quote) > 0 {
+			out = append(out, "<blockquote>"+strings.Join(quote, "\n")+"</blockquote>")
+			quote = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if lang, ok := codeFence(line); ok {
+			end := i + 1
+			for end < len(lines) && !isClosingFence(lines[end]) {
+				end++
+			}
+			if end < len(lines) {
+				flushQuote()
+				code := html.EscapeString(strings.Join(lines[i+1:end], "\n"))
+				if lang != "" {
+					out = append(out, `<pre><code class="language-`+html.EscapeString(lang)+`">`+code+"</code></pre>")
+				} else {
+					out = append(out, "<pre>"+code+"</pre>")
+				}
+				i = end
+				continue
+			}
+			// An unclosed fence is text
+		}
+
+		if m := blockquotePattern.FindStringSubmatch(line); m != nil {
+			quote = append(quote, convertInline(m[1]))
+			continue
+		}
+		flushQuote()
+
+		switch {
+		case headingPattern.MatchString(line):
+			out = append(out, "<b>"+convertInline(headingPattern.FindStringSubmatch(line)[1])+"</b>")
+		case bulletPattern.MatchString(line):
+			m := bulletPattern.FindStringSubmatch(line)
+			out = append(out, m[1]+"• "+convertInline(m[2]))
+		default:
+			out = append(out, convertInline(line))
+		}
+	}
+	flushQuote()
+
+	return strings.Join(out, "\n")
+}
+
+// codeFence reports whether a line opens a fenced code block and returns its language
+func codeFence(line string) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "```") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(trimmed, "```")), true
+}
+
+func isClosingFence(line string) bool {
+	return strings.TrimSpace(line) == "```"
+}
+
+// inlineMarkers are converted in this order, longer markers first
+var inlineMarkers = []struct {
+	marker string
+	tag    string
+}{
+	{"**", "b"},
+	{"__", "b"},
+	{"~~", "s"},
+	{"*", "i"},
+	{"_", "i"},
+}
+
+// convertInline converts code spans, links and emphasis of a line and escapes the rest
+func convertInline(text string) string {
+	var out strings.Builder
+
+	for i := 0; i < len(text); {
+		rest := text[i:]
+
+		if rest[0] == '`' {
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				out.WriteString("<code>" + html.EscapeString(rest[1:end+1]) + "</code>")
+				i += end + 2
+				continue
+			}
+		}
+
+		if rest[0] == '[' {
+			if label, url, n, ok := parseLink(rest); ok {
+				out.WriteString(`<a href="` + html.EscapeString(url) + `">` + convertInline(label) + "</a>")
+				i += n
+				continue
+			}
+		}
+
+		if converted, n, ok := parseEmphasis(text, i); ok {
+			out.WriteString(converted)
+			i += n
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(rest)
+		out.WriteString(html.EscapeString(string(r)))
+		i += size
+	}
+
+	return out.String()
+}
+
+// parseLink parses [label](url) at the start of text
+func parseLink(text string) (label, url string, n int, ok bool) {
+	closeLabel := strings.Index(text, "](")
+	if closeLabel < 0 {
+		return "", "", 0, false
+	}
+	closeURL := strings.IndexByte(text[closeLabel+2:], ')')
+	if closeURL < 0 {
+		return "", "", 0, false
+	}
+
+	label = text[1:closeLabel]
+	url = text[closeLabel+2 : closeLabel+2+closeURL]
+	if label == "" || strings.ContainsAny(url, " \t") || !strings.Contains(url, ":") {
+		return "", "", 0, false
+	}
+	return label, url, closeLabel + 3 + closeURL, true
+}
+
+// parseEmphasis converts emphasis starting at text[i]. Like in Markdown, an opening marker is
+// followed and a closing marker preceded by a non-space, underscores inside words are text
+func parseEmphasis(text string, i int) (string, int, bool) {
+	for _, m := range inlineMarkers {
+		if !strings.HasPrefix(text[i:], m.marker) {
+			continue
+		}
+
+		start := i + len(m.marker)
+		if start >= len(text) || isSpaceAt(text, start) {
+			return "", 0, false
+		}
+		if m.marker[0] == '_' && i > 0 && isWordAt(text, i-1) {
+			return "", 0, false
+		}
+
+		for end := start + 1; end+len(m.marker) <= len(text); end++ {
+			if !strings.HasPrefix(text[end:], m.marker) || isSpaceAt(text, end-1) {
+				continue
+			}
+			after := end + len(m.marker)
+			if m.marker[0] == '_' && after < len(text) && isWordAt(text, after) {
+				continue
+			}
+			// A run of markers closes with its last ones, "***" ends "*" inside "**"
+			if after < len(text) && text[after] == m.marker[0] {
+				continue
+			}
+			return "<" + m.tag + ">" + convertInline(text[start:end]) + "</" + m.tag + ">", after - i, true
+		}
+		return "", 0, false
+	}
+	return "", 0, false
+}
+
+func isSpaceAt(text string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(text[i:])
+	return unicode.IsSpace(r)
+}
+
+func isWordAt(text string, i int) bool {
+	r, _ := utf8.DecodeLastRuneInString(text[:i+1])
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// SplitMessage splits a Markdown text into parts of at most limit UTF-16 code units. Parts end at
+// paragraph boundaries where possible, code blocks are only split between lines and every part
+// keeps its code fences
+func SplitMessage(text string, limit int) []string {
+	if textLength(text) <= limit {
+		return []string{text}
+	}
+
+	var parts []string
+	var current string
+	add := func(block string) {
+		switch {
+		case current == "":
+			current = block
+		case textLength(current)+2+textLength(block) <= limit:
+			current += "\n\n" + block
+		default:
+			parts = append(parts, current)
+			current = block
+		}
+	}
+
+	for _, block := range markdownBlocks(text) {
+		if textLength(block) <= limit {
+			add(block)
+			continue
+		}
+		for _, piece := range splitBlock(block, limit) {
+			add(piece)
+		}
+	}
+	if current != "" {
+		parts = append(parts, current)
+	}
+
+	return parts
+}
+
+// markdownBlocks splits a text into paragraphs and fenced code blocks
+func markdownBlocks(text string) []string {
+	var blocks []string
+	var block []string
+	inCode := false
+
+	flush := func() {
+		if len(block) > 0 {
+			blocks = append(blocks, strings.Join(block, "\n"))
+			block = nil
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		switch {
+		case inCode:
+			block = append(block, line)
+			if isClosingFence(line) {
+				inCode = false
+				flush()
+			}
+		case strings.HasPrefix(strings.TrimSpace(line), "```"):
+			flush()
+			block = append(block, line)
+			inCode = true
+		case strings.TrimSpace(line) == "":
+			flush()
+		default:
+			block = append(block, line)
+		}
+	}
+	flush()
+
+	return blocks
+}
+
+// splitBlock splits a block longer than limit by lines, code blocks are closed and reopened
+func splitBlock(block string, limit int) []string {
+	lines := strings.Split(block, "\n")
+	opening, closing := "", ""
+	if lang, ok := codeFence(lines[0]); ok && len(lines) > 1 && isClosingFence(lines[len(lines)-1]) {
+		opening, closing = "```"+lang+"\n", "\n```"
+		lines = lines[1 : len(lines)-1]
+	}
+	room := limit - textLength(opening) - textLength(closing)
+
+	var parts []string
+	var current []string
+	size := 0
+	flush := func() {
+		if len(current) > 0 {
+			parts = append(parts, opening+strings.Join(current, "\n")+closing)
+			current, size = nil, 0
+		}
+	}
+
+	for _, line := range lines {
+		for _, piece := range splitLine(line, room) {
+			length := textLength(piece)
+			if len(current) > 0 && size+1+length > room {
+				flush()
+			}
+			if len(current) > 0 {
+				size++
+			}
+			current = append(current, piece)
+			size += length
+		}
+	}
+	flush()
+
+	return parts
+}
+
+// splitLine splits a line longer than limit at spaces, words longer than limit are cut
+func splitLine(line string, limit int) []string {
+	if textLength(line) <= limit {
+		return []string{line}
+	}
+
+	var parts []string
+	var current strings.Builder
+	size := 0
+	for _, r := range line {
+		length := utf16.RuneLen(r)
+		if size+length > limit {
+			text := current.String()
+			// Prefer the last space of the part
+			if cut := strings.LastIndexByte(text, ' '); cut > 0 {
+				parts = append(parts, text[:cut])
+				text = text[cut+1:]
+			} else {
+				parts = append(parts, text)
+				text = ""
+			}
+			current.Reset()
+			current.WriteString(text)
+			size = textLength(text)
+		}
+		current.WriteRune(r)
+		size += length
+	}
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+
+	return parts
+}
+
+// textLength returns the length of a text the way Telegram counts it
+func textLength(text string) int {
+	length := 0
+	for _, r := range text {
+		length += utf16.RuneLen(r)
+	}
+	return length
+}
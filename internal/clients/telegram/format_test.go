@@ -0,0 +1,91 @@
+package telegram
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkdownToHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		html     string
+	}{
+		{name: "plain text is escaped", markdown: "1 < 2 & 3 > 2", html: "1 &lt; 2 &amp; 3 &gt; 2"},
+		{name: "bold and italic", markdown: "**bold**, __bold__, *italic* and _italic_", html: "<b>bold</b>, <b>bold</b>, <i>italic</i> and <i>italic</i>"},
+		{name: "nested emphasis", markdown: "**bold *and italic***", html: "<b>bold <i>and italic</i></b>"},
+		{name: "strikethrough", markdown: "~~gone~~", html: "<s>gone</s>"},
+		{name: "inline code is not converted", markdown: "call `a_b(*x*) < 1`", html: "call <code>a_b(*x*) &lt; 1</code>"},
+		{name: "link", markdown: "see [the **docs**](https://example.com/?a=1&b=2)", html: `see <a href="https://example.com/?a=1&amp;b=2">the <b>docs</b></a>`},
+		{name: "brackets without url", markdown: "[x](y) and [note]", html: "[x](y) and [note]"},
+		{name: "unclosed markers stay", markdown: "2 * 3 = 6, **not closed", html: "2 * 3 = 6, **not closed"},
+		{name: "underscores inside words", markdown: "snake_case_name and file_name.go", html: "snake_case_name and file_name.go"},
+		{name: "heading", markdown: "## Summary\ntext", html: "<b>Summary</b>\ntext"},
+		{name: "bullets", markdown: "- one\n* **two**\n  + three", html: "• one\n• <b>two</b>\n  • three"},
+		{name: "blockquote", markdown: "> quoted\n> lines\nafter", html: "<blockquote>quoted\nlines</blockquote>\nafter"},
+		{
+			name:     "code block",
+			markdown: "Run:\n```go\nif a < b && *p {\n}\n```\ndone",
+			html:     "Run:\n<pre><code class=\"language-go\">if a &lt; b &amp;&amp; *p {\n}</code></pre>\ndone",
+		},
+		{name: "code block without language", markdown: "```\n**x**\n```", html: "<pre>**x**</pre>"},
+		{name: "unclosed code block", markdown: "```go\nx := 1", html: "```go\nx := 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.html, MarkdownToHTML(tt.markdown))
+		})
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	t.Run("short texts are kept", func(t *testing.T) {
+		assert.Equal(t, []string{"hello\n\nworld"}, SplitMessage("hello\n\nworld", 20))
+	})
+
+	t.Run("splits at paragraphs", func(t *testing.T) {
+		text := "first paragraph\n\nsecond paragraph\n\nthird"
+		assert.Equal(t, []string{"first paragraph", "second paragraph\n\nthird"}, SplitMessage(text, 25))
+	})
+
+	t.Run("long paragraphs are split at spaces", func(t *testing.T) {
+		parts := SplitMessage("aaaa bbbb cccc dddd", 10)
+		assert.Equal(t, []string{"aaaa bbbb", "cccc dddd"}, parts)
+	})
+
+	t.Run("long words are cut", func(t *testing.T) {
+		assert.Equal(t, []string{"aaaa", "aaaa", "aa"}, SplitMessage("aaaaaaaaaa", 4))
+	})
+
+	t.Run("code blocks keep their fences", func(t *testing.T) {
+		text := "intro\n\n```go\nline one\nline two\nline three\n```"
+		parts := SplitMessage(text, 30)
+		assert.Equal(t, []string{
+			"intro",
+			"```go\nline one\nline two\n```",
+			"```go\nline three\n```",
+		}, parts)
+	})
+
+	t.Run("blank lines inside code blocks are no paragraph", func(t *testing.T) {
+		text := "```\na\n\nb\n```\n\nafter"
+		assert.Equal(t, []string{"```\na\n\nb\n```", "after"}, SplitMessage(text, 15))
+	})
+
+	t.Run("lengths are counted in UTF-16", func(t *testing.T) {
+		// Every emoji takes two code units
+		parts := SplitMessage(strings.Repeat("😀", 5), 4)
+		assert.Equal(t, []string{"😀😀", "😀😀", "😀"}, parts)
+	})
+
+	t.Run("parts respect the limit", func(t *testing.T) {
+		text := strings.Repeat("word ", 2000) + "\n\n```\n" + strings.Repeat("code line\n", 1000) + "```"
+		for _, part := range SplitMessage(text, MaxMessageLength) {
+			assert.LessOrEqual(t, textLength(part), MaxMessageLength)
+			assert.Equal(t, strings.Count(part, "```")%2, 0, "unbalanced code fences")
+		}
+	})
+}
@@ -3,7 +3,13 @@ package telegram
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
@@ -13,19 +19,69 @@ import (
 type MessengerClient interface {
 	Start(ctx context.Context) error
 	SendMessage(ctx context.Context, chatID int64, text string) (*models.Message, error)
+	// SendMessageWithOptions sends a text split into messages of at most MaxMessageLength, the sent
+	// messages are returned in order, also next to an error when only some of them were sent
+	SendMessageWithOptions(ctx context.Context, chatID int64, text string, opts SendOptions) ([]*models.Message, error)
+	// EditMessageText replaces the text of a sent message, a nil keyboard removes the inline keyboard
+	EditMessageText(ctx context.Context, chatID int64, messageID int, text string, keyboard *models.InlineKeyboardMarkup) error
+	// EditMessageReplyMarkup replaces the inline keyboard of a sent message, nil removes it
+	EditMessageReplyMarkup(ctx context.Context, chatID int64, messageID int, keyboard *models.InlineKeyboardMarkup) error
+	AnswerCallbackQuery(ctx context.Context, callbackQueryID string, text string) error
+	SendChatAction(ctx context.Context, chatID int64, action models.ChatAction) error
+	SetMyCommands(ctx context.Context, commands []models.BotCommand) error
+	GetChatAdministrators(ctx context.Context, chatID int64) ([]models.ChatMember, error)
+	// GetChat returns the full information of a chat, e.g. its description
+	GetChat(ctx context.Context, chatID int64) (*models.ChatFullInfo, error)
+	// DownloadFile returns the content of a file sent to the bot, at most MaxDownloadSize bytes
+	DownloadFile(ctx context.Context, fileID string) ([]byte, error)
+	// Username returns the username of the bot without @
+	Username() string
 	HandleWebhook(ctx context.Context, res http.ResponseWriter, req *http.Request)
 
 	Close() error
 }
 
+// Format is the markup of a text to send
+type Format int
+
+const (
+	FormatPlain    Format = iota // Sent as is
+	FormatMarkdown               // Markdown as written by LLMs, sent as Telegram HTML
+)
+
+// SendOptions change how a message is sent, the zero value sends a plain message
+type SendOptions struct {
+	Format              Format
+	ReplyToMessageID    int                          // Sent as a reply to this message of the chat, 0 for none
+	DisableNotification bool                         // Members receive the message without sound
+	Keyboard            *models.InlineKeyboardMarkup // Buttons below the message, handled as callback queries
+}
+
+// AllowedUpdates are the update types the bot receives, chat_member updates are only sent when
+// they are asked for. Register a webhook with the same list
+var AllowedUpdates = bot.AllowedUpdates{
+	models.AllowedUpdateMessage,
+	models.AllowedUpdateEditedMessage,
+	models.AllowedUpdateCallbackQuery,
+	models.AllowedUpdateMyChatMember,
+	models.AllowedUpdateChatMember,
+}
+
+// MaxDownloadSize is the Bot API limit of files the bot can download
+const MaxDownloadSize = 20 << 20
+
 type TelegramClient struct {
-	bot *bot.Bot
+	bot        *bot.Bot
+	username   string
+	httpClient *http.Client // Downloads files
 }
 
 func NewTelegramClient(ctx context.Context, c *config.Config, handler bot.HandlerFunc) (MessengerClient, error) {
 	opts := []bot.Option{
 		bot.WithDefaultHandler(handler),
 		bot.WithNotAsyncHandlers(),
+		bot.WithSkipGetMe(), // Called below to keep the username
+		bot.WithAllowedUpdates(AllowedUpdates),
 	}
 
 	b, err := bot.New(c.TelegramToken, opts...)
@@ -34,8 +90,15 @@ func NewTelegramClient(ctx context.Context, c *config.Config, handler bot.Handle
 		return nil, err
 	}
 
+	me, err := b.GetMe(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error call getMe, %w", err)
+	}
+
 	return &TelegramClient{
-		bot: b,
+		bot:        b,
+		username:   me.Username,
+		httpClient: &http.Client{Timeout: time.Minute},
 	}, nil
 }
 
@@ -45,25 +108,183 @@ func (t *TelegramClient) Start(ctx context.Context) error {
 	return nil
 }
 
+// SendMessage sends a plain text and returns its first message
 func (t *TelegramClient) SendMessage(ctx context.Context, chatID int64, text string) (*models.Message, error) {
-	msg := bot.SendMessageParams{
+	sent, err := t.SendMessageWithOptions(ctx, chatID, text, SendOptions{})
+	if len(sent) == 0 {
+		return nil, err
+	}
+	return sent[0], err
+}
+
+// SendMessageWithOptions splits long texts at paragraph and code block boundaries. Only the first
+// message replies and only the last one gets the keyboard. A part Telegram cannot parse is sent
+// again as plain text
+func (t *TelegramClient) SendMessageWithOptions(ctx context.Context, chatID int64, text string, opts SendOptions) ([]*models.Message, error) {
+	parts := SplitMessage(text, MaxMessageLength)
+
+	var sent []*models.Message
+	for i, part := range parts {
+		params := &bot.SendMessageParams{
+			ChatID:              chatID,
+			Text:                part,
+			DisableNotification: opts.DisableNotification,
+		}
+		if opts.Format == FormatMarkdown {
+			params.Text = MarkdownToHTML(part)
+			params.ParseMode = models.ParseModeHTML
+		}
+		if i == 0 && opts.ReplyToMessageID != 0 {
+			params.ReplyParameters = &models.ReplyParameters{
+				MessageID:                opts.ReplyToMessageID,
+				AllowSendingWithoutReply: true, // The message may be deleted by now
+			}
+		}
+		if i == len(parts)-1 && opts.Keyboard != nil {
+			params.ReplyMarkup = opts.Keyboard
+		}
+
+		message, err := t.bot.SendMessage(ctx, params)
+		if err != nil && params.ParseMode != "" && isParseError(err) {
+			params.Text = part
+			params.ParseMode = ""
+			message, err = t.bot.SendMessage(ctx, params)
+		}
+		if err != nil {
+			return sent, fmt.Errorf("failed to send part %d of %d: %w", i+1, len(parts), err)
+		}
+
+		sent = append(sent, message)
+	}
+
+	return sent, nil
+}
+
+// isParseError reports whether Telegram rejected the markup of a message
+func isParseError(err error) bool {
+	return errors.Is(err, bot.ErrorBadRequest) && strings.Contains(err.Error(), "can't parse entities")
+}
+
+func (t *TelegramClient) EditMessageText(ctx context.Context, chatID int64, messageID int, text string, keyboard *models.InlineKeyboardMarkup) error {
+	params := &bot.EditMessageTextParams{
 		ChatID:    chatID,
-		Text:      bot.EscapeMarkdown(text),
-		ParseMode: models.ParseModeMarkdown,
+		MessageID: messageID,
+		Text:      text,
+	}
+	if keyboard != nil {
+		params.ReplyMarkup = keyboard
 	}
 
-	message, err := t.bot.SendMessage(ctx, &msg)
+	_, err := t.bot.EditMessageText(ctx, params)
+	return err
+}
 
+func (t *TelegramClient) EditMessageReplyMarkup(ctx context.Context, chatID int64, messageID int, keyboard *models.InlineKeyboardMarkup) error {
+	params := &bot.EditMessageReplyMarkupParams{
+		ChatID:    chatID,
+		MessageID: messageID,
+	}
+	if keyboard != nil {
+		params.ReplyMarkup = keyboard
+	}
+
+	_, err := t.bot.EditMessageReplyMarkup(ctx, params)
+	return err
+}
+
+// AnswerCallbackQuery acknowledges a button press, a non-empty text is shown as a notification
+func (t *TelegramClient) AnswerCallbackQuery(ctx context.Context, callbackQueryID string, text string) error {
+	_, err := t.bot.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: callbackQueryID,
+		Text:            text,
+	})
+	return err
+}
+
+func (t *TelegramClient) SendChatAction(ctx context.Context, chatID int64, action models.ChatAction) error {
+	_, err := t.bot.SendChatAction(ctx, &bot.SendChatActionParams{
+		ChatID: chatID,
+		Action: action,
+	})
+	return err
+}
+
+// SetMyCommands publishes the command list shown in the Telegram command menu
+func (t *TelegramClient) SetMyCommands(ctx context.Context, commands []models.BotCommand) error {
+	_, err := t.bot.SetMyCommands(ctx, &bot.SetMyCommandsParams{
+		Commands: commands,
+	})
+	return err
+}
+
+func (t *TelegramClient) GetChatAdministrators(ctx context.Context, chatID int64) ([]models.ChatMember, error) {
+	return t.bot.GetChatAdministrators(ctx, &bot.GetChatAdministratorsParams{
+		ChatID: chatID,
+	})
+}
+
+func (t *TelegramClient) GetChat(ctx context.Context, chatID int64) (*models.ChatFullInfo, error) {
+	return t.bot.GetChat(ctx, &bot.GetChatParams{
+		ChatID: chatID,
+	})
+}
+
+// DownloadFile resolves the download link of a file with getFile and fetches it
+func (t *TelegramClient) DownloadFile(ctx context.Context, fileID string) ([]byte, error) {
+	file, err := t.bot.GetFile(ctx, &bot.GetFileParams{FileID: fileID})
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to get file: %w", err)
+	}
+	if file.FileSize > MaxDownloadSize {
+		return nil, fmt.Errorf("file of %d bytes exceeds the download limit", file.FileSize)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.bot.FileDownloadLink(file), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %w", err)
+	}
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		// The link contains the bot token, keep it out of the logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("failed to download file %s: %w", file.FilePath, err)
 	}
+	defer resp.Body.Close()
 
-	return message, nil
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download file %s: status %d", file.FilePath, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxDownloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", file.FilePath, err)
+	}
+	if len(data) > MaxDownloadSize {
+		return nil, fmt.Errorf("file %s exceeds the download limit", file.FilePath)
+	}
+
+	return data, nil
+}
+
+func (t *TelegramClient) Username() string {
+	return t.username
 }
 
+// HandleWebhook acknowledges a webhook update and processes it, malformed updates are rejected
 func (t *TelegramClient) HandleWebhook(ctx context.Context, res http.ResponseWriter, req *http.Request) {
 	update := models.Update{}
-	json.NewDecoder(req.Body).Decode(&update)
+	if err := json.NewDecoder(req.Body).Decode(&update); err != nil {
+		http.Error(res, "invalid update", http.StatusBadRequest)
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	res.Write([]byte("ok"))
+
 	t.bot.ProcessUpdate(ctx, &update)
 }
 
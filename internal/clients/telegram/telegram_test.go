@@ -0,0 +1,185 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sentRequest is a sendMessage call received by the fake Bot API
+type sentRequest struct {
+	Text                string
+	ParseMode           string
+	DisableNotification bool
+	ReplyParameters     string
+	ReplyMarkup         string
+}
+
+// newTestClient returns a client talking to a fake Bot API, reject decides which requests fail
+// with a parse error
+func newTestClient(t *testing.T, reject func(req sentRequest) bool) (*TelegramClient, *[]sentRequest) {
+	var mu sync.Mutex
+	var requests []sentRequest
+	messageID := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.True(t, strings.HasSuffix(req.URL.Path, "/sendMessage"), req.URL.Path)
+		assert.NoError(t, req.ParseMultipartForm(1<<20))
+
+		sent := sentRequest{
+			Text:                req.FormValue("text"),
+			ParseMode:           req.FormValue("parse_mode"),
+			DisableNotification: req.FormValue("disable_notification") == "true",
+			ReplyParameters:     req.FormValue("reply_parameters"),
+			ReplyMarkup:         req.FormValue("reply_markup"),
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, sent)
+
+		if reject != nil && reject(sent) {
+			fmt.Fprint(res, `{"ok":false,"error_code":400,"description":"Bad Request: can't parse entities: unexpected end tag"}`)
+			return
+		}
+
+		messageID++
+		json.NewEncoder(res).Encode(map[string]any{
+			"ok":     true,
+			"result": models.Message{ID: messageID, Text: sent.Text},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	b, err := bot.New("token", bot.WithServerURL(server.URL), bot.WithSkipGetMe())
+	require.NoError(t, err)
+
+	return &TelegramClient{bot: b, username: "kpukbot"}, &requests
+}
+
+func TestTelegramClient_SendMessageWithOptions(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("plain text is sent as is", func(t *testing.T) {
+		client, requests := newTestClient(t, nil)
+
+		message, err := client.SendMessage(ctx, 1, "**not bold** <b>")
+		require.NoError(t, err)
+		assert.Equal(t, 1, message.ID)
+
+		require.Len(t, *requests, 1)
+		assert.Equal(t, "**not bold** <b>", (*requests)[0].Text)
+		assert.Empty(t, (*requests)[0].ParseMode)
+	})
+
+	t.Run("markdown is sent as html", func(t *testing.T) {
+		client, requests := newTestClient(t, nil)
+
+		_, err := client.SendMessageWithOptions(ctx, 1, "**bold**", SendOptions{
+			Format:              FormatMarkdown,
+			DisableNotification: true,
+		})
+		require.NoError(t, err)
+
+		require.Len(t, *requests, 1)
+		assert.Equal(t, "<b>bold</b>", (*requests)[0].Text)
+		assert.Equal(t, "HTML", (*requests)[0].ParseMode)
+		assert.True(t, (*requests)[0].DisableNotification)
+	})
+
+	t.Run("long texts are split", func(t *testing.T) {
+		client, requests := newTestClient(t, nil)
+		keyboard := &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{{
+			{Text: "Skip", CallbackData: "question:skip:1"},
+		}}}
+
+		paragraph := strings.Repeat("a", 3000)
+		sent, err := client.SendMessageWithOptions(ctx, 1, paragraph+"\n\n"+paragraph, SendOptions{
+			ReplyToMessageID: 42,
+			Keyboard:         keyboard,
+		})
+		require.NoError(t, err)
+		require.Len(t, sent, 2)
+		assert.Equal(t, []int{1, 2}, []int{sent[0].ID, sent[1].ID})
+
+		require.Len(t, *requests, 2)
+		first, last := (*requests)[0], (*requests)[1]
+		assert.Equal(t, paragraph, first.Text)
+		assert.Contains(t, first.ReplyParameters, `"message_id":42`)
+		assert.Empty(t, first.ReplyMarkup)
+		assert.Empty(t, last.ReplyParameters)
+		assert.Contains(t, last.ReplyMarkup, "question:skip:1")
+	})
+
+	t.Run("unparsable parts are sent as plain text", func(t *testing.T) {
+		client, requests := newTestClient(t, func(req sentRequest) bool {
+			return req.ParseMode != ""
+		})
+
+		sent, err := client.SendMessageWithOptions(ctx, 1, "**bold**", SendOptions{Format: FormatMarkdown})
+		require.NoError(t, err)
+		require.Len(t, sent, 1)
+
+		require.Len(t, *requests, 2)
+		assert.Equal(t, "**bold**", (*requests)[1].Text)
+		assert.Empty(t, (*requests)[1].ParseMode)
+	})
+
+	t.Run("sent parts are returned with the error", func(t *testing.T) {
+		calls := 0
+		client, _ := newTestClient(t, func(req sentRequest) bool {
+			calls++
+			return calls > 1
+		})
+
+		paragraph := strings.Repeat("a", 3000)
+		sent, err := client.SendMessageWithOptions(ctx, 1, paragraph+"\n\n"+paragraph, SendOptions{})
+		assert.ErrorContains(t, err, "failed to send part 2 of 2")
+		assert.Len(t, sent, 1)
+	})
+}
+
+func TestTelegramClient_DownloadFile(t *testing.T) {
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/bottoken/getFile":
+			assert.NoError(t, req.ParseMultipartForm(1<<20))
+			size := 5
+			if req.FormValue("file_id") == "huge" {
+				size = MaxDownloadSize + 1
+			}
+			json.NewEncoder(res).Encode(map[string]any{
+				"ok":     true,
+				"result": models.File{FileID: req.FormValue("file_id"), FileSize: int64(size), FilePath: "photos/file_1.jpg"},
+			})
+		case "/file/bottoken/photos/file_1.jpg":
+			fmt.Fprint(res, "image")
+		default:
+			t.Errorf("unexpected request %s", req.URL.Path)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	b, err := bot.New("token", bot.WithServerURL(server.URL), bot.WithSkipGetMe())
+	require.NoError(t, err)
+	client := &TelegramClient{bot: b, httpClient: server.Client()}
+
+	data, err := client.DownloadFile(ctx, "photo")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("image"), data)
+
+	_, err = client.DownloadFile(ctx, "huge")
+	assert.ErrorContains(t, err, "exceeds the download limit")
+}
@@ -2,15 +2,85 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Storage backends supported by the repositories
+const (
+	StorageBackendFirestore = "firestore"
+	StorageBackendMemory    = "memory"
+	StorageBackendSQLite    = "sqlite"
+)
+
+// LLM providers
+const (
+	LLMProviderGemini = "gemini"
+	LLMProviderOpenAI = "openai" // Any OpenAI compatible API, e.g. llama.cpp, Ollama or vLLM
+)
+
+// Model profiles, each LLM call site uses one of them
+const (
+	ModelProfileDefault = "default" // Call sites without a dedicated profile
+	ModelProfileFast    = "fast"    // Cheap model for classification and response gating
+	ModelProfileSmart   = "smart"   // Stronger model for user facing answers
 )
 
 // Config holds application configuration
 type Config struct {
 	GeminiAPIKey    string
 	TelegramToken   string
+	WebhookConfig   WebhookConfig
+	ServerConfig    ServerConfig
+	UpdateQueue     UpdateQueueConfig
+	Idempotency     IdempotencyConfig
+	MessageEdits    MessageEditsConfig
 	GeminiModelName string
+	LLMProvider     string // gemini (default) or openai
+	OpenAIConfig    OpenAIConfig
+	LLMRetryConfig  LLMRetryConfig
+	ModelProfiles   map[string]ModelProfile
+	ModelPricing    map[string]ModelPrice // Keyed by model name, used for usage cost estimates
 	FilestoreConfig FirestoreConfig
-	UseMockGemini   bool // Enable mock Gemini client for local testing
+	SQLiteConfig    SQLiteConfig
+	StorageBackend  string // Repository backend: firestore (default), sqlite or memory
+	UseMockGemini   bool   // Enable mock Gemini client for local testing
+}
+
+// WebhookConfig holds the credentials of incoming HTTP requests
+type WebhookConfig struct {
+	SecretToken       string // Telegram sends it in X-Telegram-Bot-Api-Secret-Token, set with setWebhook secret_token
+	Insecure          bool   // Accept updates without a secret token, only for local testing
+	TriggerToken      string // Bearer token of trigger requests
+	TriggerHMACSecret string // Key of HMAC signed trigger requests
+}
+
+// ServerConfig holds the configuration of the long-lived HTTP server
+type ServerConfig struct {
+	Port            string
+	ShutdownTimeout time.Duration // How long in-flight requests may run after SIGTERM
+}
+
+// UpdateQueueConfig controls asynchronous processing of webhook updates
+type UpdateQueueConfig struct {
+	Enabled           bool          // Webhook updates are queued and processed by workers
+	Workers           int           // Workers per instance
+	PollInterval      time.Duration // How often idle workers look for updates queued by other instances
+	VisibilityTimeout time.Duration // How long a leased update may be processed before another worker takes it over
+	MaxAttempts       int           // Attempts before an update is moved to the dead letters
+	RetryDelay        time.Duration // Backoff after the first failed attempt, doubled for every next one
+}
+
+// IdempotencyConfig controls deduplication of Telegram updates by update_id
+type IdempotencyConfig struct {
+	TTL   time.Duration // How long processed updates are remembered, Telegram stops redelivering within a day
+	Lease time.Duration // How long an attempt owns an update before a redelivery may resume it
+}
+
+// MessageEditsConfig controls how edited messages are handled
+type MessageEditsConfig struct {
+	Reprocess bool // Edited messages are classified again and refresh the summary of their thread
 }
 
 // FirestoreConfig holds the configuration for Firebase/Firestore
@@ -20,6 +90,59 @@ type FirestoreConfig struct {
 	UseEmulator  bool
 }
 
+// OpenAIConfig holds the configuration of an OpenAI compatible API
+type OpenAIConfig struct {
+	BaseURL string // e.g. http://localhost:8080/v1 for a local llama.cpp server
+	APIKey  string // Optional for local servers
+}
+
+// LLMRetryConfig controls retries and circuit breaking of LLM calls
+type LLMRetryConfig struct {
+	MaxAttempts      int           // Attempts per call including the first one
+	BaseDelay        time.Duration // Backoff before the second attempt, doubled for every next one
+	MaxDelay         time.Duration
+	FailureThreshold int           // Consecutive failed calls that open the circuit, 0 disables it
+	OpenDuration     time.Duration // How long the circuit stays open before a probe call
+}
+
+// ModelProfile holds the model and generation parameters of a group of LLM calls,
+// unset parameters are left to the caller or the model defaults
+type ModelProfile struct {
+	Model           string
+	Temperature     *float32
+	TopK            *float32
+	TopP            *float32
+	MaxOutputTokens int32
+}
+
+// ModelPrice is the price of a model in USD per million tokens
+type ModelPrice struct {
+	InputPerMillion  float64
+	OutputPerMillion float64
+}
+
+// Cost estimates the cost of a call in USD, unknown models cost nothing
+func (c *Config) Cost(model string, promptTokens, responseTokens int64) float64 {
+	price, ok := c.ModelPricing[model]
+	if !ok {
+		return 0
+	}
+	return (float64(promptTokens)*price.InputPerMillion + float64(responseTokens)*price.OutputPerMillion) / 1e6
+}
+
+// Profile returns the named model profile, falling back to the default one
+func (c *Config) Profile(name string) ModelProfile {
+	if profile, ok := c.ModelProfiles[name]; ok {
+		return profile
+	}
+	return c.ModelProfiles[ModelProfileDefault]
+}
+
+// SQLiteConfig holds the configuration for the SQLite storage backend
+type SQLiteConfig struct {
+	Path string // Database file, created on first start
+}
+
 // NewConfig loads configuration from environment variables
 func NewConfig() *Config {
 	modelName := os.Getenv("GEMINI_MODEL")
@@ -27,6 +150,88 @@ func NewConfig() *Config {
 		modelName = "gemini-2.5-flash" // Default model
 	}
 
+	llmProvider := os.Getenv("LLM_PROVIDER")
+	if llmProvider == "" {
+		llmProvider = LLMProviderGemini
+	}
+
+	openAIConfig := OpenAIConfig{
+		BaseURL: os.Getenv("OPENAI_BASE_URL"),
+		APIKey:  os.Getenv("OPENAI_API_KEY"),
+	}
+	if openAIConfig.BaseURL == "" {
+		openAIConfig.BaseURL = "http://localhost:8080/v1"
+	}
+
+	retryConfig := LLMRetryConfig{
+		MaxAttempts:      envInt("LLM_MAX_ATTEMPTS", 3),
+		BaseDelay:        envDuration("LLM_RETRY_BASE_DELAY", 500*time.Millisecond),
+		MaxDelay:         envDuration("LLM_RETRY_MAX_DELAY", 8*time.Second),
+		FailureThreshold: envInt("LLM_CIRCUIT_FAILURE_THRESHOLD", 5),
+		OpenDuration:     envDuration("LLM_CIRCUIT_OPEN_DURATION", time.Minute),
+	}
+
+	// Profiles are read from GEMINI_* or OPENAI_* variables depending on the provider
+	profilePrefix, profileModel := "GEMINI", modelName
+	if llmProvider == LLMProviderOpenAI {
+		profilePrefix, profileModel = "OPENAI", ""
+	}
+
+	// Fast and smart profiles inherit everything that is not set for them from the default one
+	defaultProfile := loadModelProfile(profilePrefix, ModelProfile{
+		Model:           profileModel,
+		Temperature:     ptr(float32(0.7)),
+		TopK:            ptr(float32(40)),
+		TopP:            ptr(float32(0.95)),
+		MaxOutputTokens: 2048,
+	})
+	modelProfiles := map[string]ModelProfile{
+		ModelProfileDefault: defaultProfile,
+		ModelProfileFast:    loadModelProfile(profilePrefix+"_FAST", defaultProfile),
+		ModelProfileSmart:   loadModelProfile(profilePrefix+"_SMART", defaultProfile),
+	}
+
+	// Known Gemini prices, LLM_PRICING adds or overrides models as model=input:output,...
+	modelPricing := map[string]ModelPrice{
+		"gemini-2.5-flash":      {InputPerMillion: 0.30, OutputPerMillion: 2.50},
+		"gemini-2.5-flash-lite": {InputPerMillion: 0.10, OutputPerMillion: 0.40},
+		"gemini-2.5-pro":        {InputPerMillion: 1.25, OutputPerMillion: 10.00},
+	}
+	loadModelPricing(os.Getenv("LLM_PRICING"), modelPricing)
+
+	webhookConfig := WebhookConfig{
+		SecretToken:       os.Getenv("TELEGRAM_WEBHOOK_SECRET"),
+		Insecure:          os.Getenv("TELEGRAM_WEBHOOK_INSECURE") == "true",
+		TriggerToken:      os.Getenv("TRIGGER_TOKEN"),
+		TriggerHMACSecret: os.Getenv("TRIGGER_HMAC_SECRET"),
+	}
+
+	serverConfig := ServerConfig{
+		Port:            os.Getenv("PORT"),
+		ShutdownTimeout: envDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+	}
+	if serverConfig.Port == "" {
+		serverConfig.Port = "8080"
+	}
+
+	updateQueue := UpdateQueueConfig{
+		Enabled:           os.Getenv("UPDATE_QUEUE") == "true",
+		Workers:           envInt("UPDATE_WORKERS", 4),
+		PollInterval:      envDuration("UPDATE_POLL_INTERVAL", time.Second),
+		VisibilityTimeout: envDuration("UPDATE_VISIBILITY_TIMEOUT", 5*time.Minute),
+		MaxAttempts:       envInt("UPDATE_MAX_ATTEMPTS", 5),
+		RetryDelay:        envDuration("UPDATE_RETRY_DELAY", 5*time.Second),
+	}
+
+	idempotency := IdempotencyConfig{
+		TTL:   envDuration("UPDATE_DEDUP_TTL", 24*time.Hour),
+		Lease: envDuration("UPDATE_DEDUP_LEASE", 5*time.Minute),
+	}
+
+	messageEdits := MessageEditsConfig{
+		Reprocess: os.Getenv("EDITED_MESSAGES_REPROCESS") == "true",
+	}
+
 	// Load Firestore configuration
 	firestoreConfig := FirestoreConfig{
 		ProjectID:    os.Getenv("CLOUD_PROJECT_ID"),
@@ -34,11 +239,110 @@ func NewConfig() *Config {
 		UseEmulator:  os.Getenv("USE_FIRESTORE_EMULATOR") == "true",
 	}
 
+	sqliteConfig := SQLiteConfig{
+		Path: os.Getenv("SQLITE_PATH"),
+	}
+	if sqliteConfig.Path == "" {
+		sqliteConfig.Path = "kpukbot.db"
+	}
+
+	storageBackend := os.Getenv("STORAGE_BACKEND")
+	if storageBackend == "" {
+		storageBackend = StorageBackendFirestore
+	}
+
 	return &Config{
 		GeminiAPIKey:    os.Getenv("GEMINI_API_KEY"),
 		TelegramToken:   os.Getenv("TELEGRAM_API_TOKEN"),
+		WebhookConfig:   webhookConfig,
+		ServerConfig:    serverConfig,
+		UpdateQueue:     updateQueue,
+		Idempotency:     idempotency,
+		MessageEdits:    messageEdits,
 		GeminiModelName: modelName,
+		LLMProvider:     llmProvider,
+		OpenAIConfig:    openAIConfig,
+		LLMRetryConfig:  retryConfig,
+		ModelProfiles:   modelProfiles,
+		ModelPricing:    modelPricing,
 		FilestoreConfig: firestoreConfig,
+		SQLiteConfig:    sqliteConfig,
+		StorageBackend:  storageBackend,
 		UseMockGemini:   os.Getenv("USE_MOCK_GEMINI") == "true",
 	}
 }
+
+// loadModelProfile reads <prefix>_MODEL, <prefix>_TEMPERATURE, <prefix>_TOP_K, <prefix>_TOP_P
+// and <prefix>_MAX_OUTPUT_TOKENS on top of the base profile
+func loadModelProfile(prefix string, base ModelProfile) ModelProfile {
+	profile := base
+
+	if model := os.Getenv(prefix + "_MODEL"); model != "" {
+		profile.Model = model
+	}
+	if v, ok := envFloat32(prefix + "_TEMPERATURE"); ok {
+		profile.Temperature = &v
+	}
+	if v, ok := envFloat32(prefix + "_TOP_K"); ok {
+		profile.TopK = &v
+	}
+	if v, ok := envFloat32(prefix + "_TOP_P"); ok {
+		profile.TopP = &v
+	}
+	if v, err := strconv.ParseInt(os.Getenv(prefix+"_MAX_OUTPUT_TOKENS"), 10, 32); err == nil {
+		profile.MaxOutputTokens = int32(v)
+	}
+
+	return profile
+}
+
+// loadModelPricing parses model=input:output pairs separated by commas, malformed pairs are skipped
+func loadModelPricing(value string, pricing map[string]ModelPrice) {
+	for _, pair := range strings.Split(value, ",") {
+		model, prices, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		input, output, ok := strings.Cut(prices, ":")
+		if !ok {
+			continue
+		}
+		inputPrice, err := strconv.ParseFloat(input, 64)
+		if err != nil {
+			continue
+		}
+		outputPrice, err := strconv.ParseFloat(output, 64)
+		if err != nil {
+			continue
+		}
+		pricing[model] = ModelPrice{InputPerMillion: inputPrice, OutputPerMillion: outputPrice}
+	}
+}
+
+func envFloat32(key string) (float32, bool) {
+	v, err := strconv.ParseFloat(os.Getenv(key), 32)
+	if err != nil {
+		return 0, false
+	}
+	return float32(v), true
+}
+
+func envInt(key string, fallback int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
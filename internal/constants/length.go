@@ -6,6 +6,11 @@ var (
 	MaxThreadSummaryLength   = int64(4096)
 	MaxAnalysisLength        = int64(4096)
 
+	MaxImageDescriptionLength  = int64(1000)
+	MaxTranscriptLength        = int64(4096)
+	MaxAttachmentTextLength    = int64(20000) // Extracted text given to the LLM for a summary
+	MaxAttachmentSummaryLength = int64(1000)
+
 	MaxFactCheckingExplanationLength    = int64(2000)
 	MaxFactCheckingAdditionalInfoLength = int64(2000)
 
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// chatLocks serializes processing per chat within this process, waiters of a chat get the lock in
+// arrival order. Instances do not share the locks: with several instances, or queue workers on
+// several instances, updates of a chat may be processed concurrently and out of order. Only the
+// transactions of the repositories keep thread and queue changes consistent across instances
+type chatLocks struct {
+	mu      sync.Mutex
+	waiters map[int64][]chan struct{} // The head of each queue holds the lock
+}
+
+func newChatLocks() *chatLocks {
+	return &chatLocks{
+		waiters: make(map[int64][]chan struct{}),
+	}
+}
+
+// lock waits until the chat is free and returns the function releasing it
+func (l *chatLocks) lock(ctx context.Context, chatID int64) (func(), error) {
+	turn := make(chan struct{})
+
+	l.mu.Lock()
+	queue := l.waiters[chatID]
+	if len(queue) == 0 {
+		close(turn)
+	}
+	l.waiters[chatID] = append(queue, turn)
+	l.mu.Unlock()
+
+	unlock := func() { l.leave(chatID, turn) }
+
+	select {
+	case <-turn:
+		return unlock, nil
+	case <-ctx.Done():
+		// Leaving also passes the lock on in case it was granted meanwhile
+		unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// leave removes a waiter from the queue of the chat and hands the lock to the next one
+func (l *chatLocks) leave(chatID int64, turn chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	queue := l.waiters[chatID]
+	i := slices.Index(queue, turn)
+	if i < 0 {
+		return
+	}
+
+	queue = slices.Delete(queue, i, i+1)
+	if len(queue) == 0 {
+		delete(l.waiters, chatID)
+		return
+	}
+
+	l.waiters[chatID] = queue
+	if i == 0 {
+		close(queue[0])
+	}
+}
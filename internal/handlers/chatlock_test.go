@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatLocks_SerializeChat(t *testing.T) {
+	locks := newChatLocks()
+	ctx := context.Background()
+
+	// Unsynchronized counters, the race detector reports any overlap within a chat
+	counters := map[int64]*int{1: new(int), 2: new(int)}
+
+	var wg sync.WaitGroup
+	for i := range 100 {
+		chatID := int64(i%2 + 1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := locks.lock(ctx, chatID)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer unlock()
+
+			value := *counters[chatID]
+			time.Sleep(time.Microsecond)
+			*counters[chatID] = value + 1
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 50, *counters[1])
+	assert.Equal(t, 50, *counters[2])
+	assert.Empty(t, locks.waiters)
+}
+
+func TestChatLocks_ArrivalOrder(t *testing.T) {
+	locks := newChatLocks()
+	ctx := context.Background()
+
+	unlock, err := locks.lock(ctx, 1)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := locks.lock(ctx, 1)
+			if !assert.NoError(t, err) {
+				return
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			unlock()
+		}()
+
+		// Wait until the waiter is queued before starting the next one
+		require.Eventually(t, func() bool {
+			locks.mu.Lock()
+			defer locks.mu.Unlock()
+			return len(locks.waiters[1]) == i+2
+		}, time.Second, time.Millisecond)
+	}
+
+	unlock()
+	wg.Wait()
+
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, order)
+}
+
+func TestChatLocks_CanceledWaiterLeaves(t *testing.T) {
+	locks := newChatLocks()
+
+	unlock, err := locks.lock(context.Background(), 1)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = locks.lock(ctx, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	unlock()
+
+	// The chat is free again, other chats were never blocked
+	unlock, err = locks.lock(context.Background(), 1)
+	require.NoError(t, err)
+	unlock()
+	assert.Empty(t, locks.waiters)
+}
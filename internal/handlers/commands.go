@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode"
+
+	botModels "github.com/go-telegram/bot/models"
+	"github.com/kriku/kpukbot/internal/clients/telegram"
+	"github.com/kriku/kpukbot/internal/services/callbacks"
+)
+
+// startText greets users who start the bot
+const startText = "Hi! I follow the conversations of this chat, answer when I can help and ask the members " +
+	"questions about their interests from time to time. Send /help to see what else I can do."
+
+// CommandRequest is a command sent to the bot
+type CommandRequest struct {
+	Name    string // Lower case, without the slash and the bot mention
+	Args    string // Text after the command
+	Message *botModels.Message
+}
+
+// ChatID returns the chat the command was sent in
+func (r *CommandRequest) ChatID() int64 {
+	return r.Message.Chat.ID
+}
+
+// CommandHandler runs a command, a returned error is reported like a failed message
+type CommandHandler func(ctx context.Context, req *CommandRequest) error
+
+// Command is an in-chat bot command
+type Command struct {
+	Name        string // Without the slash, e.g. "help"
+	Description string // Shown by /help and in the Telegram command menu
+	Admin       bool   // Only chat administrators may run the command
+	Handler     CommandHandler
+	Callback    callbacks.Handler // Handles buttons created with the command name as callback prefix, optional
+}
+
+// CommandRouter dispatches command messages to their handlers before they reach the LLM pipeline
+type CommandRouter struct {
+	commands  map[string]Command
+	order     []string // Registration order, used for /help and the command menu
+	callbacks *callbacks.CallbackRouter
+	messenger telegram.MessengerClient
+	logger    *slog.Logger
+}
+
+// NewCommandRouter creates a router with the built-in /start and /help commands, callbacks
+// of commands are registered with the callback router
+func NewCommandRouter(callbacks *callbacks.CallbackRouter, logger *slog.Logger) *CommandRouter {
+	r := &CommandRouter{
+		commands:  make(map[string]Command),
+		callbacks: callbacks,
+		logger:    logger.With("handler", "commands"),
+	}
+
+	r.Register(
+		Command{Name: "start", Description: "Introduce the bot", Handler: r.handleStart},
+		Command{Name: "help", Description: "List available commands", Handler: r.handleHelp},
+	)
+
+	return r
+}
+
+// SetMessengerClient sets the messenger client (useful for resolving circular dependencies)
+func (r *CommandRouter) SetMessengerClient(messenger telegram.MessengerClient) {
+	r.messenger = messenger
+}
+
+// Register adds commands to the router, a command registered again replaces the previous one
+func (r *CommandRouter) Register(commands ...Command) {
+	for _, command := range commands {
+		name := strings.ToLower(command.Name)
+		if _, ok := r.commands[name]; !ok {
+			r.order = append(r.order, name)
+		}
+		r.commands[name] = command
+		if command.Callback != nil {
+			r.callbacks.Handle(name, command.Callback)
+		}
+	}
+}
+
+// Commands returns the registered commands in registration order
+func (r *CommandRouter) Commands() []Command {
+	commands := make([]Command, 0, len(r.order))
+	for _, name := range r.order {
+		commands = append(commands, r.commands[name])
+	}
+	return commands
+}
+
+// RegisterCommands publishes the registered commands to the Telegram command menu
+func (r *CommandRouter) RegisterCommands(ctx context.Context) error {
+	var commands []botModels.BotCommand
+	for _, command := range r.Commands() {
+		commands = append(commands, botModels.BotCommand{
+			Command:     command.Name,
+			Description: command.Description,
+		})
+	}
+
+	if err := r.messenger.SetMyCommands(ctx, commands); err != nil {
+		return fmt.Errorf("failed to set bot commands: %w", err)
+	}
+	return nil
+}
+
+// Route runs the handler of a command message and reports whether the message was a command.
+// Commands addressed to other bots are consumed without an answer, unknown commands are only
+// answered in private chats or when they mention this bot, in groups they may be for other bots
+func (r *CommandRouter) Route(ctx context.Context, message *botModels.Message) (bool, error) {
+	name, args, mention, ok := ParseCommand(message.Text)
+	if !ok {
+		return false, nil
+	}
+
+	if mention != "" && !strings.EqualFold(mention, r.messenger.Username()) {
+		r.logger.DebugContext(ctx, "Ignoring command for another bot", "command", name, "bot", mention)
+		return true, nil
+	}
+
+	command, ok := r.commands[name]
+	if !ok {
+		r.logger.InfoContext(ctx, "Unknown command", "command", name, "chat_id", message.Chat.ID)
+		if mention == "" && message.Chat.Type != botModels.ChatTypePrivate {
+			return true, nil
+		}
+		return true, r.Reply(ctx, message.Chat.ID, fmt.Sprintf("Unknown command /%s, send /help to see the available ones.", name))
+	}
+
+	if command.Admin {
+		admin, err := r.IsAdmin(ctx, message)
+		if err != nil {
+			return true, fmt.Errorf("failed to check administrators: %w", err)
+		}
+		if !admin {
+			r.logger.InfoContext(ctx, "Rejected admin command", "command", name, "chat_id", message.Chat.ID)
+			return true, r.Reply(ctx, message.Chat.ID, fmt.Sprintf("Only chat administrators can use /%s.", name))
+		}
+	}
+
+	r.logger.InfoContext(ctx, "Running command",
+		"command", name,
+		"chat_id", message.Chat.ID)
+
+	req := &CommandRequest{Name: name, Args: args, Message: message}
+	if err := command.Handler(ctx, req); err != nil {
+		return true, fmt.Errorf("failed to run command /%s: %w", name, err)
+	}
+	return true, nil
+}
+
+// IsAdmin reports whether the sender of a message administers its chat. Private chats are
+// administered by their user, anonymous administrators send on behalf of the chat itself
+func (r *CommandRouter) IsAdmin(ctx context.Context, message *botModels.Message) (bool, error) {
+	if message.SenderChat != nil && message.SenderChat.ID == message.Chat.ID {
+		return true, nil
+	}
+	return r.IsChatAdmin(ctx, message.Chat, message.From)
+}
+
+// IsChatAdmin reports whether a user administers a chat
+func (r *CommandRouter) IsChatAdmin(ctx context.Context, chat botModels.Chat, user *botModels.User) (bool, error) {
+	if chat.Type == botModels.ChatTypePrivate {
+		return true, nil
+	}
+	if user == nil {
+		return false, nil
+	}
+
+	admins, err := r.messenger.GetChatAdministrators(ctx, chat.ID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, admin := range admins {
+		switch {
+		case admin.Owner != nil && admin.Owner.User != nil && admin.Owner.User.ID == user.ID:
+			return true, nil
+		case admin.Administrator != nil && admin.Administrator.User.ID == user.ID:
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Reply sends a plain answer to a command
+func (r *CommandRouter) Reply(ctx context.Context, chatID int64, text string) error {
+	if _, err := r.messenger.SendMessage(ctx, chatID, text); err != nil {
+		return fmt.Errorf("failed to send reply: %w", err)
+	}
+	return nil
+}
+
+// ReplyWithKeyboard sends an answer with an inline keyboard
+func (r *CommandRouter) ReplyWithKeyboard(ctx context.Context, chatID int64, text string, keyboard botModels.InlineKeyboardMarkup) error {
+	if _, err := r.messenger.SendMessageWithOptions(ctx, chatID, text, telegram.SendOptions{Keyboard: &keyboard}); err != nil {
+		return fmt.Errorf("failed to send reply: %w", err)
+	}
+	return nil
+}
+
+func (r *CommandRouter) handleStart(ctx context.Context, req *CommandRequest) error {
+	return r.Reply(ctx, req.ChatID(), startText)
+}
+
+func (r *CommandRouter) handleHelp(ctx context.Context, req *CommandRequest) error {
+	var help strings.Builder
+	help.WriteString("Available commands:\n")
+	for _, command := range r.Commands() {
+		fmt.Fprintf(&help, "/%s - %s", command.Name, command.Description)
+		if command.Admin {
+			help.WriteString(" (admins)")
+		}
+		help.WriteString("\n")
+	}
+	return r.Reply(ctx, req.ChatID(), strings.TrimSuffix(help.String(), "\n"))
+}
+
+// ParseCommand splits "/command@botname args" into its parts, the name is lower cased and
+// mention is empty when the command names no bot
+func ParseCommand(text string) (name, args, mention string, ok bool) {
+	if !strings.HasPrefix(text, "/") {
+		return "", "", "", false
+	}
+
+	head := text[1:]
+	if end := strings.IndexFunc(head, unicode.IsSpace); end >= 0 {
+		head, args = head[:end], head[end+1:]
+	}
+	name, mention, _ = strings.Cut(head, "@")
+	if name == "" {
+		return "", "", "", false
+	}
+
+	return strings.ToLower(name), strings.TrimSpace(args), mention, true
+}
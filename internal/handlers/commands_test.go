@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"testing"
+
+	botModels "github.com/go-telegram/bot/models"
+	"github.com/kriku/kpukbot/internal/clients/telegram"
+	"github.com/kriku/kpukbot/internal/services/callbacks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMessenger records what the bot sends instead of talking to Telegram
+type fakeMessenger struct {
+	sent      []string
+	keyboards []botModels.InlineKeyboardMarkup // Keyboards of sent and edited messages
+	edited    []string
+	answers   []string
+	commands  []botModels.BotCommand
+	admins    []int64
+	chats     map[int64]botModels.ChatFullInfo // Answers of getChat
+}
+
+func (f *fakeMessenger) Start(ctx context.Context) error { return nil }
+
+func (f *fakeMessenger) SendMessage(ctx context.Context, chatID int64, text string) (*botModels.Message, error) {
+	f.sent = append(f.sent, text)
+	return &botModels.Message{Chat: botModels.Chat{ID: chatID}, Text: text}, nil
+}
+
+func (f *fakeMessenger) SendMessageWithOptions(ctx context.Context, chatID int64, text string, opts telegram.SendOptions) ([]*botModels.Message, error) {
+	if opts.Keyboard != nil {
+		f.keyboards = append(f.keyboards, *opts.Keyboard)
+	}
+	message, err := f.SendMessage(ctx, chatID, text)
+	return []*botModels.Message{message}, err
+}
+
+func (f *fakeMessenger) EditMessageText(ctx context.Context, chatID int64, messageID int, text string, keyboard *botModels.InlineKeyboardMarkup) error {
+	f.edited = append(f.edited, text)
+	if keyboard != nil {
+		f.keyboards = append(f.keyboards, *keyboard)
+	}
+	return nil
+}
+
+func (f *fakeMessenger) EditMessageReplyMarkup(ctx context.Context, chatID int64, messageID int, keyboard *botModels.InlineKeyboardMarkup) error {
+	if keyboard != nil {
+		f.keyboards = append(f.keyboards, *keyboard)
+	}
+	return nil
+}
+
+func (f *fakeMessenger) AnswerCallbackQuery(ctx context.Context, callbackQueryID string, text string) error {
+	f.answers = append(f.answers, text)
+	return nil
+}
+
+func (f *fakeMessenger) SendChatAction(ctx context.Context, chatID int64, action botModels.ChatAction) error {
+	return nil
+}
+
+func (f *fakeMessenger) SetMyCommands(ctx context.Context, commands []botModels.BotCommand) error {
+	f.commands = commands
+	return nil
+}
+
+func (f *fakeMessenger) GetChatAdministrators(ctx context.Context, chatID int64) ([]botModels.ChatMember, error) {
+	var admins []botModels.ChatMember
+	for _, id := range f.admins {
+		admins = append(admins, botModels.ChatMember{
+			Type:          botModels.ChatMemberTypeAdministrator,
+			Administrator: &botModels.ChatMemberAdministrator{User: botModels.User{ID: id}},
+		})
+	}
+	return admins, nil
+}
+
+func (f *fakeMessenger) GetChat(ctx context.Context, chatID int64) (*botModels.ChatFullInfo, error) {
+	chat, ok := f.chats[chatID]
+	if !ok {
+		return nil, errors.New("chat not found")
+	}
+	return &chat, nil
+}
+
+func (f *fakeMessenger) DownloadFile(ctx context.Context, fileID string) ([]byte, error) {
+	return nil, errors.New("file not found")
+}
+
+func (f *fakeMessenger) Username() string { return "kpukbot" }
+
+func (f *fakeMessenger) HandleWebhook(ctx context.Context, res http.ResponseWriter, req *http.Request) {
+}
+
+func (f *fakeMessenger) Close() error { return nil }
+
+func newTestRouter() (*CommandRouter, *fakeMessenger) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	messenger := &fakeMessenger{}
+	callbackRouter := callbacks.NewCallbackRouter(logger)
+	callbackRouter.SetMessengerClient(messenger)
+	router := NewCommandRouter(callbackRouter, logger)
+	router.SetMessengerClient(messenger)
+	return router, messenger
+}
+
+func commandMessage(text string) *botModels.Message {
+	return &botModels.Message{ID: 1, Chat: botModels.Chat{ID: 100}, Text: text}
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		text    string
+		name    string
+		args    string
+		mention string
+		ok      bool
+	}{
+		{text: "/help", name: "help", ok: true},
+		{text: "/Queue_Skip @alice", name: "queue_skip", args: "@alice", ok: true},
+		{text: "/help@KpukBot", name: "help", mention: "KpukBot", ok: true},
+		{text: "/settings@kpukbot  interval 5 ", name: "settings", args: "interval 5", mention: "kpukbot", ok: true},
+		{text: "/start\nhello", name: "start", args: "hello", ok: true},
+		{text: "hello /help"},
+		{text: "/"},
+		{text: "/ help"},
+		{text: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			name, args, mention, ok := ParseCommand(tt.text)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.name, name)
+			assert.Equal(t, tt.args, args)
+			assert.Equal(t, tt.mention, mention)
+		})
+	}
+}
+
+func TestCommandRouter_Route(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("dispatches to the registered handler", func(t *testing.T) {
+		router, _ := newTestRouter()
+		var got *CommandRequest
+		router.Register(Command{Name: "echo", Description: "Echo", Handler: func(ctx context.Context, req *CommandRequest) error {
+			got = req
+			return nil
+		}})
+
+		handled, err := router.Route(ctx, commandMessage("/echo@kpukbot hello there"))
+		require.NoError(t, err)
+		assert.True(t, handled)
+		require.NotNil(t, got)
+		assert.Equal(t, "echo", got.Name)
+		assert.Equal(t, "hello there", got.Args)
+		assert.Equal(t, int64(100), got.ChatID())
+	})
+
+	t.Run("plain messages are not handled", func(t *testing.T) {
+		router, messenger := newTestRouter()
+
+		handled, err := router.Route(ctx, commandMessage("hello"))
+		require.NoError(t, err)
+		assert.False(t, handled)
+		assert.Empty(t, messenger.sent)
+	})
+
+	t.Run("commands of other bots are ignored", func(t *testing.T) {
+		router, messenger := newTestRouter()
+
+		handled, err := router.Route(ctx, commandMessage("/help@otherbot"))
+		require.NoError(t, err)
+		assert.True(t, handled)
+		assert.Empty(t, messenger.sent)
+	})
+
+	t.Run("unknown commands point to help", func(t *testing.T) {
+		router, messenger := newTestRouter()
+
+		private := commandMessage("/unknown")
+		private.Chat.Type = botModels.ChatTypePrivate
+		handled, err := router.Route(ctx, private)
+		require.NoError(t, err)
+		assert.True(t, handled)
+
+		handled, err = router.Route(ctx, commandMessage("/unknown@kpukbot"))
+		require.NoError(t, err)
+		assert.True(t, handled)
+
+		require.Len(t, messenger.sent, 2)
+		assert.Contains(t, messenger.sent[0], "/help")
+	})
+
+	t.Run("unknown commands in groups are ignored", func(t *testing.T) {
+		router, messenger := newTestRouter()
+
+		// The command may be meant for another bot of the group
+		handled, err := router.Route(ctx, commandMessage("/unknown"))
+		require.NoError(t, err)
+		assert.True(t, handled)
+		assert.Empty(t, messenger.sent)
+	})
+
+	t.Run("handler errors are returned", func(t *testing.T) {
+		router, _ := newTestRouter()
+		router.Register(Command{Name: "fail", Handler: func(ctx context.Context, req *CommandRequest) error {
+			return errors.New("boom")
+		}})
+
+		handled, err := router.Route(ctx, commandMessage("/fail"))
+		assert.True(t, handled)
+		assert.ErrorContains(t, err, "boom")
+	})
+}
+
+func TestCommandRouter_Help(t *testing.T) {
+	ctx := context.Background()
+	router, messenger := newTestRouter()
+	router.Register(Command{Name: "queue", Description: "Show the question queue", Handler: func(ctx context.Context, req *CommandRequest) error {
+		return nil
+	}})
+
+	_, err := router.Route(ctx, commandMessage("/help"))
+	require.NoError(t, err)
+	require.Len(t, messenger.sent, 1)
+	assert.Equal(t, "Available commands:\n"+
+		"/start - Introduce the bot\n"+
+		"/help - List available commands\n"+
+		"/queue - Show the question queue", messenger.sent[0])
+
+	require.NoError(t, router.RegisterCommands(ctx))
+	assert.Equal(t, []botModels.BotCommand{
+		{Command: "start", Description: "Introduce the bot"},
+		{Command: "help", Description: "List available commands"},
+		{Command: "queue", Description: "Show the question queue"},
+	}, messenger.commands)
+}
+
+func TestCommandRouter_Callback(t *testing.T) {
+	ctx := context.Background()
+	router, messenger := newTestRouter()
+	var got *callbacks.Request
+	router.Register(Command{Name: "vote", Handler: func(ctx context.Context, req *CommandRequest) error {
+		return nil
+	}, Callback: func(ctx context.Context, req *callbacks.Request) (string, error) {
+		got = req
+		return "Thanks!", nil
+	}})
+
+	query := &botModels.CallbackQuery{
+		ID:      "query",
+		Message: botModels.MaybeInaccessibleMessage{Message: &botModels.Message{ID: 5, Chat: botModels.Chat{ID: 100}}},
+		Data:    callbacks.Data("vote", "up"),
+	}
+	require.NoError(t, router.callbacks.Route(ctx, query))
+	require.NotNil(t, got)
+	assert.Equal(t, "up", got.Data)
+	assert.Equal(t, []string{"Thanks!"}, messenger.answers)
+}
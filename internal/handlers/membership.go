@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	botModels "github.com/go-telegram/bot/models"
+	"github.com/kriku/kpukbot/internal/clients/telegram"
+	"github.com/kriku/kpukbot/internal/services/chats"
+	"github.com/kriku/kpukbot/internal/services/users"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MembershipHandler keeps chats and their members in sync with Telegram. my_chat_member updates
+// tell when the bot is added or removed, chat_member updates and the new_chat_members and
+// left_chat_member service messages tell when users join or leave
+type MembershipHandler struct {
+	chatsService *chats.ChatsService
+	usersService *users.UsersService
+	messenger    telegram.MessengerClient
+	logger       *slog.Logger
+}
+
+func NewMembershipHandler(chatsService *chats.ChatsService, usersService *users.UsersService, logger *slog.Logger) *MembershipHandler {
+	return &MembershipHandler{
+		chatsService: chatsService,
+		usersService: usersService,
+		logger:       logger.With("handler", "membership"),
+	}
+}
+
+// SetMessengerClient sets the messenger client (useful for resolving circular dependencies)
+func (h *MembershipHandler) SetMessengerClient(messenger telegram.MessengerClient) {
+	h.messenger = messenger
+}
+
+// HandleBotMembership activates the chat the bot was added to and deactivates the chat it was
+// removed from, in private chats when the user starts or blocks the bot
+func (h *MembershipHandler) HandleBotMembership(ctx context.Context, update *botModels.ChatMemberUpdated) error {
+	wasMember, isMember := isChatMember(update.OldChatMember), isChatMember(update.NewChatMember)
+
+	h.logger.InfoContext(ctx, "Bot membership changed",
+		"chat_id", update.Chat.ID,
+		"old_status", update.OldChatMember.Type,
+		"new_status", update.NewChatMember.Type)
+
+	switch {
+	case isMember:
+		// Promotions update the chat as well, its title may have changed meanwhile
+		return h.saveChat(ctx, update.Chat)
+	case wasMember:
+		err := h.chatsService.SetChatActive(ctx, update.Chat.ID, false)
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		return err
+	default:
+		return nil
+	}
+}
+
+// HandleMembership adds users joining a chat to it and removes leaving and banned users. Telegram
+// only sends chat_member updates to administrators
+func (h *MembershipHandler) HandleMembership(ctx context.Context, update *botModels.ChatMemberUpdated) error {
+	user := chatMemberUser(update.NewChatMember)
+	if user == nil {
+		return nil
+	}
+
+	wasMember, isMember := isChatMember(update.OldChatMember), isChatMember(update.NewChatMember)
+	switch {
+	case isMember && !wasMember:
+		return h.memberJoined(ctx, update.Chat, user)
+	case wasMember && !isMember:
+		return h.memberLeft(ctx, update.Chat.ID, user)
+	default:
+		return nil
+	}
+}
+
+// HandleServiceMessage processes new_chat_members and left_chat_member messages, it reports
+// whether the message was one of them
+func (h *MembershipHandler) HandleServiceMessage(ctx context.Context, message *botModels.Message) (bool, error) {
+	switch {
+	case len(message.NewChatMembers) > 0:
+		for _, user := range message.NewChatMembers {
+			if err := h.memberJoined(ctx, message.Chat, &user); err != nil {
+				return true, err
+			}
+		}
+		return true, nil
+	case message.LeftChatMember != nil:
+		return true, h.memberLeft(ctx, message.Chat.ID, message.LeftChatMember)
+	default:
+		return false, nil
+	}
+}
+
+// memberJoined adds a user to a chat, the user is enqueued when the chat auto-enqueues new users
+func (h *MembershipHandler) memberJoined(ctx context.Context, chat botModels.Chat, user *botModels.User) error {
+	// The bot itself is tracked with my_chat_member, other bots are no members to ask
+	if user.IsBot {
+		return nil
+	}
+
+	// Chats the bot joined before membership was tracked are created on first use
+	if _, err := h.chatsService.GetChat(ctx, chat.ID); status.Code(err) == codes.NotFound {
+		if err := h.saveChat(ctx, chat); err != nil {
+			return err
+		}
+	}
+
+	if err := h.usersService.CreateOrUpdateUser(ctx, user.ID, chat.ID, user.FirstName, user.LastName, user.Username); err != nil {
+		h.logger.WarnContext(ctx, "Failed to save joined user", "user_id", user.ID, "error", err)
+	}
+
+	if err := h.chatsService.AddUserToChat(ctx, chat.ID, user.ID, true); err != nil {
+		return err
+	}
+
+	h.logger.InfoContext(ctx, "User joined chat", "chat_id", chat.ID, "user_id", user.ID)
+	return nil
+}
+
+// memberLeft removes a user from a chat and its question queue
+func (h *MembershipHandler) memberLeft(ctx context.Context, chatID int64, user *botModels.User) error {
+	if user.IsBot {
+		return nil
+	}
+
+	err := h.chatsService.RemoveUserFromChat(ctx, chatID, user.ID)
+	if status.Code(err) == codes.NotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	h.logger.InfoContext(ctx, "User left chat", "chat_id", chatID, "user_id", user.ID)
+	return nil
+}
+
+// saveChat creates or activates a chat, the description is only known to getChat
+func (h *MembershipHandler) saveChat(ctx context.Context, chat botModels.Chat) error {
+	title := chat.Title
+	if title == "" {
+		title = chat.FirstName // Private chats are named after their user
+	}
+
+	description := ""
+	info, err := h.messenger.GetChat(ctx, chat.ID)
+	if err != nil {
+		h.logger.WarnContext(ctx, "Failed to get chat info, saving chat without description", "chat_id", chat.ID, "error", err)
+	} else {
+		description = info.Description
+	}
+
+	if err := h.chatsService.CreateOrUpdateChat(ctx, chat.ID, title, string(chat.Type), description); err != nil {
+		return fmt.Errorf("failed to save chat %d: %w", chat.ID, err)
+	}
+	return nil
+}
+
+// isChatMember reports whether a chat member belongs to the chat, restricted users may or may not
+func isChatMember(member botModels.ChatMember) bool {
+	switch member.Type {
+	case botModels.ChatMemberTypeOwner, botModels.ChatMemberTypeAdministrator, botModels.ChatMemberTypeMember:
+		return true
+	case botModels.ChatMemberTypeRestricted:
+		return member.Restricted != nil && member.Restricted.IsMember
+	default:
+		return false
+	}
+}
+
+// chatMemberUser returns the user of a chat member
+func chatMemberUser(member botModels.ChatMember) *botModels.User {
+	switch {
+	case member.Owner != nil:
+		return member.Owner.User
+	case member.Administrator != nil:
+		return &member.Administrator.User
+	case member.Member != nil:
+		return member.Member.User
+	case member.Restricted != nil:
+		return member.Restricted.User
+	case member.Left != nil:
+		return member.Left.User
+	case member.Banned != nil:
+		return member.Banned.User
+	default:
+		return nil
+	}
+}
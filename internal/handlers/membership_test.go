@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	botModels "github.com/go-telegram/bot/models"
+	"github.com/kriku/kpukbot/internal/models"
+	chatsRepo "github.com/kriku/kpukbot/internal/repository/chats"
+	usersRepo "github.com/kriku/kpukbot/internal/repository/users"
+	"github.com/kriku/kpukbot/internal/services/chats"
+	"github.com/kriku/kpukbot/internal/services/users"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var membershipTestChat = botModels.Chat{ID: -100, Type: botModels.ChatTypeSupergroup, Title: "Friends"}
+
+func newMembershipTest() (*MembershipHandler, *fakeMessenger, *chats.ChatsService, *users.UsersService) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	messenger := &fakeMessenger{chats: map[int64]botModels.ChatFullInfo{
+		membershipTestChat.ID: {ID: membershipTestChat.ID, Description: "Old friends"},
+	}}
+	chatsService := chats.NewChatsService(chatsRepo.NewMemoryChatsRepository(), logger)
+	usersService := users.NewUsersService(usersRepo.NewMemoryUsersRepository(), logger)
+
+	handler := NewMembershipHandler(chatsService, usersService, logger)
+	handler.SetMessengerClient(messenger)
+	return handler, messenger, chatsService, usersService
+}
+
+func member(user *botModels.User) botModels.ChatMember {
+	return botModels.ChatMember{Type: botModels.ChatMemberTypeMember, Member: &botModels.ChatMemberMember{User: user}}
+}
+
+func leftMember(user *botModels.User) botModels.ChatMember {
+	return botModels.ChatMember{Type: botModels.ChatMemberTypeLeft, Left: &botModels.ChatMemberLeft{User: user}}
+}
+
+func bannedMember(user *botModels.User) botModels.ChatMember {
+	return botModels.ChatMember{Type: botModels.ChatMemberTypeBanned, Banned: &botModels.ChatMemberBanned{User: user}}
+}
+
+func TestMembershipHandler_BotMembership(t *testing.T) {
+	ctx := context.Background()
+	handler, _, chatsService, _ := newMembershipTest()
+	bot := &botModels.User{ID: 99, IsBot: true}
+
+	added := &botModels.ChatMemberUpdated{Chat: membershipTestChat, OldChatMember: leftMember(bot), NewChatMember: member(bot)}
+	require.NoError(t, handler.HandleBotMembership(ctx, added))
+
+	chat, err := chatsService.GetChat(ctx, membershipTestChat.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Friends", chat.Title)
+	assert.Equal(t, "supergroup", chat.Type)
+	assert.Equal(t, "Old friends", chat.Description)
+	assert.True(t, chat.IsActive)
+
+	removed := &botModels.ChatMemberUpdated{Chat: membershipTestChat, OldChatMember: member(bot), NewChatMember: bannedMember(bot)}
+	require.NoError(t, handler.HandleBotMembership(ctx, removed))
+
+	chat, err = chatsService.GetChat(ctx, membershipTestChat.ID)
+	require.NoError(t, err)
+	assert.False(t, chat.IsActive)
+
+	// Removals from chats that were never stored are ignored
+	unknown := *removed
+	unknown.Chat.ID = -200
+	require.NoError(t, handler.HandleBotMembership(ctx, &unknown))
+}
+
+func TestMembershipHandler_Membership(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("joining users are added and enqueued", func(t *testing.T) {
+		handler, _, chatsService, usersService := newMembershipTest()
+		user := &botModels.User{ID: 1, FirstName: "Ann", Username: "ann"}
+
+		joined := &botModels.ChatMemberUpdated{Chat: membershipTestChat, OldChatMember: leftMember(user), NewChatMember: member(user)}
+		require.NoError(t, handler.HandleMembership(ctx, joined))
+
+		chat, err := chatsService.GetChat(ctx, membershipTestChat.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Friends", chat.Title)
+		assert.Equal(t, []int64{1}, chat.UserIDs)
+		require.Len(t, chat.QuestionQueue, 1)
+		assert.Equal(t, models.QueueStatusWaiting, chat.QuestionQueue[0].Status)
+
+		saved, err := usersService.GetUser(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, "ann", saved.Username)
+
+		left := &botModels.ChatMemberUpdated{Chat: membershipTestChat, OldChatMember: member(user), NewChatMember: leftMember(user)}
+		require.NoError(t, handler.HandleMembership(ctx, left))
+
+		chat, err = chatsService.GetChat(ctx, membershipTestChat.ID)
+		require.NoError(t, err)
+		assert.Empty(t, chat.UserIDs)
+		assert.Empty(t, chat.QuestionQueue)
+	})
+
+	t.Run("auto-enqueue can be turned off", func(t *testing.T) {
+		handler, _, chatsService, _ := newMembershipTest()
+		settings := models.DefaultChatSettings(membershipTestChat.ID)
+		settings.AutoEnqueueNewUsers = false
+		require.NoError(t, chatsService.UpdateChatSettings(ctx, *settings))
+
+		user := &botModels.User{ID: 1}
+		joined := &botModels.ChatMemberUpdated{Chat: membershipTestChat, OldChatMember: leftMember(user), NewChatMember: member(user)}
+		require.NoError(t, handler.HandleMembership(ctx, joined))
+
+		chat, err := chatsService.GetChat(ctx, membershipTestChat.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{1}, chat.UserIDs)
+		assert.Empty(t, chat.QuestionQueue)
+	})
+
+	t.Run("service messages", func(t *testing.T) {
+		handler, _, chatsService, _ := newMembershipTest()
+
+		handled, err := handler.HandleServiceMessage(ctx, &botModels.Message{
+			Chat:           membershipTestChat,
+			NewChatMembers: []botModels.User{{ID: 1}, {ID: 2}, {ID: 3, IsBot: true}},
+		})
+		require.NoError(t, err)
+		assert.True(t, handled)
+
+		handled, err = handler.HandleServiceMessage(ctx, &botModels.Message{
+			Chat:           membershipTestChat,
+			LeftChatMember: &botModels.User{ID: 1},
+		})
+		require.NoError(t, err)
+		assert.True(t, handled)
+
+		chat, err := chatsService.GetChat(ctx, membershipTestChat.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{2}, chat.UserIDs)
+
+		handled, err = handler.HandleServiceMessage(ctx, &botModels.Message{Chat: membershipTestChat, Text: "hi"})
+		require.NoError(t, err)
+		assert.False(t, handled)
+	})
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/kriku/kpukbot/internal/services/messages"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MessageCommands manage the stored chat history. Telegram does not tell bots about deleted
+// messages, /forget is how a chat takes a message out of the LLM context
+type MessageCommands struct {
+	messagesService *messages.TelegramMessagesService
+	router          *CommandRouter
+	logger          *slog.Logger
+}
+
+func NewMessageCommands(
+	messagesService *messages.TelegramMessagesService,
+	router *CommandRouter,
+	logger *slog.Logger,
+) *MessageCommands {
+	return &MessageCommands{
+		messagesService: messagesService,
+		router:          router,
+		logger:          logger.With("handler", "message_commands"),
+	}
+}
+
+// Commands returns the message commands for registration with the router
+func (c *MessageCommands) Commands() []Command {
+	return []Command{
+		{Name: "forget", Description: "Reply to a message to leave it out of the conversation", Handler: c.handleForget},
+	}
+}
+
+// handleForget marks the replied message deleted, users may forget their own messages and admins
+// any message
+func (c *MessageCommands) handleForget(ctx context.Context, req *CommandRequest) error {
+	chatID := req.ChatID()
+	target := req.Message.ReplyToMessage
+	if target == nil {
+		return c.router.Reply(ctx, chatID, "Reply to a message with /forget to leave it out of the conversation.")
+	}
+
+	own := req.Message.From != nil && target.From != nil && target.From.ID == req.Message.From.ID
+	if !own {
+		admin, err := c.router.IsAdmin(ctx, req.Message)
+		if err != nil {
+			return err
+		}
+		if !admin {
+			return c.router.Reply(ctx, chatID, "Only chat administrators can make me forget messages of others.")
+		}
+	}
+
+	err := c.messagesService.MarkDeleted(ctx, chatID, target.ID)
+	if status.Code(err) == codes.NotFound {
+		return c.router.Reply(ctx, chatID, "I don't remember that message anyway.")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.router.Reply(ctx, chatID, "Done, I'll leave that message out of the conversation.")
+}
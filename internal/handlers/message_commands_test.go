@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	botModels "github.com/go-telegram/bot/models"
+	"github.com/kriku/kpukbot/internal/models"
+	messagesRepo "github.com/kriku/kpukbot/internal/repository/messages"
+	"github.com/kriku/kpukbot/internal/services/messages"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageCommands_Forget(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	chat := botModels.Chat{ID: -100, Type: botModels.ChatTypeSupergroup}
+
+	router, messenger := newTestRouter()
+	messenger.admins = []int64{1}
+	repo := messagesRepo.NewMemoryMessagesRepository()
+	router.Register(NewMessageCommands(messages.NewTelegramMessagesService(repo, logger), router, logger).Commands()...)
+
+	require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: 10, ChatID: chat.ID, UserID: 2, Text: "mine"}))
+	require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: 11, ChatID: chat.ID, UserID: 3, Text: "theirs"}))
+
+	forget := func(from int64, target *botModels.Message) string {
+		handled, err := router.Route(ctx, &botModels.Message{
+			ID:             20,
+			Chat:           chat,
+			From:           &botModels.User{ID: from},
+			Text:           "/forget",
+			ReplyToMessage: target,
+		})
+		require.NoError(t, err)
+		require.True(t, handled)
+		return messenger.sent[len(messenger.sent)-1]
+	}
+	deleted := func(id int) bool {
+		message, err := repo.GetMessage(ctx, chat.ID, id)
+		require.NoError(t, err)
+		return message.Deleted
+	}
+
+	assert.Equal(t, "Reply to a message with /forget to leave it out of the conversation.", forget(2, nil))
+
+	reply := forget(2, &botModels.Message{ID: 11, From: &botModels.User{ID: 3}})
+	assert.Equal(t, "Only chat administrators can make me forget messages of others.", reply)
+	assert.False(t, deleted(11))
+
+	reply = forget(2, &botModels.Message{ID: 10, From: &botModels.User{ID: 2}})
+	assert.Equal(t, "Done, I'll leave that message out of the conversation.", reply)
+	assert.True(t, deleted(10))
+
+	forget(1, &botModels.Message{ID: 11, From: &botModels.User{ID: 3}})
+	assert.True(t, deleted(11))
+
+	assert.Equal(t, "I don't remember that message anyway.", forget(1, &botModels.Message{ID: 99}))
+}
@@ -2,34 +2,133 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/go-telegram/bot"
 	botModels "github.com/go-telegram/bot/models"
+	"github.com/kriku/kpukbot/internal/config"
 	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/repository/processed"
+	"github.com/kriku/kpukbot/internal/services/callbacks"
 	"github.com/kriku/kpukbot/internal/services/orchestrator"
 )
 
 type OrchestratorHandler struct {
 	orchestrator *orchestrator.OrchestratorService
+	commands     *CommandRouter
+	callbacks    *callbacks.CallbackRouter
+	membership   *MembershipHandler
+	processed    processed.ProcessedUpdatesRepository
+	config       config.IdempotencyConfig
+	chatLocks    *chatLocks
 	logger       *slog.Logger
 }
 
 func NewOrchestratorHandler(
 	orchestrator *orchestrator.OrchestratorService,
+	commands *CommandRouter,
+	callbacks *callbacks.CallbackRouter,
+	membership *MembershipHandler,
+	processed processed.ProcessedUpdatesRepository,
+	config config.IdempotencyConfig,
 	logger *slog.Logger,
-) bot.HandlerFunc {
-	handler := &OrchestratorHandler{
+) *OrchestratorHandler {
+	return &OrchestratorHandler{
 		orchestrator: orchestrator,
+		commands:     commands,
+		callbacks:    callbacks,
+		membership:   membership,
+		processed:    processed,
+		config:       config,
+		chatLocks:    newChatLocks(),
 		logger:       logger.With("handler", "orchestrator"),
 	}
-
-	return handler.Handle
 }
 
+// Handle is the bot handler of polling and synchronous webhook mode, failures are logged right away
 func (h *OrchestratorHandler) Handle(ctx context.Context, b *bot.Bot, update *botModels.Update) {
+	if err := h.ProcessUpdate(ctx, update); err != nil {
+		h.ProcessFailed(ctx, update, err)
+	}
+}
+
+// ProcessUpdate runs an update through the orchestrator, a returned error may be retried.
+// Telegram redelivers updates it got no timely answer for, so every update_id is claimed first:
+// done updates and updates another attempt is working on are skipped, and a retry of a
+// partially processed update never replies a second time. Within an instance updates of the same
+// chat are processed one at a time in arrival order, across instances there is no ordering and
+// only repository transactions keep threads and queues consistent
+func (h *OrchestratorHandler) ProcessUpdate(ctx context.Context, update *botModels.Update) error {
+	if chatID := models.UpdateChatID(update); chatID != 0 {
+		unlock, err := h.chatLocks.lock(ctx, chatID)
+		if err != nil {
+			return fmt.Errorf("failed to wait for chat %d: %w", chatID, err)
+		}
+		defer unlock()
+	}
+
+	record, claimed, err := h.processed.Claim(ctx, update.ID, h.config.Lease, h.config.TTL)
+	if err != nil {
+		return fmt.Errorf("failed to claim update %d: %w", update.ID, err)
+	}
+	if !claimed {
+		h.logger.InfoContext(ctx, "Skipping duplicate update",
+			"update_id", update.ID,
+			"status", record.Status)
+		return nil
+	}
+
+	if record.Replied {
+		// Only the bookkeeping after the reply failed, answering again would duplicate it
+		h.logger.InfoContext(ctx, "Update already answered, completing it", "update_id", update.ID)
+		return h.complete(ctx, update.ID)
+	}
+
+	ctx = orchestrator.WithReplyHook(ctx, func(ctx context.Context) error {
+		return h.processed.MarkReplied(ctx, update.ID)
+	})
+
+	if err := h.processMessage(ctx, update); err != nil {
+		if err := h.processed.Release(ctx, update.ID); err != nil {
+			h.logger.WarnContext(ctx, "Failed to release update", "update_id", update.ID, "error", err)
+		}
+		return err
+	}
+
+	return h.complete(ctx, update.ID)
+}
+
+// complete marks an update as done, a failure only means a redelivery is processed again
+func (h *OrchestratorHandler) complete(ctx context.Context, updateID int64) error {
+	if err := h.processed.Complete(ctx, updateID); err != nil {
+		h.logger.WarnContext(ctx, "Failed to complete update", "update_id", updateID, "error", err)
+	}
+	return nil
+}
+
+// processMessage runs the message of an update through the orchestrator
+func (h *OrchestratorHandler) processMessage(ctx context.Context, update *botModels.Update) error {
+	// Buttons of inline keyboards sent by commands and strategies
+	if update.CallbackQuery != nil {
+		return h.callbacks.Route(ctx, update.CallbackQuery)
+	}
+
+	// The bot or a user joined or left a chat
+	if update.MyChatMember != nil {
+		return h.membership.HandleBotMembership(ctx, update.MyChatMember)
+	}
+	if update.ChatMember != nil {
+		return h.membership.HandleMembership(ctx, update.ChatMember)
+	}
+
+	if update.EditedMessage != nil {
+		return h.processEditedMessage(ctx, update.EditedMessage)
+	}
+
 	if update.Message == nil {
-		return
+		return nil
 	}
 
 	h.logger.InfoContext(ctx, "Received Telegram update",
@@ -37,32 +136,54 @@ func (h *OrchestratorHandler) Handle(ctx context.Context, b *bot.Bot, update *bo
 		"chat_id", update.Message.Chat.ID,
 		"text", update.Message.Text)
 
+	if handled, err := h.membership.HandleServiceMessage(ctx, update.Message); handled {
+		return err
+	}
+
+	// Commands are answered right away and never reach the LLM pipeline
+	if handled, err := h.commands.Route(ctx, update.Message); handled {
+		return err
+	}
+
 	message := models.NewMessageFromTelegramUpdate(update)
 	if message == nil {
 		h.logger.WarnContext(ctx, "Failed to convert message")
-		return
+		return nil
 	}
 
-	_, err := b.SendChatAction(ctx, &bot.SendChatActionParams{
-		ChatID: update.Message.Chat.ID,
-		Action: botModels.ChatActionTyping,
-	})
+	if err := h.orchestrator.ProcessMessage(ctx, message); err != nil {
+		return fmt.Errorf("failed to process message %d: %w", message.ID, err)
+	}
 
-	if err != nil {
-		h.logger.ErrorContext(ctx, "Error sending chat typing:", "error", err)
+	return nil
+}
+
+// processEditedMessage updates the stored version of an edited message, edits are never answered
+func (h *OrchestratorHandler) processEditedMessage(ctx context.Context, msg *botModels.Message) error {
+	h.logger.InfoContext(ctx, "Received edited message",
+		"message_id", msg.ID,
+		"chat_id", msg.Chat.ID,
+		"text", msg.Text)
+
+	// Commands are not stored and an edit does not run them again
+	if _, _, _, ok := ParseCommand(msg.Text); ok {
+		return nil
 	}
 
-	if err := h.orchestrator.ProcessMessage(ctx, message); err != nil {
-		h.logger.ErrorContext(ctx, "Failed to process message",
-			"error", err,
-			"message_id", message.ID)
-
-		_, sendErr := b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: update.Message.Chat.ID,
-			Text:   "Sorry, I encountered an error processing your message. Please try again.",
-		})
-		if sendErr != nil {
-			h.logger.ErrorContext(ctx, "Failed to send error message", "error", sendErr)
-		}
+	edited := models.NewMessageFromTelegramMessage(msg)
+	editedAt := time.Unix(int64(msg.EditDate), 0)
+	if err := h.orchestrator.ProcessEditedMessage(ctx, edited, editedAt); err != nil {
+		return fmt.Errorf("failed to process edited message %d: %w", edited.ID, err)
 	}
+
+	return nil
+}
+
+// ProcessFailed logs an update that could not be processed. The chat is not told, the bot rather
+// stays quiet than posts an error
+func (h *OrchestratorHandler) ProcessFailed(ctx context.Context, update *botModels.Update, err error) {
+	h.logger.ErrorContext(ctx, "Failed to process update",
+		"update_id", update.ID,
+		"chat_id", models.UpdateChatID(update),
+		"error", err)
 }
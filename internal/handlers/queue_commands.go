@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode/utf16"
+
+	botModels "github.com/go-telegram/bot/models"
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/services/chats"
+	"github.com/kriku/kpukbot/internal/services/users"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// queueStatusLabels are the queue entry statuses as shown in chats
+var queueStatusLabels = map[string]string{
+	models.QueueStatusWaiting:   "waiting",
+	models.QueueStatusAsking:    "being asked",
+	models.QueueStatusCompleted: "answered",
+	models.QueueStatusSkipped:   "skipped",
+}
+
+// QueueCommands exposes the question queue of a chat as bot commands
+type QueueCommands struct {
+	chatsService *chats.ChatsService
+	usersService *users.UsersService
+	router       *CommandRouter
+	logger       *slog.Logger
+}
+
+func NewQueueCommands(
+	chatsService *chats.ChatsService,
+	usersService *users.UsersService,
+	router *CommandRouter,
+	logger *slog.Logger,
+) *QueueCommands {
+	return &QueueCommands{
+		chatsService: chatsService,
+		usersService: usersService,
+		router:       router,
+		logger:       logger.With("handler", "queue_commands"),
+	}
+}
+
+// Commands returns the queue commands for registration with the router
+func (c *QueueCommands) Commands() []Command {
+	return []Command{
+		{Name: "queue", Description: "Show the question queue", Handler: c.handleQueue},
+		{Name: "queue_join", Description: "Join the question queue", Handler: c.handleJoin},
+		{Name: "queue_leave", Description: "Leave the question queue", Handler: c.handleLeave},
+		{Name: "queue_skip", Description: "Skip a user this round, e.g. /queue_skip @user", Admin: true, Handler: c.handleSkip},
+		{Name: "queue_reset", Description: "Clear answered entries, /queue_reset full rebuilds the queue", Admin: true, Handler: c.handleReset},
+	}
+}
+
+func (c *QueueCommands) handleQueue(ctx context.Context, req *CommandRequest) error {
+	chat, err := c.chatsService.GetChat(ctx, req.ChatID())
+	if status.Code(err) == codes.NotFound {
+		return c.router.Reply(ctx, req.ChatID(), "The question queue is empty. Join it with /queue_join.")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.router.Reply(ctx, req.ChatID(), c.renderQueue(ctx, chat))
+}
+
+func (c *QueueCommands) handleJoin(ctx context.Context, req *CommandRequest) error {
+	chatID := req.ChatID()
+	if req.Message.From == nil {
+		return nil
+	}
+	user := req.Message.From
+
+	settings, err := c.chatsService.GetChatSettings(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if !settings.EnableQuestionRounds {
+		return c.router.Reply(ctx, chatID, "Question rounds are disabled in this chat.")
+	}
+
+	if _, err := c.chatsService.GetUserQueuePosition(ctx, chatID, user.ID); err == nil {
+		return c.router.Reply(ctx, chatID, fmt.Sprintf("%s is already waiting in the question queue.", telegramUserName(user)))
+	}
+
+	// Creates the chat on first use
+	if err := c.chatsService.AddUserToChat(ctx, chatID, user.ID, false); err != nil {
+		return err
+	}
+
+	chat, err := c.chatsService.GetChat(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if settings.MaxQueueSize > 0 && waitingCount(chat.QuestionQueue) >= settings.MaxQueueSize {
+		return c.router.Reply(ctx, chatID, fmt.Sprintf("The question queue is full (%d users).", settings.MaxQueueSize))
+	}
+
+	if err := c.chatsService.EnqueueUser(ctx, chatID, user.ID); err != nil {
+		return err
+	}
+
+	position, err := c.chatsService.GetUserQueuePosition(ctx, chatID, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.router.Reply(ctx, chatID, fmt.Sprintf("%s joined the question queue at position %d.", telegramUserName(user), position+1))
+}
+
+func (c *QueueCommands) handleLeave(ctx context.Context, req *CommandRequest) error {
+	chatID := req.ChatID()
+	if req.Message.From == nil {
+		return nil
+	}
+	user := req.Message.From
+
+	if !c.inQueue(ctx, chatID, user.ID) {
+		return c.router.Reply(ctx, chatID, fmt.Sprintf("%s is not in the question queue.", telegramUserName(user)))
+	}
+
+	if err := c.chatsService.DequeueUser(ctx, chatID, user.ID); err != nil {
+		return err
+	}
+
+	return c.router.Reply(ctx, chatID, fmt.Sprintf("%s left the question queue.", telegramUserName(user)))
+}
+
+func (c *QueueCommands) handleSkip(ctx context.Context, req *CommandRequest) error {
+	chatID := req.ChatID()
+
+	chat, err := c.chatsService.GetChat(ctx, chatID)
+	if status.Code(err) == codes.NotFound {
+		return c.router.Reply(ctx, chatID, "The question queue is empty.")
+	}
+	if err != nil {
+		return err
+	}
+
+	userID, ok := c.resolveTarget(ctx, chat, req)
+	if !ok {
+		return c.router.Reply(ctx, chatID, "Tell me whom to skip: /queue_skip @user, or reply to their message with /queue_skip.")
+	}
+
+	if !c.inQueue(ctx, chatID, userID) {
+		return c.router.Reply(ctx, chatID, fmt.Sprintf("%s is not in the question queue.", c.userName(ctx, userID)))
+	}
+
+	if err := c.chatsService.SkipUser(ctx, chatID, userID, "skipped by admin"); err != nil {
+		return err
+	}
+	c.logger.InfoContext(ctx, "User skipped by admin", "chat_id", chatID, "user_id", userID)
+
+	return c.router.Reply(ctx, chatID, fmt.Sprintf("%s is skipped this round.", c.userName(ctx, userID)))
+}
+
+func (c *QueueCommands) handleReset(ctx context.Context, req *CommandRequest) error {
+	chatID := req.ChatID()
+	fullReset := strings.EqualFold(req.Args, "full")
+
+	if _, err := c.chatsService.GetChat(ctx, chatID); status.Code(err) == codes.NotFound {
+		return c.router.Reply(ctx, chatID, "The question queue is empty.")
+	}
+
+	if err := c.chatsService.ResetQueue(ctx, chatID, fullReset); err != nil {
+		return err
+	}
+
+	if fullReset {
+		return c.router.Reply(ctx, chatID, "The question queue was rebuilt from all chat members.")
+	}
+	return c.router.Reply(ctx, chatID, "Answered and skipped entries were removed from the question queue.")
+}
+
+// renderQueue lists the queue entries of a chat with their statuses
+func (c *QueueCommands) renderQueue(ctx context.Context, chat *models.Chat) string {
+	if len(chat.QuestionQueue) == 0 {
+		return "The question queue is empty. Join it with /queue_join."
+	}
+
+	var text strings.Builder
+	text.WriteString("Question queue:")
+	for i, entry := range chat.QuestionQueue {
+		label, ok := queueStatusLabels[entry.Status]
+		if !ok {
+			label = entry.Status
+		}
+		fmt.Fprintf(&text, "\n%d. %s - %s", i+1, c.userName(ctx, entry.UserID), label)
+	}
+	return text.String()
+}
+
+// resolveTarget finds the user a command is about: a mention with or without username
+// in the arguments, or the author of the replied message
+func (c *QueueCommands) resolveTarget(ctx context.Context, chat *models.Chat, req *CommandRequest) (int64, bool) {
+	message := req.Message
+
+	// Users without a username are mentioned by a text mention that carries the user
+	for _, entity := range message.Entities {
+		if entity.Type == botModels.MessageEntityTypeTextMention && entity.User != nil {
+			return entity.User.ID, true
+		}
+	}
+
+	if username, ok := mentionedUsername(message); ok {
+		for _, userID := range chatUserIDs(chat) {
+			user, err := c.usersService.GetUser(ctx, userID)
+			if err == nil && user != nil && strings.EqualFold(user.Username, username) {
+				return userID, true
+			}
+		}
+		return 0, false
+	}
+
+	if message.ReplyToMessage != nil && message.ReplyToMessage.From != nil {
+		return message.ReplyToMessage.From.ID, true
+	}
+
+	return 0, false
+}
+
+// inQueue reports whether a user has an entry in the queue of a chat
+func (c *QueueCommands) inQueue(ctx context.Context, chatID, userID int64) bool {
+	chat, err := c.chatsService.GetChat(ctx, chatID)
+	if err != nil {
+		return false
+	}
+
+	for _, entry := range chat.QuestionQueue {
+		if entry.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// userName returns the display name of a known user
+func (c *QueueCommands) userName(ctx context.Context, userID int64) string {
+	user, err := c.usersService.GetUser(ctx, userID)
+	if err != nil || user == nil {
+		return fmt.Sprintf("user %d", userID)
+	}
+
+	switch {
+	case user.Username != "":
+		return "@" + user.Username
+	case user.FirstName != "":
+		return strings.TrimSpace(user.FirstName + " " + user.LastName)
+	default:
+		return fmt.Sprintf("user %d", userID)
+	}
+}
+
+// mentionedUsername returns the first @username mentioned in a message
+func mentionedUsername(message *botModels.Message) (string, bool) {
+	// Entity offsets count UTF-16 code units
+	text := utf16.Encode([]rune(message.Text))
+	for _, entity := range message.Entities {
+		if entity.Type != botModels.MessageEntityTypeMention || entity.Offset+entity.Length > len(text) {
+			continue
+		}
+		mention := string(utf16.Decode(text[entity.Offset : entity.Offset+entity.Length]))
+		return strings.TrimPrefix(mention, "@"), true
+	}
+
+	// Commands typed by hand may come without entities
+	for i, field := range strings.Fields(message.Text) {
+		if i > 0 && strings.HasPrefix(field, "@") && len(field) > 1 {
+			return field[1:], true
+		}
+	}
+	return "", false
+}
+
+// chatUserIDs returns the members and queued users of a chat
+func chatUserIDs(chat *models.Chat) []int64 {
+	ids := append([]int64{}, chat.UserIDs...)
+	for _, entry := range chat.QuestionQueue {
+		ids = append(ids, entry.UserID)
+	}
+	return ids
+}
+
+// telegramUserName returns the display name of a Telegram user
+func telegramUserName(user *botModels.User) string {
+	if user.Username != "" {
+		return "@" + user.Username
+	}
+	return strings.TrimSpace(user.FirstName + " " + user.LastName)
+}
+
+// waitingCount counts the users waiting for a question
+func waitingCount(queue []models.QueueEntry) int {
+	count := 0
+	for _, entry := range queue {
+		if entry.Status == models.QueueStatusWaiting {
+			count++
+		}
+	}
+	return count
+}
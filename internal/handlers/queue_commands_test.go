@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	botModels "github.com/go-telegram/bot/models"
+	"github.com/kriku/kpukbot/internal/models"
+	chatsRepo "github.com/kriku/kpukbot/internal/repository/chats"
+	usersRepo "github.com/kriku/kpukbot/internal/repository/users"
+	"github.com/kriku/kpukbot/internal/services/chats"
+	"github.com/kriku/kpukbot/internal/services/users"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const queueTestChatID = int64(-100)
+
+type queueTestEnv struct {
+	router       *CommandRouter
+	messenger    *fakeMessenger
+	chatsService *chats.ChatsService
+	usersService *users.UsersService
+}
+
+func newQueueTestEnv(t *testing.T) *queueTestEnv {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	router, messenger := newTestRouter()
+	chatsService := chats.NewChatsService(chatsRepo.NewMemoryChatsRepository(), logger)
+	usersService := users.NewUsersService(usersRepo.NewMemoryUsersRepository(), logger)
+
+	router.Register(NewQueueCommands(chatsService, usersService, router, logger).Commands()...)
+
+	return &queueTestEnv{
+		router:       router,
+		messenger:    messenger,
+		chatsService: chatsService,
+		usersService: usersService,
+	}
+}
+
+// send routes a command from a user of the test group and returns the bot's reply
+func (e *queueTestEnv) send(t *testing.T, from *botModels.User, text string) string {
+	message := &botModels.Message{
+		ID:   len(e.messenger.sent) + 1,
+		Chat: botModels.Chat{ID: queueTestChatID, Type: botModels.ChatTypeSupergroup},
+		From: from,
+		Text: text,
+	}
+	return e.route(t, message)
+}
+
+func (e *queueTestEnv) route(t *testing.T, message *botModels.Message) string {
+	sent := len(e.messenger.sent)
+	handled, err := e.router.Route(context.Background(), message)
+	require.NoError(t, err)
+	require.True(t, handled)
+	require.Len(t, e.messenger.sent, sent+1)
+	return e.messenger.sent[sent]
+}
+
+func (e *queueTestEnv) addUser(t *testing.T, user *botModels.User) {
+	require.NoError(t, e.usersService.CreateOrUpdateUser(context.Background(),
+		user.ID, queueTestChatID, user.FirstName, user.LastName, user.Username))
+}
+
+func TestQueueCommands(t *testing.T) {
+	alice := &botModels.User{ID: 1, FirstName: "Alice", Username: "alice"}
+	bob := &botModels.User{ID: 2, FirstName: "Bob"}
+	admin := &botModels.User{ID: 3, FirstName: "Admin", Username: "admin"}
+
+	t.Run("join, show and leave the queue", func(t *testing.T) {
+		env := newQueueTestEnv(t)
+		env.addUser(t, alice)
+		env.addUser(t, bob)
+
+		assert.Equal(t, "The question queue is empty. Join it with /queue_join.", env.send(t, alice, "/queue"))
+
+		assert.Equal(t, "@alice joined the question queue at position 1.", env.send(t, alice, "/queue_join"))
+		assert.Equal(t, "Bob joined the question queue at position 2.", env.send(t, bob, "/queue_join"))
+		assert.Equal(t, "@alice is already waiting in the question queue.", env.send(t, alice, "/queue_join"))
+
+		assert.Equal(t, "Question queue:\n1. @alice - waiting\n2. Bob - waiting", env.send(t, bob, "/queue"))
+
+		assert.Equal(t, "@alice left the question queue.", env.send(t, alice, "/queue_leave"))
+		assert.Equal(t, "@alice is not in the question queue.", env.send(t, alice, "/queue_leave"))
+		assert.Equal(t, "Question queue:\n1. Bob - waiting", env.send(t, bob, "/queue"))
+	})
+
+	t.Run("join respects the chat settings", func(t *testing.T) {
+		env := newQueueTestEnv(t)
+		ctx := context.Background()
+
+		settings := models.DefaultChatSettings(queueTestChatID)
+		settings.MaxQueueSize = 1
+		require.NoError(t, env.chatsService.UpdateChatSettings(ctx, *settings))
+
+		env.send(t, alice, "/queue_join")
+		assert.Equal(t, "The question queue is full (1 users).", env.send(t, bob, "/queue_join"))
+
+		settings.EnableQuestionRounds = false
+		require.NoError(t, env.chatsService.UpdateChatSettings(ctx, *settings))
+		assert.Equal(t, "Question rounds are disabled in this chat.", env.send(t, bob, "/queue_join"))
+	})
+
+	t.Run("skip is restricted to administrators", func(t *testing.T) {
+		env := newQueueTestEnv(t)
+		env.messenger.admins = []int64{admin.ID}
+		env.addUser(t, alice)
+		env.send(t, alice, "/queue_join")
+
+		assert.Equal(t, "Only chat administrators can use /queue_skip.", env.send(t, bob, "/queue_skip @alice"))
+
+		assert.Equal(t, "@alice is skipped this round.", env.send(t, admin, "/queue_skip @alice"))
+		assert.Equal(t, "Question queue:\n1. @alice - skipped", env.send(t, admin, "/queue"))
+	})
+
+	t.Run("skip resolves the replied user", func(t *testing.T) {
+		env := newQueueTestEnv(t)
+		env.messenger.admins = []int64{admin.ID}
+		env.addUser(t, bob)
+		env.send(t, bob, "/queue_join")
+
+		message := &botModels.Message{
+			ID:             10,
+			Chat:           botModels.Chat{ID: queueTestChatID, Type: botModels.ChatTypeSupergroup},
+			From:           admin,
+			Text:           "/queue_skip",
+			ReplyToMessage: &botModels.Message{ID: 9, From: bob},
+		}
+		assert.Equal(t, "Bob is skipped this round.", env.route(t, message))
+	})
+
+	t.Run("skip without a target asks for one", func(t *testing.T) {
+		env := newQueueTestEnv(t)
+		env.messenger.admins = []int64{admin.ID}
+		env.send(t, alice, "/queue_join")
+
+		assert.Contains(t, env.send(t, admin, "/queue_skip"), "Tell me whom to skip")
+		assert.Contains(t, env.send(t, admin, "/queue_skip @nobody"), "Tell me whom to skip")
+	})
+
+	t.Run("reset removes skipped entries", func(t *testing.T) {
+		env := newQueueTestEnv(t)
+		env.messenger.admins = []int64{admin.ID}
+		env.addUser(t, alice)
+		env.addUser(t, bob)
+		env.send(t, alice, "/queue_join")
+		env.send(t, bob, "/queue_join")
+		env.send(t, admin, "/queue_skip @alice")
+
+		assert.Equal(t, "Only chat administrators can use /queue_reset.", env.send(t, bob, "/queue_reset"))
+		assert.Equal(t, "Answered and skipped entries were removed from the question queue.", env.send(t, admin, "/queue_reset"))
+		assert.Equal(t, "Question queue:\n1. Bob - waiting", env.send(t, admin, "/queue"))
+	})
+}
+
+func TestCommandRouter_IsAdmin(t *testing.T) {
+	ctx := context.Background()
+	router, messenger := newTestRouter()
+	messenger.admins = []int64{3}
+
+	group := botModels.Chat{ID: -100, Type: botModels.ChatTypeSupergroup}
+
+	tests := []struct {
+		name    string
+		message *botModels.Message
+		admin   bool
+	}{
+		{
+			name:    "private chat",
+			message: &botModels.Message{Chat: botModels.Chat{ID: 1, Type: botModels.ChatTypePrivate}, From: &botModels.User{ID: 1}},
+			admin:   true,
+		},
+		{
+			name:    "anonymous administrator",
+			message: &botModels.Message{Chat: group, SenderChat: &botModels.Chat{ID: -100}},
+			admin:   true,
+		},
+		{
+			name:    "administrator",
+			message: &botModels.Message{Chat: group, From: &botModels.User{ID: 3}},
+			admin:   true,
+		},
+		{
+			name:    "member",
+			message: &botModels.Message{Chat: group, From: &botModels.User{ID: 4}},
+			admin:   false,
+		},
+		{
+			name:    "linked channel",
+			message: &botModels.Message{Chat: group, SenderChat: &botModels.Chat{ID: -200}},
+			admin:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin, err := router.IsAdmin(ctx, tt.message)
+			require.NoError(t, err)
+			assert.Equal(t, tt.admin, admin)
+		})
+	}
+}
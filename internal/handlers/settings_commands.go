@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	botModels "github.com/go-telegram/bot/models"
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/services/callbacks"
+	"github.com/kriku/kpukbot/internal/services/chats"
+)
+
+// Values the settings keyboard steps through, typed values may lie in between
+var (
+	questionIntervalSteps = []time.Duration{
+		time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+		2 * 24 * time.Hour, 3 * 24 * time.Hour, 7 * 24 * time.Hour, 14 * 24 * time.Hour, 30 * 24 * time.Hour,
+	}
+	inactivityTimeoutSteps = []time.Duration{
+		5 * time.Minute, 15 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour,
+		4 * time.Hour, 8 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+	}
+	maxQueueSizeSteps = []int{5, 10, 20, 30, 50, 100, 200, 500}
+)
+
+// chatSetting is a chat setting that can be changed with /settings
+type chatSetting struct {
+	key    string // Used in callback data and typed commands
+	label  string
+	value  func(s *models.ChatSettings) string
+	toggle func(s *models.ChatSettings)               // Set for on/off settings
+	step   func(s *models.ChatSettings, up bool) bool // Set for other settings, false when there is no further step
+	set    func(s *models.ChatSettings, value string) error
+}
+
+var chatSettings = []chatSetting{
+	boolSetting("rounds", "Question rounds", func(s *models.ChatSettings) *bool { return &s.EnableQuestionRounds }),
+	durationSetting("interval", "Question interval", questionIntervalSteps, func(s *models.ChatSettings) *time.Duration { return &s.QuestionInterval }),
+	intSetting("queue_size", "Max queue size", maxQueueSizeSteps, func(s *models.ChatSettings) *int { return &s.MaxQueueSize }),
+	boolSetting("auto_enqueue", "Auto-enqueue new users", func(s *models.ChatSettings) *bool { return &s.AutoEnqueueNewUsers }),
+	boolSetting("skip_inactive", "Skip inactive users", func(s *models.ChatSettings) *bool { return &s.SkipInactiveUsers }),
+	durationSetting("timeout", "Inactivity timeout", inactivityTimeoutSteps, func(s *models.ChatSettings) *time.Duration { return &s.InactivityTimeout }),
+}
+
+// SettingsCommands shows the chat settings and lets admins change them with an inline keyboard
+type SettingsCommands struct {
+	chatsService *chats.ChatsService
+	router       *CommandRouter
+	logger       *slog.Logger
+}
+
+func NewSettingsCommands(
+	chatsService *chats.ChatsService,
+	router *CommandRouter,
+	logger *slog.Logger,
+) *SettingsCommands {
+	return &SettingsCommands{
+		chatsService: chatsService,
+		router:       router,
+		logger:       logger.With("handler", "settings_commands"),
+	}
+}
+
+// Commands returns the settings commands for registration with the router
+func (c *SettingsCommands) Commands() []Command {
+	return []Command{
+		{
+			Name:        "settings",
+			Description: "Show chat settings, admins can change them",
+			Handler:     c.handleSettings,
+			Callback:    c.handleCallback,
+		},
+	}
+}
+
+// handleSettings shows the settings with their keyboard, "/settings <name> <value>" changes one
+func (c *SettingsCommands) handleSettings(ctx context.Context, req *CommandRequest) error {
+	chatID := req.ChatID()
+
+	settings, err := c.chatsService.GetChatSettings(ctx, chatID)
+	if err != nil {
+		return err
+	}
+
+	if req.Args == "" {
+		return c.router.ReplyWithKeyboard(ctx, chatID, renderSettings(settings), settingsKeyboard(settings))
+	}
+
+	admin, err := c.router.IsAdmin(ctx, req.Message)
+	if err != nil {
+		return fmt.Errorf("failed to check administrators: %w", err)
+	}
+	if !admin {
+		return c.router.Reply(ctx, chatID, "Only chat administrators can change settings.")
+	}
+
+	key, value, _ := strings.Cut(req.Args, " ")
+	setting, ok := findSetting(key)
+	if !ok {
+		return c.router.Reply(ctx, chatID, "Unknown setting "+key+", use one of: "+settingKeys()+".")
+	}
+	if err := setting.set(settings, strings.TrimSpace(value)); err != nil {
+		return c.router.Reply(ctx, chatID, fmt.Sprintf("Invalid value for %s: %v.", key, err))
+	}
+
+	// Settings are validated by the service, a broken rule is told to the admin
+	var invalid *chats.InvalidSettingsError
+	err = c.save(ctx, settings)
+	if errors.As(err, &invalid) {
+		return c.router.Reply(ctx, chatID, fmt.Sprintf("Not saved: %v.", invalid.Reason))
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.router.Reply(ctx, chatID, fmt.Sprintf("%s: %s", setting.label, setting.value(settings)))
+}
+
+// handleCallback applies a button press, the data is "<action>:<key>" or "done"
+func (c *SettingsCommands) handleCallback(ctx context.Context, req *callbacks.Request) (string, error) {
+	chat := req.Query.Message.Message.Chat
+	admin, err := c.router.IsChatAdmin(ctx, chat, &req.Query.From)
+	if err != nil {
+		return "", fmt.Errorf("failed to check administrators: %w", err)
+	}
+	if !admin {
+		return "Only chat administrators can change settings.", nil
+	}
+
+	settings, err := c.chatsService.GetChatSettings(ctx, chat.ID)
+	if err != nil {
+		return "", err
+	}
+
+	action, key, _ := strings.Cut(req.Data, ":")
+	if action == "done" {
+		return "", req.EditText(ctx, renderSettings(settings), nil)
+	}
+
+	setting, ok := findSetting(key)
+	if !ok {
+		return "", nil
+	}
+
+	switch {
+	case action == "toggle" && setting.toggle != nil:
+		setting.toggle(settings)
+	case (action == "inc" || action == "dec") && setting.step != nil:
+		if !setting.step(settings, action == "inc") {
+			return fmt.Sprintf("%s is already at its limit.", setting.label), nil
+		}
+	default:
+		// Value labels between the step buttons
+		return "", nil
+	}
+
+	var invalid *chats.InvalidSettingsError
+	err = c.save(ctx, settings)
+	if errors.As(err, &invalid) {
+		return fmt.Sprintf("Not saved: %v.", invalid.Reason), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	keyboard := settingsKeyboard(settings)
+	if err := req.EditText(ctx, renderSettings(settings), &keyboard); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s: %s", setting.label, setting.value(settings)), nil
+}
+
+func (c *SettingsCommands) save(ctx context.Context, settings *models.ChatSettings) error {
+	if err := c.chatsService.UpdateChatSettings(ctx, *settings); err != nil {
+		return err
+	}
+
+	c.logger.InfoContext(ctx, "Chat settings changed", "chat_id", settings.ChatID)
+	return nil
+}
+
+func renderSettings(settings *models.ChatSettings) string {
+	var text strings.Builder
+	text.WriteString("Chat settings:")
+	for _, setting := range chatSettings {
+		fmt.Fprintf(&text, "\n%s: %s", setting.label, setting.value(settings))
+	}
+	return text.String()
+}
+
+// settingsKeyboard has a toggle button for on/off settings and -/+ buttons around the value of others
+func settingsKeyboard(settings *models.ChatSettings) botModels.InlineKeyboardMarkup {
+	var rows [][]botModels.InlineKeyboardButton
+	for _, setting := range chatSettings {
+		label := fmt.Sprintf("%s: %s", setting.label, setting.value(settings))
+
+		if setting.toggle != nil {
+			rows = append(rows, []botModels.InlineKeyboardButton{
+				callbacks.Button(label, "settings", "toggle:"+setting.key),
+			})
+			continue
+		}
+
+		rows = append(rows, []botModels.InlineKeyboardButton{
+			callbacks.Button("-", "settings", "dec:"+setting.key),
+			callbacks.Button(label, "settings", "show:"+setting.key),
+			callbacks.Button("+", "settings", "inc:"+setting.key),
+		})
+	}
+
+	rows = append(rows, []botModels.InlineKeyboardButton{
+		callbacks.Button("Done", "settings", "done"),
+	})
+
+	return botModels.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+func findSetting(key string) (chatSetting, bool) {
+	for _, setting := range chatSettings {
+		if setting.key == strings.ToLower(key) {
+			return setting, true
+		}
+	}
+	return chatSetting{}, false
+}
+
+func settingKeys() string {
+	keys := make([]string, 0, len(chatSettings))
+	for _, setting := range chatSettings {
+		keys = append(keys, setting.key)
+	}
+	return strings.Join(keys, ", ")
+}
+
+func boolSetting(key, label string, field func(s *models.ChatSettings) *bool) chatSetting {
+	return chatSetting{
+		key:   key,
+		label: label,
+		value: func(s *models.ChatSettings) string {
+			if *field(s) {
+				return "on"
+			}
+			return "off"
+		},
+		toggle: func(s *models.ChatSettings) {
+			*field(s) = !*field(s)
+		},
+		set: func(s *models.ChatSettings, value string) error {
+			switch strings.ToLower(value) {
+			case "on", "yes", "true", "1":
+				*field(s) = true
+			case "off", "no", "false", "0":
+				*field(s) = false
+			default:
+				return fmt.Errorf("use on or off")
+			}
+			return nil
+		},
+	}
+}
+
+func durationSetting(key, label string, steps []time.Duration, field func(s *models.ChatSettings) *time.Duration) chatSetting {
+	return chatSetting{
+		key:   key,
+		label: label,
+		value: func(s *models.ChatSettings) string {
+			return formatSettingDuration(*field(s))
+		},
+		step: func(s *models.ChatSettings, up bool) bool {
+			value, ok := nextStep(steps, *field(s), up)
+			*field(s) = value
+			return ok
+		},
+		set: func(s *models.ChatSettings, value string) error {
+			d, err := parseSettingDuration(value)
+			if err != nil {
+				return err
+			}
+			*field(s) = d
+			return nil
+		},
+	}
+}
+
+func intSetting(key, label string, steps []int, field func(s *models.ChatSettings) *int) chatSetting {
+	return chatSetting{
+		key:   key,
+		label: label,
+		value: func(s *models.ChatSettings) string {
+			return strconv.Itoa(*field(s))
+		},
+		step: func(s *models.ChatSettings, up bool) bool {
+			value, ok := nextStep(steps, *field(s), up)
+			*field(s) = value
+			return ok
+		},
+		set: func(s *models.ChatSettings, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("use a whole number")
+			}
+			*field(s) = n
+			return nil
+		},
+	}
+}
+
+// nextStep returns the closest step above or below the current value, or the value itself when
+// there is none
+func nextStep[T cmp.Ordered](steps []T, current T, up bool) (T, bool) {
+	if up {
+		i := slices.IndexFunc(steps, func(step T) bool { return step > current })
+		if i < 0 {
+			return current, false
+		}
+		return steps[i], true
+	}
+
+	for i := len(steps) - 1; i >= 0; i-- {
+		if steps[i] < current {
+			return steps[i], true
+		}
+	}
+	return current, false
+}
+
+// formatSettingDuration formats whole days and hours the way they are typed, e.g. 2d or 90m
+func formatSettingDuration(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour && d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d >= time.Hour && d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
+
+// parseSettingDuration parses Go durations and whole days such as 2d
+func parseSettingDuration(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("use a duration such as 30m, 12h or 2d")
+	}
+	return d, nil
+}
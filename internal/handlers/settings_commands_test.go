@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	botModels "github.com/go-telegram/bot/models"
+	"github.com/kriku/kpukbot/internal/models"
+	chatsRepo "github.com/kriku/kpukbot/internal/repository/chats"
+	"github.com/kriku/kpukbot/internal/services/chats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const settingsTestChatID = int64(-100)
+
+func newSettingsTest() (*CommandRouter, *fakeMessenger, *chats.ChatsService) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	router, messenger := newTestRouter()
+	chatsService := chats.NewChatsService(chatsRepo.NewMemoryChatsRepository(), logger)
+	router.Register(NewSettingsCommands(chatsService, router, logger).Commands()...)
+	return router, messenger, chatsService
+}
+
+func settingsMessage(from int64, text string) *botModels.Message {
+	return &botModels.Message{
+		ID:   1,
+		Chat: botModels.Chat{ID: settingsTestChatID, Type: botModels.ChatTypeSupergroup},
+		From: &botModels.User{ID: from},
+		Text: text,
+	}
+}
+
+func settingsCallback(from int64, data string) *botModels.CallbackQuery {
+	return &botModels.CallbackQuery{
+		ID:   "query",
+		From: botModels.User{ID: from},
+		Message: botModels.MaybeInaccessibleMessage{
+			Message: &botModels.Message{
+				ID:   2,
+				Chat: botModels.Chat{ID: settingsTestChatID, Type: botModels.ChatTypeSupergroup},
+			},
+		},
+		Data: data,
+	}
+}
+
+// callbackData returns the callback data of the keyboard button with the given text
+func callbackData(t *testing.T, keyboard botModels.InlineKeyboardMarkup, row int, text string) string {
+	for _, button := range keyboard.InlineKeyboard[row] {
+		if button.Text == text {
+			return button.CallbackData
+		}
+	}
+	t.Fatalf("no button %q in row %d", text, row)
+	return ""
+}
+
+func TestSettingsCommands_Show(t *testing.T) {
+	ctx := context.Background()
+	router, messenger, _ := newSettingsTest()
+
+	_, err := router.Route(ctx, settingsMessage(1, "/settings"))
+	require.NoError(t, err)
+
+	require.Len(t, messenger.sent, 1)
+	assert.Equal(t, "Chat settings:\n"+
+		"Question rounds: on\n"+
+		"Question interval: 1d\n"+
+		"Max queue size: 50\n"+
+		"Auto-enqueue new users: on\n"+
+		"Skip inactive users: on\n"+
+		"Inactivity timeout: 2h", messenger.sent[0])
+
+	require.Len(t, messenger.keyboards, 1)
+	keyboard := messenger.keyboards[0]
+	require.Len(t, keyboard.InlineKeyboard, 7)
+	assert.Equal(t, "settings:toggle:rounds", callbackData(t, keyboard, 0, "Question rounds: on"))
+	assert.Equal(t, "settings:inc:interval", callbackData(t, keyboard, 1, "+"))
+	assert.Equal(t, "settings:done", callbackData(t, keyboard, 6, "Done"))
+}
+
+func TestSettingsCommands_Callback(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("admins change settings", func(t *testing.T) {
+		router, messenger, chatsService := newSettingsTest()
+		messenger.admins = []int64{1}
+
+		require.NoError(t, router.callbacks.Route(ctx, settingsCallback(1, "settings:toggle:auto_enqueue")))
+		require.NoError(t, router.callbacks.Route(ctx, settingsCallback(1, "settings:dec:interval")))
+		require.NoError(t, router.callbacks.Route(ctx, settingsCallback(1, "settings:inc:queue_size")))
+
+		settings, err := chatsService.GetChatSettings(ctx, settingsTestChatID)
+		require.NoError(t, err)
+		assert.False(t, settings.AutoEnqueueNewUsers)
+		assert.Equal(t, 12*time.Hour, settings.QuestionInterval)
+		assert.Equal(t, 100, settings.MaxQueueSize)
+
+		assert.Equal(t, []string{
+			"Auto-enqueue new users: off",
+			"Question interval: 12h",
+			"Max queue size: 100",
+		}, messenger.answers)
+		require.Len(t, messenger.edited, 3)
+		assert.Contains(t, messenger.edited[2], "Max queue size: 100")
+	})
+
+	t.Run("members cannot change settings", func(t *testing.T) {
+		router, messenger, chatsService := newSettingsTest()
+		messenger.admins = []int64{1}
+
+		require.NoError(t, router.callbacks.Route(ctx, settingsCallback(2, "settings:toggle:rounds")))
+
+		assert.Equal(t, []string{"Only chat administrators can change settings."}, messenger.answers)
+		assert.Empty(t, messenger.edited)
+		settings, err := chatsService.GetChatSettings(ctx, settingsTestChatID)
+		require.NoError(t, err)
+		assert.True(t, settings.EnableQuestionRounds)
+	})
+
+	t.Run("steps stop at the limits", func(t *testing.T) {
+		router, messenger, _ := newSettingsTest()
+		messenger.admins = []int64{1}
+
+		for range maxQueueSizeSteps {
+			require.NoError(t, router.callbacks.Route(ctx, settingsCallback(1, "settings:inc:queue_size")))
+		}
+
+		assert.Equal(t, "Max queue size is already at its limit.", messenger.answers[len(messenger.answers)-1])
+	})
+
+	t.Run("invalid combinations are not saved", func(t *testing.T) {
+		router, messenger, chatsService := newSettingsTest()
+		messenger.admins = []int64{1}
+
+		// The inactivity timeout of 2h may not reach the question interval
+		for range 4 {
+			require.NoError(t, router.callbacks.Route(ctx, settingsCallback(1, "settings:dec:interval")))
+		}
+
+		settings, err := chatsService.GetChatSettings(ctx, settingsTestChatID)
+		require.NoError(t, err)
+		assert.Equal(t, 3*time.Hour, settings.QuestionInterval)
+		assert.Contains(t, messenger.answers[len(messenger.answers)-1], "Not saved")
+	})
+
+	t.Run("done removes the keyboard", func(t *testing.T) {
+		router, messenger, _ := newSettingsTest()
+		messenger.admins = []int64{1}
+
+		require.NoError(t, router.callbacks.Route(ctx, settingsCallback(1, "settings:done")))
+
+		require.Len(t, messenger.edited, 1)
+		assert.Empty(t, messenger.keyboards)
+	})
+}
+
+func TestSettingsCommands_Typed(t *testing.T) {
+	ctx := context.Background()
+	router, messenger, chatsService := newSettingsTest()
+	messenger.admins = []int64{1}
+
+	tests := []struct {
+		from  int64
+		text  string
+		reply string
+	}{
+		{from: 2, text: "/settings interval 2d", reply: "Only chat administrators can change settings."},
+		{from: 1, text: "/settings interval 2d", reply: "Question interval: 2d"},
+		{from: 1, text: "/settings timeout 90m", reply: "Inactivity timeout: 90m"},
+		{from: 1, text: "/settings rounds off", reply: "Question rounds: off"},
+		{from: 1, text: "/settings queue_size 0", reply: "Not saved: max queue size must be between 1 and 500."},
+		{from: 1, text: "/settings interval soon", reply: "Invalid value for interval: use a duration such as 30m, 12h or 2d."},
+		{from: 1, text: "/settings color blue", reply: "Unknown setting color, use one of: rounds, interval, queue_size, auto_enqueue, skip_inactive, timeout."},
+	}
+
+	for _, tt := range tests {
+		_, err := router.Route(ctx, settingsMessage(tt.from, tt.text))
+		require.NoError(t, err)
+		assert.Equal(t, tt.reply, messenger.sent[len(messenger.sent)-1], tt.text)
+	}
+
+	settings, err := chatsService.GetChatSettings(ctx, settingsTestChatID)
+	require.NoError(t, err)
+	assert.Equal(t, 48*time.Hour, settings.QuestionInterval)
+	assert.Equal(t, 90*time.Minute, settings.InactivityTimeout)
+	assert.False(t, settings.EnableQuestionRounds)
+	assert.Equal(t, models.DefaultChatSettings(settingsTestChatID).MaxQueueSize, settings.MaxQueueSize)
+}
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // Chat represents a chat group with its users and question queue
 type Chat struct {
@@ -43,7 +46,52 @@ type ChatSettings struct {
 	SkipInactiveUsers    bool          `firestore:"skip_inactive_users"`    // Skip users who don't respond
 	InactivityTimeout    time.Duration `firestore:"inactivity_timeout"`     // How long to wait before skipping
 	EnableQuestionRounds bool          `firestore:"enable_question_rounds"` // Enable question rounds feature
-	UpdatedAt            time.Time     `firestore:"updated_at"`
+
+	// LLM budgets, 0 means unlimited. Days and months are in UTC
+	DailyTokenBudget     int64   `firestore:"daily_token_budget"`
+	MonthlyTokenBudget   int64   `firestore:"monthly_token_budget"`
+	DailyCostBudgetUSD   float64 `firestore:"daily_cost_budget_usd"`
+	MonthlyCostBudgetUSD float64 `firestore:"monthly_cost_budget_usd"`
+	BudgetNearRatio      float64 `firestore:"budget_near_ratio"`    // Share of a budget after which the bot economizes, 0 means DefaultBudgetNearRatio
+	BudgetNotice         bool    `firestore:"budget_notice"`        // Post a notice when a budget is exhausted
+	BudgetNoticePeriod   string  `firestore:"budget_notice_period"` // Budget period the last notice was posted for
+
+	UpdatedAt time.Time `firestore:"updated_at"`
+}
+
+// DefaultBudgetNearRatio is the share of a budget after which the bot economizes
+const DefaultBudgetNearRatio = 0.8
+
+// Limits of the chat settings that can be changed in chats
+const (
+	MinQuestionInterval  = time.Hour
+	MaxQuestionInterval  = 30 * 24 * time.Hour
+	MinInactivityTimeout = 5 * time.Minute
+	MaxQueueSizeLimit    = 500
+)
+
+// Validate reports the first setting that is out of range
+func (s *ChatSettings) Validate() error {
+	switch {
+	case s.QuestionInterval < MinQuestionInterval || s.QuestionInterval > MaxQuestionInterval:
+		return fmt.Errorf("question interval must be between %s and %s", MinQuestionInterval, MaxQuestionInterval)
+	case s.MaxQueueSize < 1 || s.MaxQueueSize > MaxQueueSizeLimit:
+		return fmt.Errorf("max queue size must be between 1 and %d", MaxQueueSizeLimit)
+	case s.InactivityTimeout < MinInactivityTimeout:
+		return fmt.Errorf("inactivity timeout must be at least %s", MinInactivityTimeout)
+	case s.InactivityTimeout >= s.QuestionInterval:
+		return fmt.Errorf("inactivity timeout must be shorter than the question interval")
+	case s.DailyTokenBudget < 0 || s.MonthlyTokenBudget < 0 || s.DailyCostBudgetUSD < 0 || s.MonthlyCostBudgetUSD < 0:
+		return fmt.Errorf("budgets must not be negative")
+	case s.BudgetNearRatio < 0 || s.BudgetNearRatio > 1:
+		return fmt.Errorf("budget near ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// HasBudget reports whether any LLM budget is set
+func (s *ChatSettings) HasBudget() bool {
+	return s.DailyTokenBudget > 0 || s.MonthlyTokenBudget > 0 || s.DailyCostBudgetUSD > 0 || s.MonthlyCostBudgetUSD > 0
 }
 
 // DefaultChatSettings returns default settings for a new chat
@@ -56,6 +104,8 @@ func DefaultChatSettings(chatID int64) *ChatSettings {
 		SkipInactiveUsers:    true,
 		InactivityTimeout:    2 * time.Hour,
 		EnableQuestionRounds: true,
+		BudgetNearRatio:      DefaultBudgetNearRatio,
+		BudgetNotice:         true,
 		UpdatedAt:            time.Now(),
 	}
 }
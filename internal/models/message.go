@@ -1,7 +1,10 @@
 package models
 
 import (
+	"slices"
+	"strings"
 	"time"
+	"unicode/utf16"
 
 	"github.com/go-telegram/bot/models"
 )
@@ -17,6 +20,104 @@ type Message struct {
 	LastName         string    `firestore:"last_name"`
 	Date             time.Time `firestore:"date"`
 	IsBot            bool      `firestore:"is_bot"`
+	// Edits are the previous versions of an edited message, oldest first
+	Edits []MessageEdit `firestore:"edits,omitempty"`
+	// Deleted messages are kept for the record but left out of LLM context
+	Deleted bool `firestore:"deleted,omitempty"`
+	// Image is the photo or image document of the message, its caption is the text
+	Image *MessageImage `firestore:"image,omitempty"`
+	// Voice is the recording of a voice or video note
+	Voice *MessageVoice `firestore:"voice,omitempty"`
+	// Transcript marks a text transcribed from the voice recording of the message
+	Transcript bool `firestore:"transcript,omitempty"`
+	// Document is a file attached to the message that is no image, only kept while the update is
+	// processed, its summary is kept in Attachments
+	Document *MessageDocument `firestore:"-"`
+	// Links are the URLs of the text, only kept while the update is processed
+	Links []string `firestore:"-"`
+	// Attachments summarize the documents and web pages shared with the message
+	Attachments []MessageAttachment `firestore:"attachments,omitempty"`
+}
+
+// MessageImage is an image attached to a message
+type MessageImage struct {
+	FileID   string `firestore:"file_id"` // Telegram file to download
+	MIMEType string `firestore:"mime_type"`
+	// Description is written by the LLM once, later prompts mention the image by it
+	Description string `firestore:"description,omitempty"`
+	// Data is the downloaded image, only kept while the update is processed
+	Data []byte `firestore:"-"`
+}
+
+// MessageVoice is a voice or video note attached to a message
+type MessageVoice struct {
+	FileID   string `firestore:"file_id"` // Telegram file to download
+	MIMEType string `firestore:"mime_type"`
+}
+
+// MessageDocument is a file attached to a message
+type MessageDocument struct {
+	FileID   string
+	FileName string
+	MIMEType string
+}
+
+// MessageAttachment is the summary of a document or web page shared with a message
+type MessageAttachment struct {
+	Source  string `firestore:"source"` // File name or URL
+	Summary string `firestore:"summary"`
+}
+
+// PromptText returns the text of a message as shown to the LLM, transcripts are marked and
+// attached images, documents and web pages are summarized after the text
+func (m *Message) PromptText() string {
+	text := m.Text
+	if m.Transcript {
+		text = "[Voice message] " + text
+	}
+
+	if m.Image != nil {
+		if m.Image.Description != "" {
+			text += " [Image: " + m.Image.Description + "]"
+		} else {
+			text += " [Image]"
+		}
+	}
+	for _, attachment := range m.Attachments {
+		text += " [Attachment " + attachment.Source + ": " + attachment.Summary + "]"
+	}
+
+	return strings.TrimSpace(text)
+}
+
+// MessageEdit is a previous version of an edited message
+type MessageEdit struct {
+	Text     string    `firestore:"text"`
+	EditedAt time.Time `firestore:"edited_at"` // When the text was replaced
+}
+
+// ApplyEdit takes the text of the edited version of a message and keeps the previous text in the
+// edit history, it reports whether the text changed
+func (m *Message) ApplyEdit(edited *Message, editedAt time.Time) bool {
+	// Only the caption of a voice message can be edited, the transcript stays its text
+	if m.Transcript || edited.Text == m.Text {
+		return false
+	}
+
+	m.Edits = append(m.Edits, MessageEdit{Text: m.Text, EditedAt: editedAt})
+	m.Text = edited.Text
+	return true
+}
+
+// WithoutDeleted returns the messages that were not deleted, the ones to show to the LLM
+func WithoutDeleted(messages []*Message) []*Message {
+	visible := make([]*Message, 0, len(messages))
+	for _, m := range messages {
+		if !m.Deleted {
+			visible = append(visible, m)
+		}
+	}
+	return visible
 }
 
 func NewMessageFromTelegramUpdate(update *models.Update) *Message {
@@ -24,12 +125,33 @@ func NewMessageFromTelegramUpdate(update *models.Update) *Message {
 		return nil
 	}
 
-	msg := update.Message
+	return NewMessageFromTelegramMessage(update.Message)
+}
+
+// NewMessageFromTelegramMessage converts a Telegram message, received or sent by the bot
+func NewMessageFromTelegramMessage(msg *models.Message) *Message {
 	message := &Message{
 		ID:     msg.ID,
 		ChatID: msg.Chat.ID,
 		Date:   time.Unix(int64(msg.Date), 0),
 		Text:   msg.Text,
+		Image:  messageImage(msg),
+		Voice:  messageVoice(msg),
+		Links:  messageLinks(msg.Text, msg.Entities),
+	}
+
+	// Media messages have a caption instead of a text
+	if message.Text == "" {
+		message.Text = msg.Caption
+		message.Links = messageLinks(msg.Caption, msg.CaptionEntities)
+	}
+
+	if msg.Document != nil && message.Image == nil {
+		message.Document = &MessageDocument{
+			FileID:   msg.Document.FileID,
+			FileName: msg.Document.FileName,
+			MIMEType: msg.Document.MimeType,
+		}
 	}
 
 	if msg.ReplyToMessage != nil {
@@ -46,3 +168,65 @@ func NewMessageFromTelegramUpdate(update *models.Update) *Message {
 
 	return message
 }
+
+// messageImage returns the image of a photo or image document message, the largest size of a
+// photo is used
+func messageImage(msg *models.Message) *MessageImage {
+	if len(msg.Photo) > 0 {
+		largest := msg.Photo[0]
+		for _, size := range msg.Photo[1:] {
+			if size.Width*size.Height > largest.Width*largest.Height {
+				largest = size
+			}
+		}
+		return &MessageImage{FileID: largest.FileID, MIMEType: "image/jpeg"} // Telegram stores photos as JPEG
+	}
+
+	if msg.Document != nil && strings.HasPrefix(msg.Document.MimeType, "image/") {
+		return &MessageImage{FileID: msg.Document.FileID, MIMEType: msg.Document.MimeType}
+	}
+
+	return nil
+}
+
+// messageVoice returns the recording of a voice or video note message
+func messageVoice(msg *models.Message) *MessageVoice {
+	switch {
+	case msg.Voice != nil:
+		mimeType := msg.Voice.MimeType
+		if mimeType == "" {
+			mimeType = "audio/ogg" // Voice notes are OGG with OPUS unless stated otherwise
+		}
+		return &MessageVoice{FileID: msg.Voice.FileID, MIMEType: mimeType}
+	case msg.VideoNote != nil:
+		return &MessageVoice{FileID: msg.VideoNote.FileID, MIMEType: "video/mp4"}
+	default:
+		return nil
+	}
+}
+
+// messageLinks returns the URLs of a text, entity offsets count UTF-16 code units
+func messageLinks(text string, entities []models.MessageEntity) []string {
+	var links []string
+	var encoded []uint16
+	for _, entity := range entities {
+		switch entity.Type {
+		case models.MessageEntityTypeURL:
+			if encoded == nil {
+				encoded = utf16.Encode([]rune(text))
+			}
+			if entity.Offset < 0 || entity.Offset+entity.Length > len(encoded) {
+				continue
+			}
+			link := string(utf16.Decode(encoded[entity.Offset : entity.Offset+entity.Length]))
+			if !slices.Contains(links, link) {
+				links = append(links, link)
+			}
+		case models.MessageEntityTypeTextLink:
+			if !slices.Contains(links, entity.URL) {
+				links = append(links, entity.URL)
+			}
+		}
+	}
+	return links
+}
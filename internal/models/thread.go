@@ -7,7 +7,7 @@ type Thread struct {
 	ChatID      int64     `firestore:"chat_id"`
 	Theme       string    `firestore:"theme"`       // Main theme/topic of the thread
 	Summary     string    `firestore:"summary"`     // Brief summary of the thread
-	MessageIDs  []int     `firestore:"message_ids"` // IDs of messages in this thread
+	MessageIDs  []int     `firestore:"message_ids"` // IDs of messages in this thread, scoped to ChatID
 	CreatedAt   time.Time `firestore:"created_at"`
 	UpdatedAt   time.Time `firestore:"updated_at"`
 	IsActive    bool      `firestore:"is_active"` // Whether thread is still active
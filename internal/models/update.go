@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	tmodels "github.com/go-telegram/bot/models"
+)
+
+// QueuedUpdate is a Telegram update waiting in the work queue or kept as a dead letter
+type QueuedUpdate struct {
+	ID         string    `firestore:"id"`
+	UpdateID   int64     `firestore:"update_id"`
+	ChatID     int64     `firestore:"chat_id"` // 0 for updates without a chat
+	Payload    []byte    `firestore:"payload"` // Update as received from Telegram
+	Attempts   int       `firestore:"attempts"`
+	LastError  string    `firestore:"last_error"`
+	EnqueuedAt time.Time `firestore:"enqueued_at"`
+	VisibleAt  time.Time `firestore:"visible_at"` // Leased updates are hidden from workers until then
+	FailedAt   time.Time `firestore:"failed_at"`  // Set for dead letters only
+}
+
+// Processing states of a Telegram update
+const (
+	UpdateStatusProcessing = "processing"
+	UpdateStatusDone       = "done"
+)
+
+// ProcessedUpdate remembers a Telegram update so retried deliveries are not processed twice
+type ProcessedUpdate struct {
+	UpdateID   int64     `firestore:"update_id"`
+	Status     string    `firestore:"status"`      // UpdateStatusProcessing or UpdateStatusDone
+	Replied    bool      `firestore:"replied"`     // The bot already answered the message of the update
+	Attempts   int       `firestore:"attempts"`    // Processing attempts so far
+	LeaseUntil time.Time `firestore:"lease_until"` // Until then the current attempt owns the update
+	ExpiresAt  time.Time `firestore:"expires_at"`  // The record is forgotten afterwards
+	UpdatedAt  time.Time `firestore:"updated_at"`
+}
+
+// UpdateChatID returns the chat an update belongs to, 0 when it has none
+func UpdateChatID(update *tmodels.Update) int64 {
+	switch {
+	case update.Message != nil:
+		return update.Message.Chat.ID
+	case update.EditedMessage != nil:
+		return update.EditedMessage.Chat.ID
+	case update.CallbackQuery != nil && update.CallbackQuery.Message.Message != nil:
+		return update.CallbackQuery.Message.Message.Chat.ID
+	case update.MyChatMember != nil:
+		return update.MyChatMember.Chat.ID
+	case update.ChatMember != nil:
+		return update.ChatMember.Chat.ID
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,88 @@
+package models
+
+import "time"
+
+// UsageDayLayout is the format of DailyUsage.Day, days are in UTC
+const UsageDayLayout = "2006-01-02"
+
+// UsageMonthLayout is the format of a monthly budget period
+const UsageMonthLayout = "2006-01"
+
+// BudgetState tells how much of its LLM budget a chat has used
+type BudgetState int
+
+const (
+	BudgetOK        BudgetState = iota
+	BudgetNear                  // Close to a budget, the bot economizes
+	BudgetExhausted             // A budget is used up, the bot does not call the LLM
+)
+
+func (s BudgetState) String() string {
+	switch s {
+	case BudgetNear:
+		return "near"
+	case BudgetExhausted:
+		return "exhausted"
+	default:
+		return "ok"
+	}
+}
+
+// BudgetStatus is the budget state of a chat
+type BudgetStatus struct {
+	State  BudgetState
+	Period string // Day or month of the budget that caused the state, empty when OK
+}
+
+// UsageDay returns the usage day of a point in time
+func UsageDay(t time.Time) string {
+	return t.UTC().Format(UsageDayLayout)
+}
+
+// LLMUsage is the token usage of a single LLM call with its attribution
+type LLMUsage struct {
+	ChatID         int64
+	UserID         int64  // 0 when the call was not made on behalf of a user
+	ThreadID       string // Empty when the call was not made for a thread
+	CallSite       string // classifier, analyzer or the strategy name
+	Model          string
+	PromptTokens   int64
+	ResponseTokens int64
+	TotalTokens    int64
+	CostUSD        float64
+	CreatedAt      time.Time
+}
+
+// DailyUsage aggregates token usage of a chat per day, user, thread, call site and model
+type DailyUsage struct {
+	ChatID         int64     `firestore:"chat_id"`
+	Day            string    `firestore:"day"` // UTC date, see UsageDayLayout
+	UserID         int64     `firestore:"user_id"`
+	ThreadID       string    `firestore:"thread_id"`
+	CallSite       string    `firestore:"call_site"`
+	Model          string    `firestore:"model"`
+	Calls          int64     `firestore:"calls"`
+	PromptTokens   int64     `firestore:"prompt_tokens"`
+	ResponseTokens int64     `firestore:"response_tokens"`
+	TotalTokens    int64     `firestore:"total_tokens"`
+	CostUSD        float64   `firestore:"cost_usd"`
+	UpdatedAt      time.Time `firestore:"updated_at"`
+}
+
+// UsageTotals sums usage over any number of daily aggregates
+type UsageTotals struct {
+	Calls          int64
+	PromptTokens   int64
+	ResponseTokens int64
+	TotalTokens    int64
+	CostUSD        float64
+}
+
+// Add adds a daily aggregate to the totals
+func (t *UsageTotals) Add(u *DailyUsage) {
+	t.Calls += u.Calls
+	t.PromptTokens += u.PromptTokens
+	t.ResponseTokens += u.ResponseTokens
+	t.TotalTokens += u.TotalTokens
+	t.CostUSD += u.CostUSD
+}
@@ -9,6 +9,15 @@ import (
 	"github.com/kriku/kpukbot/internal/models"
 )
 
+// Truncate cuts a text to at most limit characters, never inside a multi-byte character
+func Truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit])
+}
+
 // ThreadClassificationPrompt generates a prompt for classifying a message into threads
 func ThreadClassificationPrompt(message *models.Message, existingThreads []*models.Thread) string {
 	var sb strings.Builder
@@ -17,7 +26,7 @@ func ThreadClassificationPrompt(message *models.Message, existingThreads []*mode
 
 	sb.WriteString("New message:\n")
 	sb.WriteString(fmt.Sprintf("From: %s %s (@%s)\n", message.FirstName, message.LastName, message.Username))
-	sb.WriteString(fmt.Sprintf("Text: %s\n\n", message.Text))
+	sb.WriteString(fmt.Sprintf("Text: %s\n\n", message.PromptText()))
 
 	if len(existingThreads) > 0 {
 		sb.WriteString("Existing threads:\n")
@@ -50,7 +59,7 @@ func ThreadSummaryPrompt(messages []*models.Message) string {
 	sb.WriteString("Messages:\n")
 
 	for i, msg := range messages {
-		sb.WriteString(fmt.Sprintf("\n%d. %s %s: %s\n", i+1, msg.FirstName, msg.LastName, msg.Text))
+		sb.WriteString(fmt.Sprintf("\n%d. %s %s: %s\n", i+1, msg.FirstName, msg.LastName, msg.PromptText()))
 	}
 
 	sb.WriteString("\nSpecify:\n")
@@ -71,10 +80,10 @@ func ResponseAnalysisPrompt(thread *models.Thread, messages []*models.Message, n
 
 	sb.WriteString("Recent messages:\n")
 	for i, msg := range messages {
-		sb.WriteString(fmt.Sprintf("%d. %s: %s\n", i+1, msg.FirstName, msg.Text))
+		sb.WriteString(fmt.Sprintf("%d. %s: %s\n", i+1, msg.FirstName, msg.PromptText()))
 	}
 
-	sb.WriteString(fmt.Sprintf("\nNew message: %s: %s\n\n", newMessage.FirstName, newMessage.Text))
+	sb.WriteString(fmt.Sprintf("\nNew message: %s: %s\n\n", newMessage.FirstName, newMessage.PromptText()))
 
 	sb.WriteString("Analyze whether the bot should respond. Consider:\n")
 	sb.WriteString("1. Is there a question that requires an answer?\n")
@@ -92,15 +101,66 @@ func GeneralResponsePrompt(thread *models.Thread, messages []*models.Message, ne
 
 	sb.WriteString("Discussion:\n")
 	for _, msg := range messages {
-		sb.WriteString(fmt.Sprintf("%s: %s\n", msg.FirstName, msg.Text))
+		sb.WriteString(fmt.Sprintf("%s: %s\n", msg.FirstName, msg.PromptText()))
 	}
-	sb.WriteString(fmt.Sprintf("\n%s: %s\n\n", newMessage.FirstName, newMessage.Text))
+	sb.WriteString(fmt.Sprintf("\n%s: %s\n\n", newMessage.FirstName, newMessage.PromptText()))
 
 	sb.WriteString("Provide a brief, helpful response. Be friendly but professional.")
 
 	return sb.String()
 }
 
+// ImageDescriptionPrompt generates a prompt for describing the image attached to a message
+func ImageDescriptionPrompt(message *models.Message) string {
+	var sb strings.Builder
+
+	sb.WriteString("Describe the attached image of a chat message so that the discussion can refer to it later without seeing it.\n")
+	sb.WriteString("Mention what it shows, any readable text and details relevant to the caption.\n\n")
+
+	if message.Text != "" {
+		sb.WriteString(fmt.Sprintf("Caption from %s: \"%s\"\n\n", message.FirstName, message.Text))
+	}
+
+	sb.WriteString(fmt.Sprintf("Answer with the description only, no longer than %d characters.", constants.MaxImageDescriptionLength))
+
+	return sb.String()
+}
+
+// AttachmentSummaryPrompt generates a prompt for summarizing a document or web page shared in a
+// chat, text is its extracted text or empty when the document is attached to the prompt
+func AttachmentSummaryPrompt(source string, text string) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("Summarize the following content shared in a group chat from %s.\n", source))
+	sb.WriteString("Keep what it is about, its key facts and conclusions, so that the discussion can refer to it later.\n\n")
+
+	if text != "" {
+		sb.WriteString("Content:\n")
+		sb.WriteString(text)
+		sb.WriteString("\n\n")
+	} else {
+		sb.WriteString("The content is attached.\n\n")
+	}
+
+	sb.WriteString(fmt.Sprintf("Answer with the summary only, no longer than %d characters.", constants.MaxAttachmentSummaryLength))
+
+	return sb.String()
+}
+
+// NoSpeechAnswer is the answer to TranscriptionPrompt for recordings without speech
+const NoSpeechAnswer = "[no speech]"
+
+// TranscriptionPrompt generates a prompt for transcribing an attached voice recording
+func TranscriptionPrompt() string {
+	var sb strings.Builder
+
+	sb.WriteString("Transcribe the speech of the attached recording word for word, in the language it is spoken in.\n")
+	sb.WriteString("Leave out filler sounds, do not translate, summarize or comment on it.\n\n")
+	sb.WriteString(fmt.Sprintf("Answer with the transcript only, or with %s if there is no speech.", NoSpeechAnswer))
+
+	return sb.String()
+}
+
 // IntroductionAnalysisPrompt generates a prompt for analyzing if a message is an introduction
 func IntroductionAnalysisPrompt(message *models.Message) string {
 	var sb strings.Builder
@@ -2,8 +2,11 @@ package chats
 
 import (
 	"context"
+	"time"
 
 	"github.com/kriku/kpukbot/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type ChatsRepository interface {
@@ -13,6 +16,10 @@ type ChatsRepository interface {
 	// SaveChat saves or updates a chat in the repository
 	SaveChat(ctx context.Context, chat models.Chat) error
 
+	// SaveChatInfo saves the title, type, description and active status of a chat and creates the chat
+	// if it is missing, its users and question queue are left untouched
+	SaveChatInfo(ctx context.Context, chat models.Chat) error
+
 	// GetChat retrieves a chat by its ID
 	GetChat(ctx context.Context, chatID int64) (*models.Chat, error)
 
@@ -47,6 +54,10 @@ type ChatsRepository interface {
 	// UpdateQueueEntry updates a specific queue entry
 	UpdateQueueEntry(ctx context.Context, chatID int64, entry models.QueueEntry) error
 
+	// SetQueueEntryStatus changes the status of a user's queue entry and keeps the rest of the entry,
+	// completed entries get their answer time
+	SetQueueEntryStatus(ctx context.Context, chatID int64, userID int64, entryStatus string) error
+
 	// GetQueuePosition gets a user's current position in the queue
 	GetQueuePosition(ctx context.Context, chatID int64, userID int64) (int, error)
 
@@ -70,3 +81,19 @@ type ChatsRepository interface {
 	// GetChatsByUser retrieves all chats that contain a specific user
 	GetChatsByUser(ctx context.Context, userID int64) ([]*models.Chat, error)
 }
+
+// setQueueEntryStatus changes the status of a user's entry in the queue of a chat loaded for an update
+func setQueueEntryStatus(chat *models.Chat, userID int64, entryStatus string) error {
+	for i, entry := range chat.QuestionQueue {
+		if entry.UserID == userID {
+			chat.QuestionQueue[i].Status = entryStatus
+			if entryStatus == models.QueueStatusCompleted {
+				now := time.Now()
+				chat.QuestionQueue[i].AnsweredAt = &now
+			}
+			return nil
+		}
+	}
+
+	return status.Errorf(codes.NotFound, "queue entry not found for user")
+}
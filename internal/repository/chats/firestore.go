@@ -3,6 +3,7 @@ package chats
 import (
 	"context"
 	"fmt"
+	"slices"
 	"time"
 
 	"cloud.google.com/go/firestore"
@@ -61,6 +62,44 @@ func (r *FirestoreRepository) SaveChat(ctx context.Context, chat models.Chat) er
 	return nil
 }
 
+// SaveChatInfo saves the title, type, description and active status of a chat, creating it if missing.
+// Existing chats are updated field by field inside a transaction, so concurrent user and queue changes are kept
+func (r *FirestoreRepository) SaveChatInfo(ctx context.Context, chat models.Chat) error {
+	ref := r.client.Collection(chatsCollection).Doc(fmt.Sprintf("%d", chat.ID))
+
+	err := r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		_, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return tx.Create(ref, models.Chat{
+				ID:            chat.ID,
+				Title:         chat.Title,
+				Type:          chat.Type,
+				Description:   chat.Description,
+				UserIDs:       []int64{},
+				QuestionQueue: []models.QueueEntry{},
+				IsActive:      chat.IsActive,
+				CreatedAt:     time.Now(),
+				UpdatedAt:     time.Now(),
+			})
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.Update(ref, []firestore.Update{
+			{Path: "title", Value: chat.Title},
+			{Path: "type", Value: chat.Type},
+			{Path: "description", Value: chat.Description},
+			{Path: "is_active", Value: chat.IsActive},
+			{Path: "updated_at", Value: time.Now()},
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save chat info: %w", err)
+	}
+	return nil
+}
+
 // GetChat retrieves a chat by its ID
 func (r *FirestoreRepository) GetChat(ctx context.Context, chatID int64) (*models.Chat, error) {
 	doc, err := r.client.Collection(chatsCollection).Doc(fmt.Sprintf("%d", chatID)).Get(ctx)
@@ -142,52 +181,38 @@ func (r *FirestoreRepository) UpdateChatUsers(ctx context.Context, chatID int64,
 
 // AddUserToChat adds a user to the chat's user list
 func (r *FirestoreRepository) AddUserToChat(ctx context.Context, chatID int64, userID int64) error {
-	chat, err := r.GetChat(ctx, chatID)
-	if err != nil {
-		return fmt.Errorf("failed to get chat: %w", err)
-	}
-
-	// Check if user already exists
-	for _, id := range chat.UserIDs {
-		if id == userID {
-			return nil // User already in chat
+	return r.update(ctx, chatID, func(chat *models.Chat) error {
+		// Check if user already exists
+		if !slices.Contains(chat.UserIDs, userID) {
+			chat.UserIDs = append(chat.UserIDs, userID)
 		}
-	}
-
-	chat.UserIDs = append(chat.UserIDs, userID)
-	chat.UpdatedAt = time.Now()
-
-	return r.SaveChat(ctx, *chat)
+		return nil
+	})
 }
 
 // RemoveUserFromChat removes a user from the chat's user list
 func (r *FirestoreRepository) RemoveUserFromChat(ctx context.Context, chatID int64, userID int64) error {
-	chat, err := r.GetChat(ctx, chatID)
-	if err != nil {
-		return fmt.Errorf("failed to get chat: %w", err)
-	}
-
-	// Remove user from user list
-	var newUserIDs []int64
-	for _, id := range chat.UserIDs {
-		if id != userID {
-			newUserIDs = append(newUserIDs, id)
+	return r.update(ctx, chatID, func(chat *models.Chat) error {
+		// Remove user from user list
+		var newUserIDs []int64
+		for _, id := range chat.UserIDs {
+			if id != userID {
+				newUserIDs = append(newUserIDs, id)
+			}
 		}
-	}
 
-	// Remove user from queue as well
-	var newQueue []models.QueueEntry
-	for _, entry := range chat.QuestionQueue {
-		if entry.UserID != userID {
-			newQueue = append(newQueue, entry)
+		// Remove user from queue as well
+		var newQueue []models.QueueEntry
+		for _, entry := range chat.QuestionQueue {
+			if entry.UserID != userID {
+				newQueue = append(newQueue, entry)
+			}
 		}
-	}
-
-	chat.UserIDs = newUserIDs
-	chat.QuestionQueue = newQueue
-	chat.UpdatedAt = time.Now()
 
-	return r.SaveChat(ctx, *chat)
+		chat.UserIDs = newUserIDs
+		chat.QuestionQueue = newQueue
+		return nil
+	})
 }
 
 // UpdateQuestionQueue updates the entire question queue for a chat
@@ -206,54 +231,40 @@ func (r *FirestoreRepository) UpdateQuestionQueue(ctx context.Context, chatID in
 
 // AddToQueue adds a user to the question queue
 func (r *FirestoreRepository) AddToQueue(ctx context.Context, chatID int64, userID int64) error {
-	chat, err := r.GetChat(ctx, chatID)
-	if err != nil {
-		return fmt.Errorf("failed to get chat: %w", err)
-	}
-
-	// Check if user already in queue
-	for _, entry := range chat.QuestionQueue {
-		if entry.UserID == userID && entry.Status == models.QueueStatusWaiting {
-			return nil // User already in queue
+	return r.update(ctx, chatID, func(chat *models.Chat) error {
+		// Check if user already in queue
+		for _, entry := range chat.QuestionQueue {
+			if entry.UserID == userID && entry.Status == models.QueueStatusWaiting {
+				return nil // User already in queue
+			}
 		}
-	}
-
-	// Add to end of queue
-	newEntry := models.QueueEntry{
-		UserID:     userID,
-		Position:   len(chat.QuestionQueue),
-		EnqueuedAt: time.Now(),
-		Status:     models.QueueStatusWaiting,
-	}
 
-	chat.QuestionQueue = append(chat.QuestionQueue, newEntry)
-	chat.UpdatedAt = time.Now()
-
-	return r.SaveChat(ctx, *chat)
+		// Add to end of queue
+		chat.QuestionQueue = append(chat.QuestionQueue, models.QueueEntry{
+			UserID:     userID,
+			Position:   len(chat.QuestionQueue),
+			EnqueuedAt: time.Now(),
+			Status:     models.QueueStatusWaiting,
+		})
+		return nil
+	})
 }
 
 // RemoveFromQueue removes a user from the question queue
 func (r *FirestoreRepository) RemoveFromQueue(ctx context.Context, chatID int64, userID int64) error {
-	chat, err := r.GetChat(ctx, chatID)
-	if err != nil {
-		return fmt.Errorf("failed to get chat: %w", err)
-	}
-
-	var newQueue []models.QueueEntry
-	for i, entry := range chat.QuestionQueue {
-		if entry.UserID != userID {
-			// Update positions for remaining entries
-			if entry.Position > i {
+	return r.update(ctx, chatID, func(chat *models.Chat) error {
+		var newQueue []models.QueueEntry
+		for _, entry := range chat.QuestionQueue {
+			if entry.UserID != userID {
+				// Update positions for remaining entries
 				entry.Position = len(newQueue)
+				newQueue = append(newQueue, entry)
 			}
-			newQueue = append(newQueue, entry)
 		}
-	}
-
-	chat.QuestionQueue = newQueue
-	chat.UpdatedAt = time.Now()
 
-	return r.SaveChat(ctx, *chat)
+		chat.QuestionQueue = newQueue
+		return nil
+	})
 }
 
 // GetNextInQueue gets the next user in the question queue
@@ -274,21 +285,24 @@ func (r *FirestoreRepository) GetNextInQueue(ctx context.Context, chatID int64)
 
 // UpdateQueueEntry updates a specific queue entry
 func (r *FirestoreRepository) UpdateQueueEntry(ctx context.Context, chatID int64, entry models.QueueEntry) error {
-	chat, err := r.GetChat(ctx, chatID)
-	if err != nil {
-		return fmt.Errorf("failed to get chat: %w", err)
-	}
-
-	// Find and update the entry
-	for i, queueEntry := range chat.QuestionQueue {
-		if queueEntry.UserID == entry.UserID {
-			chat.QuestionQueue[i] = entry
-			chat.UpdatedAt = time.Now()
-			return r.SaveChat(ctx, *chat)
+	return r.update(ctx, chatID, func(chat *models.Chat) error {
+		// Find and update the entry
+		for i, queueEntry := range chat.QuestionQueue {
+			if queueEntry.UserID == entry.UserID {
+				chat.QuestionQueue[i] = entry
+				return nil
+			}
 		}
-	}
 
-	return status.Errorf(codes.NotFound, "queue entry not found for user")
+		return status.Errorf(codes.NotFound, "queue entry not found for user")
+	})
+}
+
+// SetQueueEntryStatus changes the status of a user's queue entry
+func (r *FirestoreRepository) SetQueueEntryStatus(ctx context.Context, chatID int64, userID int64, entryStatus string) error {
+	return r.update(ctx, chatID, func(chat *models.Chat) error {
+		return setQueueEntryStatus(chat, userID, entryStatus)
+	})
 }
 
 // GetQueuePosition gets a user's current position in the queue
@@ -313,50 +327,37 @@ func (r *FirestoreRepository) GetQueuePosition(ctx context.Context, chatID int64
 
 // ClearCompletedQueue removes completed entries from the queue
 func (r *FirestoreRepository) ClearCompletedQueue(ctx context.Context, chatID int64) error {
-	chat, err := r.GetChat(ctx, chatID)
-	if err != nil {
-		return fmt.Errorf("failed to get chat: %w", err)
-	}
-
-	var newQueue []models.QueueEntry
-	position := 0
-	for _, entry := range chat.QuestionQueue {
-		if entry.Status == models.QueueStatusWaiting || entry.Status == models.QueueStatusAsking {
-			entry.Position = position
-			newQueue = append(newQueue, entry)
-			position++
+	return r.update(ctx, chatID, func(chat *models.Chat) error {
+		var newQueue []models.QueueEntry
+		for _, entry := range chat.QuestionQueue {
+			if entry.Status == models.QueueStatusWaiting || entry.Status == models.QueueStatusAsking {
+				entry.Position = len(newQueue)
+				newQueue = append(newQueue, entry)
+			}
 		}
-	}
 
-	chat.QuestionQueue = newQueue
-	chat.UpdatedAt = time.Now()
-
-	return r.SaveChat(ctx, *chat)
+		chat.QuestionQueue = newQueue
+		return nil
+	})
 }
 
 // ResetQueue clears the entire queue and rebuilds it from active users
 func (r *FirestoreRepository) ResetQueue(ctx context.Context, chatID int64) error {
-	chat, err := r.GetChat(ctx, chatID)
-	if err != nil {
-		return fmt.Errorf("failed to get chat: %w", err)
-	}
-
-	// Clear the queue and rebuild from active users
-	var newQueue []models.QueueEntry
-	for i, userID := range chat.UserIDs {
-		entry := models.QueueEntry{
-			UserID:     userID,
-			Position:   i,
-			EnqueuedAt: time.Now(),
-			Status:     models.QueueStatusWaiting,
+	return r.update(ctx, chatID, func(chat *models.Chat) error {
+		// Clear the queue and rebuild from active users
+		var newQueue []models.QueueEntry
+		for i, userID := range chat.UserIDs {
+			newQueue = append(newQueue, models.QueueEntry{
+				UserID:     userID,
+				Position:   i,
+				EnqueuedAt: time.Now(),
+				Status:     models.QueueStatusWaiting,
+			})
 		}
-		newQueue = append(newQueue, entry)
-	}
-
-	chat.QuestionQueue = newQueue
-	chat.UpdatedAt = time.Now()
 
-	return r.SaveChat(ctx, *chat)
+		chat.QuestionQueue = newQueue
+		return nil
+	})
 }
 
 // SaveChatSettings saves chat settings
@@ -425,3 +426,31 @@ func (r *FirestoreRepository) GetChatsByUser(ctx context.Context, userID int64)
 
 	return chats, nil
 }
+
+// update applies fn to a stored chat inside a transaction, concurrent updates of the chat are retried
+// by Firestore so none of them is lost. The result is kept only if fn succeeds
+func (r *FirestoreRepository) update(ctx context.Context, chatID int64, fn func(chat *models.Chat) error) error {
+	ref := r.client.Collection(chatsCollection).Doc(fmt.Sprintf("%d", chatID))
+
+	return r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return fmt.Errorf("failed to get chat: %w", status.Errorf(codes.NotFound, "chat not found"))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get chat: %w", err)
+		}
+
+		var chat models.Chat
+		if err := doc.DataTo(&chat); err != nil {
+			return fmt.Errorf("failed to convert chat data: %w", err)
+		}
+
+		if err := fn(&chat); err != nil {
+			return err
+		}
+
+		chat.UpdatedAt = time.Now()
+		return tx.Set(ref, chat)
+	})
+}
@@ -0,0 +1,404 @@
+package chats
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MemoryRepository implements ChatsRepository interface in memory.
+// Every read-modify-write runs under a single lock, so queue mutations are atomic.
+type MemoryRepository struct {
+	mu       sync.RWMutex
+	chats    map[int64]models.Chat
+	settings map[int64]models.ChatSettings
+}
+
+// NewMemoryChatsRepository creates a new empty MemoryRepository
+func NewMemoryChatsRepository() ChatsRepository {
+	return &MemoryRepository{
+		chats:    make(map[int64]models.Chat),
+		settings: make(map[int64]models.ChatSettings),
+	}
+}
+
+// Create new chat in memory
+func (r *MemoryRepository) NewChat(ctx context.Context, chatID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.chats[chatID] = models.Chat{
+		ID:            chatID,
+		UserIDs:       []int64{},
+		QuestionQueue: []models.QueueEntry{},
+		IsActive:      true,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	return nil
+}
+
+// SaveChat saves or updates a chat in memory
+func (r *MemoryRepository) SaveChat(ctx context.Context, chat models.Chat) error {
+	chat.UpdatedAt = time.Now()
+	if chat.CreatedAt.IsZero() {
+		chat.CreatedAt = time.Now()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.chats[chat.ID] = cloneChat(chat)
+	return nil
+}
+
+// SaveChatInfo saves the title, type, description and active status of a chat, creating it if missing
+func (r *MemoryRepository) SaveChatInfo(ctx context.Context, chat models.Chat) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.chats[chat.ID]
+	if !ok {
+		stored = models.Chat{
+			ID:            chat.ID,
+			UserIDs:       []int64{},
+			QuestionQueue: []models.QueueEntry{},
+			CreatedAt:     time.Now(),
+		}
+	}
+
+	stored.Title = chat.Title
+	stored.Type = chat.Type
+	stored.Description = chat.Description
+	stored.IsActive = chat.IsActive
+	stored.UpdatedAt = time.Now()
+	r.chats[chat.ID] = stored
+	return nil
+}
+
+// GetChat retrieves a chat by its ID
+func (r *MemoryRepository) GetChat(ctx context.Context, chatID int64) (*models.Chat, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	chat, ok := r.chats[chatID]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "chat not found")
+	}
+
+	chat = cloneChat(chat)
+	return &chat, nil
+}
+
+// GetAllChats retrieves all chats
+func (r *MemoryRepository) GetAllChats(ctx context.Context) ([]*models.Chat, error) {
+	return r.findChats(func(chat models.Chat) bool {
+		return true
+	}), nil
+}
+
+// GetActiveChats retrieves all active chats
+func (r *MemoryRepository) GetActiveChats(ctx context.Context) ([]*models.Chat, error) {
+	return r.findChats(func(chat models.Chat) bool {
+		return chat.IsActive
+	}), nil
+}
+
+// UpdateChatUsers updates the list of users in a chat
+func (r *MemoryRepository) UpdateChatUsers(ctx context.Context, chatID int64, userIDs []int64) error {
+	err := r.update(chatID, func(chat *models.Chat) error {
+		chat.UserIDs = slices.Clone(userIDs)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update chat users: %w", err)
+	}
+	return nil
+}
+
+// AddUserToChat adds a user to the chat's user list
+func (r *MemoryRepository) AddUserToChat(ctx context.Context, chatID int64, userID int64) error {
+	return r.update(chatID, func(chat *models.Chat) error {
+		if !slices.Contains(chat.UserIDs, userID) {
+			chat.UserIDs = append(chat.UserIDs, userID)
+		}
+		return nil
+	})
+}
+
+// RemoveUserFromChat removes a user from the chat's user list
+func (r *MemoryRepository) RemoveUserFromChat(ctx context.Context, chatID int64, userID int64) error {
+	return r.update(chatID, func(chat *models.Chat) error {
+		chat.UserIDs = slices.DeleteFunc(chat.UserIDs, func(id int64) bool {
+			return id == userID
+		})
+
+		// Remove user from queue as well
+		chat.QuestionQueue = slices.DeleteFunc(chat.QuestionQueue, func(entry models.QueueEntry) bool {
+			return entry.UserID == userID
+		})
+		return nil
+	})
+}
+
+// UpdateQuestionQueue updates the entire question queue for a chat
+func (r *MemoryRepository) UpdateQuestionQueue(ctx context.Context, chatID int64, queue []models.QueueEntry) error {
+	err := r.update(chatID, func(chat *models.Chat) error {
+		chat.QuestionQueue = cloneQueue(queue)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update question queue: %w", err)
+	}
+	return nil
+}
+
+// AddToQueue adds a user to the question queue
+func (r *MemoryRepository) AddToQueue(ctx context.Context, chatID int64, userID int64) error {
+	return r.update(chatID, func(chat *models.Chat) error {
+		// Check if user already in queue
+		for _, entry := range chat.QuestionQueue {
+			if entry.UserID == userID && entry.Status == models.QueueStatusWaiting {
+				return nil
+			}
+		}
+
+		// Add to end of queue
+		chat.QuestionQueue = append(chat.QuestionQueue, models.QueueEntry{
+			UserID:     userID,
+			Position:   len(chat.QuestionQueue),
+			EnqueuedAt: time.Now(),
+			Status:     models.QueueStatusWaiting,
+		})
+		return nil
+	})
+}
+
+// RemoveFromQueue removes a user from the question queue
+func (r *MemoryRepository) RemoveFromQueue(ctx context.Context, chatID int64, userID int64) error {
+	return r.update(chatID, func(chat *models.Chat) error {
+		var newQueue []models.QueueEntry
+		for _, entry := range chat.QuestionQueue {
+			if entry.UserID != userID {
+				entry.Position = len(newQueue)
+				newQueue = append(newQueue, entry)
+			}
+		}
+
+		chat.QuestionQueue = newQueue
+		return nil
+	})
+}
+
+// GetNextInQueue gets the next user in the question queue
+func (r *MemoryRepository) GetNextInQueue(ctx context.Context, chatID int64) (*models.QueueEntry, error) {
+	chat, err := r.GetChat(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat: %w", err)
+	}
+
+	for _, entry := range chat.QuestionQueue {
+		if entry.Status == models.QueueStatusWaiting {
+			return &entry, nil
+		}
+	}
+
+	return nil, status.Errorf(codes.NotFound, "no users waiting in queue")
+}
+
+// UpdateQueueEntry updates a specific queue entry
+func (r *MemoryRepository) UpdateQueueEntry(ctx context.Context, chatID int64, entry models.QueueEntry) error {
+	return r.update(chatID, func(chat *models.Chat) error {
+		for i, queueEntry := range chat.QuestionQueue {
+			if queueEntry.UserID == entry.UserID {
+				chat.QuestionQueue[i] = cloneQueueEntry(entry)
+				return nil
+			}
+		}
+
+		return status.Errorf(codes.NotFound, "queue entry not found for user")
+	})
+}
+
+// SetQueueEntryStatus changes the status of a user's queue entry
+func (r *MemoryRepository) SetQueueEntryStatus(ctx context.Context, chatID int64, userID int64, entryStatus string) error {
+	return r.update(chatID, func(chat *models.Chat) error {
+		return setQueueEntryStatus(chat, userID, entryStatus)
+	})
+}
+
+// GetQueuePosition gets a user's current position in the queue
+func (r *MemoryRepository) GetQueuePosition(ctx context.Context, chatID int64, userID int64) (int, error) {
+	chat, err := r.GetChat(ctx, chatID)
+	if err != nil {
+		return -1, fmt.Errorf("failed to get chat: %w", err)
+	}
+
+	waitingCount := 0
+	for _, entry := range chat.QuestionQueue {
+		if entry.Status == models.QueueStatusWaiting {
+			if entry.UserID == userID {
+				return waitingCount, nil
+			}
+			waitingCount++
+		}
+	}
+
+	return -1, status.Errorf(codes.NotFound, "user not found in queue")
+}
+
+// ClearCompletedQueue removes completed entries from the queue
+func (r *MemoryRepository) ClearCompletedQueue(ctx context.Context, chatID int64) error {
+	return r.update(chatID, func(chat *models.Chat) error {
+		var newQueue []models.QueueEntry
+		for _, entry := range chat.QuestionQueue {
+			if entry.Status == models.QueueStatusWaiting || entry.Status == models.QueueStatusAsking {
+				entry.Position = len(newQueue)
+				newQueue = append(newQueue, entry)
+			}
+		}
+
+		chat.QuestionQueue = newQueue
+		return nil
+	})
+}
+
+// ResetQueue clears the entire queue and rebuilds it from active users
+func (r *MemoryRepository) ResetQueue(ctx context.Context, chatID int64) error {
+	return r.update(chatID, func(chat *models.Chat) error {
+		var newQueue []models.QueueEntry
+		for i, userID := range chat.UserIDs {
+			newQueue = append(newQueue, models.QueueEntry{
+				UserID:     userID,
+				Position:   i,
+				EnqueuedAt: time.Now(),
+				Status:     models.QueueStatusWaiting,
+			})
+		}
+
+		chat.QuestionQueue = newQueue
+		return nil
+	})
+}
+
+// SaveChatSettings saves chat settings
+func (r *MemoryRepository) SaveChatSettings(ctx context.Context, settings models.ChatSettings) error {
+	settings.UpdatedAt = time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.settings[settings.ChatID] = settings
+	return nil
+}
+
+// GetChatSettings retrieves chat settings
+func (r *MemoryRepository) GetChatSettings(ctx context.Context, chatID int64) (*models.ChatSettings, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	settings, ok := r.settings[chatID]
+	if !ok {
+		// Return default settings if not found
+		return models.DefaultChatSettings(chatID), nil
+	}
+
+	return &settings, nil
+}
+
+// SetChatActive sets the active status of a chat
+func (r *MemoryRepository) SetChatActive(ctx context.Context, chatID int64, isActive bool) error {
+	err := r.update(chatID, func(chat *models.Chat) error {
+		chat.IsActive = isActive
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update chat active status: %w", err)
+	}
+	return nil
+}
+
+// GetChatsByUser retrieves all chats that contain a specific user
+func (r *MemoryRepository) GetChatsByUser(ctx context.Context, userID int64) ([]*models.Chat, error) {
+	return r.findChats(func(chat models.Chat) bool {
+		return slices.Contains(chat.UserIDs, userID)
+	}), nil
+}
+
+// update applies fn to a stored chat under the write lock and keeps the result only if fn succeeds
+func (r *MemoryRepository) update(chatID int64, fn func(chat *models.Chat) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.chats[chatID]
+	if !ok {
+		return fmt.Errorf("failed to get chat: %w", status.Errorf(codes.NotFound, "chat not found"))
+	}
+
+	chat := cloneChat(stored)
+	if err := fn(&chat); err != nil {
+		return err
+	}
+
+	chat.UpdatedAt = time.Now()
+	r.chats[chatID] = chat
+	return nil
+}
+
+// findChats returns copies of all chats matching the filter ordered by ID
+func (r *MemoryRepository) findChats(match func(chat models.Chat) bool) []*models.Chat {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var chats []*models.Chat
+	for _, chat := range r.chats {
+		if match(chat) {
+			chat = cloneChat(chat)
+			chats = append(chats, &chat)
+		}
+	}
+
+	sort.Slice(chats, func(i, j int) bool {
+		return chats[i].ID < chats[j].ID
+	})
+
+	return chats
+}
+
+// cloneChat copies a chat so callers never share slices or pointers with the stored value
+func cloneChat(chat models.Chat) models.Chat {
+	chat.UserIDs = slices.Clone(chat.UserIDs)
+	chat.QuestionQueue = cloneQueue(chat.QuestionQueue)
+	return chat
+}
+
+func cloneQueue(queue []models.QueueEntry) []models.QueueEntry {
+	if queue == nil {
+		return nil
+	}
+
+	cloned := make([]models.QueueEntry, len(queue))
+	for i, entry := range queue {
+		cloned[i] = cloneQueueEntry(entry)
+	}
+	return cloned
+}
+
+func cloneQueueEntry(entry models.QueueEntry) models.QueueEntry {
+	if entry.AskedAt != nil {
+		askedAt := *entry.AskedAt
+		entry.AskedAt = &askedAt
+	}
+	if entry.AnsweredAt != nil {
+		answeredAt := *entry.AnsweredAt
+		entry.AnsweredAt = &answeredAt
+	}
+	return entry
+}
@@ -0,0 +1,343 @@
+package chats
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/repository/repotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// runChatsRepositoryTests checks behaviour every ChatsRepository implementation must share
+func runChatsRepositoryTests(t *testing.T, newRepo func(t *testing.T) ChatsRepository) {
+	ctx := context.Background()
+
+	t.Run("GetChat returns NotFound for unknown chat", func(t *testing.T) {
+		repo := newRepo(t)
+
+		_, err := repo.GetChat(ctx, 1)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("NewChat and SaveChat", func(t *testing.T) {
+		repo := newRepo(t)
+		chatID := int64(100)
+
+		require.NoError(t, repo.NewChat(ctx, chatID))
+		chat, err := repo.GetChat(ctx, chatID)
+		require.NoError(t, err)
+		assert.True(t, chat.IsActive)
+		assert.Empty(t, chat.UserIDs)
+
+		chat.Title = "Book club"
+		require.NoError(t, repo.SaveChat(ctx, *chat))
+
+		chat, err = repo.GetChat(ctx, chatID)
+		require.NoError(t, err)
+		assert.Equal(t, "Book club", chat.Title)
+		assert.False(t, chat.CreatedAt.IsZero())
+	})
+
+	t.Run("SaveChatInfo keeps users and queue", func(t *testing.T) {
+		repo := newRepo(t)
+		chatID := int64(100)
+
+		require.NoError(t, repo.SaveChatInfo(ctx, models.Chat{ID: chatID, Title: "Book club", Type: "group", IsActive: true}))
+		chat, err := repo.GetChat(ctx, chatID)
+		require.NoError(t, err)
+		assert.Equal(t, "Book club", chat.Title)
+		assert.Empty(t, chat.UserIDs)
+		assert.False(t, chat.CreatedAt.IsZero())
+
+		require.NoError(t, repo.AddUserToChat(ctx, chatID, 1))
+		require.NoError(t, repo.AddToQueue(ctx, chatID, 1))
+		require.NoError(t, repo.SetChatActive(ctx, chatID, false))
+
+		info := models.Chat{ID: chatID, Title: "Reading club", Type: "supergroup", Description: "Books", IsActive: true}
+		require.NoError(t, repo.SaveChatInfo(ctx, info))
+
+		chat, err = repo.GetChat(ctx, chatID)
+		require.NoError(t, err)
+		assert.Equal(t, "Reading club", chat.Title)
+		assert.Equal(t, "supergroup", chat.Type)
+		assert.Equal(t, "Books", chat.Description)
+		assert.True(t, chat.IsActive)
+		assert.Equal(t, []int64{1}, chat.UserIDs)
+		require.Len(t, chat.QuestionQueue, 1)
+		assert.Equal(t, int64(1), chat.QuestionQueue[0].UserID)
+	})
+
+	t.Run("active chats and chats by user", func(t *testing.T) {
+		repo := newRepo(t)
+
+		require.NoError(t, repo.NewChat(ctx, 1))
+		require.NoError(t, repo.NewChat(ctx, 2))
+		require.NoError(t, repo.SetChatActive(ctx, 2, false))
+		require.NoError(t, repo.AddUserToChat(ctx, 2, 42))
+
+		all, err := repo.GetAllChats(ctx)
+		require.NoError(t, err)
+		assert.Len(t, all, 2)
+
+		active, err := repo.GetActiveChats(ctx)
+		require.NoError(t, err)
+		require.Len(t, active, 1)
+		assert.Equal(t, int64(1), active[0].ID)
+
+		byUser, err := repo.GetChatsByUser(ctx, 42)
+		require.NoError(t, err)
+		require.Len(t, byUser, 1)
+		assert.Equal(t, int64(2), byUser[0].ID)
+	})
+
+	t.Run("users are added once and removed with their queue entries", func(t *testing.T) {
+		repo := newRepo(t)
+		chatID := int64(100)
+		require.NoError(t, repo.NewChat(ctx, chatID))
+
+		require.NoError(t, repo.AddUserToChat(ctx, chatID, 1))
+		require.NoError(t, repo.AddUserToChat(ctx, chatID, 1))
+		require.NoError(t, repo.AddUserToChat(ctx, chatID, 2))
+		require.NoError(t, repo.AddToQueue(ctx, chatID, 1))
+
+		require.NoError(t, repo.RemoveUserFromChat(ctx, chatID, 1))
+
+		chat, err := repo.GetChat(ctx, chatID)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{2}, chat.UserIDs)
+		assert.Empty(t, chat.QuestionQueue)
+	})
+
+	t.Run("queue order, positions and statuses", func(t *testing.T) {
+		repo := newRepo(t)
+		chatID := int64(100)
+		require.NoError(t, repo.NewChat(ctx, chatID))
+
+		for _, userID := range []int64{1, 2, 3} {
+			require.NoError(t, repo.AddToQueue(ctx, chatID, userID))
+		}
+		// Waiting users are not enqueued twice
+		require.NoError(t, repo.AddToQueue(ctx, chatID, 2))
+
+		next, err := repo.GetNextInQueue(ctx, chatID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), next.UserID)
+
+		next.Status = models.QueueStatusCompleted
+		require.NoError(t, repo.UpdateQueueEntry(ctx, chatID, *next))
+
+		next, err = repo.GetNextInQueue(ctx, chatID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), next.UserID)
+
+		position, err := repo.GetQueuePosition(ctx, chatID, 3)
+		require.NoError(t, err)
+		assert.Equal(t, 1, position)
+
+		_, err = repo.GetQueuePosition(ctx, chatID, 1)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+
+		require.NoError(t, repo.ClearCompletedQueue(ctx, chatID))
+		chat, err := repo.GetChat(ctx, chatID)
+		require.NoError(t, err)
+		require.Len(t, chat.QuestionQueue, 2)
+		assert.Equal(t, int64(2), chat.QuestionQueue[0].UserID)
+		assert.Equal(t, 0, chat.QuestionQueue[0].Position)
+		assert.Equal(t, 1, chat.QuestionQueue[1].Position)
+
+		require.NoError(t, repo.RemoveFromQueue(ctx, chatID, 2))
+		next, err = repo.GetNextInQueue(ctx, chatID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), next.UserID)
+		assert.Equal(t, 0, next.Position)
+
+		err = repo.UpdateQueueEntry(ctx, chatID, models.QueueEntry{UserID: 99})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("SetQueueEntryStatus keeps the rest of the entry", func(t *testing.T) {
+		repo := newRepo(t)
+		chatID := int64(100)
+		require.NoError(t, repo.NewChat(ctx, chatID))
+		require.NoError(t, repo.AddToQueue(ctx, chatID, 1))
+		require.NoError(t, repo.AddToQueue(ctx, chatID, 2))
+
+		asked := time.Now()
+		require.NoError(t, repo.UpdateQueueEntry(ctx, chatID, models.QueueEntry{
+			UserID:     1,
+			Status:     models.QueueStatusAsking,
+			QuestionID: "q-1",
+			AskedAt:    &asked,
+		}))
+
+		require.NoError(t, repo.SetQueueEntryStatus(ctx, chatID, 1, models.QueueStatusCompleted))
+		require.NoError(t, repo.SetQueueEntryStatus(ctx, chatID, 2, models.QueueStatusSkipped))
+
+		chat, err := repo.GetChat(ctx, chatID)
+		require.NoError(t, err)
+		require.Len(t, chat.QuestionQueue, 2)
+		assert.Equal(t, models.QueueStatusCompleted, chat.QuestionQueue[0].Status)
+		assert.Equal(t, "q-1", chat.QuestionQueue[0].QuestionID)
+		assert.NotNil(t, chat.QuestionQueue[0].AskedAt)
+		assert.NotNil(t, chat.QuestionQueue[0].AnsweredAt)
+		assert.Equal(t, models.QueueStatusSkipped, chat.QuestionQueue[1].Status)
+		assert.Equal(t, 1, chat.QuestionQueue[1].Position)
+		assert.Nil(t, chat.QuestionQueue[1].AnsweredAt)
+
+		err = repo.SetQueueEntryStatus(ctx, chatID, 99, models.QueueStatusSkipped)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("empty queue returns NotFound", func(t *testing.T) {
+		repo := newRepo(t)
+		chatID := int64(100)
+		require.NoError(t, repo.NewChat(ctx, chatID))
+
+		_, err := repo.GetNextInQueue(ctx, chatID)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("ResetQueue rebuilds queue from chat users", func(t *testing.T) {
+		repo := newRepo(t)
+		chatID := int64(100)
+		require.NoError(t, repo.NewChat(ctx, chatID))
+		require.NoError(t, repo.UpdateChatUsers(ctx, chatID, []int64{5, 6}))
+		require.NoError(t, repo.UpdateQuestionQueue(ctx, chatID, []models.QueueEntry{
+			{UserID: 5, Status: models.QueueStatusCompleted},
+		}))
+
+		require.NoError(t, repo.ResetQueue(ctx, chatID))
+
+		chat, err := repo.GetChat(ctx, chatID)
+		require.NoError(t, err)
+		require.Len(t, chat.QuestionQueue, 2)
+		for i, entry := range chat.QuestionQueue {
+			assert.Equal(t, chat.UserIDs[i], entry.UserID)
+			assert.Equal(t, i, entry.Position)
+			assert.Equal(t, models.QueueStatusWaiting, entry.Status)
+		}
+	})
+
+	t.Run("chat settings default until saved", func(t *testing.T) {
+		repo := newRepo(t)
+		chatID := int64(100)
+
+		settings, err := repo.GetChatSettings(ctx, chatID)
+		require.NoError(t, err)
+		assert.Equal(t, models.DefaultChatSettings(chatID).MaxQueueSize, settings.MaxQueueSize)
+
+		settings.MaxQueueSize = 5
+		settings.AutoEnqueueNewUsers = false
+		settings.DailyTokenBudget = 10000
+		settings.MonthlyCostBudgetUSD = 2.5
+		settings.BudgetNoticePeriod = "2025-03"
+		require.NoError(t, repo.SaveChatSettings(ctx, *settings))
+
+		settings, err = repo.GetChatSettings(ctx, chatID)
+		require.NoError(t, err)
+		assert.Equal(t, 5, settings.MaxQueueSize)
+		assert.False(t, settings.AutoEnqueueNewUsers)
+		assert.Equal(t, int64(10000), settings.DailyTokenBudget)
+		assert.Equal(t, 2.5, settings.MonthlyCostBudgetUSD)
+		assert.Equal(t, models.DefaultBudgetNearRatio, settings.BudgetNearRatio)
+		assert.True(t, settings.BudgetNotice)
+		assert.Equal(t, "2025-03", settings.BudgetNoticePeriod)
+	})
+
+	t.Run("updates fail for unknown chat", func(t *testing.T) {
+		repo := newRepo(t)
+
+		assert.Error(t, repo.AddToQueue(ctx, 1, 1))
+		assert.Error(t, repo.SetChatActive(ctx, 1, false))
+	})
+
+	t.Run("concurrent queue mutations are not lost", func(t *testing.T) {
+		repo := newRepo(t)
+		chatID := int64(100)
+		require.NoError(t, repo.NewChat(ctx, chatID))
+
+		const users = 10
+		var wg sync.WaitGroup
+		for userID := int64(1); userID <= users; userID++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, repo.AddUserToChat(ctx, chatID, userID))
+				assert.NoError(t, repo.AddToQueue(ctx, chatID, userID))
+			}()
+		}
+		wg.Wait()
+
+		chat, err := repo.GetChat(ctx, chatID)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, chat.UserIDs)
+		require.Len(t, chat.QuestionQueue, users)
+		for i, entry := range chat.QuestionQueue {
+			assert.Equal(t, i, entry.Position)
+		}
+
+		// Removals race with status updates of the remaining entries
+		for userID := int64(1); userID <= users; userID++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if userID%2 == 0 {
+					assert.NoError(t, repo.RemoveFromQueue(ctx, chatID, userID))
+					return
+				}
+				assert.NoError(t, repo.UpdateQueueEntry(ctx, chatID, models.QueueEntry{
+					UserID: userID,
+					Status: models.QueueStatusAsking,
+				}))
+			}()
+		}
+		wg.Wait()
+
+		chat, err = repo.GetChat(ctx, chatID)
+		require.NoError(t, err)
+		require.Len(t, chat.QuestionQueue, users/2)
+		for _, entry := range chat.QuestionQueue {
+			assert.Equal(t, int64(1), entry.UserID%2)
+			assert.Equal(t, models.QueueStatusAsking, entry.Status)
+		}
+	})
+}
+
+func TestMemoryRepository(t *testing.T) {
+	runChatsRepositoryTests(t, func(t *testing.T) ChatsRepository {
+		return NewMemoryChatsRepository()
+	})
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	runChatsRepositoryTests(t, func(t *testing.T) ChatsRepository {
+		return NewSQLiteChatsRepository(repotest.SQLiteDB(t))
+	})
+}
+
+func TestFirestoreRepository(t *testing.T) {
+	runChatsRepositoryTests(t, func(t *testing.T) ChatsRepository {
+		return NewFirestoreChatsRepository(repotest.FirestoreClient(t))
+	})
+}
+
+func TestMemoryRepository_ReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryChatsRepository()
+	require.NoError(t, repo.NewChat(ctx, 1))
+	require.NoError(t, repo.AddUserToChat(ctx, 1, 7))
+
+	chat, err := repo.GetChat(ctx, 1)
+	require.NoError(t, err)
+	chat.UserIDs[0] = 8
+
+	chat, err = repo.GetChat(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{7}, chat.UserIDs)
+}
@@ -0,0 +1,551 @@
+package chats
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/repository/sqlite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	chatColumns     = `id, title, type, description, is_active, created_at, updated_at`
+	queueColumns    = `user_id, position, enqueued_at, status, question_id, asked_at, answered_at`
+	settingsColumns = `chat_id, question_interval, max_queue_size, auto_enqueue_new_users, skip_inactive_users,
+		inactivity_timeout, enable_question_rounds, daily_token_budget, monthly_token_budget, daily_cost_budget_usd,
+		monthly_cost_budget_usd, budget_near_ratio, budget_notice, budget_notice_period, updated_at`
+)
+
+// SQLiteRepository implements ChatsRepository interface using SQLite.
+// Read-modify-write operations run inside a transaction.
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteChatsRepository creates a new SQLiteRepository with existing database
+func NewSQLiteChatsRepository(db *sql.DB) ChatsRepository {
+	return &SQLiteRepository{
+		db: db,
+	}
+}
+
+// Create new chat in SQLite
+func (r *SQLiteRepository) NewChat(ctx context.Context, chatID int64) error {
+	chat := models.Chat{
+		ID:            chatID,
+		UserIDs:       []int64{},
+		QuestionQueue: []models.QueueEntry{},
+		IsActive:      true,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+
+	err := sqlite.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		return saveChat(ctx, tx, chat)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save chat: %w", err)
+	}
+	return nil
+}
+
+// SaveChat saves or updates a chat to SQLite
+func (r *SQLiteRepository) SaveChat(ctx context.Context, chat models.Chat) error {
+	chat.UpdatedAt = time.Now()
+	if chat.CreatedAt.IsZero() {
+		chat.CreatedAt = time.Now()
+	}
+
+	err := sqlite.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		return saveChat(ctx, tx, chat)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save chat: %w", err)
+	}
+	return nil
+}
+
+// SaveChatInfo saves the title, type, description and active status of a chat, creating it if missing.
+// Only the chat row is written, so its users and queue stay as they are
+func (r *SQLiteRepository) SaveChatInfo(ctx context.Context, chat models.Chat) error {
+	now := sqlite.UnixTime(time.Now())
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO chats (`+chatColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			title = excluded.title,
+			type = excluded.type,
+			description = excluded.description,
+			is_active = excluded.is_active,
+			updated_at = excluded.updated_at`,
+		chat.ID, chat.Title, chat.Type, chat.Description, chat.IsActive, now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save chat info: %w", err)
+	}
+	return nil
+}
+
+// GetChat retrieves a chat by its ID
+func (r *SQLiteRepository) GetChat(ctx context.Context, chatID int64) (*models.Chat, error) {
+	chats, err := queryChats(ctx, r.db, `SELECT `+chatColumns+` FROM chats WHERE id = ?`, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat: %w", err)
+	}
+
+	if len(chats) == 0 {
+		return nil, status.Errorf(codes.NotFound, "chat not found")
+	}
+
+	return chats[0], nil
+}
+
+// GetAllChats retrieves all chats
+func (r *SQLiteRepository) GetAllChats(ctx context.Context) ([]*models.Chat, error) {
+	return queryChats(ctx, r.db, `SELECT `+chatColumns+` FROM chats ORDER BY id`)
+}
+
+// GetActiveChats retrieves all active chats
+func (r *SQLiteRepository) GetActiveChats(ctx context.Context) ([]*models.Chat, error) {
+	return queryChats(ctx, r.db, `SELECT `+chatColumns+` FROM chats WHERE is_active = 1 ORDER BY id`)
+}
+
+// UpdateChatUsers updates the list of users in a chat
+func (r *SQLiteRepository) UpdateChatUsers(ctx context.Context, chatID int64, userIDs []int64) error {
+	err := r.update(ctx, chatID, func(chat *models.Chat) error {
+		chat.UserIDs = slices.Clone(userIDs)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update chat users: %w", err)
+	}
+	return nil
+}
+
+// AddUserToChat adds a user to the chat's user list
+func (r *SQLiteRepository) AddUserToChat(ctx context.Context, chatID int64, userID int64) error {
+	return r.update(ctx, chatID, func(chat *models.Chat) error {
+		if !slices.Contains(chat.UserIDs, userID) {
+			chat.UserIDs = append(chat.UserIDs, userID)
+		}
+		return nil
+	})
+}
+
+// RemoveUserFromChat removes a user from the chat's user list
+func (r *SQLiteRepository) RemoveUserFromChat(ctx context.Context, chatID int64, userID int64) error {
+	return r.update(ctx, chatID, func(chat *models.Chat) error {
+		chat.UserIDs = slices.DeleteFunc(chat.UserIDs, func(id int64) bool {
+			return id == userID
+		})
+
+		// Remove user from queue as well
+		chat.QuestionQueue = slices.DeleteFunc(chat.QuestionQueue, func(entry models.QueueEntry) bool {
+			return entry.UserID == userID
+		})
+		return nil
+	})
+}
+
+// UpdateQuestionQueue updates the entire question queue for a chat
+func (r *SQLiteRepository) UpdateQuestionQueue(ctx context.Context, chatID int64, queue []models.QueueEntry) error {
+	err := r.update(ctx, chatID, func(chat *models.Chat) error {
+		chat.QuestionQueue = queue
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update question queue: %w", err)
+	}
+	return nil
+}
+
+// AddToQueue adds a user to the question queue
+func (r *SQLiteRepository) AddToQueue(ctx context.Context, chatID int64, userID int64) error {
+	return r.update(ctx, chatID, func(chat *models.Chat) error {
+		// Check if user already in queue
+		for _, entry := range chat.QuestionQueue {
+			if entry.UserID == userID && entry.Status == models.QueueStatusWaiting {
+				return nil
+			}
+		}
+
+		// Add to end of queue
+		chat.QuestionQueue = append(chat.QuestionQueue, models.QueueEntry{
+			UserID:     userID,
+			Position:   len(chat.QuestionQueue),
+			EnqueuedAt: time.Now(),
+			Status:     models.QueueStatusWaiting,
+		})
+		return nil
+	})
+}
+
+// RemoveFromQueue removes a user from the question queue
+func (r *SQLiteRepository) RemoveFromQueue(ctx context.Context, chatID int64, userID int64) error {
+	return r.update(ctx, chatID, func(chat *models.Chat) error {
+		var newQueue []models.QueueEntry
+		for _, entry := range chat.QuestionQueue {
+			if entry.UserID != userID {
+				entry.Position = len(newQueue)
+				newQueue = append(newQueue, entry)
+			}
+		}
+
+		chat.QuestionQueue = newQueue
+		return nil
+	})
+}
+
+// GetNextInQueue gets the next user in the question queue
+func (r *SQLiteRepository) GetNextInQueue(ctx context.Context, chatID int64) (*models.QueueEntry, error) {
+	if _, err := r.GetChat(ctx, chatID); err != nil {
+		return nil, fmt.Errorf("failed to get chat: %w", err)
+	}
+
+	queue, err := queryQueue(ctx, r.db, `
+		SELECT `+queueColumns+` FROM queue_entries
+		WHERE chat_id = ? AND status = ?
+		ORDER BY seq
+		LIMIT 1`, chatID, models.QueueStatusWaiting)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(queue) == 0 {
+		return nil, status.Errorf(codes.NotFound, "no users waiting in queue")
+	}
+
+	return &queue[0], nil
+}
+
+// UpdateQueueEntry updates a specific queue entry
+func (r *SQLiteRepository) UpdateQueueEntry(ctx context.Context, chatID int64, entry models.QueueEntry) error {
+	return r.update(ctx, chatID, func(chat *models.Chat) error {
+		for i, queueEntry := range chat.QuestionQueue {
+			if queueEntry.UserID == entry.UserID {
+				chat.QuestionQueue[i] = entry
+				return nil
+			}
+		}
+
+		return status.Errorf(codes.NotFound, "queue entry not found for user")
+	})
+}
+
+// SetQueueEntryStatus changes the status of a user's queue entry
+func (r *SQLiteRepository) SetQueueEntryStatus(ctx context.Context, chatID int64, userID int64, entryStatus string) error {
+	return r.update(ctx, chatID, func(chat *models.Chat) error {
+		return setQueueEntryStatus(chat, userID, entryStatus)
+	})
+}
+
+// GetQueuePosition gets a user's current position in the queue
+func (r *SQLiteRepository) GetQueuePosition(ctx context.Context, chatID int64, userID int64) (int, error) {
+	chat, err := r.GetChat(ctx, chatID)
+	if err != nil {
+		return -1, fmt.Errorf("failed to get chat: %w", err)
+	}
+
+	waitingCount := 0
+	for _, entry := range chat.QuestionQueue {
+		if entry.Status == models.QueueStatusWaiting {
+			if entry.UserID == userID {
+				return waitingCount, nil
+			}
+			waitingCount++
+		}
+	}
+
+	return -1, status.Errorf(codes.NotFound, "user not found in queue")
+}
+
+// ClearCompletedQueue removes completed entries from the queue
+func (r *SQLiteRepository) ClearCompletedQueue(ctx context.Context, chatID int64) error {
+	return r.update(ctx, chatID, func(chat *models.Chat) error {
+		var newQueue []models.QueueEntry
+		for _, entry := range chat.QuestionQueue {
+			if entry.Status == models.QueueStatusWaiting || entry.Status == models.QueueStatusAsking {
+				entry.Position = len(newQueue)
+				newQueue = append(newQueue, entry)
+			}
+		}
+
+		chat.QuestionQueue = newQueue
+		return nil
+	})
+}
+
+// ResetQueue clears the entire queue and rebuilds it from active users
+func (r *SQLiteRepository) ResetQueue(ctx context.Context, chatID int64) error {
+	return r.update(ctx, chatID, func(chat *models.Chat) error {
+		var newQueue []models.QueueEntry
+		for i, userID := range chat.UserIDs {
+			newQueue = append(newQueue, models.QueueEntry{
+				UserID:     userID,
+				Position:   i,
+				EnqueuedAt: time.Now(),
+				Status:     models.QueueStatusWaiting,
+			})
+		}
+
+		chat.QuestionQueue = newQueue
+		return nil
+	})
+}
+
+// SaveChatSettings saves chat settings
+func (r *SQLiteRepository) SaveChatSettings(ctx context.Context, settings models.ChatSettings) error {
+	settings.UpdatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO chat_settings (`+settingsColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chat_id) DO UPDATE SET
+			question_interval = excluded.question_interval,
+			max_queue_size = excluded.max_queue_size,
+			auto_enqueue_new_users = excluded.auto_enqueue_new_users,
+			skip_inactive_users = excluded.skip_inactive_users,
+			inactivity_timeout = excluded.inactivity_timeout,
+			enable_question_rounds = excluded.enable_question_rounds,
+			daily_token_budget = excluded.daily_token_budget,
+			monthly_token_budget = excluded.monthly_token_budget,
+			daily_cost_budget_usd = excluded.daily_cost_budget_usd,
+			monthly_cost_budget_usd = excluded.monthly_cost_budget_usd,
+			budget_near_ratio = excluded.budget_near_ratio,
+			budget_notice = excluded.budget_notice,
+			budget_notice_period = excluded.budget_notice_period,
+			updated_at = excluded.updated_at`,
+		settings.ChatID, int64(settings.QuestionInterval), settings.MaxQueueSize,
+		settings.AutoEnqueueNewUsers, settings.SkipInactiveUsers, int64(settings.InactivityTimeout),
+		settings.EnableQuestionRounds, settings.DailyTokenBudget, settings.MonthlyTokenBudget,
+		settings.DailyCostBudgetUSD, settings.MonthlyCostBudgetUSD, settings.BudgetNearRatio,
+		settings.BudgetNotice, settings.BudgetNoticePeriod, sqlite.UnixTime(settings.UpdatedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save chat settings: %w", err)
+	}
+	return nil
+}
+
+// GetChatSettings retrieves chat settings
+func (r *SQLiteRepository) GetChatSettings(ctx context.Context, chatID int64) (*models.ChatSettings, error) {
+	var settings models.ChatSettings
+	var questionInterval, inactivityTimeout, updatedAt int64
+
+	err := r.db.QueryRowContext(ctx,
+		`SELECT `+settingsColumns+` FROM chat_settings WHERE chat_id = ?`, chatID,
+	).Scan(&settings.ChatID, &questionInterval, &settings.MaxQueueSize, &settings.AutoEnqueueNewUsers,
+		&settings.SkipInactiveUsers, &inactivityTimeout, &settings.EnableQuestionRounds,
+		&settings.DailyTokenBudget, &settings.MonthlyTokenBudget, &settings.DailyCostBudgetUSD,
+		&settings.MonthlyCostBudgetUSD, &settings.BudgetNearRatio, &settings.BudgetNotice,
+		&settings.BudgetNoticePeriod, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Return default settings if not found
+		return models.DefaultChatSettings(chatID), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat settings: %w", err)
+	}
+
+	settings.QuestionInterval = time.Duration(questionInterval)
+	settings.InactivityTimeout = time.Duration(inactivityTimeout)
+	settings.UpdatedAt = sqlite.FromUnixTime(updatedAt)
+	return &settings, nil
+}
+
+// SetChatActive sets the active status of a chat
+func (r *SQLiteRepository) SetChatActive(ctx context.Context, chatID int64, isActive bool) error {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE chats SET is_active = ?, updated_at = ? WHERE id = ?`,
+		isActive, sqlite.UnixTime(time.Now()), chatID)
+	if err == nil {
+		err = requireAffected(result)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update chat active status: %w", err)
+	}
+	return nil
+}
+
+// GetChatsByUser retrieves all chats that contain a specific user
+func (r *SQLiteRepository) GetChatsByUser(ctx context.Context, userID int64) ([]*models.Chat, error) {
+	return queryChats(ctx, r.db, `
+		SELECT `+chatColumns+` FROM chats
+		WHERE id IN (SELECT chat_id FROM chat_users WHERE user_id = ?)
+		ORDER BY id`, userID)
+}
+
+// update loads a chat, applies fn and saves the result in a single transaction
+func (r *SQLiteRepository) update(ctx context.Context, chatID int64, fn func(chat *models.Chat) error) error {
+	return sqlite.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		chats, err := queryChats(ctx, tx, `SELECT `+chatColumns+` FROM chats WHERE id = ?`, chatID)
+		if err != nil {
+			return fmt.Errorf("failed to get chat: %w", err)
+		}
+		if len(chats) == 0 {
+			return fmt.Errorf("failed to get chat: %w", status.Errorf(codes.NotFound, "chat not found"))
+		}
+
+		chat := chats[0]
+		if err := fn(chat); err != nil {
+			return err
+		}
+
+		chat.UpdatedAt = time.Now()
+		return saveChat(ctx, tx, *chat)
+	})
+}
+
+// saveChat writes the chat row together with its users and queue
+func saveChat(ctx context.Context, q sqlite.Querier, chat models.Chat) error {
+	_, err := q.ExecContext(ctx, `
+		INSERT INTO chats (`+chatColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			title = excluded.title,
+			type = excluded.type,
+			description = excluded.description,
+			is_active = excluded.is_active,
+			created_at = excluded.created_at,
+			updated_at = excluded.updated_at`,
+		chat.ID, chat.Title, chat.Type, chat.Description, chat.IsActive,
+		sqlite.UnixTime(chat.CreatedAt), sqlite.UnixTime(chat.UpdatedAt),
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := q.ExecContext(ctx, `DELETE FROM chat_users WHERE chat_id = ?`, chat.ID); err != nil {
+		return err
+	}
+	for i, userID := range chat.UserIDs {
+		_, err := q.ExecContext(ctx,
+			`INSERT INTO chat_users (chat_id, position, user_id) VALUES (?, ?, ?)`, chat.ID, i, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := q.ExecContext(ctx, `DELETE FROM queue_entries WHERE chat_id = ?`, chat.ID); err != nil {
+		return err
+	}
+	for i, entry := range chat.QuestionQueue {
+		_, err := q.ExecContext(ctx, `
+			INSERT INTO queue_entries (chat_id, seq, `+queueColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			chat.ID, i, entry.UserID, entry.Position, sqlite.UnixTime(entry.EnqueuedAt), entry.Status,
+			entry.QuestionID, sqlite.NullUnixTime(entry.AskedAt), sqlite.NullUnixTime(entry.AnsweredAt),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// queryChats reads chat rows and loads their users and queue
+func queryChats(ctx context.Context, q sqlite.Querier, query string, args ...any) ([]*models.Chat, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chats: %w", err)
+	}
+
+	var chats []*models.Chat
+	for rows.Next() {
+		var chat models.Chat
+		var createdAt, updatedAt int64
+		err := rows.Scan(&chat.ID, &chat.Title, &chat.Type, &chat.Description, &chat.IsActive,
+			&createdAt, &updatedAt)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to convert chat data: %w", err)
+		}
+		chat.CreatedAt = sqlite.FromUnixTime(createdAt)
+		chat.UpdatedAt = sqlite.FromUnixTime(updatedAt)
+		chats = append(chats, &chat)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate chats: %w", err)
+	}
+
+	// Load relations after closing rows, the database uses a single connection
+	for _, chat := range chats {
+		if chat.UserIDs, err = queryChatUsers(ctx, q, chat.ID); err != nil {
+			return nil, err
+		}
+		chat.QuestionQueue, err = queryQueue(ctx, q,
+			`SELECT `+queueColumns+` FROM queue_entries WHERE chat_id = ? ORDER BY seq`, chat.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return chats, nil
+}
+
+func queryChatUsers(ctx context.Context, q sqlite.Querier, chatID int64) ([]int64, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT user_id FROM chat_users WHERE chat_id = ? ORDER BY position`, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chat users: %w", err)
+	}
+	defer rows.Close()
+
+	userIDs := []int64{}
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to convert chat user: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, rows.Err()
+}
+
+func queryQueue(ctx context.Context, q sqlite.Querier, query string, args ...any) ([]models.QueueEntry, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query queue: %w", err)
+	}
+	defer rows.Close()
+
+	queue := []models.QueueEntry{}
+	for rows.Next() {
+		var entry models.QueueEntry
+		var enqueuedAt int64
+		var askedAt, answeredAt sql.NullInt64
+		err := rows.Scan(&entry.UserID, &entry.Position, &enqueuedAt, &entry.Status,
+			&entry.QuestionID, &askedAt, &answeredAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert queue entry: %w", err)
+		}
+		entry.EnqueuedAt = sqlite.FromUnixTime(enqueuedAt)
+		entry.AskedAt = sqlite.FromNullUnixTime(askedAt)
+		entry.AnsweredAt = sqlite.FromNullUnixTime(answeredAt)
+		queue = append(queue, entry)
+	}
+
+	return queue, rows.Err()
+}
+
+// requireAffected turns an update that matched no rows into a NotFound error
+func requireAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return status.Errorf(codes.NotFound, "chat not found")
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package messages
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	"github.com/kriku/kpukbot/internal/models"
@@ -27,9 +28,14 @@ func NewFirestoreMessagesRepository(client *firestore.Client) MessagesRepository
 	}
 }
 
+// messageDocID builds the document ID of a message, unique across chats
+func messageDocID(chatID int64, messageID int) string {
+	return fmt.Sprintf("%d_%d", chatID, messageID)
+}
+
 // SaveMessage saves a message to Firestore
 func (r *FirestoreRepository) SaveMessage(ctx context.Context, m models.Message) error {
-	_, err := r.client.Collection(messagesCollection).Doc(fmt.Sprintf("%d", m.ID)).Set(ctx, m)
+	_, err := r.client.Collection(messagesCollection).Doc(messageDocID(m.ChatID, m.ID)).Set(ctx, m)
 	if err != nil {
 		return fmt.Errorf("failed to save message: %w", err)
 	}
@@ -37,19 +43,55 @@ func (r *FirestoreRepository) SaveMessage(ctx context.Context, m models.Message)
 }
 
 func (r *FirestoreRepository) GetMessages(ctx context.Context, chatID int64) ([]*models.Message, error) {
-	iter := r.client.Collection(messagesCollection).
-		Where("chat_id", "==", chatID).
-		Documents(ctx)
-	defer iter.Stop()
+	messages, err := r.queryMessages(ctx, r.chatQuery(chatID, firestore.Asc))
+	if err != nil {
+		return nil, err
+	}
 
-	var messages []*models.Message
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
+	if len(messages) == 0 {
+		return nil, status.Errorf(codes.NotFound, "no messages found")
+	}
+
+	return messages, nil
+}
+
+func (r *FirestoreRepository) GetMessage(ctx context.Context, chatID int64, messageID int) (*models.Message, error) {
+	doc, err := r.client.Collection(messagesCollection).Doc(messageDocID(chatID, messageID)).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, status.Errorf(codes.NotFound, "message with id %d not found in chat %d", messageID, chatID)
 		}
-		if err != nil {
-			return nil, fmt.Errorf("failed to iterate messages: %w", err)
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+
+	var m models.Message
+	if err := doc.DataTo(&m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+
+	return &m, nil
+}
+
+func (r *FirestoreRepository) GetMessagesByIDs(ctx context.Context, chatID int64, ids []int) ([]*models.Message, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	refs := make([]*firestore.DocumentRef, len(ids))
+	for i, id := range ids {
+		refs[i] = r.client.Collection(messagesCollection).Doc(messageDocID(chatID, id))
+	}
+
+	// a single batched read instead of one round-trip per message
+	docs, err := r.client.GetAll(ctx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+
+	messages := make([]*models.Message, 0, len(docs))
+	for _, doc := range docs {
+		if !doc.Exists() {
+			continue
 		}
 
 		var m models.Message
@@ -59,15 +101,63 @@ func (r *FirestoreRepository) GetMessages(ctx context.Context, chatID int64) ([]
 		messages = append(messages, &m)
 	}
 
-	if len(messages) == 0 {
-		return nil, status.Errorf(codes.NotFound, "no messages found")
+	return messages, nil
+}
+
+func (r *FirestoreRepository) GetMessagesPage(ctx context.Context, chatID int64, cursor string, limit int) (*MessagesPage, error) {
+	limit = pageLimit(limit)
+
+	query := r.chatQuery(chatID, firestore.Desc)
+	if cursor != "" {
+		date, id, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		query = query.StartAfter(date, id)
 	}
 
-	return messages, nil
+	messages, err := r.queryMessages(ctx, query.Limit(limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(messages, limit), nil
+}
+
+func (r *FirestoreRepository) GetLastMessages(ctx context.Context, chatID int64, limit int) ([]*models.Message, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	messages, err := r.queryMessages(ctx, r.chatQuery(chatID, firestore.Desc).Limit(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	return reverse(messages), nil
+}
+
+func (r *FirestoreRepository) GetMessagesBetween(ctx context.Context, chatID int64, from, to time.Time) ([]*models.Message, error) {
+	query := r.client.Collection(messagesCollection).
+		Where("chat_id", "==", chatID).
+		Where("date", ">=", from).
+		Where("date", "<", to).
+		OrderBy("date", firestore.Asc).
+		OrderBy("id", firestore.Asc)
+
+	return r.queryMessages(ctx, query)
+}
+
+// chatQuery selects the messages of a chat ordered by date, with the message ID as a tie-breaker
+func (r *FirestoreRepository) chatQuery(chatID int64, dir firestore.Direction) firestore.Query {
+	return r.client.Collection(messagesCollection).
+		Where("chat_id", "==", chatID).
+		OrderBy("date", dir).
+		OrderBy("id", dir)
 }
 
-func (r *FirestoreRepository) GetMessage(ctx context.Context, id int64) ([]*models.Message, error) {
-	iter := r.client.Collection(messagesCollection).Where("id", "==", id).Documents(ctx)
+func (r *FirestoreRepository) queryMessages(ctx context.Context, query firestore.Query) ([]*models.Message, error) {
+	iter := query.Documents(ctx)
 	defer iter.Stop()
 
 	var messages []*models.Message
@@ -84,13 +174,8 @@ func (r *FirestoreRepository) GetMessage(ctx context.Context, id int64) ([]*mode
 		if err := doc.DataTo(&m); err != nil {
 			return nil, fmt.Errorf("failed to unmarshal message: %w", err)
 		}
-
 		messages = append(messages, &m)
 	}
 
-	if len(messages) == 0 {
-		return nil, status.Errorf(codes.NotFound, "message with id %d not found", id)
-	}
-
 	return messages, nil
 }
@@ -0,0 +1,157 @@
+package messages
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// messageKey identifies a message, Telegram message IDs are only unique per chat
+type messageKey struct {
+	chatID    int64
+	messageID int
+}
+
+// MemoryRepository implements MessagesRepository interface in memory
+type MemoryRepository struct {
+	mu       sync.RWMutex
+	messages map[messageKey]models.Message
+}
+
+// NewMemoryMessagesRepository creates a new empty MemoryRepository
+func NewMemoryMessagesRepository() MessagesRepository {
+	return &MemoryRepository{
+		messages: make(map[messageKey]models.Message),
+	}
+}
+
+// SaveMessage saves a message in memory
+func (r *MemoryRepository) SaveMessage(ctx context.Context, m models.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Copies handed out share the history, appending to them must not reach the stored one
+	m.Edits = slices.Clip(slices.Clone(m.Edits))
+	m.Attachments = slices.Clip(slices.Clone(m.Attachments))
+	if m.Image != nil {
+		image := *m.Image
+		image.Data = nil // Like the other backends, downloaded data is not stored
+		m.Image = &image
+	}
+	if m.Voice != nil {
+		voice := *m.Voice
+		m.Voice = &voice
+	}
+	r.messages[messageKey{chatID: m.ChatID, messageID: m.ID}] = m
+	return nil
+}
+
+func (r *MemoryRepository) GetMessages(ctx context.Context, chatID int64) ([]*models.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	messages := r.chatMessages(chatID)
+	if len(messages) == 0 {
+		return nil, status.Errorf(codes.NotFound, "no messages found")
+	}
+
+	return messages, nil
+}
+
+func (r *MemoryRepository) GetMessage(ctx context.Context, chatID int64, messageID int) (*models.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m, ok := r.messages[messageKey{chatID: chatID, messageID: messageID}]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "message with id %d not found in chat %d", messageID, chatID)
+	}
+
+	return &m, nil
+}
+
+func (r *MemoryRepository) GetMessagesByIDs(ctx context.Context, chatID int64, ids []int) ([]*models.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	messages := make([]*models.Message, 0, len(ids))
+	for _, id := range ids {
+		if m, ok := r.messages[messageKey{chatID: chatID, messageID: id}]; ok {
+			messages = append(messages, &m)
+		}
+	}
+
+	return messages, nil
+}
+
+func (r *MemoryRepository) GetMessagesPage(ctx context.Context, chatID int64, cursor string, limit int) (*MessagesPage, error) {
+	limit = pageLimit(limit)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	messages := reverse(r.chatMessages(chatID))
+	if cursor != "" {
+		date, id, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		// skip everything up to and including the cursor message
+		start := sort.Search(len(messages), func(i int) bool {
+			m := messages[i]
+			return m.Date.Before(date) || (m.Date.Equal(date) && m.ID < id)
+		})
+		messages = messages[start:]
+	}
+
+	return newPage(messages[:min(len(messages), limit+1)], limit), nil
+}
+
+func (r *MemoryRepository) GetLastMessages(ctx context.Context, chatID int64, limit int) ([]*models.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	messages := r.chatMessages(chatID)
+	return messages[max(0, len(messages)-limit):], nil
+}
+
+func (r *MemoryRepository) GetMessagesBetween(ctx context.Context, chatID int64, from, to time.Time) ([]*models.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var messages []*models.Message
+	for _, m := range r.chatMessages(chatID) {
+		if !m.Date.Before(from) && m.Date.Before(to) {
+			messages = append(messages, m)
+		}
+	}
+
+	return messages, nil
+}
+
+// chatMessages returns copies of the messages of a chat in chronological order, the caller must hold the lock
+func (r *MemoryRepository) chatMessages(chatID int64) []*models.Message {
+	var messages []*models.Message
+	for _, m := range r.messages {
+		if m.ChatID == chatID {
+			m := m
+			messages = append(messages, &m)
+		}
+	}
+
+	// Keep a stable chronological order, map iteration is random
+	sort.Slice(messages, func(i, j int) bool {
+		if messages[i].Date.Equal(messages[j].Date) {
+			return messages[i].ID < messages[j].ID
+		}
+		return messages[i].Date.Before(messages[j].Date)
+	})
+
+	return messages
+}
@@ -2,12 +2,25 @@ package messages
 
 import (
 	"context"
+	"time"
 
 	"github.com/kriku/kpukbot/internal/models"
 )
 
+// MessagesRepository stores messages keyed by chat and message ID,
+// Telegram message IDs are only unique within a chat
 type MessagesRepository interface {
 	SaveMessage(ctx context.Context, m models.Message) error
-	GetMessage(ctx context.Context, ID int64) ([]*models.Message, error)
+	GetMessage(ctx context.Context, chatID int64, messageID int) (*models.Message, error)
+	// GetMessagesByIDs fetches several messages of a chat at once, in the order of ids.
+	// Unknown ids are skipped.
+	GetMessagesByIDs(ctx context.Context, chatID int64, ids []int) ([]*models.Message, error)
+	// GetMessages returns the whole chat history in chronological order
 	GetMessages(ctx context.Context, chatID int64) ([]*models.Message, error)
+	// GetMessagesPage returns chat history from newest to oldest, pass an empty cursor for the first page
+	GetMessagesPage(ctx context.Context, chatID int64, cursor string, limit int) (*MessagesPage, error)
+	// GetLastMessages returns the last limit messages of a chat in chronological order
+	GetLastMessages(ctx context.Context, chatID int64, limit int) ([]*models.Message, error)
+	// GetMessagesBetween returns messages sent in [from, to) in chronological order
+	GetMessagesBetween(ctx context.Context, chatID int64, from, to time.Time) ([]*models.Message, error)
 }
@@ -0,0 +1,66 @@
+package messages
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/firestore"
+	"github.com/kriku/kpukbot/internal/models"
+	"google.golang.org/api/iterator"
+)
+
+// MigrateFirestoreMessageKeys moves messages stored under the legacy message ID document key
+// to the chat scoped key, returns the number of moved documents. Safe to run more than once.
+func MigrateFirestoreMessageKeys(ctx context.Context, client *firestore.Client) (int, error) {
+	iter := client.Collection(messagesCollection).Documents(ctx)
+	defer iter.Stop()
+
+	bw := client.BulkWriter(ctx)
+	var jobs []*firestore.BulkWriterJob
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			bw.End()
+			return 0, fmt.Errorf("failed to iterate messages: %w", err)
+		}
+
+		var m models.Message
+		if err := doc.DataTo(&m); err != nil {
+			bw.End()
+			return 0, fmt.Errorf("failed to unmarshal message %s: %w", doc.Ref.ID, err)
+		}
+
+		newID := messageDocID(m.ChatID, m.ID)
+		if doc.Ref.ID == newID {
+			continue
+		}
+
+		job, err := bw.Set(client.Collection(messagesCollection).Doc(newID), m)
+		if err != nil {
+			bw.End()
+			return 0, fmt.Errorf("failed to enqueue message %s: %w", newID, err)
+		}
+		jobs = append(jobs, job)
+
+		job, err = bw.Delete(doc.Ref)
+		if err != nil {
+			bw.End()
+			return 0, fmt.Errorf("failed to enqueue delete of message %s: %w", doc.Ref.ID, err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	bw.End()
+
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			return 0, fmt.Errorf("failed to migrate messages: %w", err)
+		}
+	}
+
+	return len(jobs) / 2, nil
+}
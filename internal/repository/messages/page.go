@@ -0,0 +1,90 @@
+package messages
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultPageSize is used when a page is requested without a limit
+const DefaultPageSize = 50
+
+// MessagesPage is a page of chat history ordered from newest to oldest
+type MessagesPage struct {
+	Messages []*models.Message
+	// NextCursor continues with older messages, empty on the last page
+	NextCursor string
+}
+
+// pageLimit returns the limit to use for a page request
+func pageLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultPageSize
+	}
+	return limit
+}
+
+// encodeCursor builds an opaque cursor pointing right after the given message
+func encodeCursor(m *models.Message) string {
+	return fmt.Sprintf("%d_%d", m.Date.UnixNano(), m.ID)
+}
+
+// decodeCursor parses a cursor built by encodeCursor
+func decodeCursor(cursor string) (time.Time, int, error) {
+	date, id, ok := strings.Cut(cursor, "_")
+	if !ok {
+		return time.Time{}, 0, status.Errorf(codes.InvalidArgument, "invalid cursor %q", cursor)
+	}
+
+	nanos, err := strconv.ParseInt(date, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, status.Errorf(codes.InvalidArgument, "invalid cursor %q", cursor)
+	}
+
+	messageID, err := strconv.Atoi(id)
+	if err != nil {
+		return time.Time{}, 0, status.Errorf(codes.InvalidArgument, "invalid cursor %q", cursor)
+	}
+
+	return time.Unix(0, nanos), messageID, nil
+}
+
+// newPage builds a page from up to limit+1 messages ordered from newest to oldest,
+// the extra message only signals that there are more pages
+func newPage(messages []*models.Message, limit int) *MessagesPage {
+	page := &MessagesPage{Messages: messages}
+	if len(messages) > limit {
+		page.Messages = messages[:limit]
+		page.NextCursor = encodeCursor(page.Messages[limit-1])
+	}
+	return page
+}
+
+// orderByIDs returns the messages in the order of ids, skipping ids without a message
+func orderByIDs(messages []*models.Message, ids []int) []*models.Message {
+	byID := make(map[int]*models.Message, len(messages))
+	for _, m := range messages {
+		byID[m.ID] = m
+	}
+
+	ordered := make([]*models.Message, 0, len(messages))
+	for _, id := range ids {
+		if m, ok := byID[id]; ok {
+			ordered = append(ordered, m)
+		}
+	}
+	return ordered
+}
+
+// reverse returns messages in the opposite order
+func reverse(messages []*models.Message) []*models.Message {
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages
+}
@@ -0,0 +1,235 @@
+package messages
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/repository/repotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// runMessagesRepositoryTests checks behaviour every MessagesRepository implementation must share
+func runMessagesRepositoryTests(t *testing.T, newRepo func(t *testing.T) MessagesRepository) {
+	ctx := context.Background()
+
+	t.Run("save and get message", func(t *testing.T) {
+		repo := newRepo(t)
+		require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: 1, ChatID: 100, Text: "hello", Date: time.Now()}))
+
+		message, err := repo.GetMessage(ctx, 100, 1)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", message.Text)
+
+		_, err = repo.GetMessage(ctx, 100, 2)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("same message id in different chats", func(t *testing.T) {
+		repo := newRepo(t)
+		require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: 1, ChatID: 100, Text: "first", Date: time.Now()}))
+		require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: 1, ChatID: 200, Text: "second", Date: time.Now()}))
+
+		message, err := repo.GetMessage(ctx, 100, 1)
+		require.NoError(t, err)
+		assert.Equal(t, "first", message.Text)
+
+		message, err = repo.GetMessage(ctx, 200, 1)
+		require.NoError(t, err)
+		assert.Equal(t, "second", message.Text)
+
+		_, err = repo.GetMessage(ctx, 300, 1)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("messages by chat", func(t *testing.T) {
+		repo := newRepo(t)
+		now := time.Now()
+		require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: 2, ChatID: 100, Date: now}))
+		require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: 1, ChatID: 100, Date: now.Add(-time.Minute)}))
+		require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: 3, ChatID: 200, Date: now}))
+
+		messages, err := repo.GetMessages(ctx, 100)
+		require.NoError(t, err)
+
+		require.Len(t, messages, 2)
+		assert.Equal(t, 1, messages[0].ID)
+		assert.Equal(t, 2, messages[1].ID)
+
+		_, err = repo.GetMessages(ctx, 300)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("messages by ids", func(t *testing.T) {
+		repo := newRepo(t)
+		now := time.Now()
+		for id := 1; id <= 3; id++ {
+			require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: id, ChatID: 100, Date: now}))
+		}
+		require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: 4, ChatID: 200, Date: now}))
+
+		messages, err := repo.GetMessagesByIDs(ctx, 100, []int{3, 1, 4, 42})
+		require.NoError(t, err)
+		require.Len(t, messages, 2)
+		assert.Equal(t, 3, messages[0].ID)
+		assert.Equal(t, 1, messages[1].ID)
+
+		messages, err = repo.GetMessagesByIDs(ctx, 100, nil)
+		require.NoError(t, err)
+		assert.Empty(t, messages)
+	})
+
+	t.Run("edits and deletion are kept", func(t *testing.T) {
+		repo := newRepo(t)
+		now := time.Now().Truncate(time.Second)
+		message := models.Message{ID: 1, ChatID: 100, Text: "hello", Date: now}
+		require.NoError(t, repo.SaveMessage(ctx, message))
+		require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: 2, ChatID: 100, Text: "other", Date: now}))
+
+		message.ApplyEdit(&models.Message{Text: "hello there"}, now.Add(time.Minute))
+		message.ApplyEdit(&models.Message{Text: "hello there!"}, now.Add(2*time.Minute))
+		message.Deleted = true
+		require.NoError(t, repo.SaveMessage(ctx, message))
+
+		messages, err := repo.GetMessagesByIDs(ctx, 100, []int{1, 2})
+		require.NoError(t, err)
+		require.Len(t, messages, 2)
+
+		edited := messages[0]
+		assert.Equal(t, "hello there!", edited.Text)
+		assert.True(t, edited.Deleted)
+		require.Len(t, edited.Edits, 2)
+		assert.Equal(t, "hello", edited.Edits[0].Text)
+		assert.True(t, now.Add(time.Minute).Equal(edited.Edits[0].EditedAt))
+		assert.Equal(t, "hello there", edited.Edits[1].Text)
+
+		assert.Empty(t, messages[1].Edits)
+		assert.False(t, messages[1].Deleted)
+	})
+
+	t.Run("images are kept without their data", func(t *testing.T) {
+		repo := newRepo(t)
+		message := models.Message{ID: 1, ChatID: 100, Text: "look", Date: time.Now().Truncate(time.Second), Image: &models.MessageImage{
+			FileID:      "file-1",
+			MIMEType:    "image/png",
+			Description: "A cat on a keyboard",
+			Data:        []byte("png"),
+		}}
+		require.NoError(t, repo.SaveMessage(ctx, message))
+		require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: 2, ChatID: 100, Text: "plain", Date: message.Date}))
+
+		messages, err := repo.GetMessagesByIDs(ctx, 100, []int{1, 2})
+		require.NoError(t, err)
+		require.Len(t, messages, 2)
+
+		assert.Equal(t, &models.MessageImage{FileID: "file-1", MIMEType: "image/png", Description: "A cat on a keyboard"}, messages[0].Image)
+		assert.Nil(t, messages[1].Image)
+	})
+
+	t.Run("voice transcripts are kept", func(t *testing.T) {
+		repo := newRepo(t)
+		require.NoError(t, repo.SaveMessage(ctx, models.Message{
+			ID:         1,
+			ChatID:     100,
+			Text:       "see you at eight",
+			Date:       time.Now().Truncate(time.Second),
+			Voice:      &models.MessageVoice{FileID: "voice-1", MIMEType: "audio/ogg"},
+			Transcript: true,
+		}))
+
+		message, err := repo.GetMessage(ctx, 100, 1)
+		require.NoError(t, err)
+		assert.Equal(t, &models.MessageVoice{FileID: "voice-1", MIMEType: "audio/ogg"}, message.Voice)
+		assert.True(t, message.Transcript)
+		assert.Equal(t, "see you at eight", message.Text)
+	})
+
+	t.Run("attachments are kept", func(t *testing.T) {
+		repo := newRepo(t)
+		now := time.Now().Truncate(time.Second)
+		attachments := []models.MessageAttachment{
+			{Source: "report.pdf", Summary: "Quarterly numbers"},
+			{Source: "https://example.com", Summary: "An example page"},
+		}
+		require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: 1, ChatID: 100, Date: now, Attachments: attachments}))
+		require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: 2, ChatID: 100, Date: now}))
+
+		messages, err := repo.GetMessagesByIDs(ctx, 100, []int{1, 2})
+		require.NoError(t, err)
+		require.Len(t, messages, 2)
+		assert.Equal(t, attachments, messages[0].Attachments)
+		assert.Empty(t, messages[1].Attachments)
+
+		// Saving again replaces the attachments
+		require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: 1, ChatID: 100, Date: now, Attachments: attachments[1:]}))
+		message, err := repo.GetMessage(ctx, 100, 1)
+		require.NoError(t, err)
+		assert.Equal(t, attachments[1:], message.Attachments)
+	})
+
+	t.Run("history pages", func(t *testing.T) {
+		repo := newRepo(t)
+		start := time.Now().Truncate(time.Second)
+		for id := 1; id <= 5; id++ {
+			require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: id, ChatID: 100, Date: start.Add(time.Duration(id) * time.Minute)}))
+		}
+		// same date as message 5, ordered by ID
+		require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: 6, ChatID: 100, Date: start.Add(5 * time.Minute)}))
+		require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: 7, ChatID: 200, Date: start}))
+
+		var ids []int
+		cursor := ""
+		pages := 0
+		for {
+			page, err := repo.GetMessagesPage(ctx, 100, cursor, 4)
+			require.NoError(t, err)
+			for _, m := range page.Messages {
+				ids = append(ids, m.ID)
+			}
+			pages++
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+		assert.Equal(t, 2, pages)
+		assert.Equal(t, []int{6, 5, 4, 3, 2, 1}, ids)
+
+		_, err := repo.GetMessagesPage(ctx, 100, "bogus", 4)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		last, err := repo.GetLastMessages(ctx, 100, 3)
+		require.NoError(t, err)
+		require.Len(t, last, 3)
+		assert.Equal(t, 4, last[0].ID)
+		assert.Equal(t, 6, last[2].ID)
+
+		between, err := repo.GetMessagesBetween(ctx, 100, start.Add(2*time.Minute), start.Add(5*time.Minute))
+		require.NoError(t, err)
+		require.Len(t, between, 3)
+		assert.Equal(t, 2, between[0].ID)
+		assert.Equal(t, 4, between[2].ID)
+	})
+}
+
+func TestMemoryRepository(t *testing.T) {
+	runMessagesRepositoryTests(t, func(t *testing.T) MessagesRepository {
+		return NewMemoryMessagesRepository()
+	})
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	runMessagesRepositoryTests(t, func(t *testing.T) MessagesRepository {
+		return NewSQLiteMessagesRepository(repotest.SQLiteDB(t))
+	})
+}
+
+func TestFirestoreRepository(t *testing.T) {
+	runMessagesRepositoryTests(t, func(t *testing.T) MessagesRepository {
+		return NewFirestoreMessagesRepository(repotest.FirestoreClient(t))
+	})
+}
@@ -0,0 +1,336 @@
+package messages
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/repository/sqlite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const messageColumns = `id, reply_to_message_id, chat_id, user_id, text, username, first_name, last_name, date, is_bot, deleted,
+	image_file_id, image_mime_type, image_description, voice_file_id, voice_mime_type, transcript`
+
+// SQLiteRepository implements MessagesRepository interface using SQLite
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteMessagesRepository creates a new SQLiteRepository with existing database
+func NewSQLiteMessagesRepository(db *sql.DB) MessagesRepository {
+	return &SQLiteRepository{
+		db: db,
+	}
+}
+
+// SaveMessage saves a message with its edit history and attachments to SQLite
+func (r *SQLiteRepository) SaveMessage(ctx context.Context, m models.Message) error {
+	var image models.MessageImage
+	if m.Image != nil {
+		image = *m.Image
+	}
+	var voice models.MessageVoice
+	if m.Voice != nil {
+		voice = *m.Voice
+	}
+
+	err := sqlite.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO messages (`+messageColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (chat_id, id) DO UPDATE SET
+				reply_to_message_id = excluded.reply_to_message_id,
+				user_id = excluded.user_id,
+				text = excluded.text,
+				username = excluded.username,
+				first_name = excluded.first_name,
+				last_name = excluded.last_name,
+				date = excluded.date,
+				is_bot = excluded.is_bot,
+				deleted = excluded.deleted,
+				image_file_id = excluded.image_file_id,
+				image_mime_type = excluded.image_mime_type,
+				image_description = excluded.image_description,
+				voice_file_id = excluded.voice_file_id,
+				voice_mime_type = excluded.voice_mime_type,
+				transcript = excluded.transcript`,
+			m.ID, m.ReplyToMessageID, m.ChatID, m.UserID, m.Text,
+			m.Username, m.FirstName, m.LastName, sqlite.UnixTime(m.Date), m.IsBot, m.Deleted,
+			image.FileID, image.MIMEType, image.Description, voice.FileID, voice.MIMEType, m.Transcript,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM message_edits WHERE chat_id = ? AND message_id = ?`, m.ChatID, m.ID)
+		if err != nil {
+			return err
+		}
+
+		for i, edit := range m.Edits {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO message_edits (chat_id, message_id, position, text, edited_at)
+				VALUES (?, ?, ?, ?, ?)`,
+				m.ChatID, m.ID, i, edit.Text, sqlite.UnixTime(edit.EditedAt))
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM message_attachments WHERE chat_id = ? AND message_id = ?`, m.ChatID, m.ID)
+		if err != nil {
+			return err
+		}
+
+		for i, attachment := range m.Attachments {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO message_attachments (chat_id, message_id, position, source, summary)
+				VALUES (?, ?, ?, ?, ?)`,
+				m.ChatID, m.ID, i, attachment.Source, attachment.Summary)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save message: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) GetMessages(ctx context.Context, chatID int64) ([]*models.Message, error) {
+	messages, err := r.queryMessages(ctx,
+		`SELECT `+messageColumns+` FROM messages WHERE chat_id = ? ORDER BY date, id`, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(messages) == 0 {
+		return nil, status.Errorf(codes.NotFound, "no messages found")
+	}
+
+	return messages, nil
+}
+
+func (r *SQLiteRepository) GetMessage(ctx context.Context, chatID int64, messageID int) (*models.Message, error) {
+	messages, err := r.queryMessages(ctx,
+		`SELECT `+messageColumns+` FROM messages WHERE chat_id = ? AND id = ?`, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(messages) == 0 {
+		return nil, status.Errorf(codes.NotFound, "message with id %d not found in chat %d", messageID, chatID)
+	}
+
+	return messages[0], nil
+}
+
+func (r *SQLiteRepository) GetMessagesByIDs(ctx context.Context, chatID int64, ids []int) ([]*models.Message, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := make([]any, 0, len(ids)+1)
+	args = append(args, chatID)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	messages, err := r.queryMessages(ctx,
+		`SELECT `+messageColumns+` FROM messages WHERE chat_id = ? AND id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return orderByIDs(messages, ids), nil
+}
+
+func (r *SQLiteRepository) GetMessagesPage(ctx context.Context, chatID int64, cursor string, limit int) (*MessagesPage, error) {
+	limit = pageLimit(limit)
+
+	query := `SELECT ` + messageColumns + ` FROM messages WHERE chat_id = ?`
+	args := []any{chatID}
+	if cursor != "" {
+		date, id, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		query += ` AND (date < ? OR (date = ? AND id < ?))`
+		args = append(args, sqlite.UnixTime(date), sqlite.UnixTime(date), id)
+	}
+	query += ` ORDER BY date DESC, id DESC LIMIT ?`
+	args = append(args, limit+1)
+
+	messages, err := r.queryMessages(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(messages, limit), nil
+}
+
+func (r *SQLiteRepository) GetLastMessages(ctx context.Context, chatID int64, limit int) ([]*models.Message, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	messages, err := r.queryMessages(ctx,
+		`SELECT `+messageColumns+` FROM messages WHERE chat_id = ? ORDER BY date DESC, id DESC LIMIT ?`,
+		chatID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return reverse(messages), nil
+}
+
+func (r *SQLiteRepository) GetMessagesBetween(ctx context.Context, chatID int64, from, to time.Time) ([]*models.Message, error) {
+	return r.queryMessages(ctx,
+		`SELECT `+messageColumns+` FROM messages WHERE chat_id = ? AND date >= ? AND date < ? ORDER BY date, id`,
+		chatID, sqlite.UnixTime(from), sqlite.UnixTime(to))
+}
+
+func (r *SQLiteRepository) queryMessages(ctx context.Context, query string, args ...any) ([]*models.Message, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+
+	var messages []*models.Message
+	for rows.Next() {
+		var m models.Message
+		var date int64
+		var image models.MessageImage
+		var voice models.MessageVoice
+		err := rows.Scan(&m.ID, &m.ReplyToMessageID, &m.ChatID, &m.UserID, &m.Text,
+			&m.Username, &m.FirstName, &m.LastName, &date, &m.IsBot, &m.Deleted,
+			&image.FileID, &image.MIMEType, &image.Description, &voice.FileID, &voice.MIMEType, &m.Transcript)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to unmarshal message: %w", err)
+		}
+		m.Date = sqlite.FromUnixTime(date)
+		if image.FileID != "" {
+			m.Image = &image
+		}
+		if voice.FileID != "" {
+			m.Voice = &voice
+		}
+		messages = append(messages, &m)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate messages: %w", err)
+	}
+
+	// Load edits and attachments after closing rows, the database uses a single connection
+	if err := r.loadEdits(ctx, messages); err != nil {
+		return nil, err
+	}
+	if err := r.loadAttachments(ctx, messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// idRange is the range of message IDs of a chat
+type idRange struct{ from, to int }
+
+// messageRanges returns the message ID range of every chat and the messages by key. Edits and
+// attachments are rare, so the ones of a range are read at once instead of querying each message
+func messageRanges(messages []*models.Message) (map[int64]idRange, map[messageKey]*models.Message) {
+	ranges := make(map[int64]idRange)
+	byKey := make(map[messageKey]*models.Message, len(messages))
+	for _, m := range messages {
+		byKey[messageKey{chatID: m.ChatID, messageID: m.ID}] = m
+		ids, ok := ranges[m.ChatID]
+		if !ok {
+			ids = idRange{from: m.ID, to: m.ID}
+		}
+		ranges[m.ChatID] = idRange{from: min(ids.from, m.ID), to: max(ids.to, m.ID)}
+	}
+	return ranges, byKey
+}
+
+// loadEdits attaches the edit history to messages
+func (r *SQLiteRepository) loadEdits(ctx context.Context, messages []*models.Message) error {
+	ranges, byKey := messageRanges(messages)
+
+	for chatID, ids := range ranges {
+		rows, err := r.db.QueryContext(ctx, `
+			SELECT message_id, text, edited_at FROM message_edits
+			WHERE chat_id = ? AND message_id BETWEEN ? AND ?
+			ORDER BY message_id, position`, chatID, ids.from, ids.to)
+		if err != nil {
+			return fmt.Errorf("failed to query message edits: %w", err)
+		}
+
+		for rows.Next() {
+			var messageID int
+			var edit models.MessageEdit
+			var editedAt int64
+			if err := rows.Scan(&messageID, &edit.Text, &editedAt); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to unmarshal message edit: %w", err)
+			}
+			edit.EditedAt = sqlite.FromUnixTime(editedAt)
+
+			if m, ok := byKey[messageKey{chatID: chatID, messageID: messageID}]; ok {
+				m.Edits = append(m.Edits, edit)
+			}
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to iterate message edits: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// loadAttachments attaches the document and web page summaries to messages
+func (r *SQLiteRepository) loadAttachments(ctx context.Context, messages []*models.Message) error {
+	ranges, byKey := messageRanges(messages)
+
+	for chatID, ids := range ranges {
+		rows, err := r.db.QueryContext(ctx, `
+			SELECT message_id, source, summary FROM message_attachments
+			WHERE chat_id = ? AND message_id BETWEEN ? AND ?
+			ORDER BY message_id, position`, chatID, ids.from, ids.to)
+		if err != nil {
+			return fmt.Errorf("failed to query message attachments: %w", err)
+		}
+
+		for rows.Next() {
+			var messageID int
+			var attachment models.MessageAttachment
+			if err := rows.Scan(&messageID, &attachment.Source, &attachment.Summary); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to unmarshal message attachment: %w", err)
+			}
+
+			if m, ok := byKey[messageKey{chatID: chatID, messageID: messageID}]; ok {
+				m.Attachments = append(m.Attachments, attachment)
+			}
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to iterate message attachments: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package processed
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/kriku/kpukbot/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	processedCollection = "processed_updates"
+)
+
+// FirestoreRepository implements ProcessedUpdatesRepository interface using Firestore.
+// Claims run inside a transaction. A TTL policy on expires_at lets Firestore delete old records
+type FirestoreRepository struct {
+	client *firestore.Client
+}
+
+// NewFirestoreProcessedUpdatesRepository creates a new FirestoreRepository with existing client
+func NewFirestoreProcessedUpdatesRepository(client *firestore.Client) ProcessedUpdatesRepository {
+	return &FirestoreRepository{
+		client: client,
+	}
+}
+
+func (r *FirestoreRepository) doc(updateID int64) *firestore.DocumentRef {
+	return r.client.Collection(processedCollection).Doc(fmt.Sprintf("%d", updateID))
+}
+
+func (r *FirestoreRepository) Claim(ctx context.Context, updateID int64, lease, ttl time.Duration) (*models.ProcessedUpdate, bool, error) {
+	var update models.ProcessedUpdate
+	var claimed bool
+
+	ref := r.doc(updateID)
+	err := r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var existing *models.ProcessedUpdate
+
+		doc, err := tx.Get(ref)
+		switch {
+		case status.Code(err) == codes.NotFound:
+		case err != nil:
+			return err
+		default:
+			existing = &models.ProcessedUpdate{}
+			if err := doc.DataTo(existing); err != nil {
+				return err
+			}
+		}
+
+		update, claimed = claim(existing, updateID, time.Now(), lease, ttl)
+		if !claimed {
+			return nil
+		}
+		return tx.Set(ref, update)
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to claim update: %w", err)
+	}
+
+	return &update, claimed, nil
+}
+
+func (r *FirestoreRepository) MarkReplied(ctx context.Context, updateID int64) error {
+	return r.update(ctx, updateID, firestore.Update{Path: "replied", Value: true})
+}
+
+func (r *FirestoreRepository) Complete(ctx context.Context, updateID int64) error {
+	return r.update(ctx, updateID, firestore.Update{Path: "status", Value: models.UpdateStatusDone})
+}
+
+func (r *FirestoreRepository) Release(ctx context.Context, updateID int64) error {
+	return r.update(ctx, updateID, firestore.Update{Path: "lease_until", Value: time.Now()})
+}
+
+func (r *FirestoreRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	docs, err := r.client.Collection(processedCollection).Where("expires_at", "<=", now).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get expired updates: %w", err)
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+
+	bulk := r.client.BulkWriter(ctx)
+	for _, doc := range docs {
+		if _, err := bulk.Delete(doc.Ref); err != nil {
+			bulk.End()
+			return 0, fmt.Errorf("failed to delete expired update: %w", err)
+		}
+	}
+	bulk.End()
+
+	return len(docs), nil
+}
+
+func (r *FirestoreRepository) update(ctx context.Context, updateID int64, update firestore.Update) error {
+	_, err := r.doc(updateID).Update(ctx, []firestore.Update{
+		update,
+		{Path: "updated_at", Value: time.Now()},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update processed update: %w", err)
+	}
+	return nil
+}
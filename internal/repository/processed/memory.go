@@ -0,0 +1,87 @@
+package processed
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MemoryRepository implements ProcessedUpdatesRepository interface in memory
+type MemoryRepository struct {
+	mu      sync.Mutex
+	updates map[int64]models.ProcessedUpdate
+}
+
+// NewMemoryProcessedUpdatesRepository creates a new empty MemoryRepository
+func NewMemoryProcessedUpdatesRepository() ProcessedUpdatesRepository {
+	return &MemoryRepository{
+		updates: make(map[int64]models.ProcessedUpdate),
+	}
+}
+
+func (r *MemoryRepository) Claim(ctx context.Context, updateID int64, lease, ttl time.Duration) (*models.ProcessedUpdate, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var existing *models.ProcessedUpdate
+	if update, ok := r.updates[updateID]; ok {
+		existing = &update
+	}
+
+	update, claimed := claim(existing, updateID, time.Now(), lease, ttl)
+	if claimed {
+		r.updates[updateID] = update
+	}
+	return &update, claimed, nil
+}
+
+func (r *MemoryRepository) MarkReplied(ctx context.Context, updateID int64) error {
+	return r.update(updateID, func(update *models.ProcessedUpdate) {
+		update.Replied = true
+	})
+}
+
+func (r *MemoryRepository) Complete(ctx context.Context, updateID int64) error {
+	return r.update(updateID, func(update *models.ProcessedUpdate) {
+		update.Status = models.UpdateStatusDone
+	})
+}
+
+func (r *MemoryRepository) Release(ctx context.Context, updateID int64) error {
+	return r.update(updateID, func(update *models.ProcessedUpdate) {
+		update.LeaseUntil = time.Now()
+	})
+}
+
+func (r *MemoryRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted := 0
+	for id, update := range r.updates {
+		if !update.ExpiresAt.After(now) {
+			delete(r.updates, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (r *MemoryRepository) update(updateID int64, fn func(update *models.ProcessedUpdate)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	update, ok := r.updates[updateID]
+	if !ok {
+		return status.Errorf(codes.NotFound, "update not found")
+	}
+
+	fn(&update)
+	update.UpdatedAt = time.Now()
+	r.updates[updateID] = update
+	return nil
+}
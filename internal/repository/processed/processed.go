@@ -0,0 +1,52 @@
+package processed
+
+import (
+	"context"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+)
+
+// ProcessedUpdatesRepository records the Telegram updates being or already processed, keyed by update_id
+type ProcessedUpdatesRepository interface {
+	// Claim takes an update for processing. It reports false when the update is done or another
+	// attempt holds an unexpired lease. An unfinished update whose lease expired is claimed again
+	// with its progress, records older than their TTL are treated as unknown
+	Claim(ctx context.Context, updateID int64, lease, ttl time.Duration) (*models.ProcessedUpdate, bool, error)
+
+	// MarkReplied records that the bot answered the message of the update
+	MarkReplied(ctx context.Context, updateID int64) error
+
+	// Complete marks the update as done
+	Complete(ctx context.Context, updateID int64) error
+
+	// Release ends the lease of a failed attempt so a retry can resume right away
+	Release(ctx context.Context, updateID int64) error
+
+	// DeleteExpired removes records whose TTL passed before now
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+// claim decides whether an attempt at now may process the update given its existing record, if any
+func claim(existing *models.ProcessedUpdate, updateID int64, now time.Time, lease, ttl time.Duration) (models.ProcessedUpdate, bool) {
+	if existing == nil || !existing.ExpiresAt.After(now) {
+		return models.ProcessedUpdate{
+			UpdateID:   updateID,
+			Status:     models.UpdateStatusProcessing,
+			Attempts:   1,
+			LeaseUntil: now.Add(lease),
+			ExpiresAt:  now.Add(ttl),
+			UpdatedAt:  now,
+		}, true
+	}
+
+	if existing.Status == models.UpdateStatusDone || existing.LeaseUntil.After(now) {
+		return *existing, false
+	}
+
+	resumed := *existing
+	resumed.Attempts++
+	resumed.LeaseUntil = now.Add(lease)
+	resumed.UpdatedAt = now
+	return resumed, true
+}
@@ -0,0 +1,113 @@
+package processed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/repository/repotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// runProcessedUpdatesRepositoryTests checks behaviour every ProcessedUpdatesRepository implementation must share
+func runProcessedUpdatesRepositoryTests(t *testing.T, newRepo func(t *testing.T) ProcessedUpdatesRepository) {
+	ctx := context.Background()
+
+	t.Run("first claim wins", func(t *testing.T) {
+		repo := newRepo(t)
+
+		update, claimed, err := repo.Claim(ctx, 1, time.Minute, time.Hour)
+		require.NoError(t, err)
+		assert.True(t, claimed)
+		assert.Equal(t, int64(1), update.UpdateID)
+		assert.Equal(t, models.UpdateStatusProcessing, update.Status)
+		assert.Equal(t, 1, update.Attempts)
+		assert.False(t, update.Replied)
+
+		update, claimed, err = repo.Claim(ctx, 1, time.Minute, time.Hour)
+		require.NoError(t, err)
+		assert.False(t, claimed, "the lease of the first attempt is still active")
+		assert.Equal(t, models.UpdateStatusProcessing, update.Status)
+	})
+
+	t.Run("done updates are not claimed again", func(t *testing.T) {
+		repo := newRepo(t)
+
+		_, _, err := repo.Claim(ctx, 1, 0, time.Hour)
+		require.NoError(t, err)
+		require.NoError(t, repo.Complete(ctx, 1))
+
+		update, claimed, err := repo.Claim(ctx, 1, 0, time.Hour)
+		require.NoError(t, err)
+		assert.False(t, claimed)
+		assert.Equal(t, models.UpdateStatusDone, update.Status)
+	})
+
+	t.Run("released updates are resumed with their progress", func(t *testing.T) {
+		repo := newRepo(t)
+
+		_, _, err := repo.Claim(ctx, 1, time.Minute, time.Hour)
+		require.NoError(t, err)
+		require.NoError(t, repo.MarkReplied(ctx, 1))
+		require.NoError(t, repo.Release(ctx, 1))
+
+		update, claimed, err := repo.Claim(ctx, 1, time.Minute, time.Hour)
+		require.NoError(t, err)
+		assert.True(t, claimed)
+		assert.True(t, update.Replied)
+		assert.Equal(t, 2, update.Attempts)
+	})
+
+	t.Run("expired records are forgotten", func(t *testing.T) {
+		repo := newRepo(t)
+
+		_, _, err := repo.Claim(ctx, 1, 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, repo.Complete(ctx, 1))
+		_, _, err = repo.Claim(ctx, 2, 0, time.Hour)
+		require.NoError(t, err)
+
+		update, claimed, err := repo.Claim(ctx, 1, 0, 0)
+		require.NoError(t, err)
+		assert.True(t, claimed)
+		assert.Equal(t, 1, update.Attempts)
+
+		deleted, err := repo.DeleteExpired(ctx, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+
+		_, claimed, err = repo.Claim(ctx, 2, 0, time.Hour)
+		require.NoError(t, err)
+		assert.True(t, claimed, "unexpired records are kept")
+	})
+
+	t.Run("unknown updates", func(t *testing.T) {
+		repo := newRepo(t)
+
+		assert.Equal(t, codes.NotFound, status.Code(repo.MarkReplied(ctx, 1)))
+		assert.Equal(t, codes.NotFound, status.Code(repo.Complete(ctx, 1)))
+		assert.Equal(t, codes.NotFound, status.Code(repo.Release(ctx, 1)))
+	})
+}
+
+func TestMemoryRepository(t *testing.T) {
+	runProcessedUpdatesRepositoryTests(t, func(t *testing.T) ProcessedUpdatesRepository {
+		return NewMemoryProcessedUpdatesRepository()
+	})
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	runProcessedUpdatesRepositoryTests(t, func(t *testing.T) ProcessedUpdatesRepository {
+		return NewSQLiteProcessedUpdatesRepository(repotest.SQLiteDB(t))
+	})
+}
+
+func TestFirestoreRepository(t *testing.T) {
+	runProcessedUpdatesRepositoryTests(t, func(t *testing.T) ProcessedUpdatesRepository {
+		return NewFirestoreProcessedUpdatesRepository(repotest.FirestoreClient(t))
+	})
+}
@@ -0,0 +1,127 @@
+package processed
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/repository/sqlite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const processedColumns = `update_id, status, replied, attempts, lease_until, expires_at, updated_at`
+
+// SQLiteRepository implements ProcessedUpdatesRepository interface using SQLite.
+// Claims run inside a transaction
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteProcessedUpdatesRepository creates a new SQLiteRepository with existing database
+func NewSQLiteProcessedUpdatesRepository(db *sql.DB) ProcessedUpdatesRepository {
+	return &SQLiteRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteRepository) Claim(ctx context.Context, updateID int64, lease, ttl time.Duration) (*models.ProcessedUpdate, bool, error) {
+	var update models.ProcessedUpdate
+	var claimed bool
+
+	err := sqlite.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		existing, err := getProcessedUpdate(ctx, tx, updateID)
+		if err != nil {
+			return err
+		}
+
+		update, claimed = claim(existing, updateID, time.Now(), lease, ttl)
+		if !claimed {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO processed_updates (`+processedColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (update_id) DO UPDATE SET
+				status = excluded.status,
+				replied = excluded.replied,
+				attempts = excluded.attempts,
+				lease_until = excluded.lease_until,
+				expires_at = excluded.expires_at,
+				updated_at = excluded.updated_at`,
+			update.UpdateID, update.Status, update.Replied, update.Attempts,
+			sqlite.UnixTime(update.LeaseUntil), sqlite.UnixTime(update.ExpiresAt), sqlite.UnixTime(update.UpdatedAt))
+		return err
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to claim update: %w", err)
+	}
+
+	return &update, claimed, nil
+}
+
+func (r *SQLiteRepository) MarkReplied(ctx context.Context, updateID int64) error {
+	return r.update(ctx, updateID, `replied = 1`)
+}
+
+func (r *SQLiteRepository) Complete(ctx context.Context, updateID int64) error {
+	return r.update(ctx, updateID, `status = '`+models.UpdateStatusDone+`'`)
+}
+
+func (r *SQLiteRepository) Release(ctx context.Context, updateID int64) error {
+	return r.update(ctx, updateID, `lease_until = ?`, sqlite.UnixTime(time.Now()))
+}
+
+func (r *SQLiteRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM processed_updates WHERE expires_at <= ?`, sqlite.UnixTime(now))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired updates: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired updates: %w", err)
+	}
+	return int(deleted), nil
+}
+
+// update applies the set clause to the record of an update
+func (r *SQLiteRepository) update(ctx context.Context, updateID int64, set string, args ...any) error {
+	args = append(args, sqlite.UnixTime(time.Now()), updateID)
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE processed_updates SET `+set+`, updated_at = ? WHERE update_id = ?`, args...)
+	if err == nil {
+		var affected int64
+		affected, err = result.RowsAffected()
+		if err == nil && affected == 0 {
+			err = status.Errorf(codes.NotFound, "update not found")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update processed update: %w", err)
+	}
+	return nil
+}
+
+func getProcessedUpdate(ctx context.Context, q sqlite.Querier, updateID int64) (*models.ProcessedUpdate, error) {
+	var update models.ProcessedUpdate
+	var leaseUntil, expiresAt, updatedAt int64
+
+	err := q.QueryRowContext(ctx, `SELECT `+processedColumns+` FROM processed_updates WHERE update_id = ?`, updateID).
+		Scan(&update.UpdateID, &update.Status, &update.Replied, &update.Attempts, &leaseUntil, &expiresAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	update.LeaseUntil = sqlite.FromUnixTime(leaseUntil)
+	update.ExpiresAt = sqlite.FromUnixTime(expiresAt)
+	update.UpdatedAt = sqlite.FromUnixTime(updatedAt)
+	return &update, nil
+}
@@ -0,0 +1,45 @@
+// Package repotest provides storage backends for the repository behavioural test suites
+package repotest
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"github.com/kriku/kpukbot/internal/repository/sqlite"
+)
+
+// SQLiteDB opens a migrated SQLite database in a temporary directory, closed when the test ends
+func SQLiteDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sqlite.Open(context.Background(), filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// FirestoreClient connects to the Firestore emulator using a fresh project per test,
+// the test is skipped when FIRESTORE_EMULATOR_HOST is not set
+func FirestoreClient(t *testing.T) *firestore.Client {
+	t.Helper()
+
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+
+	client, err := firestore.NewClient(context.Background(), "test-"+uuid.NewString())
+	if err != nil {
+		t.Fatalf("failed to create firestore client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
@@ -0,0 +1,296 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migrations are applied in order, the version of a migration is its index + 1.
+// Never edit an applied migration, append a new one instead.
+var migrations = []string{
+	// 1: initial schema
+	`
+	CREATE TABLE messages (
+		id                  INTEGER PRIMARY KEY,
+		reply_to_message_id INTEGER NOT NULL DEFAULT 0,
+		chat_id             INTEGER NOT NULL,
+		user_id             INTEGER NOT NULL DEFAULT 0,
+		text                TEXT    NOT NULL DEFAULT '',
+		username            TEXT    NOT NULL DEFAULT '',
+		first_name          TEXT    NOT NULL DEFAULT '',
+		last_name           TEXT    NOT NULL DEFAULT '',
+		date                INTEGER NOT NULL DEFAULT 0,
+		is_bot              INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX idx_messages_chat_id ON messages (chat_id, date);
+	CREATE INDEX idx_messages_user_id ON messages (user_id);
+
+	CREATE TABLE threads (
+		id         TEXT    PRIMARY KEY,
+		chat_id    INTEGER NOT NULL,
+		theme      TEXT    NOT NULL DEFAULT '',
+		summary    TEXT    NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL DEFAULT 0,
+		updated_at INTEGER NOT NULL DEFAULT 0,
+		is_active  INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX idx_threads_chat_id ON threads (chat_id, is_active, updated_at);
+
+	CREATE TABLE thread_messages (
+		thread_id  TEXT    NOT NULL REFERENCES threads (id) ON DELETE CASCADE,
+		position   INTEGER NOT NULL,
+		message_id INTEGER NOT NULL,
+		PRIMARY KEY (thread_id, position)
+	);
+	CREATE INDEX idx_thread_messages_message_id ON thread_messages (message_id);
+
+	CREATE TABLE users (
+		id         INTEGER PRIMARY KEY,
+		first_name TEXT    NOT NULL DEFAULT '',
+		last_name  TEXT    NOT NULL DEFAULT '',
+		username   TEXT    NOT NULL DEFAULT '',
+		bio        TEXT    NOT NULL DEFAULT '',
+		chat_id    INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL DEFAULT 0,
+		updated_at INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX idx_users_chat_id ON users (chat_id);
+
+	CREATE TABLE user_interests (
+		user_id  INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		value    TEXT    NOT NULL,
+		PRIMARY KEY (user_id, position)
+	);
+	CREATE INDEX idx_user_interests_value ON user_interests (value);
+
+	CREATE TABLE user_hobbies (
+		user_id  INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		value    TEXT    NOT NULL,
+		PRIMARY KEY (user_id, position)
+	);
+	CREATE INDEX idx_user_hobbies_value ON user_hobbies (value);
+
+	CREATE TABLE chats (
+		id          INTEGER PRIMARY KEY,
+		title       TEXT    NOT NULL DEFAULT '',
+		type        TEXT    NOT NULL DEFAULT '',
+		description TEXT    NOT NULL DEFAULT '',
+		is_active   INTEGER NOT NULL DEFAULT 0,
+		created_at  INTEGER NOT NULL DEFAULT 0,
+		updated_at  INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX idx_chats_is_active ON chats (is_active);
+
+	CREATE TABLE chat_users (
+		chat_id  INTEGER NOT NULL REFERENCES chats (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		user_id  INTEGER NOT NULL,
+		PRIMARY KEY (chat_id, position)
+	);
+	CREATE INDEX idx_chat_users_user_id ON chat_users (user_id);
+
+	CREATE TABLE queue_entries (
+		chat_id     INTEGER NOT NULL REFERENCES chats (id) ON DELETE CASCADE,
+		seq         INTEGER NOT NULL,
+		user_id     INTEGER NOT NULL,
+		position    INTEGER NOT NULL DEFAULT 0,
+		enqueued_at INTEGER NOT NULL DEFAULT 0,
+		status      TEXT    NOT NULL DEFAULT '',
+		question_id TEXT    NOT NULL DEFAULT '',
+		asked_at    INTEGER,
+		answered_at INTEGER,
+		PRIMARY KEY (chat_id, seq)
+	);
+	CREATE INDEX idx_queue_entries_user_id ON queue_entries (chat_id, user_id);
+
+	CREATE TABLE chat_settings (
+		chat_id                INTEGER PRIMARY KEY,
+		question_interval      INTEGER NOT NULL DEFAULT 0,
+		max_queue_size         INTEGER NOT NULL DEFAULT 0,
+		auto_enqueue_new_users INTEGER NOT NULL DEFAULT 0,
+		skip_inactive_users    INTEGER NOT NULL DEFAULT 0,
+		inactivity_timeout     INTEGER NOT NULL DEFAULT 0,
+		enable_question_rounds INTEGER NOT NULL DEFAULT 0,
+		updated_at             INTEGER NOT NULL DEFAULT 0
+	);
+	`,
+
+	// 2: messages are keyed by chat and message ID, Telegram message IDs are only unique per chat
+	`
+	CREATE TABLE messages_v2 (
+		id                  INTEGER NOT NULL,
+		reply_to_message_id INTEGER NOT NULL DEFAULT 0,
+		chat_id             INTEGER NOT NULL,
+		user_id             INTEGER NOT NULL DEFAULT 0,
+		text                TEXT    NOT NULL DEFAULT '',
+		username            TEXT    NOT NULL DEFAULT '',
+		first_name          TEXT    NOT NULL DEFAULT '',
+		last_name           TEXT    NOT NULL DEFAULT '',
+		date                INTEGER NOT NULL DEFAULT 0,
+		is_bot              INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (chat_id, id)
+	);
+	INSERT INTO messages_v2 SELECT
+		id, reply_to_message_id, chat_id, user_id, text, username, first_name, last_name, date, is_bot
+	FROM messages;
+	DROP TABLE messages;
+	ALTER TABLE messages_v2 RENAME TO messages;
+	CREATE INDEX idx_messages_chat_id ON messages (chat_id, date);
+	CREATE INDEX idx_messages_user_id ON messages (user_id);
+	`,
+
+	// 3: daily LLM usage aggregates
+	`
+	CREATE TABLE llm_usage_daily (
+		chat_id         INTEGER NOT NULL,
+		day             TEXT    NOT NULL,
+		user_id         INTEGER NOT NULL DEFAULT 0,
+		thread_id       TEXT    NOT NULL DEFAULT '',
+		call_site       TEXT    NOT NULL DEFAULT '',
+		model           TEXT    NOT NULL DEFAULT '',
+		calls           INTEGER NOT NULL DEFAULT 0,
+		prompt_tokens   INTEGER NOT NULL DEFAULT 0,
+		response_tokens INTEGER NOT NULL DEFAULT 0,
+		total_tokens    INTEGER NOT NULL DEFAULT 0,
+		cost_usd        REAL    NOT NULL DEFAULT 0,
+		updated_at      INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (chat_id, day, user_id, thread_id, call_site, model)
+	);
+	CREATE INDEX idx_llm_usage_daily_day ON llm_usage_daily (day);
+	`,
+
+	// 4: per chat LLM budgets
+	`
+	ALTER TABLE chat_settings ADD COLUMN daily_token_budget INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE chat_settings ADD COLUMN monthly_token_budget INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE chat_settings ADD COLUMN daily_cost_budget_usd REAL NOT NULL DEFAULT 0;
+	ALTER TABLE chat_settings ADD COLUMN monthly_cost_budget_usd REAL NOT NULL DEFAULT 0;
+	ALTER TABLE chat_settings ADD COLUMN budget_near_ratio REAL NOT NULL DEFAULT 0;
+	ALTER TABLE chat_settings ADD COLUMN budget_notice INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE chat_settings ADD COLUMN budget_notice_period TEXT NOT NULL DEFAULT '';
+	`,
+
+	// 5: work queue of Telegram updates and its dead letters
+	`
+	CREATE TABLE update_queue (
+		id          TEXT PRIMARY KEY,
+		update_id   INTEGER NOT NULL,
+		chat_id     INTEGER NOT NULL DEFAULT 0,
+		payload     BLOB    NOT NULL,
+		attempts    INTEGER NOT NULL DEFAULT 0,
+		last_error  TEXT    NOT NULL DEFAULT '',
+		enqueued_at INTEGER NOT NULL,
+		visible_at  INTEGER NOT NULL
+	);
+	CREATE INDEX idx_update_queue_visible_at ON update_queue (visible_at, enqueued_at);
+
+	CREATE TABLE update_dead_letters (
+		id          TEXT PRIMARY KEY,
+		update_id   INTEGER NOT NULL,
+		chat_id     INTEGER NOT NULL DEFAULT 0,
+		payload     BLOB    NOT NULL,
+		attempts    INTEGER NOT NULL DEFAULT 0,
+		last_error  TEXT    NOT NULL DEFAULT '',
+		enqueued_at INTEGER NOT NULL,
+		visible_at  INTEGER NOT NULL,
+		failed_at   INTEGER NOT NULL
+	);
+	CREATE INDEX idx_update_dead_letters_failed_at ON update_dead_letters (failed_at);
+	`,
+
+	// 6: processed Telegram updates for deduplication
+	`
+	CREATE TABLE processed_updates (
+		update_id   INTEGER PRIMARY KEY,
+		status      TEXT    NOT NULL,
+		replied     INTEGER NOT NULL DEFAULT 0,
+		attempts    INTEGER NOT NULL DEFAULT 0,
+		lease_until INTEGER NOT NULL,
+		expires_at  INTEGER NOT NULL,
+		updated_at  INTEGER NOT NULL
+	);
+	CREATE INDEX idx_processed_updates_expires_at ON processed_updates (expires_at);
+	`,
+
+	// 7: edit history and deletion of messages
+	`
+	ALTER TABLE messages ADD COLUMN deleted INTEGER NOT NULL DEFAULT 0;
+
+	CREATE TABLE message_edits (
+		chat_id    INTEGER NOT NULL,
+		message_id INTEGER NOT NULL,
+		position   INTEGER NOT NULL,
+		text       TEXT    NOT NULL DEFAULT '',
+		edited_at  INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (chat_id, message_id, position),
+		FOREIGN KEY (chat_id, message_id) REFERENCES messages (chat_id, id) ON DELETE CASCADE
+	);
+	`,
+
+	// 8: images attached to messages
+	`
+	ALTER TABLE messages ADD COLUMN image_file_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE messages ADD COLUMN image_mime_type TEXT NOT NULL DEFAULT '';
+	ALTER TABLE messages ADD COLUMN image_description TEXT NOT NULL DEFAULT '';
+	`,
+
+	// 9: voice recordings of messages and their transcripts
+	`
+	ALTER TABLE messages ADD COLUMN voice_file_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE messages ADD COLUMN voice_mime_type TEXT NOT NULL DEFAULT '';
+	ALTER TABLE messages ADD COLUMN transcript INTEGER NOT NULL DEFAULT 0;
+	`,
+
+	// 10: summaries of documents and web pages shared with messages
+	`
+	CREATE TABLE message_attachments (
+		chat_id    INTEGER NOT NULL,
+		message_id INTEGER NOT NULL,
+		position   INTEGER NOT NULL,
+		source     TEXT    NOT NULL DEFAULT '',
+		summary    TEXT    NOT NULL DEFAULT '',
+		PRIMARY KEY (chat_id, message_id, position),
+		FOREIGN KEY (chat_id, message_id) REFERENCES messages (chat_id, id) ON DELETE CASCADE
+	);
+	`,
+}
+
+// Migrate applies all migrations that have not been applied yet
+func Migrate(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			applied_at INTEGER NOT NULL
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	var current int
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		err := WithTx(ctx, db, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, migrations[i]); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+				version, UnixTime(time.Now()))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %d: %w", version, err)
+		}
+	}
+
+	return nil
+}
@@ -3,6 +3,8 @@ package threads
 import (
 	"context"
 	"fmt"
+	"slices"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	"github.com/kriku/kpukbot/internal/models"
@@ -41,8 +43,9 @@ func (r *FirestoreThreadsRepository) GetThread(ctx context.Context, id string) (
 	return &thread, nil
 }
 
-func (r *FirestoreThreadsRepository) GetThreadByMessageID(ctx context.Context, messageID int) (*models.Thread, error) {
+func (r *FirestoreThreadsRepository) GetThreadByMessageID(ctx context.Context, chatID int64, messageID int) (*models.Thread, error) {
 	iter := r.client.Collection("threads").
+		Where("chat_id", "==", chatID).
 		Where("message_ids", "array-contains", messageID).
 		Limit(1).
 		Documents(ctx)
@@ -125,6 +128,51 @@ func (r *FirestoreThreadsRepository) UpdateThread(ctx context.Context, thread *m
 	return nil
 }
 
+// AppendMessage runs in a transaction, Firestore retries it when another append changed the thread
+func (r *FirestoreThreadsRepository) AppendMessage(ctx context.Context, threadID string, messageID int) (*models.Thread, error) {
+	ref := r.client.Collection("threads").Doc(threadID)
+
+	var thread models.Thread
+	err := r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return fmt.Errorf("failed to get thread: %w", err)
+		}
+
+		thread = models.Thread{}
+		if err := doc.DataTo(&thread); err != nil {
+			return fmt.Errorf("failed to unmarshal thread: %w", err)
+		}
+
+		if slices.Contains(thread.MessageIDs, messageID) {
+			return nil
+		}
+
+		thread.MessageIDs = append(thread.MessageIDs, messageID)
+		thread.UpdatedAt = time.Now()
+		return tx.Update(ref, []firestore.Update{
+			{Path: "message_ids", Value: thread.MessageIDs},
+			{Path: "updated_at", Value: thread.UpdatedAt},
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to append message to thread: %w", err)
+	}
+
+	return &thread, nil
+}
+
+func (r *FirestoreThreadsRepository) UpdateThreadSummary(ctx context.Context, threadID, theme, summary string) error {
+	_, err := r.client.Collection("threads").Doc(threadID).Update(ctx, []firestore.Update{
+		{Path: "theme", Value: theme},
+		{Path: "summary", Value: summary},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update thread summary: %w", err)
+	}
+	return nil
+}
+
 func (r *FirestoreThreadsRepository) Close() error {
 	return r.client.Close()
 }
@@ -0,0 +1,144 @@
+package threads
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type MemoryThreadsRepository struct {
+	mu      sync.RWMutex
+	threads map[string]models.Thread
+}
+
+func NewMemoryThreadsRepository() *MemoryThreadsRepository {
+	return &MemoryThreadsRepository{
+		threads: make(map[string]models.Thread),
+	}
+}
+
+func (r *MemoryThreadsRepository) SaveThread(ctx context.Context, thread *models.Thread) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := cloneThread(*thread)
+	stored.Probability = 0 // Not persisted, same as in Firestore
+	r.threads[thread.ID] = stored
+	return nil
+}
+
+func (r *MemoryThreadsRepository) GetThread(ctx context.Context, id string) (*models.Thread, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	thread, ok := r.threads[id]
+	if !ok {
+		return nil, fmt.Errorf("failed to get thread: %w", status.Errorf(codes.NotFound, "thread %s not found", id))
+	}
+
+	thread = cloneThread(thread)
+	return &thread, nil
+}
+
+func (r *MemoryThreadsRepository) GetThreadByMessageID(ctx context.Context, chatID int64, messageID int) (*models.Thread, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, thread := range r.threads {
+		if thread.ChatID == chatID && slices.Contains(thread.MessageIDs, messageID) {
+			thread = cloneThread(thread)
+			return &thread, nil
+		}
+	}
+
+	return nil, nil // Not found
+}
+
+func (r *MemoryThreadsRepository) GetThreadsByChatID(ctx context.Context, chatID int64) ([]*models.Thread, error) {
+	return r.findThreads(chatID, false, 0), nil
+}
+
+func (r *MemoryThreadsRepository) GetActiveThreadsByChatID(ctx context.Context, chatID int64) ([]*models.Thread, error) {
+	return r.findThreads(chatID, true, 10), nil // Limit to recent active threads
+}
+
+func (r *MemoryThreadsRepository) UpdateThread(ctx context.Context, thread *models.Thread) error {
+	return r.SaveThread(ctx, thread)
+}
+
+func (r *MemoryThreadsRepository) AppendMessage(ctx context.Context, threadID string, messageID int) (*models.Thread, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	thread, ok := r.threads[threadID]
+	if !ok {
+		return nil, fmt.Errorf("failed to get thread: %w", status.Errorf(codes.NotFound, "thread %s not found", threadID))
+	}
+
+	if !slices.Contains(thread.MessageIDs, messageID) {
+		thread = cloneThread(thread)
+		thread.MessageIDs = append(thread.MessageIDs, messageID)
+		thread.UpdatedAt = time.Now()
+		r.threads[threadID] = thread
+	}
+
+	thread = cloneThread(thread)
+	return &thread, nil
+}
+
+func (r *MemoryThreadsRepository) UpdateThreadSummary(ctx context.Context, threadID, theme, summary string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	thread, ok := r.threads[threadID]
+	if !ok {
+		return fmt.Errorf("failed to get thread: %w", status.Errorf(codes.NotFound, "thread %s not found", threadID))
+	}
+
+	thread.Theme = theme
+	thread.Summary = summary
+	r.threads[threadID] = thread
+	return nil
+}
+
+func (r *MemoryThreadsRepository) Close() error {
+	return nil
+}
+
+// findThreads returns chat threads ordered by updated_at descending, limit 0 means no limit
+func (r *MemoryThreadsRepository) findThreads(chatID int64, activeOnly bool, limit int) []*models.Thread {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var threads []*models.Thread
+	for _, thread := range r.threads {
+		if thread.ChatID != chatID || (activeOnly && !thread.IsActive) {
+			continue
+		}
+		thread = cloneThread(thread)
+		threads = append(threads, &thread)
+	}
+
+	sort.Slice(threads, func(i, j int) bool {
+		return threads[i].UpdatedAt.After(threads[j].UpdatedAt)
+	})
+
+	if limit > 0 && len(threads) > limit {
+		threads = threads[:limit]
+	}
+
+	return threads
+}
+
+// cloneThread copies a thread so callers never share slices with the stored value
+func cloneThread(thread models.Thread) models.Thread {
+	thread.MessageIDs = slices.Clone(thread.MessageIDs)
+	return thread
+}
@@ -0,0 +1,187 @@
+package threads
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/repository/repotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// runThreadsRepositoryTests checks behaviour every ThreadsRepository implementation must share
+func runThreadsRepositoryTests(t *testing.T, newRepo func(t *testing.T) ThreadsRepository) {
+	ctx := context.Background()
+
+	t.Run("save and get thread", func(t *testing.T) {
+		repo := newRepo(t)
+		thread := &models.Thread{
+			ID:         "thread-1",
+			ChatID:     100,
+			Theme:      "Books",
+			MessageIDs: []int{1, 2},
+			IsActive:   true,
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+		}
+		require.NoError(t, repo.SaveThread(ctx, thread))
+
+		got, err := repo.GetThread(ctx, "thread-1")
+		require.NoError(t, err)
+		assert.Equal(t, "Books", got.Theme)
+		assert.Equal(t, []int{1, 2}, got.MessageIDs)
+
+		_, err = repo.GetThread(ctx, "missing")
+		assert.Error(t, err)
+	})
+
+	t.Run("thread by message id", func(t *testing.T) {
+		repo := newRepo(t)
+		require.NoError(t, repo.SaveThread(ctx, &models.Thread{ID: "a", ChatID: 100, MessageIDs: []int{1, 2}}))
+		require.NoError(t, repo.SaveThread(ctx, &models.Thread{ID: "b", ChatID: 100, MessageIDs: []int{3}}))
+
+		require.NoError(t, repo.SaveThread(ctx, &models.Thread{ID: "c", ChatID: 200, MessageIDs: []int{3}}))
+
+		thread, err := repo.GetThreadByMessageID(ctx, 100, 3)
+		require.NoError(t, err)
+		require.NotNil(t, thread)
+		assert.Equal(t, "b", thread.ID)
+
+		thread, err = repo.GetThreadByMessageID(ctx, 200, 3)
+		require.NoError(t, err)
+		require.NotNil(t, thread)
+		assert.Equal(t, "c", thread.ID)
+
+		thread, err = repo.GetThreadByMessageID(ctx, 100, 42)
+		require.NoError(t, err)
+		assert.Nil(t, thread)
+
+		thread, err = repo.GetThreadByMessageID(ctx, 300, 1)
+		require.NoError(t, err)
+		assert.Nil(t, thread)
+	})
+
+	t.Run("threads by chat are ordered by update time", func(t *testing.T) {
+		repo := newRepo(t)
+		now := time.Now()
+		require.NoError(t, repo.SaveThread(ctx, &models.Thread{ID: "old", ChatID: 100, IsActive: true, UpdatedAt: now.Add(-time.Hour)}))
+		require.NoError(t, repo.SaveThread(ctx, &models.Thread{ID: "new", ChatID: 100, IsActive: true, UpdatedAt: now}))
+		require.NoError(t, repo.SaveThread(ctx, &models.Thread{ID: "closed", ChatID: 100, IsActive: false, UpdatedAt: now}))
+		require.NoError(t, repo.SaveThread(ctx, &models.Thread{ID: "other", ChatID: 200, IsActive: true, UpdatedAt: now}))
+
+		threads, err := repo.GetThreadsByChatID(ctx, 100)
+		require.NoError(t, err)
+		assert.Len(t, threads, 3)
+
+		active, err := repo.GetActiveThreadsByChatID(ctx, 100)
+		require.NoError(t, err)
+		require.Len(t, active, 2)
+		assert.Equal(t, "new", active[0].ID)
+		assert.Equal(t, "old", active[1].ID)
+	})
+
+	t.Run("active threads are limited to the ten most recent", func(t *testing.T) {
+		repo := newRepo(t)
+		now := time.Now()
+		for i := 0; i < 12; i++ {
+			require.NoError(t, repo.SaveThread(ctx, &models.Thread{
+				ID:        string(rune('a' + i)),
+				ChatID:    100,
+				IsActive:  true,
+				UpdatedAt: now.Add(time.Duration(i) * time.Minute),
+			}))
+		}
+
+		active, err := repo.GetActiveThreadsByChatID(ctx, 100)
+		require.NoError(t, err)
+		require.Len(t, active, 10)
+		assert.Equal(t, "l", active[0].ID)
+	})
+
+	t.Run("update thread", func(t *testing.T) {
+		repo := newRepo(t)
+		thread := &models.Thread{ID: "a", ChatID: 100, MessageIDs: []int{1}}
+		require.NoError(t, repo.SaveThread(ctx, thread))
+
+		thread.MessageIDs = append(thread.MessageIDs, 2)
+		thread.Summary = "updated"
+		require.NoError(t, repo.UpdateThread(ctx, thread))
+
+		got, err := repo.GetThread(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, []int{1, 2}, got.MessageIDs)
+		assert.Equal(t, "updated", got.Summary)
+	})
+
+	t.Run("append message", func(t *testing.T) {
+		repo := newRepo(t)
+		require.NoError(t, repo.SaveThread(ctx, &models.Thread{ID: "a", ChatID: 100, MessageIDs: []int{1}, Summary: "s"}))
+
+		got, err := repo.AppendMessage(ctx, "a", 2)
+		require.NoError(t, err)
+		assert.Equal(t, []int{1, 2}, got.MessageIDs)
+		assert.Equal(t, "s", got.Summary)
+
+		got, err = repo.AppendMessage(ctx, "a", 1)
+		require.NoError(t, err)
+		assert.Equal(t, []int{1, 2}, got.MessageIDs, "messages are added once")
+
+		require.NoError(t, repo.UpdateThreadSummary(ctx, "a", "theme", "summary"))
+		got, err = repo.GetThread(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, []int{1, 2}, got.MessageIDs)
+		assert.Equal(t, "theme", got.Theme)
+		assert.Equal(t, "summary", got.Summary)
+
+		_, err = repo.AppendMessage(ctx, "missing", 1)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		assert.Equal(t, codes.NotFound, status.Code(repo.UpdateThreadSummary(ctx, "missing", "", "")))
+	})
+
+	t.Run("concurrent appends are not lost", func(t *testing.T) {
+		repo := newRepo(t)
+		require.NoError(t, repo.SaveThread(ctx, &models.Thread{ID: "a", ChatID: 100, MessageIDs: []int{}}))
+
+		const messages = 20
+		var wg sync.WaitGroup
+		for messageID := 1; messageID <= messages; messageID++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := repo.AppendMessage(ctx, "a", messageID)
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		got, err := repo.GetThread(ctx, "a")
+		require.NoError(t, err)
+		assert.Len(t, got.MessageIDs, messages)
+		for messageID := 1; messageID <= messages; messageID++ {
+			assert.Contains(t, got.MessageIDs, messageID)
+		}
+	})
+}
+
+func TestMemoryThreadsRepository(t *testing.T) {
+	runThreadsRepositoryTests(t, func(t *testing.T) ThreadsRepository {
+		return NewMemoryThreadsRepository()
+	})
+}
+
+func TestSQLiteThreadsRepository(t *testing.T) {
+	runThreadsRepositoryTests(t, func(t *testing.T) ThreadsRepository {
+		return NewSQLiteThreadsRepository(repotest.SQLiteDB(t))
+	})
+}
+
+func TestFirestoreThreadsRepository(t *testing.T) {
+	runThreadsRepositoryTests(t, func(t *testing.T) ThreadsRepository {
+		return NewFirestoreThreadsRepository(repotest.FirestoreClient(t))
+	})
+}
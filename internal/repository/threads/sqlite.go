@@ -0,0 +1,236 @@
+package threads
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/repository/sqlite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const threadColumns = `id, chat_id, theme, summary, created_at, updated_at, is_active`
+
+type SQLiteThreadsRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteThreadsRepository(db *sql.DB) *SQLiteThreadsRepository {
+	return &SQLiteThreadsRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteThreadsRepository) SaveThread(ctx context.Context, thread *models.Thread) error {
+	err := sqlite.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO threads (`+threadColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET
+				chat_id = excluded.chat_id,
+				theme = excluded.theme,
+				summary = excluded.summary,
+				created_at = excluded.created_at,
+				updated_at = excluded.updated_at,
+				is_active = excluded.is_active`,
+			thread.ID, thread.ChatID, thread.Theme, thread.Summary,
+			sqlite.UnixTime(thread.CreatedAt), sqlite.UnixTime(thread.UpdatedAt), thread.IsActive,
+		)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM thread_messages WHERE thread_id = ?`, thread.ID); err != nil {
+			return err
+		}
+
+		for i, messageID := range thread.MessageIDs {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO thread_messages (thread_id, position, message_id) VALUES (?, ?, ?)`,
+				thread.ID, i, messageID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save thread: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteThreadsRepository) GetThread(ctx context.Context, id string) (*models.Thread, error) {
+	threads, err := r.queryThreads(ctx, `SELECT `+threadColumns+` FROM threads WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thread: %w", err)
+	}
+
+	if len(threads) == 0 {
+		return nil, fmt.Errorf("failed to get thread: %w", status.Errorf(codes.NotFound, "thread %s not found", id))
+	}
+
+	return threads[0], nil
+}
+
+func (r *SQLiteThreadsRepository) GetThreadByMessageID(ctx context.Context, chatID int64, messageID int) (*models.Thread, error) {
+	var threadID string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT tm.thread_id FROM thread_messages tm
+		JOIN threads t ON t.id = tm.thread_id
+		WHERE t.chat_id = ? AND tm.message_id = ?
+		LIMIT 1`, chatID, messageID).Scan(&threadID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // Not found
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query thread messages: %w", err)
+	}
+
+	return r.GetThread(ctx, threadID)
+}
+
+func (r *SQLiteThreadsRepository) GetThreadsByChatID(ctx context.Context, chatID int64) ([]*models.Thread, error) {
+	return r.queryThreads(ctx, `
+		SELECT `+threadColumns+` FROM threads
+		WHERE chat_id = ?
+		ORDER BY updated_at DESC`, chatID)
+}
+
+func (r *SQLiteThreadsRepository) GetActiveThreadsByChatID(ctx context.Context, chatID int64) ([]*models.Thread, error) {
+	return r.queryThreads(ctx, `
+		SELECT `+threadColumns+` FROM threads
+		WHERE chat_id = ? AND is_active = 1
+		ORDER BY updated_at DESC
+		LIMIT 10`, chatID) // Limit to recent active threads
+}
+
+func (r *SQLiteThreadsRepository) UpdateThread(ctx context.Context, thread *models.Thread) error {
+	if err := r.SaveThread(ctx, thread); err != nil {
+		return fmt.Errorf("failed to update thread: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteThreadsRepository) AppendMessage(ctx context.Context, threadID string, messageID int) (*models.Thread, error) {
+	err := sqlite.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		var contains bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM thread_messages WHERE thread_id = ? AND message_id = ?)`,
+			threadID, messageID).Scan(&contains)
+		if err != nil || contains {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `UPDATE threads SET updated_at = ? WHERE id = ?`,
+			sqlite.UnixTime(time.Now()), threadID)
+		if err != nil {
+			return err
+		}
+		if err := requireAffected(result, threadID); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO thread_messages (thread_id, position, message_id)
+			SELECT ?, COALESCE(MAX(position) + 1, 0), ? FROM thread_messages WHERE thread_id = ?`,
+			threadID, messageID, threadID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to append message to thread: %w", err)
+	}
+
+	return r.GetThread(ctx, threadID)
+}
+
+func (r *SQLiteThreadsRepository) UpdateThreadSummary(ctx context.Context, threadID, theme, summary string) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE threads SET theme = ?, summary = ? WHERE id = ?`, theme, summary, threadID)
+	if err == nil {
+		err = requireAffected(result, threadID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update thread summary: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteThreadsRepository) Close() error {
+	// The database is shared with other repositories and closed by the app
+	return nil
+}
+
+func (r *SQLiteThreadsRepository) queryThreads(ctx context.Context, query string, args ...any) ([]*models.Thread, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query threads: %w", err)
+	}
+
+	var threads []*models.Thread
+	for rows.Next() {
+		var thread models.Thread
+		var createdAt, updatedAt int64
+		err := rows.Scan(&thread.ID, &thread.ChatID, &thread.Theme, &thread.Summary,
+			&createdAt, &updatedAt, &thread.IsActive)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to unmarshal thread: %w", err)
+		}
+		thread.CreatedAt = sqlite.FromUnixTime(createdAt)
+		thread.UpdatedAt = sqlite.FromUnixTime(updatedAt)
+		threads = append(threads, &thread)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate threads: %w", err)
+	}
+
+	// Load message IDs after closing rows, the database uses a single connection
+	for _, thread := range threads {
+		messageIDs, err := r.messageIDs(ctx, thread.ID)
+		if err != nil {
+			return nil, err
+		}
+		thread.MessageIDs = messageIDs
+	}
+
+	return threads, nil
+}
+
+func (r *SQLiteThreadsRepository) messageIDs(ctx context.Context, threadID string) ([]int, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT message_id FROM thread_messages WHERE thread_id = ? ORDER BY position`, threadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query thread messages: %w", err)
+	}
+	defer rows.Close()
+
+	messageIDs := []int{}
+	for rows.Next() {
+		var messageID int
+		if err := rows.Scan(&messageID); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal thread message: %w", err)
+		}
+		messageIDs = append(messageIDs, messageID)
+	}
+
+	return messageIDs, rows.Err()
+}
+
+// requireAffected turns an update of no rows into a NotFound error
+func requireAffected(result sql.Result, threadID string) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return status.Errorf(codes.NotFound, "thread %s not found", threadID)
+	}
+	return nil
+}
@@ -9,9 +9,15 @@ import (
 type ThreadsRepository interface {
 	SaveThread(ctx context.Context, thread *models.Thread) error
 	GetThread(ctx context.Context, id string) (*models.Thread, error)
-	GetThreadByMessageID(ctx context.Context, messageID int) (*models.Thread, error)
+	// GetThreadByMessageID finds the thread of a message in the given chat, nil if there is none
+	GetThreadByMessageID(ctx context.Context, chatID int64, messageID int) (*models.Thread, error)
 	GetThreadsByChatID(ctx context.Context, chatID int64) ([]*models.Thread, error)
 	GetActiveThreadsByChatID(ctx context.Context, chatID int64) ([]*models.Thread, error)
 	UpdateThread(ctx context.Context, thread *models.Thread) error
+	// AppendMessage atomically adds a message to the end of a thread unless it is already there
+	// and returns the stored thread, concurrent appends are never lost
+	AppendMessage(ctx context.Context, threadID string, messageID int) (*models.Thread, error)
+	// UpdateThreadSummary sets theme and summary without touching the messages of the thread
+	UpdateThreadSummary(ctx context.Context, threadID, theme, summary string) error
 	Close() error
 }
@@ -0,0 +1,163 @@
+package updates
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/kriku/kpukbot/internal/models"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	queueCollection       = "update_queue"
+	deadLettersCollection = "update_dead_letters"
+)
+
+// FirestoreRepository implements UpdatesRepository interface using Firestore.
+// Leases run inside a transaction so an update is never handed to two workers
+type FirestoreRepository struct {
+	client *firestore.Client
+}
+
+// NewFirestoreUpdatesRepository creates a new FirestoreRepository with existing client
+func NewFirestoreUpdatesRepository(client *firestore.Client) UpdatesRepository {
+	return &FirestoreRepository{
+		client: client,
+	}
+}
+
+func (r *FirestoreRepository) Enqueue(ctx context.Context, update models.QueuedUpdate) error {
+	if update.EnqueuedAt.IsZero() {
+		update.EnqueuedAt = time.Now()
+	}
+	if update.VisibleAt.IsZero() {
+		update.VisibleAt = update.EnqueuedAt
+	}
+
+	_, err := r.client.Collection(queueCollection).Doc(update.ID).Create(ctx, update)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue update: %w", err)
+	}
+	return nil
+}
+
+func (r *FirestoreRepository) Lease(ctx context.Context, limit int, visibility time.Duration) ([]*models.QueuedUpdate, error) {
+	var leased []*models.QueuedUpdate
+
+	err := r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		leased = nil
+		now := time.Now()
+
+		query := r.client.Collection(queueCollection).
+			Where("visible_at", "<=", now).
+			OrderBy("visible_at", firestore.Asc).
+			Limit(limit)
+
+		docs, err := tx.Documents(query).GetAll()
+		if err != nil {
+			return err
+		}
+
+		visibleAt := now.Add(visibility)
+		for _, doc := range docs {
+			var update models.QueuedUpdate
+			if err := doc.DataTo(&update); err != nil {
+				return err
+			}
+
+			update.Attempts++
+			update.VisibleAt = visibleAt
+			err := tx.Update(doc.Ref, []firestore.Update{
+				{Path: "attempts", Value: update.Attempts},
+				{Path: "visible_at", Value: update.VisibleAt},
+			})
+			if err != nil {
+				return err
+			}
+
+			leased = append(leased, &update)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to lease updates: %w", err)
+	}
+
+	return leased, nil
+}
+
+func (r *FirestoreRepository) Ack(ctx context.Context, id string) error {
+	// Delete succeeds for missing documents, the precondition reports them
+	_, err := r.client.Collection(queueCollection).Doc(id).Delete(ctx, firestore.Exists)
+	if err != nil {
+		return fmt.Errorf("failed to ack update: %w", err)
+	}
+	return nil
+}
+
+func (r *FirestoreRepository) Retry(ctx context.Context, id string, delay time.Duration, lastErr string) error {
+	_, err := r.client.Collection(queueCollection).Doc(id).Update(ctx, []firestore.Update{
+		{Path: "visible_at", Value: time.Now().Add(delay)},
+		{Path: "last_error", Value: lastErr},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to retry update: %w", err)
+	}
+	return nil
+}
+
+func (r *FirestoreRepository) DeadLetter(ctx context.Context, id string, lastErr string) error {
+	ref := r.client.Collection(queueCollection).Doc(id)
+
+	err := r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+
+		var update models.QueuedUpdate
+		if err := doc.DataTo(&update); err != nil {
+			return err
+		}
+		update.LastError = lastErr
+		update.FailedAt = time.Now()
+
+		if err := tx.Create(r.client.Collection(deadLettersCollection).Doc(id), update); err != nil {
+			return err
+		}
+		return tx.Delete(ref)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to dead letter update: %w", err)
+	}
+	return nil
+}
+
+func (r *FirestoreRepository) GetDeadLetters(ctx context.Context, limit int) ([]*models.QueuedUpdate, error) {
+	iter := r.client.Collection(deadLettersCollection).
+		OrderBy("failed_at", firestore.Desc).
+		Limit(limit).
+		Documents(ctx)
+	defer iter.Stop()
+
+	var updates []*models.QueuedUpdate
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate dead letters: %w", err)
+		}
+
+		var update models.QueuedUpdate
+		if err := doc.DataTo(&update); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal dead letter: %w", err)
+		}
+		updates = append(updates, &update)
+	}
+
+	return updates, nil
+}
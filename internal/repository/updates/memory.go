@@ -0,0 +1,132 @@
+package updates
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MemoryRepository implements UpdatesRepository interface in memory
+type MemoryRepository struct {
+	mu          sync.Mutex
+	queue       map[string]models.QueuedUpdate
+	deadLetters []models.QueuedUpdate
+}
+
+// NewMemoryUpdatesRepository creates a new empty MemoryRepository
+func NewMemoryUpdatesRepository() UpdatesRepository {
+	return &MemoryRepository{
+		queue: make(map[string]models.QueuedUpdate),
+	}
+}
+
+func (r *MemoryRepository) Enqueue(ctx context.Context, update models.QueuedUpdate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if update.EnqueuedAt.IsZero() {
+		update.EnqueuedAt = time.Now()
+	}
+	if update.VisibleAt.IsZero() {
+		update.VisibleAt = update.EnqueuedAt
+	}
+	update.Payload = append([]byte(nil), update.Payload...)
+
+	r.queue[update.ID] = update
+	return nil
+}
+
+func (r *MemoryRepository) Lease(ctx context.Context, limit int, visibility time.Duration) ([]*models.QueuedUpdate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+
+	var visible []models.QueuedUpdate
+	for _, update := range r.queue {
+		if !update.VisibleAt.After(now) {
+			visible = append(visible, update)
+		}
+	}
+	sort.Slice(visible, func(i, j int) bool {
+		if !visible[i].VisibleAt.Equal(visible[j].VisibleAt) {
+			return visible[i].VisibleAt.Before(visible[j].VisibleAt)
+		}
+		return visible[i].EnqueuedAt.Before(visible[j].EnqueuedAt)
+	})
+	if len(visible) > limit {
+		visible = visible[:limit]
+	}
+
+	leased := make([]*models.QueuedUpdate, 0, len(visible))
+	for _, update := range visible {
+		update.Attempts++
+		update.VisibleAt = now.Add(visibility)
+		r.queue[update.ID] = update
+
+		update.Payload = append([]byte(nil), update.Payload...)
+		leased = append(leased, &update)
+	}
+
+	return leased, nil
+}
+
+func (r *MemoryRepository) Ack(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.queue[id]; !ok {
+		return status.Errorf(codes.NotFound, "update not found")
+	}
+	delete(r.queue, id)
+	return nil
+}
+
+func (r *MemoryRepository) Retry(ctx context.Context, id string, delay time.Duration, lastErr string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	update, ok := r.queue[id]
+	if !ok {
+		return status.Errorf(codes.NotFound, "update not found")
+	}
+
+	update.VisibleAt = time.Now().Add(delay)
+	update.LastError = lastErr
+	r.queue[id] = update
+	return nil
+}
+
+func (r *MemoryRepository) DeadLetter(ctx context.Context, id string, lastErr string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	update, ok := r.queue[id]
+	if !ok {
+		return status.Errorf(codes.NotFound, "update not found")
+	}
+
+	update.LastError = lastErr
+	update.FailedAt = time.Now()
+	r.deadLetters = append(r.deadLetters, update)
+	delete(r.queue, id)
+	return nil
+}
+
+func (r *MemoryRepository) GetDeadLetters(ctx context.Context, limit int) ([]*models.QueuedUpdate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deadLetters []*models.QueuedUpdate
+	for i := len(r.deadLetters) - 1; i >= 0 && len(deadLetters) < limit; i-- {
+		update := r.deadLetters[i]
+		update.Payload = append([]byte(nil), update.Payload...)
+		deadLetters = append(deadLetters, &update)
+	}
+	return deadLetters, nil
+}
@@ -0,0 +1,143 @@
+package updates
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/repository/repotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// runUpdatesRepositoryTests checks behaviour every UpdatesRepository implementation must share
+func runUpdatesRepositoryTests(t *testing.T, newRepo func(t *testing.T) UpdatesRepository) {
+	ctx := context.Background()
+
+	enqueue := func(t *testing.T, repo UpdatesRepository, id string, updateID int64, enqueuedAt time.Time) {
+		require.NoError(t, repo.Enqueue(ctx, models.QueuedUpdate{
+			ID:         id,
+			UpdateID:   updateID,
+			ChatID:     100,
+			Payload:    []byte(`{"update_id":1}`),
+			EnqueuedAt: enqueuedAt,
+		}))
+	}
+
+	t.Run("lease hides updates until the visibility timeout", func(t *testing.T) {
+		repo := newRepo(t)
+		now := time.Now()
+		enqueue(t, repo, "b", 2, now.Add(-time.Second))
+		enqueue(t, repo, "a", 1, now.Add(-2*time.Second))
+
+		leased, err := repo.Lease(ctx, 1, 200*time.Millisecond)
+		require.NoError(t, err)
+		require.Len(t, leased, 1)
+		assert.Equal(t, "a", leased[0].ID)
+		assert.Equal(t, int64(1), leased[0].UpdateID)
+		assert.Equal(t, int64(100), leased[0].ChatID)
+		assert.Equal(t, []byte(`{"update_id":1}`), leased[0].Payload)
+		assert.Equal(t, 1, leased[0].Attempts)
+
+		leased, err = repo.Lease(ctx, 10, 200*time.Millisecond)
+		require.NoError(t, err)
+		require.Len(t, leased, 1)
+		assert.Equal(t, "b", leased[0].ID)
+
+		leased, err = repo.Lease(ctx, 10, 200*time.Millisecond)
+		require.NoError(t, err)
+		assert.Empty(t, leased)
+
+		// Workers that died never ack, their updates come back
+		time.Sleep(300 * time.Millisecond)
+		leased, err = repo.Lease(ctx, 10, time.Minute)
+		require.NoError(t, err)
+		require.Len(t, leased, 2)
+		assert.Equal(t, 2, leased[0].Attempts)
+	})
+
+	t.Run("ack removes updates", func(t *testing.T) {
+		repo := newRepo(t)
+		enqueue(t, repo, "a", 1, time.Now())
+
+		leased, err := repo.Lease(ctx, 1, 0)
+		require.NoError(t, err)
+		require.Len(t, leased, 1)
+		require.NoError(t, repo.Ack(ctx, "a"))
+
+		leased, err = repo.Lease(ctx, 1, 0)
+		require.NoError(t, err)
+		assert.Empty(t, leased)
+
+		assert.Equal(t, codes.NotFound, status.Code(repo.Ack(ctx, "a")))
+	})
+
+	t.Run("retry delays updates and keeps the error", func(t *testing.T) {
+		repo := newRepo(t)
+		enqueue(t, repo, "a", 1, time.Now())
+
+		_, err := repo.Lease(ctx, 1, time.Minute)
+		require.NoError(t, err)
+		require.NoError(t, repo.Retry(ctx, "a", 0, "boom"))
+
+		leased, err := repo.Lease(ctx, 1, time.Minute)
+		require.NoError(t, err)
+		require.Len(t, leased, 1)
+		assert.Equal(t, 2, leased[0].Attempts)
+		assert.Equal(t, "boom", leased[0].LastError)
+
+		require.NoError(t, repo.Retry(ctx, "a", time.Minute, "boom"))
+		leased, err = repo.Lease(ctx, 1, time.Minute)
+		require.NoError(t, err)
+		assert.Empty(t, leased)
+
+		assert.Equal(t, codes.NotFound, status.Code(repo.Retry(ctx, "missing", 0, "")))
+	})
+
+	t.Run("dead letters leave the queue", func(t *testing.T) {
+		repo := newRepo(t)
+		enqueue(t, repo, "a", 1, time.Now())
+		enqueue(t, repo, "b", 2, time.Now())
+
+		_, err := repo.Lease(ctx, 2, time.Minute)
+		require.NoError(t, err)
+		require.NoError(t, repo.DeadLetter(ctx, "a", "bad update"))
+		time.Sleep(time.Millisecond)
+		require.NoError(t, repo.DeadLetter(ctx, "b", "still failing"))
+
+		deadLetters, err := repo.GetDeadLetters(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, deadLetters, 2)
+		assert.Equal(t, "b", deadLetters[0].ID)
+		assert.Equal(t, "still failing", deadLetters[0].LastError)
+		assert.Equal(t, 1, deadLetters[0].Attempts)
+		assert.False(t, deadLetters[0].FailedAt.IsZero())
+		assert.Equal(t, []byte(`{"update_id":1}`), deadLetters[1].Payload)
+
+		leased, err := repo.Lease(ctx, 2, 0)
+		require.NoError(t, err)
+		assert.Empty(t, leased)
+		assert.Equal(t, codes.NotFound, status.Code(repo.DeadLetter(ctx, "a", "")))
+	})
+}
+
+func TestMemoryRepository(t *testing.T) {
+	runUpdatesRepositoryTests(t, func(t *testing.T) UpdatesRepository {
+		return NewMemoryUpdatesRepository()
+	})
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	runUpdatesRepositoryTests(t, func(t *testing.T) UpdatesRepository {
+		return NewSQLiteUpdatesRepository(repotest.SQLiteDB(t))
+	})
+}
+
+func TestFirestoreRepository(t *testing.T) {
+	runUpdatesRepositoryTests(t, func(t *testing.T) UpdatesRepository {
+		return NewFirestoreUpdatesRepository(repotest.FirestoreClient(t))
+	})
+}
@@ -0,0 +1,203 @@
+package updates
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/repository/sqlite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const updateColumns = `id, update_id, chat_id, payload, attempts, last_error, enqueued_at, visible_at`
+
+// SQLiteRepository implements UpdatesRepository interface using SQLite.
+// Leases run inside a transaction so an update is never handed to two workers
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteUpdatesRepository creates a new SQLiteRepository with existing database
+func NewSQLiteUpdatesRepository(db *sql.DB) UpdatesRepository {
+	return &SQLiteRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteRepository) Enqueue(ctx context.Context, update models.QueuedUpdate) error {
+	if update.EnqueuedAt.IsZero() {
+		update.EnqueuedAt = time.Now()
+	}
+	if update.VisibleAt.IsZero() {
+		update.VisibleAt = update.EnqueuedAt
+	}
+
+	_, err := r.db.ExecContext(ctx, `INSERT INTO update_queue (`+updateColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		update.ID, update.UpdateID, update.ChatID, update.Payload, update.Attempts, update.LastError,
+		sqlite.UnixTime(update.EnqueuedAt), sqlite.UnixTime(update.VisibleAt))
+	if err != nil {
+		return fmt.Errorf("failed to enqueue update: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) Lease(ctx context.Context, limit int, visibility time.Duration) ([]*models.QueuedUpdate, error) {
+	var leased []*models.QueuedUpdate
+
+	err := sqlite.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		now := time.Now()
+
+		updates, err := queryUpdates(ctx, tx, `
+			SELECT `+updateColumns+` FROM update_queue
+			WHERE visible_at <= ?
+			ORDER BY visible_at, enqueued_at
+			LIMIT ?`, sqlite.UnixTime(now), limit)
+		if err != nil {
+			return err
+		}
+
+		visibleAt := now.Add(visibility)
+		for _, update := range updates {
+			update.Attempts++
+			update.VisibleAt = visibleAt
+
+			_, err := tx.ExecContext(ctx, `UPDATE update_queue SET attempts = ?, visible_at = ? WHERE id = ?`,
+				update.Attempts, sqlite.UnixTime(update.VisibleAt), update.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		leased = updates
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to lease updates: %w", err)
+	}
+
+	return leased, nil
+}
+
+func (r *SQLiteRepository) Ack(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM update_queue WHERE id = ?`, id)
+	if err == nil {
+		err = requireAffected(result)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to ack update: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) Retry(ctx context.Context, id string, delay time.Duration, lastErr string) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE update_queue SET visible_at = ?, last_error = ? WHERE id = ?`,
+		sqlite.UnixTime(time.Now().Add(delay)), lastErr, id)
+	if err == nil {
+		err = requireAffected(result)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to retry update: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) DeadLetter(ctx context.Context, id string, lastErr string) error {
+	err := sqlite.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO update_dead_letters (`+updateColumns+`, failed_at)
+			SELECT id, update_id, chat_id, payload, attempts, ?, enqueued_at, visible_at, ?
+			FROM update_queue WHERE id = ?`,
+			lastErr, sqlite.UnixTime(time.Now()), id)
+		if err == nil {
+			err = requireAffected(result)
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM update_queue WHERE id = ?`, id)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to dead letter update: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) GetDeadLetters(ctx context.Context, limit int) ([]*models.QueuedUpdate, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+updateColumns+`, failed_at FROM update_dead_letters
+		ORDER BY failed_at DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	var updates []*models.QueuedUpdate
+	for rows.Next() {
+		var failedAt int64
+		update, err := scanUpdate(rows, &failedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal dead letter: %w", err)
+		}
+		update.FailedAt = sqlite.FromUnixTime(failedAt)
+		updates = append(updates, update)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate dead letters: %w", err)
+	}
+
+	return updates, nil
+}
+
+func queryUpdates(ctx context.Context, q sqlite.Querier, query string, args ...any) ([]*models.QueuedUpdate, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var updates []*models.QueuedUpdate
+	for rows.Next() {
+		update, err := scanUpdate(rows)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, update)
+	}
+
+	return updates, rows.Err()
+}
+
+// scanUpdate reads the updateColumns of a row followed by extra columns
+func scanUpdate(rows *sql.Rows, extra ...any) (*models.QueuedUpdate, error) {
+	var update models.QueuedUpdate
+	var enqueuedAt, visibleAt int64
+
+	dest := []any{&update.ID, &update.UpdateID, &update.ChatID, &update.Payload, &update.Attempts,
+		&update.LastError, &enqueuedAt, &visibleAt}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	update.EnqueuedAt = sqlite.FromUnixTime(enqueuedAt)
+	update.VisibleAt = sqlite.FromUnixTime(visibleAt)
+	return &update, nil
+}
+
+// requireAffected turns a statement that matched no rows into a NotFound error
+func requireAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return status.Errorf(codes.NotFound, "update not found")
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package updates
+
+import (
+	"context"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+)
+
+// UpdatesRepository is a durable work queue of Telegram updates with a dead letter store.
+// Leased updates are hidden from other workers until their visibility timeout passes,
+// so an update whose worker died is picked up again
+type UpdatesRepository interface {
+	// Enqueue adds an update that is visible right away
+	Enqueue(ctx context.Context, update models.QueuedUpdate) error
+
+	// Lease returns up to limit visible updates in the order they became visible, hides them for visibility
+	// and counts the attempt
+	Lease(ctx context.Context, limit int, visibility time.Duration) ([]*models.QueuedUpdate, error)
+
+	// Ack removes a processed update
+	Ack(ctx context.Context, id string) error
+
+	// Retry makes a failed update visible again after delay
+	Retry(ctx context.Context, id string, delay time.Duration, lastErr string) error
+
+	// DeadLetter moves an update that cannot be processed to the dead letter store
+	DeadLetter(ctx context.Context, id string, lastErr string) error
+
+	// GetDeadLetters returns up to limit dead letters, newest first
+	GetDeadLetters(ctx context.Context, limit int) ([]*models.QueuedUpdate, error)
+}
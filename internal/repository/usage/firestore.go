@@ -0,0 +1,99 @@
+package usage
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/kriku/kpukbot/internal/models"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	usageCollection = "llm_usage_daily"
+)
+
+// FirestoreRepository implements UsageRepository interface using Firestore
+type FirestoreRepository struct {
+	client *firestore.Client
+}
+
+// NewFirestoreUsageRepository creates a new FirestoreRepository with existing client
+func NewFirestoreUsageRepository(client *firestore.Client) UsageRepository {
+	return &FirestoreRepository{
+		client: client,
+	}
+}
+
+// usageDocID builds the document ID of an aggregate, thread IDs and model names may contain
+// characters that are not allowed in document IDs so the key is hashed
+func usageDocID(key aggregateKey) string {
+	sum := sha1.Sum(fmt.Appendf(nil, "%d|%s|%d|%s|%s|%s",
+		key.chatID, key.day, key.userID, key.threadID, key.callSite, key.model))
+	return hex.EncodeToString(sum[:])
+}
+
+// AddUsage adds usage to its daily aggregate in Firestore, counters are incremented atomically
+func (r *FirestoreRepository) AddUsage(ctx context.Context, usage models.LLMUsage) error {
+	key := keyOf(usage)
+	_, err := r.client.Collection(usageCollection).Doc(usageDocID(key)).Set(ctx, map[string]any{
+		"chat_id":         key.chatID,
+		"day":             key.day,
+		"user_id":         key.userID,
+		"thread_id":       key.threadID,
+		"call_site":       key.callSite,
+		"model":           key.model,
+		"calls":           firestore.Increment(1),
+		"prompt_tokens":   firestore.Increment(usage.PromptTokens),
+		"response_tokens": firestore.Increment(usage.ResponseTokens),
+		"total_tokens":    firestore.Increment(usage.TotalTokens),
+		"cost_usd":        firestore.Increment(usage.CostUSD),
+		"updated_at":      time.Now(),
+	}, firestore.MergeAll)
+	if err != nil {
+		return fmt.Errorf("failed to add usage: %w", err)
+	}
+	return nil
+}
+
+func (r *FirestoreRepository) GetDailyUsage(ctx context.Context, chatID int64, from, to time.Time) ([]*models.DailyUsage, error) {
+	return r.queryUsage(ctx, r.client.Collection(usageCollection).
+		Where("chat_id", "==", chatID).
+		Where("day", ">=", models.UsageDay(from)).
+		Where("day", "<=", models.UsageDay(to)).
+		OrderBy("day", firestore.Asc))
+}
+
+func (r *FirestoreRepository) GetAllDailyUsage(ctx context.Context, from, to time.Time) ([]*models.DailyUsage, error) {
+	return r.queryUsage(ctx, r.client.Collection(usageCollection).
+		Where("day", ">=", models.UsageDay(from)).
+		Where("day", "<=", models.UsageDay(to)).
+		OrderBy("day", firestore.Asc))
+}
+
+func (r *FirestoreRepository) queryUsage(ctx context.Context, query firestore.Query) ([]*models.DailyUsage, error) {
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+
+	var usage []*models.DailyUsage
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate usage: %w", err)
+		}
+
+		var u models.DailyUsage
+		if err := doc.DataTo(&u); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal usage: %w", err)
+		}
+		usage = append(usage, &u)
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,85 @@
+package usage
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+)
+
+// MemoryRepository implements UsageRepository interface in memory
+type MemoryRepository struct {
+	mu         sync.RWMutex
+	aggregates map[aggregateKey]models.DailyUsage
+}
+
+// NewMemoryUsageRepository creates a new empty MemoryRepository
+func NewMemoryUsageRepository() UsageRepository {
+	return &MemoryRepository{
+		aggregates: make(map[aggregateKey]models.DailyUsage),
+	}
+}
+
+// AddUsage adds usage to its daily aggregate in memory
+func (r *MemoryRepository) AddUsage(ctx context.Context, usage models.LLMUsage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := keyOf(usage)
+	aggregate, ok := r.aggregates[key]
+	if !ok {
+		aggregate = models.DailyUsage{
+			ChatID:   key.chatID,
+			Day:      key.day,
+			UserID:   key.userID,
+			ThreadID: key.threadID,
+			CallSite: key.callSite,
+			Model:    key.model,
+		}
+	}
+
+	aggregate.Calls++
+	aggregate.PromptTokens += usage.PromptTokens
+	aggregate.ResponseTokens += usage.ResponseTokens
+	aggregate.TotalTokens += usage.TotalTokens
+	aggregate.CostUSD += usage.CostUSD
+	aggregate.UpdatedAt = time.Now()
+
+	r.aggregates[key] = aggregate
+	return nil
+}
+
+func (r *MemoryRepository) GetDailyUsage(ctx context.Context, chatID int64, from, to time.Time) ([]*models.DailyUsage, error) {
+	return r.findUsage(func(u models.DailyUsage) bool { return u.ChatID == chatID }, from, to), nil
+}
+
+func (r *MemoryRepository) GetAllDailyUsage(ctx context.Context, from, to time.Time) ([]*models.DailyUsage, error) {
+	return r.findUsage(func(u models.DailyUsage) bool { return true }, from, to), nil
+}
+
+func (r *MemoryRepository) findUsage(match func(models.DailyUsage) bool, from, to time.Time) []*models.DailyUsage {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	fromDay, toDay := models.UsageDay(from), models.UsageDay(to)
+
+	var usage []*models.DailyUsage
+	for _, u := range r.aggregates {
+		if u.Day >= fromDay && u.Day <= toDay && match(u) {
+			u := u
+			usage = append(usage, &u)
+		}
+	}
+
+	// Keep a stable order, map iteration is random
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Day != usage[j].Day {
+			return usage[i].Day < usage[j].Day
+		}
+		return usage[i].ChatID < usage[j].ChatID
+	})
+
+	return usage
+}
@@ -0,0 +1,112 @@
+package usage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/repository/repotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runUsageRepositoryTests checks behaviour every UsageRepository implementation must share
+func runUsageRepositoryTests(t *testing.T, newRepo func(t *testing.T) UsageRepository) {
+	ctx := context.Background()
+	day := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	t.Run("usage is aggregated per day and attribution", func(t *testing.T) {
+		repo := newRepo(t)
+
+		call := models.LLMUsage{
+			ChatID:         1,
+			UserID:         7,
+			ThreadID:       "thread-1",
+			CallSite:       "classifier",
+			Model:          "gemini-2.5-flash",
+			PromptTokens:   100,
+			ResponseTokens: 20,
+			TotalTokens:    120,
+			CostUSD:        0.5,
+			CreatedAt:      day,
+		}
+		require.NoError(t, repo.AddUsage(ctx, call))
+		require.NoError(t, repo.AddUsage(ctx, call))
+
+		other := call
+		other.CallSite = "general"
+		require.NoError(t, repo.AddUsage(ctx, other))
+
+		usage, err := repo.GetDailyUsage(ctx, 1, day, day)
+		require.NoError(t, err)
+		require.Len(t, usage, 2)
+
+		var classifier *models.DailyUsage
+		for _, u := range usage {
+			if u.CallSite == "classifier" {
+				classifier = u
+			}
+		}
+		require.NotNil(t, classifier)
+		assert.Equal(t, "2025-03-10", classifier.Day)
+		assert.Equal(t, int64(7), classifier.UserID)
+		assert.Equal(t, "thread-1", classifier.ThreadID)
+		assert.Equal(t, "gemini-2.5-flash", classifier.Model)
+		assert.Equal(t, int64(2), classifier.Calls)
+		assert.Equal(t, int64(200), classifier.PromptTokens)
+		assert.Equal(t, int64(40), classifier.ResponseTokens)
+		assert.Equal(t, int64(240), classifier.TotalTokens)
+		assert.InDelta(t, 1.0, classifier.CostUSD, 1e-9)
+	})
+
+	t.Run("days and chats are filtered", func(t *testing.T) {
+		repo := newRepo(t)
+
+		require.NoError(t, repo.AddUsage(ctx, models.LLMUsage{ChatID: 1, TotalTokens: 10, CreatedAt: day.AddDate(0, 0, -1)}))
+		require.NoError(t, repo.AddUsage(ctx, models.LLMUsage{ChatID: 1, TotalTokens: 20, CreatedAt: day}))
+		require.NoError(t, repo.AddUsage(ctx, models.LLMUsage{ChatID: 2, TotalTokens: 30, CreatedAt: day}))
+		require.NoError(t, repo.AddUsage(ctx, models.LLMUsage{ChatID: 1, TotalTokens: 40, CreatedAt: day.AddDate(0, 0, 1)}))
+
+		usage, err := repo.GetDailyUsage(ctx, 1, day, day)
+		require.NoError(t, err)
+		require.Len(t, usage, 1)
+		assert.Equal(t, int64(20), usage[0].TotalTokens)
+
+		usage, err = repo.GetDailyUsage(ctx, 1, day.AddDate(0, 0, -1), day.AddDate(0, 0, 1))
+		require.NoError(t, err)
+		require.Len(t, usage, 3)
+		assert.Equal(t, "2025-03-09", usage[0].Day)
+		assert.Equal(t, "2025-03-11", usage[2].Day)
+
+		all, err := repo.GetAllDailyUsage(ctx, day, day)
+		require.NoError(t, err)
+		assert.Len(t, all, 2)
+	})
+
+	t.Run("no usage is not an error", func(t *testing.T) {
+		repo := newRepo(t)
+
+		usage, err := repo.GetDailyUsage(ctx, 1, day, day)
+		require.NoError(t, err)
+		assert.Empty(t, usage)
+	})
+}
+
+func TestMemoryRepository(t *testing.T) {
+	runUsageRepositoryTests(t, func(t *testing.T) UsageRepository {
+		return NewMemoryUsageRepository()
+	})
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	runUsageRepositoryTests(t, func(t *testing.T) UsageRepository {
+		return NewSQLiteUsageRepository(repotest.SQLiteDB(t))
+	})
+}
+
+func TestFirestoreRepository(t *testing.T) {
+	runUsageRepositoryTests(t, func(t *testing.T) UsageRepository {
+		return NewFirestoreUsageRepository(repotest.FirestoreClient(t))
+	})
+}
@@ -0,0 +1,87 @@
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/repository/sqlite"
+)
+
+const usageColumns = `chat_id, day, user_id, thread_id, call_site, model, calls,
+	prompt_tokens, response_tokens, total_tokens, cost_usd, updated_at`
+
+// SQLiteRepository implements UsageRepository interface using SQLite
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteUsageRepository creates a new SQLiteRepository with existing database
+func NewSQLiteUsageRepository(db *sql.DB) UsageRepository {
+	return &SQLiteRepository{
+		db: db,
+	}
+}
+
+// AddUsage adds usage to its daily aggregate in SQLite
+func (r *SQLiteRepository) AddUsage(ctx context.Context, usage models.LLMUsage) error {
+	key := keyOf(usage)
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO llm_usage_daily (`+usageColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?, ?)
+		ON CONFLICT (chat_id, day, user_id, thread_id, call_site, model) DO UPDATE SET
+			calls = calls + 1,
+			prompt_tokens = prompt_tokens + excluded.prompt_tokens,
+			response_tokens = response_tokens + excluded.response_tokens,
+			total_tokens = total_tokens + excluded.total_tokens,
+			cost_usd = cost_usd + excluded.cost_usd,
+			updated_at = excluded.updated_at`,
+		key.chatID, key.day, key.userID, key.threadID, key.callSite, key.model,
+		usage.PromptTokens, usage.ResponseTokens, usage.TotalTokens, usage.CostUSD, sqlite.UnixTime(time.Now()),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add usage: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) GetDailyUsage(ctx context.Context, chatID int64, from, to time.Time) ([]*models.DailyUsage, error) {
+	return r.queryUsage(ctx,
+		`SELECT `+usageColumns+` FROM llm_usage_daily WHERE chat_id = ? AND day >= ? AND day <= ? ORDER BY day`,
+		chatID, models.UsageDay(from), models.UsageDay(to))
+}
+
+func (r *SQLiteRepository) GetAllDailyUsage(ctx context.Context, from, to time.Time) ([]*models.DailyUsage, error) {
+	return r.queryUsage(ctx,
+		`SELECT `+usageColumns+` FROM llm_usage_daily WHERE day >= ? AND day <= ? ORDER BY day, chat_id`,
+		models.UsageDay(from), models.UsageDay(to))
+}
+
+func (r *SQLiteRepository) queryUsage(ctx context.Context, query string, args ...any) ([]*models.DailyUsage, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+	defer rows.Close()
+
+	var usage []*models.DailyUsage
+	for rows.Next() {
+		var u models.DailyUsage
+		var updatedAt int64
+		err := rows.Scan(&u.ChatID, &u.Day, &u.UserID, &u.ThreadID, &u.CallSite, &u.Model, &u.Calls,
+			&u.PromptTokens, &u.ResponseTokens, &u.TotalTokens, &u.CostUSD, &updatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal usage: %w", err)
+		}
+		u.UpdatedAt = sqlite.FromUnixTime(updatedAt)
+		usage = append(usage, &u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate usage: %w", err)
+	}
+
+	return usage, nil
+}
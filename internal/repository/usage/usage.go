@@ -0,0 +1,41 @@
+package usage
+
+import (
+	"context"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+)
+
+// UsageRepository stores LLM token usage as daily aggregates
+type UsageRepository interface {
+	// AddUsage adds the usage of one call to its daily aggregate
+	AddUsage(ctx context.Context, usage models.LLMUsage) error
+
+	// GetDailyUsage returns the aggregates of a chat for the days from..to, both inclusive
+	GetDailyUsage(ctx context.Context, chatID int64, from, to time.Time) ([]*models.DailyUsage, error)
+
+	// GetAllDailyUsage returns the aggregates of all chats for the days from..to, both inclusive
+	GetAllDailyUsage(ctx context.Context, from, to time.Time) ([]*models.DailyUsage, error)
+}
+
+// aggregateKey identifies a daily aggregate
+type aggregateKey struct {
+	chatID   int64
+	day      string
+	userID   int64
+	threadID string
+	callSite string
+	model    string
+}
+
+func keyOf(usage models.LLMUsage) aggregateKey {
+	return aggregateKey{
+		chatID:   usage.ChatID,
+		day:      models.UsageDay(usage.CreatedAt),
+		userID:   usage.UserID,
+		threadID: usage.ThreadID,
+		callSite: usage.CallSite,
+		model:    usage.Model,
+	}
+}
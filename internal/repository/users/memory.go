@@ -0,0 +1,152 @@
+package users
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MemoryRepository implements UsersRepository interface in memory
+type MemoryRepository struct {
+	mu    sync.RWMutex
+	users map[int64]models.User
+}
+
+// NewMemoryUsersRepository creates a new empty MemoryRepository
+func NewMemoryUsersRepository() UsersRepository {
+	return &MemoryRepository{
+		users: make(map[int64]models.User),
+	}
+}
+
+// SaveUser saves or updates a user in memory
+func (r *MemoryRepository) SaveUser(ctx context.Context, user models.User) error {
+	user.UpdatedAt = time.Now()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.users[user.ID] = cloneUser(user)
+	return nil
+}
+
+// GetUser retrieves a user by their Telegram ID
+func (r *MemoryRepository) GetUser(ctx context.Context, userID int64) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "user not found")
+	}
+
+	user = cloneUser(user)
+	return &user, nil
+}
+
+// GetUsersByChatID retrieves all users from a specific chat
+func (r *MemoryRepository) GetUsersByChatID(ctx context.Context, chatID int64) ([]*models.User, error) {
+	return r.findUsers(func(user models.User) bool {
+		return user.ChatID == chatID
+	}), nil
+}
+
+// UpdateUserBio updates the bio/introduction text for a user
+func (r *MemoryRepository) UpdateUserBio(ctx context.Context, userID int64, bio string) error {
+	err := r.update(userID, func(user *models.User) {
+		user.Bio = bio
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update user bio: %w", err)
+	}
+	return nil
+}
+
+// UpdateUserInterests updates or adds interests for a user
+func (r *MemoryRepository) UpdateUserInterests(ctx context.Context, userID int64, interests []string) error {
+	err := r.update(userID, func(user *models.User) {
+		user.Interests = slices.Clone(interests)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update user interests: %w", err)
+	}
+	return nil
+}
+
+// UpdateUserHobbies updates or adds hobbies for a user
+func (r *MemoryRepository) UpdateUserHobbies(ctx context.Context, userID int64, hobbies []string) error {
+	err := r.update(userID, func(user *models.User) {
+		user.Hobbies = slices.Clone(hobbies)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update user hobbies: %w", err)
+	}
+	return nil
+}
+
+// SearchUsersByInterest finds users who have specific interests
+func (r *MemoryRepository) SearchUsersByInterest(ctx context.Context, interest string) ([]*models.User, error) {
+	return r.findUsers(func(user models.User) bool {
+		return slices.Contains(user.Interests, interest)
+	}), nil
+}
+
+// SearchUsersByHobby finds users who have specific hobbies
+func (r *MemoryRepository) SearchUsersByHobby(ctx context.Context, hobby string) ([]*models.User, error) {
+	return r.findUsers(func(user models.User) bool {
+		return slices.Contains(user.Hobbies, hobby)
+	}), nil
+}
+
+// update applies fn to a stored user, failing like a Firestore update when the user is missing
+func (r *MemoryRepository) update(userID int64, fn func(user *models.User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return status.Errorf(codes.NotFound, "user not found")
+	}
+
+	fn(&user)
+	user.UpdatedAt = time.Now()
+	r.users[userID] = user
+	return nil
+}
+
+// findUsers returns copies of all users matching the filter ordered by ID
+func (r *MemoryRepository) findUsers(match func(user models.User) bool) []*models.User {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var users []*models.User
+	for _, user := range r.users {
+		if match(user) {
+			user = cloneUser(user)
+			users = append(users, &user)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+
+	return users
+}
+
+// cloneUser copies a user so callers never share slices with the stored value
+func cloneUser(user models.User) models.User {
+	user.Interests = slices.Clone(user.Interests)
+	user.Hobbies = slices.Clone(user.Hobbies)
+	return user
+}
@@ -0,0 +1,97 @@
+package users
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/repository/repotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// runUsersRepositoryTests checks behaviour every UsersRepository implementation must share
+func runUsersRepositoryTests(t *testing.T, newRepo func(t *testing.T) UsersRepository) {
+	ctx := context.Background()
+
+	t.Run("save and get user", func(t *testing.T) {
+		repo := newRepo(t)
+
+		_, err := repo.GetUser(ctx, 1)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+
+		require.NoError(t, repo.SaveUser(ctx, models.User{ID: 1, FirstName: "John", ChatID: 100}))
+
+		user, err := repo.GetUser(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, "John", user.FirstName)
+		assert.False(t, user.CreatedAt.IsZero())
+		assert.False(t, user.UpdatedAt.IsZero())
+	})
+
+	t.Run("users by chat", func(t *testing.T) {
+		repo := newRepo(t)
+		require.NoError(t, repo.SaveUser(ctx, models.User{ID: 1, ChatID: 100}))
+		require.NoError(t, repo.SaveUser(ctx, models.User{ID: 2, ChatID: 100}))
+		require.NoError(t, repo.SaveUser(ctx, models.User{ID: 3, ChatID: 200}))
+
+		users, err := repo.GetUsersByChatID(ctx, 100)
+		require.NoError(t, err)
+		assert.Len(t, users, 2)
+	})
+
+	t.Run("profile updates and searches", func(t *testing.T) {
+		repo := newRepo(t)
+		require.NoError(t, repo.SaveUser(ctx, models.User{ID: 1, ChatID: 100}))
+		require.NoError(t, repo.SaveUser(ctx, models.User{ID: 2, ChatID: 100}))
+
+		require.NoError(t, repo.UpdateUserBio(ctx, 1, "Developer"))
+		require.NoError(t, repo.UpdateUserInterests(ctx, 1, []string{"go", "music"}))
+		require.NoError(t, repo.UpdateUserHobbies(ctx, 2, []string{"hiking"}))
+
+		user, err := repo.GetUser(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, "Developer", user.Bio)
+		assert.Equal(t, []string{"go", "music"}, user.Interests)
+
+		byInterest, err := repo.SearchUsersByInterest(ctx, "music")
+		require.NoError(t, err)
+		require.Len(t, byInterest, 1)
+		assert.Equal(t, int64(1), byInterest[0].ID)
+
+		byHobby, err := repo.SearchUsersByHobby(ctx, "hiking")
+		require.NoError(t, err)
+		require.Len(t, byHobby, 1)
+		assert.Equal(t, int64(2), byHobby[0].ID)
+
+		byHobby, err = repo.SearchUsersByHobby(ctx, "chess")
+		require.NoError(t, err)
+		assert.Empty(t, byHobby)
+	})
+
+	t.Run("updates fail for unknown user", func(t *testing.T) {
+		repo := newRepo(t)
+
+		assert.Error(t, repo.UpdateUserBio(ctx, 1, "bio"))
+	})
+}
+
+func TestMemoryRepository(t *testing.T) {
+	runUsersRepositoryTests(t, func(t *testing.T) UsersRepository {
+		return NewMemoryUsersRepository()
+	})
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	runUsersRepositoryTests(t, func(t *testing.T) UsersRepository {
+		return NewSQLiteUsersRepository(repotest.SQLiteDB(t))
+	})
+}
+
+func TestFirestoreRepository(t *testing.T) {
+	runUsersRepositoryTests(t, func(t *testing.T) UsersRepository {
+		return NewFirestoreUsersRepository(repotest.FirestoreClient(t))
+	})
+}
@@ -0,0 +1,243 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/repository/sqlite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	userColumns = `id, first_name, last_name, username, bio, chat_id, created_at, updated_at`
+
+	interestsTable = "user_interests"
+	hobbiesTable   = "user_hobbies"
+)
+
+// SQLiteRepository implements UsersRepository interface using SQLite
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteUsersRepository creates a new SQLiteRepository with existing database
+func NewSQLiteUsersRepository(db *sql.DB) UsersRepository {
+	return &SQLiteRepository{
+		db: db,
+	}
+}
+
+// SaveUser saves or updates a user to SQLite
+func (r *SQLiteRepository) SaveUser(ctx context.Context, user models.User) error {
+	user.UpdatedAt = time.Now()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+
+	err := sqlite.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO users (`+userColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET
+				first_name = excluded.first_name,
+				last_name = excluded.last_name,
+				username = excluded.username,
+				bio = excluded.bio,
+				chat_id = excluded.chat_id,
+				created_at = excluded.created_at,
+				updated_at = excluded.updated_at`,
+			user.ID, user.FirstName, user.LastName, user.Username, user.Bio, user.ChatID,
+			sqlite.UnixTime(user.CreatedAt), sqlite.UnixTime(user.UpdatedAt),
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := replaceValues(ctx, tx, interestsTable, user.ID, user.Interests); err != nil {
+			return err
+		}
+		return replaceValues(ctx, tx, hobbiesTable, user.ID, user.Hobbies)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save user: %w", err)
+	}
+	return nil
+}
+
+// GetUser retrieves a user by their Telegram ID
+func (r *SQLiteRepository) GetUser(ctx context.Context, userID int64) (*models.User, error) {
+	users, err := r.queryUsers(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if len(users) == 0 {
+		return nil, status.Errorf(codes.NotFound, "user not found")
+	}
+
+	return users[0], nil
+}
+
+// GetUsersByChatID retrieves all users from a specific chat
+func (r *SQLiteRepository) GetUsersByChatID(ctx context.Context, chatID int64) ([]*models.User, error) {
+	return r.queryUsers(ctx, `SELECT `+userColumns+` FROM users WHERE chat_id = ? ORDER BY id`, chatID)
+}
+
+// UpdateUserBio updates the bio/introduction text for a user
+func (r *SQLiteRepository) UpdateUserBio(ctx context.Context, userID int64, bio string) error {
+	err := sqlite.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		return touchUser(ctx, tx, userID, `bio = ?`, bio)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update user bio: %w", err)
+	}
+	return nil
+}
+
+// UpdateUserInterests updates or adds interests for a user
+func (r *SQLiteRepository) UpdateUserInterests(ctx context.Context, userID int64, interests []string) error {
+	err := sqlite.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		if err := touchUser(ctx, tx, userID, ""); err != nil {
+			return err
+		}
+		return replaceValues(ctx, tx, interestsTable, userID, interests)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update user interests: %w", err)
+	}
+	return nil
+}
+
+// UpdateUserHobbies updates or adds hobbies for a user
+func (r *SQLiteRepository) UpdateUserHobbies(ctx context.Context, userID int64, hobbies []string) error {
+	err := sqlite.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		if err := touchUser(ctx, tx, userID, ""); err != nil {
+			return err
+		}
+		return replaceValues(ctx, tx, hobbiesTable, userID, hobbies)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update user hobbies: %w", err)
+	}
+	return nil
+}
+
+// SearchUsersByInterest finds users who have specific interests
+func (r *SQLiteRepository) SearchUsersByInterest(ctx context.Context, interest string) ([]*models.User, error) {
+	return r.queryUsers(ctx, `
+		SELECT `+userColumns+` FROM users
+		WHERE id IN (SELECT user_id FROM user_interests WHERE value = ?)
+		ORDER BY id`, interest)
+}
+
+// SearchUsersByHobby finds users who have specific hobbies
+func (r *SQLiteRepository) SearchUsersByHobby(ctx context.Context, hobby string) ([]*models.User, error) {
+	return r.queryUsers(ctx, `
+		SELECT `+userColumns+` FROM users
+		WHERE id IN (SELECT user_id FROM user_hobbies WHERE value = ?)
+		ORDER BY id`, hobby)
+}
+
+func (r *SQLiteRepository) queryUsers(ctx context.Context, query string, args ...any) ([]*models.User, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+
+	var users []*models.User
+	for rows.Next() {
+		var user models.User
+		var createdAt, updatedAt int64
+		err := rows.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Username, &user.Bio,
+			&user.ChatID, &createdAt, &updatedAt)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+		}
+		user.CreatedAt = sqlite.FromUnixTime(createdAt)
+		user.UpdatedAt = sqlite.FromUnixTime(updatedAt)
+		users = append(users, &user)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate users: %w", err)
+	}
+
+	// Load lists after closing rows, the database uses a single connection
+	for _, user := range users {
+		if user.Interests, err = loadValues(ctx, r.db, interestsTable, user.ID); err != nil {
+			return nil, err
+		}
+		if user.Hobbies, err = loadValues(ctx, r.db, hobbiesTable, user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return users, nil
+}
+
+// touchUser bumps updated_at and applies an optional extra assignment, failing if the user is missing
+func touchUser(ctx context.Context, q sqlite.Querier, userID int64, assignment string, args ...any) error {
+	query := `UPDATE users SET updated_at = ?`
+	if assignment != "" {
+		query += `, ` + assignment
+	}
+	query += ` WHERE id = ?`
+
+	args = append([]any{sqlite.UnixTime(time.Now())}, args...)
+	result, err := q.ExecContext(ctx, query, append(args, userID)...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return status.Errorf(codes.NotFound, "user not found")
+	}
+	return nil
+}
+
+// replaceValues overwrites an ordered list of strings stored in table for the user
+func replaceValues(ctx context.Context, q sqlite.Querier, table string, userID int64, values []string) error {
+	if _, err := q.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+
+	for i, value := range values {
+		_, err := q.ExecContext(ctx,
+			`INSERT INTO `+table+` (user_id, position, value) VALUES (?, ?, ?)`, userID, i, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadValues reads an ordered list of strings stored in table for the user
+func loadValues(ctx context.Context, q sqlite.Querier, table string, userID int64) ([]string, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT value FROM `+table+` WHERE user_id = ? ORDER BY position`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal %s: %w", table, err)
+		}
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
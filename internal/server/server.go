@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	tmodels "github.com/go-telegram/bot/models"
+	"github.com/kriku/kpukbot/app"
+	"github.com/kriku/kpukbot/internal/webhook"
+)
+
+// updateTimeout bounds the processing of a single Telegram update
+const updateTimeout = 5 * time.Minute
+
+// Server serves Telegram updates, triggers and health checks of a long-lived App
+type Server struct {
+	app    app.App
+	ready  atomic.Bool
+	logger *slog.Logger
+}
+
+// New creates a server for an initialized app, the server is ready right away
+func New(a app.App) *Server {
+	s := &Server{
+		app:    a,
+		logger: a.Logger.With("component", "server"),
+	}
+	s.ready.Store(true)
+
+	if webhookConfig := a.Config.WebhookConfig; webhookConfig.SecretToken == "" {
+		if webhookConfig.Insecure {
+			s.logger.Warn("TELEGRAM_WEBHOOK_INSECURE is set, webhook requests are not verified")
+		} else {
+			s.logger.Error("TELEGRAM_WEBHOOK_SECRET is not set, webhook requests are rejected")
+		}
+	}
+
+	return s
+}
+
+// Handler returns the routes of the server, updates are also accepted on / for webhooks
+// registered before /webhook existed
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /{$}", s.handleWebhook)
+	mux.HandleFunc("POST /webhook", s.handleWebhook)
+	mux.HandleFunc("POST /trigger/{name}", s.handleTrigger)
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /readyz", s.handleReady)
+	return mux
+}
+
+// StartWorkers starts the update workers when the update queue is enabled, the returned
+// channel is closed once they stopped after ctx is done
+func (s *Server) StartWorkers(ctx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+	if !s.app.Config.UpdateQueue.Enabled {
+		close(done)
+		return done
+	}
+
+	go func() {
+		defer close(done)
+		s.app.UpdateWorker.Run(ctx)
+	}()
+	return done
+}
+
+// Run serves on addr until ctx is done, then stops accepting requests and waits up to
+// shutdownTimeout for in-flight updates to finish
+func (s *Server) Run(ctx context.Context, addr string, shutdownTimeout time.Duration) error {
+	workersCtx, stopWorkers := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopWorkers()
+	workersDone := s.StartWorkers(workersCtx)
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return context.WithoutCancel(ctx) },
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		s.logger.Info("Server listening", "addr", addr)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	s.logger.Info("Shutting down, draining in-flight requests", "timeout", shutdownTimeout)
+	s.ready.Store(false)
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+	defer cancel()
+
+	// Synchronous updates are processed inside their handlers, Shutdown returns once all of them are done
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down gracefully: %w", err)
+	}
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("server failed: %w", err)
+	}
+
+	// Queued updates in flight are finished, the rest stays in the queue for the next instance
+	stopWorkers()
+	select {
+	case <-workersDone:
+	case <-shutdownCtx.Done():
+		return fmt.Errorf("failed to drain update workers: %w", shutdownCtx.Err())
+	}
+
+	s.logger.Info("Server stopped")
+	return nil
+}
+
+func (s *Server) handleWebhook(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	err := webhook.VerifyTelegramSecret(req, s.app.Config.WebhookConfig)
+	switch {
+	case errors.Is(err, webhook.ErrSecretMissing):
+		s.logger.ErrorContext(ctx, "Rejected webhook request, no secret token configured")
+		http.Error(res, "webhook is not configured", http.StatusForbidden)
+		return
+	case err != nil:
+		s.logger.WarnContext(ctx, "Rejected webhook request", "error", err)
+		http.Error(res, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType != "application/json" {
+		http.Error(res, "unsupported media type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if s.app.Config.UpdateQueue.Enabled {
+		s.enqueueUpdate(res, req)
+		return
+	}
+
+	// Telegram may close the connection once it got the response, processing goes on regardless
+	handleCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), updateTimeout)
+	defer cancel()
+
+	s.app.MessengerClient.HandleWebhook(handleCtx, res, req)
+}
+
+// enqueueUpdate queues an update for the workers, Telegram retries the update when it cannot be queued
+func (s *Server) enqueueUpdate(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	update := tmodels.Update{}
+	if err := json.NewDecoder(req.Body).Decode(&update); err != nil {
+		http.Error(res, "invalid update", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.app.UpdateWorker.Enqueue(ctx, &update); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to enqueue update", "update_id", update.ID, "error", err)
+		http.Error(res, "failed to enqueue update", http.StatusInternalServerError)
+		return
+	}
+
+	res.Write([]byte("ok"))
+}
+
+func (s *Server) handleHealth(res http.ResponseWriter, req *http.Request) {
+	res.Write([]byte("ok"))
+}
+
+// handleReady reports whether the server accepts work, it turns unready on shutdown
+func (s *Server) handleReady(res http.ResponseWriter, req *http.Request) {
+	if !s.ready.Load() {
+		http.Error(res, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	if s.app.SQLiteDB != nil {
+		if err := s.app.SQLiteDB.PingContext(req.Context()); err != nil {
+			s.logger.WarnContext(req.Context(), "Database is not reachable", "error", err)
+			http.Error(res, "database unavailable", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	res.Write([]byte("ok"))
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	tmodels "github.com/go-telegram/bot/models"
+	"github.com/kriku/kpukbot/app"
+	"github.com/kriku/kpukbot/internal/clients/telegram"
+	"github.com/kriku/kpukbot/internal/config"
+	updatesRepo "github.com/kriku/kpukbot/internal/repository/updates"
+	"github.com/kriku/kpukbot/internal/services/updates"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMessenger records webhook calls instead of talking to Telegram
+type fakeMessenger struct {
+	webhooks int
+}
+
+func (f *fakeMessenger) Start(ctx context.Context) error { return nil }
+
+func (f *fakeMessenger) SendMessage(ctx context.Context, chatID int64, text string) (*tmodels.Message, error) {
+	return &tmodels.Message{Chat: tmodels.Chat{ID: chatID}, Text: text}, nil
+}
+
+func (f *fakeMessenger) SendMessageWithOptions(ctx context.Context, chatID int64, text string, opts telegram.SendOptions) ([]*tmodels.Message, error) {
+	message, err := f.SendMessage(ctx, chatID, text)
+	return []*tmodels.Message{message}, err
+}
+
+func (f *fakeMessenger) EditMessageText(ctx context.Context, chatID int64, messageID int, text string, keyboard *tmodels.InlineKeyboardMarkup) error {
+	return nil
+}
+
+func (f *fakeMessenger) EditMessageReplyMarkup(ctx context.Context, chatID int64, messageID int, keyboard *tmodels.InlineKeyboardMarkup) error {
+	return nil
+}
+
+func (f *fakeMessenger) AnswerCallbackQuery(ctx context.Context, callbackQueryID string, text string) error {
+	return nil
+}
+
+func (f *fakeMessenger) SendChatAction(ctx context.Context, chatID int64, action tmodels.ChatAction) error {
+	return nil
+}
+
+func (f *fakeMessenger) SetMyCommands(ctx context.Context, commands []tmodels.BotCommand) error {
+	return nil
+}
+
+func (f *fakeMessenger) GetChatAdministrators(ctx context.Context, chatID int64) ([]tmodels.ChatMember, error) {
+	return nil, nil
+}
+
+func (f *fakeMessenger) GetChat(ctx context.Context, chatID int64) (*tmodels.ChatFullInfo, error) {
+	return &tmodels.ChatFullInfo{ID: chatID}, nil
+}
+
+func (f *fakeMessenger) DownloadFile(ctx context.Context, fileID string) ([]byte, error) {
+	return nil, errors.New("no files")
+}
+
+func (f *fakeMessenger) Username() string { return "kpukbot" }
+
+func (f *fakeMessenger) HandleWebhook(ctx context.Context, res http.ResponseWriter, req *http.Request) {
+	f.webhooks++
+	res.Write([]byte("ok"))
+}
+
+func (f *fakeMessenger) Close() error { return nil }
+
+func newTestServer(webhookConfig config.WebhookConfig) (*Server, *fakeMessenger) {
+	messenger := &fakeMessenger{}
+	s := New(app.App{
+		Config:          &config.Config{WebhookConfig: webhookConfig},
+		Logger:          slog.New(slog.NewJSONHandler(os.Stdout, nil)),
+		MessengerClient: messenger,
+	})
+	return s, messenger
+}
+
+func serve(s *Server, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(`{"update_id":1}`))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServer_Health(t *testing.T) {
+	s, _ := newTestServer(config.WebhookConfig{})
+
+	assert.Equal(t, http.StatusOK, serve(s, http.MethodGet, "/healthz", nil).Code)
+	assert.Equal(t, http.StatusOK, serve(s, http.MethodGet, "/readyz", nil).Code)
+
+	s.ready.Store(false)
+	assert.Equal(t, http.StatusOK, serve(s, http.MethodGet, "/healthz", nil).Code)
+	assert.Equal(t, http.StatusServiceUnavailable, serve(s, http.MethodGet, "/readyz", nil).Code)
+}
+
+func TestServer_Webhook(t *testing.T) {
+	s, messenger := newTestServer(config.WebhookConfig{SecretToken: "s3cret"})
+	valid := map[string]string{
+		"Content-Type":                    "application/json",
+		"X-Telegram-Bot-Api-Secret-Token": "s3cret",
+	}
+
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(s, http.MethodGet, "/webhook", nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(s, http.MethodPost, "/webhook", map[string]string{
+		"Content-Type": "application/json",
+	}).Code)
+	assert.Equal(t, http.StatusUnsupportedMediaType, serve(s, http.MethodPost, "/webhook", map[string]string{
+		"X-Telegram-Bot-Api-Secret-Token": "s3cret",
+	}).Code)
+	assert.Equal(t, 0, messenger.webhooks)
+
+	assert.Equal(t, http.StatusOK, serve(s, http.MethodPost, "/webhook", valid).Code)
+	assert.Equal(t, http.StatusOK, serve(s, http.MethodPost, "/", valid).Code)
+	assert.Equal(t, 2, messenger.webhooks)
+}
+
+func TestServer_WebhookWithoutSecret(t *testing.T) {
+	headers := map[string]string{"Content-Type": "application/json"}
+
+	s, messenger := newTestServer(config.WebhookConfig{})
+	assert.Equal(t, http.StatusForbidden, serve(s, http.MethodPost, "/webhook", headers).Code)
+	assert.Equal(t, http.StatusForbidden, serve(s, http.MethodPost, "/", headers).Code)
+	assert.Equal(t, 0, messenger.webhooks)
+
+	s, messenger = newTestServer(config.WebhookConfig{Insecure: true})
+	assert.Equal(t, http.StatusOK, serve(s, http.MethodPost, "/webhook", headers).Code)
+	assert.Equal(t, 1, messenger.webhooks)
+}
+
+func TestServer_Trigger(t *testing.T) {
+	t.Run("disabled without credentials", func(t *testing.T) {
+		s, _ := newTestServer(config.WebhookConfig{})
+		rec := serve(s, http.MethodPost, "/trigger/question", map[string]string{"Authorization": "Bearer token"})
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	s, _ := newTestServer(config.WebhookConfig{TriggerToken: "token"})
+
+	rec := serve(s, http.MethodPost, "/trigger/question", map[string]string{"Authorization": "Bearer wrong"})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(s, http.MethodPost, "/trigger/unknown", map[string]string{"Authorization": "Bearer token"})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestServer_RunStopsOnCancel(t *testing.T) {
+	s, _ := newTestServer(config.WebhookConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx, "127.0.0.1:0", time.Second) }()
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.False(t, s.ready.Load())
+}
+
+func TestServer_WebhookQueued(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	queue := updatesRepo.NewMemoryUpdatesRepository()
+	messenger := &fakeMessenger{}
+	s := New(app.App{
+		Config: &config.Config{
+			WebhookConfig: config.WebhookConfig{SecretToken: "s3cret"},
+			UpdateQueue:   config.UpdateQueueConfig{Enabled: true},
+		},
+		Logger:          logger,
+		MessengerClient: messenger,
+		UpdateWorker:    updates.NewWorker(queue, nil, config.UpdateQueueConfig{}, logger),
+	})
+
+	rec := serve(s, http.MethodPost, "/webhook", map[string]string{
+		"Content-Type":                    "application/json",
+		"X-Telegram-Bot-Api-Secret-Token": "s3cret",
+	})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 0, messenger.webhooks)
+
+	leased, err := queue.Lease(context.Background(), 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, leased, 1)
+	assert.Equal(t, int64(1), leased[0].UpdateID)
+}
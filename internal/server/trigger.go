@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/clients/gemini"
+	"github.com/kriku/kpukbot/internal/clients/telegram"
+	"github.com/kriku/kpukbot/internal/strategies"
+	"github.com/kriku/kpukbot/internal/webhook"
+)
+
+// maxTriggerBody limits the body of trigger requests, triggers carry no payload yet
+const maxTriggerBody = 64 << 10
+
+// handleTrigger authenticates a trigger request and runs the named trigger
+func (s *Server) handleTrigger(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	trigger := req.PathValue("name")
+
+	body, err := io.ReadAll(http.MaxBytesReader(res, req.Body, maxTriggerBody))
+	if err != nil {
+		http.Error(res, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	err = webhook.VerifyTrigger(req, body, s.app.Config.WebhookConfig, time.Now())
+	switch {
+	case errors.Is(err, webhook.ErrTriggersDisabled):
+		s.logger.WarnContext(ctx, "Rejected trigger, no trigger credentials configured", "trigger", trigger)
+		http.Error(res, "triggers are disabled", http.StatusForbidden)
+		return
+	case err != nil:
+		s.logger.WarnContext(ctx, "Rejected trigger request", "trigger", trigger, "error", err)
+		res.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(res, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch trigger {
+	case "question":
+		s.logger.InfoContext(ctx, "Trigger question")
+		s.handleQuestionTrigger(context.WithoutCancel(ctx), res)
+	case "cleanup":
+		s.logger.InfoContext(ctx, "Trigger cleanup")
+		s.handleCleanupTrigger(context.WithoutCancel(ctx), res)
+	default:
+		http.Error(res, "unknown trigger", http.StatusNotFound)
+	}
+}
+
+// handleQuestionTrigger asks the next queued user of every active chat a question
+func (s *Server) handleQuestionTrigger(ctx context.Context, res http.ResponseWriter) {
+	// Get all chats
+	chats, err := s.app.ChatsService.GetAllChats(ctx)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to get all chats", "error", err)
+		http.Error(res, "failed to get chats", http.StatusInternalServerError)
+		return
+	}
+
+	questionStrategy := s.findQuestionStrategy()
+	if questionStrategy == nil {
+		s.logger.ErrorContext(ctx, "Question strategy not found")
+		http.Error(res, "question strategy not found", http.StatusInternalServerError)
+		return
+	}
+
+	// Process each chat
+	questionsAsked := 0
+	for _, chat := range chats {
+		if !chat.IsActive {
+			continue
+		}
+
+		// Questions are LLM generated, chats out of budget are skipped
+		if s.app.Orchestrator.BudgetExhausted(ctx, chat.ID) {
+			s.logger.InfoContext(ctx, "Skipping chat, LLM budget exhausted", "chat_id", chat.ID)
+			continue
+		}
+
+		// Ask question to the next user in queue for this chat
+		chatCtx := gemini.WithUsageScope(ctx, gemini.UsageScope{ChatID: chat.ID})
+		question, userID, err := questionStrategy.AskQuestionToUser(chatCtx, chat.ID)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Failed to ask question", "chat_id", chat.ID, "error", err)
+			continue
+		}
+
+		if userID > 0 && question != "" {
+			// Send the question to the chat using the messenger client
+			opts := telegram.SendOptions{Keyboard: questionStrategy.QuestionKeyboard(userID)}
+			sent, err := s.app.MessengerClient.SendMessageWithOptions(chatCtx, chat.ID, question, opts)
+			if err != nil {
+				s.logger.ErrorContext(ctx, "Failed to send question", "chat_id", chat.ID, "error", err)
+			}
+			if len(sent) == 0 {
+				continue
+			}
+
+			questionsAsked++
+			s.logger.InfoContext(ctx, "Asked question", "user_id", userID, "chat_id", chat.ID)
+
+			// Keep the question in history so answers are threaded with it
+			for _, message := range sent {
+				if err := s.app.Orchestrator.RecordBotMessage(chatCtx, message); err != nil {
+					s.logger.WarnContext(ctx, "Failed to save question", "chat_id", chat.ID, "error", err)
+				}
+			}
+		}
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(map[string]interface{}{
+		"status":          "success",
+		"questions_asked": questionsAsked,
+		"chats_processed": len(chats),
+	})
+}
+
+// handleCleanupTrigger forgets processed updates past their TTL
+func (s *Server) handleCleanupTrigger(ctx context.Context, res http.ResponseWriter) {
+	deleted, err := s.app.ProcessedUpdates.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to delete expired updates", "error", err)
+		http.Error(res, "failed to delete expired updates", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.InfoContext(ctx, "Deleted expired updates", "deleted", deleted)
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(map[string]interface{}{
+		"status":          "success",
+		"updates_deleted": deleted,
+	})
+}
+
+// findQuestionStrategy finds the question strategy from the available strategies
+func (s *Server) findQuestionStrategy() *strategies.QuestionStrategy {
+	for _, strategy := range s.app.Strategies {
+		if questionStrategy, ok := strategy.(*strategies.QuestionStrategy); ok {
+			return questionStrategy
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package callbacks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	tmodels "github.com/go-telegram/bot/models"
+	"github.com/kriku/kpukbot/internal/clients/telegram"
+)
+
+// MaxDataLength is the Telegram limit of callback data in bytes
+const MaxDataLength = 64
+
+// Request is a press of an inline keyboard button
+type Request struct {
+	Prefix    string // Prefix the handler is registered under
+	Data      string // Callback data without the prefix
+	Query     *tmodels.CallbackQuery
+	messenger telegram.MessengerClient
+}
+
+// ChatID returns the chat of the message with the keyboard
+func (r *Request) ChatID() int64 {
+	return r.Query.Message.Message.Chat.ID
+}
+
+// MessageID returns the message with the keyboard
+func (r *Request) MessageID() int {
+	return r.Query.Message.Message.ID
+}
+
+// EditText replaces the text of the message with the keyboard, a nil keyboard removes it
+func (r *Request) EditText(ctx context.Context, text string, keyboard *tmodels.InlineKeyboardMarkup) error {
+	if err := r.messenger.EditMessageText(ctx, r.ChatID(), r.MessageID(), text, keyboard); err != nil {
+		return fmt.Errorf("failed to edit message: %w", err)
+	}
+	return nil
+}
+
+// EditKeyboard replaces the keyboard of the message, a nil keyboard removes it
+func (r *Request) EditKeyboard(ctx context.Context, keyboard *tmodels.InlineKeyboardMarkup) error {
+	if err := r.messenger.EditMessageReplyMarkup(ctx, r.ChatID(), r.MessageID(), keyboard); err != nil {
+		return fmt.Errorf("failed to edit keyboard: %w", err)
+	}
+	return nil
+}
+
+// Handler handles a button press, the returned text is shown to the user as a notification
+type Handler func(ctx context.Context, req *Request) (string, error)
+
+// CallbackRouter dispatches button presses to the handler registered for the prefix of their data
+type CallbackRouter struct {
+	handlers  map[string]Handler
+	messenger telegram.MessengerClient
+	logger    *slog.Logger
+}
+
+func NewCallbackRouter(logger *slog.Logger) *CallbackRouter {
+	return &CallbackRouter{
+		handlers: make(map[string]Handler),
+		logger:   logger.With("service", "callbacks"),
+	}
+}
+
+// SetMessengerClient sets the messenger client (useful for resolving circular dependencies)
+func (r *CallbackRouter) SetMessengerClient(messenger telegram.MessengerClient) {
+	r.messenger = messenger
+}
+
+// Handle registers the handler of buttons created with Data and the same prefix
+func (r *CallbackRouter) Handle(prefix string, handler Handler) {
+	r.handlers[prefix] = handler
+}
+
+// Route runs the handler of a pressed button and answers the callback query, so the client
+// stops showing a progress indicator
+func (r *CallbackRouter) Route(ctx context.Context, query *tmodels.CallbackQuery) error {
+	prefix, data, _ := strings.Cut(query.Data, ":")
+	handler, ok := r.handlers[prefix]
+	if !ok {
+		r.logger.InfoContext(ctx, "Unknown callback", "data", query.Data)
+		return r.answer(ctx, query.ID, "")
+	}
+
+	// Telegram omits messages older than 48 hours, their keyboards can no longer be updated
+	if query.Message.Message == nil {
+		return r.answer(ctx, query.ID, "This message is too old.")
+	}
+
+	r.logger.InfoContext(ctx, "Running callback",
+		"prefix", prefix,
+		"data", data,
+		"chat_id", query.Message.Message.Chat.ID,
+		"user_id", query.From.ID)
+
+	req := &Request{Prefix: prefix, Data: data, Query: query, messenger: r.messenger}
+	text, err := handler(ctx, req)
+	if err != nil {
+		// Still answered, the failure is reported like a failed message
+		r.answer(ctx, query.ID, "")
+		return fmt.Errorf("failed to run callback %s: %w", prefix, err)
+	}
+	return r.answer(ctx, query.ID, text)
+}
+
+func (r *CallbackRouter) answer(ctx context.Context, callbackQueryID string, text string) error {
+	if err := r.messenger.AnswerCallbackQuery(ctx, callbackQueryID, text); err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+	return nil
+}
+
+// Data builds the callback data of a button handled by the handler registered for prefix.
+// Telegram rejects keyboards with callback data over MaxDataLength bytes
+func Data(prefix string, data string) string {
+	return prefix + ":" + data
+}
+
+// Button creates an inline keyboard button handled by the handler registered for prefix
+func Button(text string, prefix string, data string) tmodels.InlineKeyboardButton {
+	return tmodels.InlineKeyboardButton{Text: text, CallbackData: Data(prefix, data)}
+}
@@ -0,0 +1,109 @@
+package callbacks
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	tmodels "github.com/go-telegram/bot/models"
+	"github.com/kriku/kpukbot/internal/clients/telegram"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMessenger records answered callback queries and edited keyboards, other methods are not used
+type fakeMessenger struct {
+	telegram.MessengerClient
+	answers []string
+	edited  []*tmodels.InlineKeyboardMarkup
+}
+
+func (f *fakeMessenger) AnswerCallbackQuery(ctx context.Context, callbackQueryID string, text string) error {
+	f.answers = append(f.answers, text)
+	return nil
+}
+
+func (f *fakeMessenger) EditMessageReplyMarkup(ctx context.Context, chatID int64, messageID int, keyboard *tmodels.InlineKeyboardMarkup) error {
+	f.edited = append(f.edited, keyboard)
+	return nil
+}
+
+func newTestRouter() (*CallbackRouter, *fakeMessenger) {
+	messenger := &fakeMessenger{}
+	router := NewCallbackRouter(slog.Default())
+	router.SetMessengerClient(messenger)
+	return router, messenger
+}
+
+func callbackQuery(data string) *tmodels.CallbackQuery {
+	return &tmodels.CallbackQuery{
+		ID:   "query",
+		From: tmodels.User{ID: 7},
+		Message: tmodels.MaybeInaccessibleMessage{
+			Message: &tmodels.Message{ID: 5, Chat: tmodels.Chat{ID: 100}},
+		},
+		Data: data,
+	}
+}
+
+func TestCallbackRouter_Route(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("dispatches by prefix and answers", func(t *testing.T) {
+		router, messenger := newTestRouter()
+		var got *Request
+		router.Handle("rate", func(ctx context.Context, req *Request) (string, error) {
+			got = req
+			return "Thanks!", req.EditKeyboard(ctx, nil)
+		})
+
+		button := Button("Good", "rate", "up:42")
+		assert.Equal(t, "rate:up:42", button.CallbackData)
+
+		require.NoError(t, router.Route(ctx, callbackQuery(button.CallbackData)))
+		require.NotNil(t, got)
+		assert.Equal(t, "rate", got.Prefix)
+		assert.Equal(t, "up:42", got.Data)
+		assert.Equal(t, int64(100), got.ChatID())
+		assert.Equal(t, 5, got.MessageID())
+		assert.Equal(t, []string{"Thanks!"}, messenger.answers)
+		assert.Equal(t, []*tmodels.InlineKeyboardMarkup{nil}, messenger.edited)
+	})
+
+	t.Run("unknown prefixes are answered", func(t *testing.T) {
+		router, messenger := newTestRouter()
+
+		require.NoError(t, router.Route(ctx, callbackQuery("unknown:data")))
+		assert.Equal(t, []string{""}, messenger.answers)
+	})
+
+	t.Run("inaccessible messages are answered", func(t *testing.T) {
+		router, messenger := newTestRouter()
+		called := false
+		router.Handle("rate", func(ctx context.Context, req *Request) (string, error) {
+			called = true
+			return "", nil
+		})
+
+		query := callbackQuery("rate:up")
+		query.Message = tmodels.MaybeInaccessibleMessage{
+			Type:                tmodels.MaybeInaccessibleMessageTypeInaccessibleMessage,
+			InaccessibleMessage: &tmodels.InaccessibleMessage{},
+		}
+		require.NoError(t, router.Route(ctx, query))
+		assert.False(t, called)
+		assert.Equal(t, []string{"This message is too old."}, messenger.answers)
+	})
+
+	t.Run("handler errors are returned after answering", func(t *testing.T) {
+		router, messenger := newTestRouter()
+		router.Handle("rate", func(ctx context.Context, req *Request) (string, error) {
+			return "", errors.New("boom")
+		})
+
+		err := router.Route(ctx, callbackQuery("rate:up"))
+		assert.ErrorContains(t, err, "boom")
+		assert.Equal(t, []string{""}, messenger.answers)
+	})
+}
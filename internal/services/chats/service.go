@@ -16,6 +16,19 @@ type ChatsService struct {
 	logger     *slog.Logger
 }
 
+// InvalidSettingsError is returned for chat settings that break a validation rule, they are not saved
+type InvalidSettingsError struct {
+	Reason error // The broken rule
+}
+
+func (e *InvalidSettingsError) Error() string {
+	return "invalid chat settings: " + e.Reason.Error()
+}
+
+func (e *InvalidSettingsError) Unwrap() error {
+	return e.Reason
+}
+
 // NewChatsService creates a new chats service
 func NewChatsService(repository chats.ChatsRepository, logger *slog.Logger) *ChatsService {
 	return &ChatsService{
@@ -24,7 +37,8 @@ func NewChatsService(repository chats.ChatsRepository, logger *slog.Logger) *Cha
 	}
 }
 
-// CreateOrUpdateChat creates a new chat or updates an existing one
+// CreateOrUpdateChat creates a new chat or updates the info of an existing one, its users and question queue
+// are kept
 func (s *ChatsService) CreateOrUpdateChat(ctx context.Context, chatID int64, title, chatType, description string) error {
 	chat := models.Chat{
 		ID:          chatID,
@@ -32,20 +46,9 @@ func (s *ChatsService) CreateOrUpdateChat(ctx context.Context, chatID int64, tit
 		Type:        chatType,
 		Description: description,
 		IsActive:    true,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-	}
-
-	// Check if chat already exists
-	existingChat, err := s.repository.GetChat(ctx, chatID)
-	if err == nil && existingChat != nil {
-		// Chat exists, preserve existing data and update basic info
-		chat.UserIDs = existingChat.UserIDs
-		chat.QuestionQueue = existingChat.QuestionQueue
-		chat.CreatedAt = existingChat.CreatedAt
 	}
 
-	err = s.repository.SaveChat(ctx, chat)
+	err := s.repository.SaveChatInfo(ctx, chat)
 	if err != nil {
 		s.logger.Error("Failed to save chat", "chatID", chatID, "error", err)
 		return fmt.Errorf("failed to save chat: %w", err)
@@ -55,6 +58,16 @@ func (s *ChatsService) CreateOrUpdateChat(ctx context.Context, chatID int64, tit
 	return nil
 }
 
+// GetChat retrieves a chat with its users and question queue
+func (s *ChatsService) GetChat(ctx context.Context, chatID int64) (*models.Chat, error) {
+	chat, err := s.repository.GetChat(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat: %w", err)
+	}
+
+	return chat, nil
+}
+
 // AddUserToChat adds a user to a chat and optionally to the queue
 func (s *ChatsService) AddUserToChat(ctx context.Context, chatID int64, userID int64, autoEnqueue bool) error {
 
@@ -73,6 +86,8 @@ func (s *ChatsService) AddUserToChat(ctx context.Context, chatID int64, userID i
 		settings, err := s.repository.GetChatSettings(ctx, chatID)
 		if err != nil {
 			s.logger.Warn("Failed to get chat settings for auto-enqueue", "chatID", chatID, "error", err)
+		} else if settings.AutoEnqueueNewUsers && settings.EnableQuestionRounds && s.queueFull(ctx, chatID, settings) {
+			s.logger.Info("Question queue is full, user not auto-enqueued", "chatID", chatID, "userID", userID)
 		} else if settings.AutoEnqueueNewUsers && settings.EnableQuestionRounds {
 			err = s.repository.AddToQueue(ctx, chatID, userID)
 			if err != nil {
@@ -87,6 +102,26 @@ func (s *ChatsService) AddUserToChat(ctx context.Context, chatID int64, userID i
 	return nil
 }
 
+// queueFull reports whether the waiting users of a chat reached its maximum queue size
+func (s *ChatsService) queueFull(ctx context.Context, chatID int64, settings *models.ChatSettings) bool {
+	if settings.MaxQueueSize <= 0 {
+		return false
+	}
+
+	chat, err := s.repository.GetChat(ctx, chatID)
+	if err != nil {
+		return false
+	}
+
+	waiting := 0
+	for _, entry := range chat.QuestionQueue {
+		if entry.Status == models.QueueStatusWaiting {
+			waiting++
+		}
+	}
+	return waiting >= settings.MaxQueueSize
+}
+
 // RemoveUserFromChat removes a user from a chat and queue
 func (s *ChatsService) RemoveUserFromChat(ctx context.Context, chatID int64, userID int64) error {
 	err := s.repository.RemoveUserFromChat(ctx, chatID, userID)
@@ -165,31 +200,7 @@ func (s *ChatsService) MarkQuestionAsked(ctx context.Context, chatID int64, user
 
 // MarkQuestionAnswered marks a user's question as answered and completed
 func (s *ChatsService) MarkQuestionAnswered(ctx context.Context, chatID int64, userID int64) error {
-	// Get current entry to preserve existing data
-	chat, err := s.repository.GetChat(ctx, chatID)
-	if err != nil {
-		return fmt.Errorf("failed to get chat: %w", err)
-	}
-
-	var entry models.QueueEntry
-	found := false
-	for _, queueEntry := range chat.QuestionQueue {
-		if queueEntry.UserID == userID {
-			entry = queueEntry
-			found = true
-			break
-		}
-	}
-
-	if !found {
-		return fmt.Errorf("user not found in queue")
-	}
-
-	entry.Status = models.QueueStatusCompleted
-	now := time.Now()
-	entry.AnsweredAt = &now
-
-	err = s.repository.UpdateQueueEntry(ctx, chatID, entry)
+	err := s.repository.SetQueueEntryStatus(ctx, chatID, userID, models.QueueStatusCompleted)
 	if err != nil {
 		s.logger.Error("Failed to mark question as answered", "chatID", chatID, "userID", userID, "error", err)
 		return fmt.Errorf("failed to mark question as answered: %w", err)
@@ -201,29 +212,7 @@ func (s *ChatsService) MarkQuestionAnswered(ctx context.Context, chatID int64, u
 
 // SkipUser marks a user as skipped for this round
 func (s *ChatsService) SkipUser(ctx context.Context, chatID int64, userID int64, reason string) error {
-	// Get current entry to preserve existing data
-	chat, err := s.repository.GetChat(ctx, chatID)
-	if err != nil {
-		return fmt.Errorf("failed to get chat: %w", err)
-	}
-
-	var entry models.QueueEntry
-	found := false
-	for _, queueEntry := range chat.QuestionQueue {
-		if queueEntry.UserID == userID {
-			entry = queueEntry
-			found = true
-			break
-		}
-	}
-
-	if !found {
-		return fmt.Errorf("user not found in queue")
-	}
-
-	entry.Status = models.QueueStatusSkipped
-
-	err = s.repository.UpdateQueueEntry(ctx, chatID, entry)
+	err := s.repository.SetQueueEntryStatus(ctx, chatID, userID, models.QueueStatusSkipped)
 	if err != nil {
 		s.logger.Error("Failed to skip user", "chatID", chatID, "userID", userID, "error", err)
 		return fmt.Errorf("failed to skip user: %w", err)
@@ -272,8 +261,13 @@ func (s *ChatsService) GetChatSettings(ctx context.Context, chatID int64) (*mode
 	return settings, nil
 }
 
-// UpdateChatSettings updates settings for a chat
+// UpdateChatSettings validates and updates settings for a chat, invalid settings are rejected with an
+// InvalidSettingsError
 func (s *ChatsService) UpdateChatSettings(ctx context.Context, settings models.ChatSettings) error {
+	if err := settings.Validate(); err != nil {
+		return &InvalidSettingsError{Reason: err}
+	}
+
 	err := s.repository.SaveChatSettings(ctx, settings)
 	if err != nil {
 		s.logger.Error("Failed to update chat settings", "chatID", settings.ChatID, "error", err)
@@ -284,6 +278,22 @@ func (s *ChatsService) UpdateChatSettings(ctx context.Context, settings models.C
 	return nil
 }
 
+// SetBudgetNoticePeriod remembers the budget period the budget notice of a chat was posted for.
+// Only the notice period is written, stored settings are not validated again
+func (s *ChatsService) SetBudgetNoticePeriod(ctx context.Context, chatID int64, period string) error {
+	settings, err := s.repository.GetChatSettings(ctx, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to get chat settings: %w", err)
+	}
+
+	settings.BudgetNoticePeriod = period
+	if err := s.repository.SaveChatSettings(ctx, *settings); err != nil {
+		return fmt.Errorf("failed to save budget notice period: %w", err)
+	}
+
+	return nil
+}
+
 // SetChatActive sets the active status of a chat
 func (s *ChatsService) SetChatActive(ctx context.Context, chatID int64, isActive bool) error {
 	err := s.repository.SetChatActive(ctx, chatID, isActive)
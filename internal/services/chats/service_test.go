@@ -9,6 +9,7 @@ import (
 	"github.com/kriku/kpukbot/internal/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockChatsRepository is a mock implementation of ChatsRepository for testing
@@ -26,6 +27,11 @@ func (m *MockChatsRepository) SaveChat(ctx context.Context, chat models.Chat) er
 	return args.Error(0)
 }
 
+func (m *MockChatsRepository) SaveChatInfo(ctx context.Context, chat models.Chat) error {
+	args := m.Called(ctx, chat)
+	return args.Error(0)
+}
+
 func (m *MockChatsRepository) GetChat(ctx context.Context, chatID int64) (*models.Chat, error) {
 	args := m.Called(ctx, chatID)
 	return args.Get(0).(*models.Chat), args.Error(1)
@@ -81,6 +87,11 @@ func (m *MockChatsRepository) UpdateQueueEntry(ctx context.Context, chatID int64
 	return args.Error(0)
 }
 
+func (m *MockChatsRepository) SetQueueEntryStatus(ctx context.Context, chatID int64, userID int64, entryStatus string) error {
+	args := m.Called(ctx, chatID, userID, entryStatus)
+	return args.Error(0)
+}
+
 func (m *MockChatsRepository) GetQueuePosition(ctx context.Context, chatID int64, userID int64) (int, error) {
 	args := m.Called(ctx, chatID, userID)
 	return args.Int(0), args.Error(1)
@@ -189,3 +200,88 @@ func TestChatsService_MarkQuestionAsked(t *testing.T) {
 	assert.NoError(t, err)
 	mockRepo.AssertExpectations(t)
 }
+
+func TestChatsService_UpdateChatSettings(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockChatsRepository)
+	logger := slog.Default()
+	service := NewChatsService(mockRepo, logger)
+
+	chatID := int64(123)
+
+	settings := models.DefaultChatSettings(chatID)
+	mockRepo.On("SaveChatSettings", ctx, *settings).Return(nil)
+
+	err := service.UpdateChatSettings(ctx, *settings)
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+
+	// Invalid settings are rejected before they reach the repository
+	invalid := *settings
+	invalid.InactivityTimeout = invalid.QuestionInterval
+
+	err = service.UpdateChatSettings(ctx, invalid)
+
+	var invalidErr *InvalidSettingsError
+	require.ErrorAs(t, err, &invalidErr)
+	assert.ErrorContains(t, invalidErr.Reason, "inactivity timeout")
+	mockRepo.AssertNumberOfCalls(t, "SaveChatSettings", 1)
+}
+
+func TestChatsService_SetBudgetNoticePeriod(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockChatsRepository)
+	service := NewChatsService(mockRepo, slog.Default())
+
+	chatID := int64(123)
+
+	// Settings stored before validation existed are saved as they are
+	settings := &models.ChatSettings{ChatID: chatID, BudgetNotice: true}
+	mockRepo.On("GetChatSettings", ctx, chatID).Return(settings, nil)
+
+	saved := *settings
+	saved.BudgetNoticePeriod = "2026-10"
+	mockRepo.On("SaveChatSettings", ctx, saved).Return(nil)
+
+	err := service.SetBudgetNoticePeriod(ctx, chatID, "2026-10")
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestChatsService_AddUserToChat_AutoEnqueue(t *testing.T) {
+	ctx := context.Background()
+	chatID := int64(123)
+
+	settings := models.DefaultChatSettings(chatID)
+	settings.MaxQueueSize = 1
+
+	t.Run("new users are enqueued", func(t *testing.T) {
+		mockRepo := new(MockChatsRepository)
+		service := NewChatsService(mockRepo, slog.Default())
+
+		mockRepo.On("GetChat", ctx, chatID).Return(&models.Chat{ID: chatID}, nil)
+		mockRepo.On("AddUserToChat", ctx, chatID, int64(1)).Return(nil)
+		mockRepo.On("GetChatSettings", ctx, chatID).Return(settings, nil)
+		mockRepo.On("AddToQueue", ctx, chatID, int64(1)).Return(nil)
+
+		assert.NoError(t, service.AddUserToChat(ctx, chatID, 1, true))
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("full queues are left alone", func(t *testing.T) {
+		mockRepo := new(MockChatsRepository)
+		service := NewChatsService(mockRepo, slog.Default())
+
+		chat := &models.Chat{ID: chatID, QuestionQueue: []models.QueueEntry{
+			{UserID: 1, Status: models.QueueStatusWaiting},
+		}}
+		mockRepo.On("GetChat", ctx, chatID).Return(chat, nil)
+		mockRepo.On("AddUserToChat", ctx, chatID, int64(2)).Return(nil)
+		mockRepo.On("GetChatSettings", ctx, chatID).Return(settings, nil)
+
+		assert.NoError(t, service.AddUserToChat(ctx, chatID, 2, true))
+		mockRepo.AssertNotCalled(t, "AddToQueue", ctx, chatID, int64(2))
+	})
+}
@@ -0,0 +1,325 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kriku/kpukbot/internal/clients/gemini"
+	"github.com/kriku/kpukbot/internal/constants"
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/prompts"
+	"golang.org/x/net/html"
+)
+
+const (
+	// maxLinks limits how many links of a message are fetched
+	maxLinks = 3
+	// maxDocumentSize limits the size of documents and web pages that are read
+	maxDocumentSize = 5 << 20
+)
+
+// textExtensions are the text files Telegram may send without a useful MIME type
+var textExtensions = map[string]string{
+	".txt": "text/plain",
+	".md":  "text/markdown",
+	".csv": "text/csv",
+	".log": "text/plain",
+}
+
+// errUnsupported is returned for documents and web pages the bot cannot read
+var errUnsupported = errors.New("unsupported content type")
+
+// content is the readable part of a document or web page, either extracted text or a file the LLM
+// reads itself
+type content struct {
+	text  string
+	media *gemini.Media
+}
+
+// SummarizeAttachments reads the document and the first links of a message and stores a summary of
+// each. Sources that cannot be read are skipped, only an unavailable LLM stops the summaries.
+// Sources summarized by an earlier attempt of the update are not read again
+func (s *MediaService) SummarizeAttachments(ctx context.Context, message *models.Message) error {
+	if message.Document == nil && len(message.Links) == 0 {
+		return nil
+	}
+
+	stored, err := s.messagesRepo.GetMessage(ctx, message.ChatID, message.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get message: %w", err)
+	}
+	attachments := slices.Clone(stored.Attachments)
+	summarized := len(attachments)
+
+	add := func(source string, read func() (content, error)) error {
+		if slices.ContainsFunc(attachments, func(a models.MessageAttachment) bool { return a.Source == source }) {
+			return nil
+		}
+
+		c, err := read()
+		if err == nil {
+			var summary string
+			summary, err = s.summarize(ctx, source, c)
+			if err == nil {
+				attachments = append(attachments, models.MessageAttachment{Source: source, Summary: summary})
+				return nil
+			}
+		}
+		if errors.Is(err, gemini.ErrUnavailable) {
+			return err
+		}
+		s.logger.WarnContext(ctx, "Failed to summarize attachment", "message_id", message.ID, "source", source, "error", err)
+		return nil
+	}
+
+	if document := message.Document; document != nil {
+		source := document.FileName
+		if source == "" {
+			source = "a document"
+		}
+		err := add(source, func() (content, error) {
+			data, err := s.messenger.DownloadFile(ctx, document.FileID)
+			if err != nil {
+				return content{}, fmt.Errorf("failed to download document: %w", err)
+			}
+			return extract(data, document.MIMEType, document.FileName)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, link := range message.Links[:min(len(message.Links), maxLinks)] {
+		if err := add(link, func() (content, error) { return s.fetch(ctx, link) }); err != nil {
+			return err
+		}
+	}
+
+	message.Attachments = attachments
+	if len(attachments) == summarized {
+		return nil
+	}
+
+	// The stored message may have been edited meanwhile, only its attachments are replaced
+	stored, err = s.messagesRepo.GetMessage(ctx, message.ChatID, message.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get message: %w", err)
+	}
+	stored.Attachments = attachments
+
+	if err := s.messagesRepo.SaveMessage(ctx, *stored); err != nil {
+		return fmt.Errorf("failed to save attachments: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "Attachments summarized",
+		"message_id", message.ID,
+		"chat_id", message.ChatID,
+		"attachments", len(attachments)-summarized)
+	return nil
+}
+
+// summarize asks the LLM for a summary of a document or web page
+func (s *MediaService) summarize(ctx context.Context, source string, c content) (string, error) {
+	messages := gemini.NewPrompt(prompts.AttachmentSummaryPrompt(source, c.text))
+	if c.media != nil {
+		messages = gemini.NewPrompt(prompts.AttachmentSummaryPrompt(source, ""), *c.media)
+	}
+
+	response, err := s.gemini.GenerateContent(ctx, gemini.Request{
+		Messages: messages,
+		CallSite: "attachment_summary",
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize: %w", err)
+	}
+
+	return prompts.Truncate(strings.TrimSpace(response), int(constants.MaxAttachmentSummaryLength)), nil
+}
+
+// fetch downloads a linked web page or document, links without a scheme are fetched over HTTPS
+func (s *MediaService) fetch(ctx context.Context, link string) (content, error) {
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return content{}, fmt.Errorf("invalid link %q", link)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return content{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/html, text/plain, application/pdf")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return content{}, fmt.Errorf("failed to fetch link: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return content{}, fmt.Errorf("failed to fetch link: status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize+1))
+	if err != nil {
+		return content{}, fmt.Errorf("failed to read link: %w", err)
+	}
+
+	return extract(data, resp.Header.Get("Content-Type"), u.Path)
+}
+
+// extract returns the readable content of a document. PDFs are read by the LLM, the text of web
+// pages and text files is extracted and bounded
+func extract(data []byte, contentType string, name string) (content, error) {
+	if len(data) > maxDocumentSize {
+		return content{}, fmt.Errorf("document exceeds %d bytes", maxDocumentSize)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" || mediaType == "application/octet-stream" {
+		ext := strings.ToLower(path.Ext(name))
+		mediaType = textExtensions[ext]
+		if mediaType == "" {
+			mediaType, _, _ = mime.ParseMediaType(mime.TypeByExtension(ext))
+		}
+	}
+
+	var text string
+	switch {
+	case mediaType == "application/pdf":
+		return content{media: &gemini.Media{MIMEType: mediaType, Data: data}}, nil
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		text = htmlText(data)
+	case strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" || mediaType == "application/xml":
+		if !utf8.Valid(data) {
+			return content{}, fmt.Errorf("document is not UTF-8 text")
+		}
+		text = strings.TrimSpace(string(data))
+	default:
+		return content{}, fmt.Errorf("%w %q", errUnsupported, mediaType)
+	}
+
+	if text == "" {
+		return content{}, fmt.Errorf("document has no text")
+	}
+	return content{text: prompts.Truncate(text, int(constants.MaxAttachmentTextLength))}, nil
+}
+
+// skippedElements hold no readable text
+var skippedElements = map[string]bool{
+	"head": true, "script": true, "style": true, "noscript": true, "svg": true, "template": true,
+}
+
+// blockElements start a new line
+var blockElements = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "section": true, "article": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "pre": true, "blockquote": true,
+}
+
+// htmlText returns the visible text of a web page with its title, one line per block
+func htmlText(data []byte) string {
+	tokenizer := html.NewTokenizer(bytes.NewReader(data))
+	var title, body strings.Builder
+	skipped, inTitle := 0, false
+
+	for {
+		switch token := tokenizer.Next(); token {
+		case html.ErrorToken:
+			text := collapseLines(body.String())
+			if title := strings.Join(strings.Fields(title.String()), " "); title != "" {
+				text = title + "\n" + text
+			}
+			return strings.TrimSpace(text)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			switch tag := string(name); {
+			case tag == "title":
+				inTitle = token == html.StartTagToken
+			case skippedElements[tag]:
+				if token == html.StartTagToken {
+					skipped++
+				}
+			case blockElements[tag]:
+				body.WriteByte('\n')
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch tag := string(name); {
+			case tag == "title":
+				inTitle = false
+			case skippedElements[tag]:
+				skipped = max(0, skipped-1)
+			case blockElements[tag]:
+				body.WriteByte('\n')
+			}
+		case html.TextToken:
+			switch {
+			case inTitle:
+				title.Write(tokenizer.Text())
+			case skipped == 0:
+				body.Write(tokenizer.Text())
+				body.WriteByte(' ')
+			}
+		}
+	}
+}
+
+// collapseLines collapses the whitespace of every line and drops empty lines
+func collapseLines(text string) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line := strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// NewLinkClient returns the HTTP client fetching links shared in chats. It only connects to public
+// addresses, a link must not reach the network the bot runs in
+func NewLinkClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil || !isPublic(ip) {
+				return fmt.Errorf("address %s is not public", host)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil // A proxy would connect on behalf of the bot
+
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// isPublic reports whether an address is reachable on the internet
+func isPublic(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast()
+}
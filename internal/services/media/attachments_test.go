@@ -0,0 +1,180 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	botModels "github.com/go-telegram/bot/models"
+	"github.com/kriku/kpukbot/internal/clients/gemini"
+	"github.com/kriku/kpukbot/internal/constants"
+	"github.com/kriku/kpukbot/internal/models"
+	messagesRepo "github.com/kriku/kpukbot/internal/repository/messages"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtract(t *testing.T) {
+	t.Run("web pages", func(t *testing.T) {
+		page := `<html><head><title>Launch
+			plan</title><style>p { color: red }</style></head>
+			<body><nav>Home</nav><h1>Launch</h1><p>We move the launch to <b>May</b>.</p>
+			<script>alert("hi")</script><p>Questions &amp; answers</p></body></html>`
+
+		c, err := extract([]byte(page), "text/html; charset=utf-8", "/plan")
+		require.NoError(t, err)
+		assert.Equal(t, "Launch plan\nHome\nLaunch\nWe move the launch to May .\nQuestions & answers", c.text)
+		assert.Nil(t, c.media)
+	})
+
+	t.Run("text files are bounded", func(t *testing.T) {
+		c, err := extract([]byte(strings.Repeat("a", 30000)), "text/plain", "notes.txt")
+		require.NoError(t, err)
+		assert.Len(t, c.text, int(constants.MaxAttachmentTextLength))
+	})
+
+	t.Run("file names stand in for missing types", func(t *testing.T) {
+		c, err := extract([]byte("# Notes"), "application/octet-stream", "notes.md")
+		require.NoError(t, err)
+		assert.Equal(t, "# Notes", c.text)
+	})
+
+	t.Run("pdfs are read by the model", func(t *testing.T) {
+		c, err := extract([]byte("%PDF-1.4"), "application/pdf", "report.pdf")
+		require.NoError(t, err)
+		assert.Equal(t, &gemini.Media{MIMEType: "application/pdf", Data: []byte("%PDF-1.4")}, c.media)
+	})
+
+	t.Run("unsupported documents", func(t *testing.T) {
+		_, err := extract([]byte("PK"), "application/zip", "archive.zip")
+		assert.ErrorIs(t, err, errUnsupported)
+
+		_, err = extract([]byte{0xff, 0xfe}, "text/plain", "broken.txt")
+		assert.ErrorContains(t, err, "not UTF-8")
+
+		_, err = extract(make([]byte, maxDocumentSize+1), "text/plain", "huge.txt")
+		assert.ErrorContains(t, err, "exceeds")
+	})
+}
+
+func TestMediaService_SummarizeAttachments(t *testing.T) {
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/article":
+			res.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(res, "<title>Article</title><p>Rust 2.0 was announced.</p>")
+		default:
+			http.NotFound(res, req)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	newService := func() (*MediaService, *fakeLLM, messagesRepo.MessagesRepository) {
+		llm := &fakeLLM{response: "A short summary."}
+		service, repo := newTestService(llm, &fakeTranscriber{})
+		return service, llm, repo
+	}
+
+	t.Run("documents and links are summarized", func(t *testing.T) {
+		service, llm, repo := newService()
+
+		// Links are taken from the entities, offsets count UTF-16 code units and the emoji takes two
+		text := "😀 see " + server.URL + "/article and this"
+		message := models.NewMessageFromTelegramMessage(&botModels.Message{
+			ID:      1,
+			Chat:    botModels.Chat{ID: 100},
+			Caption: text,
+			CaptionEntities: []botModels.MessageEntity{
+				{Type: botModels.MessageEntityTypeURL, Offset: 7, Length: len(server.URL) + len("/article")},
+				{Type: botModels.MessageEntityTypeTextLink, Offset: len(text) - 2 - len("this"), Length: len("this"), URL: server.URL + "/missing"},
+			},
+			Document: &botModels.Document{FileID: "notes-1", FileName: "notes.txt", MimeType: "text/plain"},
+		})
+		require.Equal(t, []string{server.URL + "/article", server.URL + "/missing"}, message.Links)
+		require.NoError(t, repo.SaveMessage(ctx, *message))
+
+		require.NoError(t, service.SummarizeAttachments(ctx, message))
+
+		// The missing page is skipped
+		expected := []models.MessageAttachment{
+			{Source: "notes.txt", Summary: "A short summary."},
+			{Source: server.URL + "/article", Summary: "A short summary."},
+		}
+		assert.Equal(t, expected, message.Attachments)
+
+		require.Len(t, llm.requests, 2)
+		assert.Equal(t, "attachment_summary", llm.requests[0].CallSite)
+		assert.Contains(t, llm.requests[0].Messages[0].Content, "we move the launch to May")
+		assert.Contains(t, llm.requests[1].Messages[0].Content, "Rust 2.0 was announced.")
+
+		stored, err := repo.GetMessage(ctx, 100, 1)
+		require.NoError(t, err)
+		assert.Equal(t, expected, stored.Attachments)
+		assert.Contains(t, stored.PromptText(), "[Attachment notes.txt: A short summary.]")
+	})
+
+	t.Run("summaries of earlier attempts are kept", func(t *testing.T) {
+		service, llm, repo := newService()
+		earlier := models.MessageAttachment{Source: "notes.txt", Summary: "Launch moves to May."}
+		require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: 1, ChatID: 100, Attachments: []models.MessageAttachment{earlier}}))
+
+		// A retried update converts the message again, without the summaries
+		message := &models.Message{
+			ID:       1,
+			ChatID:   100,
+			Document: &models.MessageDocument{FileID: "notes-1", FileName: "notes.txt"},
+			Links:    []string{server.URL + "/article"},
+		}
+		require.NoError(t, service.SummarizeAttachments(ctx, message))
+
+		expected := []models.MessageAttachment{earlier, {Source: server.URL + "/article", Summary: "A short summary."}}
+		assert.Equal(t, expected, message.Attachments)
+		require.Len(t, llm.requests, 1)
+		assert.Contains(t, llm.requests[0].Messages[0].Content, "Rust 2.0 was announced.")
+
+		stored, err := repo.GetMessage(ctx, 100, 1)
+		require.NoError(t, err)
+		assert.Equal(t, expected, stored.Attachments)
+
+		// Nothing is left to summarize
+		require.NoError(t, service.SummarizeAttachments(ctx, message))
+		assert.Len(t, llm.requests, 1)
+	})
+
+	t.Run("pdfs are attached to the prompt", func(t *testing.T) {
+		service, llm, repo := newService()
+		message := &models.Message{ID: 1, ChatID: 100, Document: &models.MessageDocument{FileID: "pdf-1", MIMEType: "application/pdf"}}
+		require.NoError(t, repo.SaveMessage(ctx, *message))
+
+		require.NoError(t, service.SummarizeAttachments(ctx, message))
+		assert.Equal(t, []models.MessageAttachment{{Source: "a document", Summary: "A short summary."}}, message.Attachments)
+		require.Len(t, llm.requests, 1)
+		assert.Equal(t, []gemini.Media{{MIMEType: "application/pdf", Data: []byte("%PDF-1.4")}}, llm.requests[0].Messages[0].Media)
+	})
+
+	t.Run("unreadable sources are skipped", func(t *testing.T) {
+		service, llm, repo := newService()
+		message := &models.Message{ID: 1, ChatID: 100, Document: &models.MessageDocument{FileID: "zip-1", FileName: "archive.zip"}}
+		require.NoError(t, repo.SaveMessage(ctx, *message))
+
+		require.NoError(t, service.SummarizeAttachments(ctx, message))
+		assert.Empty(t, message.Attachments)
+		assert.Empty(t, llm.requests)
+	})
+}
+
+func TestNewLinkClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(res, "internal")
+	}))
+	t.Cleanup(server.Close)
+
+	_, err := NewLinkClient(time.Second).Get(server.URL)
+	assert.ErrorContains(t, err, "is not public")
+}
@@ -0,0 +1,161 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/kriku/kpukbot/internal/clients/gemini"
+	"github.com/kriku/kpukbot/internal/clients/telegram"
+	"github.com/kriku/kpukbot/internal/constants"
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/prompts"
+	messagesRepo "github.com/kriku/kpukbot/internal/repository/messages"
+)
+
+// MediaService downloads the media of messages so that the LLM can look at them. It describes
+// images, transcribes voice recordings and summarizes shared documents and web pages for later
+// prompts
+type MediaService struct {
+	gemini       gemini.Client
+	transcriber  Transcriber
+	httpClient   *http.Client // Fetches linked web pages
+	messagesRepo messagesRepo.MessagesRepository
+	messenger    telegram.MessengerClient
+	logger       *slog.Logger
+}
+
+func NewMediaService(
+	gemini gemini.Client,
+	transcriber Transcriber,
+	httpClient *http.Client,
+	messagesRepo messagesRepo.MessagesRepository,
+	logger *slog.Logger,
+) *MediaService {
+	return &MediaService{
+		gemini:       gemini,
+		transcriber:  transcriber,
+		httpClient:   httpClient,
+		messagesRepo: messagesRepo,
+		logger:       logger.With("service", "media"),
+	}
+}
+
+// SetMessengerClient sets the messenger client (useful for resolving circular dependencies)
+func (s *MediaService) SetMessengerClient(messenger telegram.MessengerClient) {
+	s.messenger = messenger
+}
+
+// MessageMedia returns the downloaded media of a chat message to attach to a prompt, media that
+// were not downloaded are only known by their description
+func MessageMedia(message *models.Message) []gemini.Media {
+	if message.Image == nil || len(message.Image.Data) == 0 {
+		return nil
+	}
+	return []gemini.Media{{MIMEType: message.Image.MIMEType, Data: message.Image.Data}}
+}
+
+// LoadImage downloads the image of a message for the LLM calls of this update and stores a
+// description of it, later prompts only know the image by its description
+func (s *MediaService) LoadImage(ctx context.Context, message *models.Message) error {
+	if message.Image == nil {
+		return nil
+	}
+
+	data, err := s.messenger.DownloadFile(ctx, message.Image.FileID)
+	if err != nil {
+		return fmt.Errorf("failed to download image: %w", err)
+	}
+	message.Image.Data = data
+
+	if message.Image.Description != "" {
+		return nil
+	}
+
+	// A retried update finds the description of the earlier attempt
+	stored, err := s.messagesRepo.GetMessage(ctx, message.ChatID, message.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get message: %w", err)
+	}
+	if stored.Image != nil && stored.Image.FileID == message.Image.FileID && stored.Image.Description != "" {
+		message.Image.Description = stored.Image.Description
+		return nil
+	}
+
+	response, err := s.gemini.GenerateContent(ctx, gemini.Request{
+		Messages: gemini.NewPrompt(prompts.ImageDescriptionPrompt(message), MessageMedia(message)...),
+		CallSite: "image_description",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe image: %w", err)
+	}
+	message.Image.Description = prompts.Truncate(strings.TrimSpace(response), int(constants.MaxImageDescriptionLength))
+
+	// The stored message may have been edited meanwhile, only its image is replaced
+	stored, err = s.messagesRepo.GetMessage(ctx, message.ChatID, message.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get message: %w", err)
+	}
+	image := *message.Image
+	image.Data = nil
+	stored.Image = &image
+
+	if err := s.messagesRepo.SaveMessage(ctx, *stored); err != nil {
+		return fmt.Errorf("failed to save image description: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "Image described",
+		"message_id", message.ID,
+		"chat_id", message.ChatID,
+		"description_length", len(image.Description))
+	return nil
+}
+
+// TranscribeVoice downloads the voice or video note of a message and makes its transcript the
+// text of the message, a caption is kept after the transcript. Recordings without speech leave
+// the message as it is
+func (s *MediaService) TranscribeVoice(ctx context.Context, message *models.Message) error {
+	if message.Voice == nil || message.Transcript {
+		return nil
+	}
+
+	data, err := s.messenger.DownloadFile(ctx, message.Voice.FileID)
+	if err != nil {
+		return fmt.Errorf("failed to download voice message: %w", err)
+	}
+
+	transcript, err := s.transcriber.Transcribe(ctx, gemini.Media{MIMEType: message.Voice.MIMEType, Data: data})
+	if err != nil {
+		return err
+	}
+	transcript = prompts.Truncate(strings.TrimSpace(transcript), int(constants.MaxTranscriptLength))
+	if transcript == "" {
+		s.logger.InfoContext(ctx, "Voice message without speech", "message_id", message.ID, "chat_id", message.ChatID)
+		return nil
+	}
+
+	if message.Text != "" {
+		transcript += "\n\n" + message.Text
+	}
+	message.Text = transcript
+	message.Transcript = true
+
+	stored, err := s.messagesRepo.GetMessage(ctx, message.ChatID, message.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get message: %w", err)
+	}
+	stored.Text = message.Text
+	stored.Transcript = true
+
+	if err := s.messagesRepo.SaveMessage(ctx, *stored); err != nil {
+		return fmt.Errorf("failed to save transcript: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "Voice message transcribed",
+		"message_id", message.ID,
+		"chat_id", message.ChatID,
+		"transcript_length", len(message.Text))
+	return nil
+}
@@ -0,0 +1,218 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/clients/gemini"
+	"github.com/kriku/kpukbot/internal/clients/telegram"
+	"github.com/kriku/kpukbot/internal/config"
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/prompts"
+	messagesRepo "github.com/kriku/kpukbot/internal/repository/messages"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMessenger serves downloads of known files, other methods are not used
+type fakeMessenger struct {
+	telegram.MessengerClient
+	files map[string][]byte
+}
+
+func (f *fakeMessenger) DownloadFile(ctx context.Context, fileID string) ([]byte, error) {
+	data, ok := f.files[fileID]
+	if !ok {
+		return nil, errors.New("file not found")
+	}
+	return data, nil
+}
+
+// fakeLLM answers every request with the same text and keeps the requests
+type fakeLLM struct {
+	response string
+	requests []gemini.Request
+}
+
+func (f *fakeLLM) GenerateContent(ctx context.Context, req gemini.Request) (string, error) {
+	f.requests = append(f.requests, req)
+	return f.response, nil
+}
+
+func (f *fakeLLM) WithProfile(profile config.ModelProfile) gemini.Client { return f }
+func (f *fakeLLM) Close() error                                          { return nil }
+
+// fakeTranscriber stands in for the LLM transcriber, it knows the transcripts of recordings
+type fakeTranscriber struct {
+	transcripts map[string]string // By recording data
+	recordings  []gemini.Media
+}
+
+func (f *fakeTranscriber) Transcribe(ctx context.Context, recording gemini.Media) (string, error) {
+	f.recordings = append(f.recordings, recording)
+	return f.transcripts[string(recording.Data)], nil
+}
+
+func newTestService(llm gemini.Client, transcriber Transcriber) (*MediaService, messagesRepo.MessagesRepository) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	repo := messagesRepo.NewMemoryMessagesRepository()
+	service := NewMediaService(llm, transcriber, http.DefaultClient, repo, logger)
+	service.SetMessengerClient(&fakeMessenger{files: map[string][]byte{
+		"photo-1": []byte("jpeg"),
+		"voice-1": []byte("hello"),
+		"voice-2": []byte("silence"),
+		"notes-1": []byte("Meeting notes: we move the launch to May."),
+		"pdf-1":   []byte("%PDF-1.4"),
+		"zip-1":   []byte("PK"),
+	}})
+	return service, repo
+}
+
+func TestMediaService_LoadImage(t *testing.T) {
+	ctx := context.Background()
+
+	newService := func() (*MediaService, *fakeLLM, messagesRepo.MessagesRepository) {
+		llm := &fakeLLM{response: "  A cat sleeping on a laptop keyboard.\n"}
+		service, repo := newTestService(llm, &fakeTranscriber{})
+		return service, llm, repo
+	}
+
+	t.Run("images are downloaded and described", func(t *testing.T) {
+		service, llm, repo := newService()
+		message := &models.Message{ID: 1, ChatID: 100, Text: "my cat", Image: &models.MessageImage{FileID: "photo-1", MIMEType: "image/jpeg"}}
+		require.NoError(t, repo.SaveMessage(ctx, *message))
+
+		require.NoError(t, service.LoadImage(ctx, message))
+		assert.Equal(t, []byte("jpeg"), message.Image.Data)
+		assert.Equal(t, "A cat sleeping on a laptop keyboard.", message.Image.Description)
+
+		require.Len(t, llm.requests, 1)
+		assert.Equal(t, "image_description", llm.requests[0].CallSite)
+		assert.Contains(t, llm.requests[0].Messages[0].Content, `"my cat"`)
+		assert.Equal(t, []gemini.Media{{MIMEType: "image/jpeg", Data: []byte("jpeg")}}, llm.requests[0].Messages[0].Media)
+
+		stored, err := repo.GetMessage(ctx, 100, 1)
+		require.NoError(t, err)
+		assert.Equal(t, "A cat sleeping on a laptop keyboard.", stored.Image.Description)
+		assert.Equal(t, "my cat [Image: A cat sleeping on a laptop keyboard.]", stored.PromptText())
+	})
+
+	t.Run("described images are not described again", func(t *testing.T) {
+		service, llm, _ := newService()
+		message := &models.Message{ID: 1, ChatID: 100, Image: &models.MessageImage{FileID: "photo-1", Description: "A cat"}}
+
+		require.NoError(t, service.LoadImage(ctx, message))
+		assert.Equal(t, []byte("jpeg"), message.Image.Data)
+		assert.Empty(t, llm.requests)
+	})
+
+	t.Run("descriptions of earlier attempts are reused", func(t *testing.T) {
+		service, llm, repo := newService()
+		require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: 1, ChatID: 100, Image: &models.MessageImage{FileID: "photo-1", Description: "A cat"}}))
+
+		// A retried update converts the message again, without the description
+		message := &models.Message{ID: 1, ChatID: 100, Image: &models.MessageImage{FileID: "photo-1"}}
+		require.NoError(t, service.LoadImage(ctx, message))
+		assert.Equal(t, []byte("jpeg"), message.Image.Data)
+		assert.Equal(t, "A cat", message.Image.Description)
+		assert.Empty(t, llm.requests)
+	})
+
+	t.Run("failed downloads are reported", func(t *testing.T) {
+		service, llm, _ := newService()
+		message := &models.Message{ID: 1, ChatID: 100, Image: &models.MessageImage{FileID: "gone"}}
+
+		assert.ErrorContains(t, service.LoadImage(ctx, message), "failed to download image")
+		assert.Empty(t, llm.requests)
+	})
+
+	t.Run("messages without images are skipped", func(t *testing.T) {
+		service, llm, _ := newService()
+		require.NoError(t, service.LoadImage(ctx, &models.Message{ID: 1, ChatID: 100, Text: "hi"}))
+		assert.Empty(t, llm.requests)
+	})
+}
+
+func TestMediaService_TranscribeVoice(t *testing.T) {
+	ctx := context.Background()
+
+	newService := func() (*MediaService, *fakeTranscriber, messagesRepo.MessagesRepository) {
+		transcriber := &fakeTranscriber{transcripts: map[string]string{"hello": " Hello everyone, running late today. "}}
+		service, repo := newTestService(&fakeLLM{}, transcriber)
+		return service, transcriber, repo
+	}
+
+	t.Run("transcripts become the text", func(t *testing.T) {
+		service, transcriber, repo := newService()
+		message := &models.Message{ID: 1, ChatID: 100, Text: "sorry", Voice: &models.MessageVoice{FileID: "voice-1", MIMEType: "audio/ogg"}}
+		require.NoError(t, repo.SaveMessage(ctx, *message))
+
+		require.NoError(t, service.TranscribeVoice(ctx, message))
+		assert.Equal(t, "Hello everyone, running late today.\n\nsorry", message.Text)
+		assert.True(t, message.Transcript)
+		assert.Equal(t, []gemini.Media{{MIMEType: "audio/ogg", Data: []byte("hello")}}, transcriber.recordings)
+
+		stored, err := repo.GetMessage(ctx, 100, 1)
+		require.NoError(t, err)
+		assert.Equal(t, message.Text, stored.Text)
+		assert.True(t, stored.Transcript)
+		assert.Equal(t, "[Voice message] "+message.Text, stored.PromptText())
+
+		// Transcripts are not edited away by caption edits
+		assert.False(t, stored.ApplyEdit(&models.Message{Text: "sorry!"}, time.Now()))
+
+		// Transcribed messages are not transcribed again
+		require.NoError(t, service.TranscribeVoice(ctx, message))
+		assert.Len(t, transcriber.recordings, 1)
+	})
+
+	t.Run("recordings without speech keep their text", func(t *testing.T) {
+		service, _, repo := newService()
+		message := &models.Message{ID: 1, ChatID: 100, Voice: &models.MessageVoice{FileID: "voice-2", MIMEType: "video/mp4"}}
+		require.NoError(t, repo.SaveMessage(ctx, *message))
+
+		require.NoError(t, service.TranscribeVoice(ctx, message))
+		assert.Empty(t, message.Text)
+		assert.False(t, message.Transcript)
+	})
+
+	t.Run("failed downloads are reported", func(t *testing.T) {
+		service, transcriber, _ := newService()
+		message := &models.Message{ID: 1, ChatID: 100, Voice: &models.MessageVoice{FileID: "gone"}}
+
+		assert.ErrorContains(t, service.TranscribeVoice(ctx, message), "failed to download voice message")
+		assert.Empty(t, transcriber.recordings)
+	})
+}
+
+func TestLLMTranscriber_Transcribe(t *testing.T) {
+	ctx := context.Background()
+	recording := gemini.Media{MIMEType: "audio/ogg", Data: []byte("ogg")}
+
+	llm := &fakeLLM{response: "Hello there\n"}
+	transcript, err := NewLLMTranscriber(llm).Transcribe(ctx, recording)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello there", transcript)
+
+	require.Len(t, llm.requests, 1)
+	assert.Equal(t, "transcription", llm.requests[0].CallSite)
+	assert.Equal(t, []gemini.Media{recording}, llm.requests[0].Messages[0].Media)
+
+	llm.response = prompts.NoSpeechAnswer
+	transcript, err = NewLLMTranscriber(llm).Transcribe(ctx, recording)
+	require.NoError(t, err)
+	assert.Empty(t, transcript)
+}
+
+func TestMessageMedia(t *testing.T) {
+	assert.Nil(t, MessageMedia(&models.Message{Text: "hi"}))
+	assert.Nil(t, MessageMedia(&models.Message{Image: &models.MessageImage{FileID: "photo-1", Description: "A cat"}}))
+
+	message := &models.Message{Image: &models.MessageImage{MIMEType: "image/jpeg", Data: []byte("jpeg")}}
+	assert.Equal(t, []gemini.Media{{MIMEType: "image/jpeg", Data: []byte("jpeg")}}, MessageMedia(message))
+}
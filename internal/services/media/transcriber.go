@@ -0,0 +1,41 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kriku/kpukbot/internal/clients/gemini"
+	"github.com/kriku/kpukbot/internal/prompts"
+)
+
+// Transcriber turns the speech of a recording into text, an empty transcript means there was no
+// speech
+type Transcriber interface {
+	Transcribe(ctx context.Context, recording gemini.Media) (string, error)
+}
+
+// LLMTranscriber transcribes recordings with a model that takes audio input, e.g. Gemini
+type LLMTranscriber struct {
+	gemini gemini.Client
+}
+
+func NewLLMTranscriber(gemini gemini.Client) Transcriber {
+	return &LLMTranscriber{gemini: gemini}
+}
+
+func (t *LLMTranscriber) Transcribe(ctx context.Context, recording gemini.Media) (string, error) {
+	response, err := t.gemini.GenerateContent(ctx, gemini.Request{
+		Messages: gemini.NewPrompt(prompts.TranscriptionPrompt(), recording),
+		CallSite: "transcription",
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to transcribe recording: %w", err)
+	}
+
+	transcript := strings.TrimSpace(response)
+	if transcript == prompts.NoSpeechAnswer {
+		return "", nil
+	}
+	return transcript, nil
+}
@@ -2,8 +2,8 @@ package messages
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
-	"time"
 
 	tmodels "github.com/go-telegram/bot/models"
 
@@ -46,22 +46,22 @@ func (s *TelegramMessagesService) HandleMessage(ctx context.Context, update *tmo
 	return nil
 }
 
-func (s *TelegramMessagesService) SaveBotMessage(ctx context.Context, chatID int64, messageID int, text string) error {
-	message := &models.Message{
-		ID:        messageID,
-		ChatID:    chatID,
-		UserID:    0, // Bot has no user ID
-		Text:      text,
-		Username:  "kpukbot",
-		FirstName: "",
-		LastName:  "",
-		Date:      time.Now(),
-		IsBot:     true,
+// SaveBotMessage stores a message sent by the bot under its real Telegram message ID,
+// replyToMessageID links it to the message it answers when Telegram did not
+func (s *TelegramMessagesService) SaveBotMessage(ctx context.Context, sent *tmodels.Message, replyToMessageID int) (*models.Message, error) {
+	message := models.NewMessageFromTelegramMessage(sent)
+	message.IsBot = true
+	if message.Username == "" {
+		message.Username = "kpukbot"
+	}
+	if message.ReplyToMessageID == 0 {
+		message.ReplyToMessageID = replyToMessageID
 	}
 
 	s.logger.InfoContext(ctx, "Saving bot message",
 		"message_id", message.ID,
 		"chat_id", message.ChatID,
+		"reply_to_message_id", message.ReplyToMessageID,
 		"text_length", len(message.Text),
 	)
 
@@ -71,9 +71,29 @@ func (s *TelegramMessagesService) SaveBotMessage(ctx context.Context, chatID int
 			"error", err,
 			"message_id", message.ID,
 		)
-		return err
+		return nil, err
 	}
 
 	s.logger.DebugContext(ctx, "Bot message saved successfully", "message_id", message.ID)
+	return message, nil
+}
+
+// MarkDeleted flags a stored message as deleted, it stays in the history but is no longer shown
+// to the LLM
+func (s *TelegramMessagesService) MarkDeleted(ctx context.Context, chatID int64, messageID int) error {
+	message, err := s.repo.GetMessage(ctx, chatID, messageID)
+	if err != nil {
+		return err
+	}
+	if message.Deleted {
+		return nil
+	}
+
+	message.Deleted = true
+	if err := s.repo.SaveMessage(ctx, *message); err != nil {
+		return fmt.Errorf("failed to mark message deleted: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "Message marked deleted", "message_id", messageID, "chat_id", chatID)
 	return nil
 }
@@ -0,0 +1,83 @@
+package messages
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	tmodels "github.com/go-telegram/bot/models"
+	"github.com/kriku/kpukbot/internal/models"
+	repositories "github.com/kriku/kpukbot/internal/repository/messages"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTelegramMessagesService_SaveBotMessage(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewMemoryMessagesRepository()
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	service := NewTelegramMessagesService(repo, logger)
+
+	sent := &tmodels.Message{
+		ID:   555,
+		Chat: tmodels.Chat{ID: 789},
+		From: &tmodels.User{ID: 42, IsBot: true, Username: "test_bot"},
+		Date: 1700000000,
+		Text: "Hello there",
+	}
+
+	message, err := service.SaveBotMessage(ctx, sent, 554)
+	require.NoError(t, err)
+	assert.Equal(t, 555, message.ID)
+
+	saved, err := repo.GetMessage(ctx, 789, 555)
+	require.NoError(t, err)
+	assert.True(t, saved.IsBot)
+	assert.Equal(t, "Hello there", saved.Text)
+	assert.Equal(t, "test_bot", saved.Username)
+	assert.Equal(t, 554, saved.ReplyToMessageID)
+}
+
+func TestTelegramMessagesService_SaveBotMessage_KeepsTelegramReply(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewMemoryMessagesRepository()
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	service := NewTelegramMessagesService(repo, logger)
+
+	sent := &tmodels.Message{
+		ID:             10,
+		Chat:           tmodels.Chat{ID: 789},
+		Text:           "Answer",
+		ReplyToMessage: &tmodels.Message{ID: 7},
+	}
+
+	message, err := service.SaveBotMessage(ctx, sent, 9)
+	require.NoError(t, err)
+	assert.Equal(t, 7, message.ReplyToMessageID)
+	assert.Equal(t, "kpukbot", message.Username)
+	assert.True(t, message.IsBot)
+}
+
+func TestTelegramMessagesService_MarkDeleted(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewMemoryMessagesRepository()
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	service := NewTelegramMessagesService(repo, logger)
+
+	require.NoError(t, repo.SaveMessage(ctx, models.Message{ID: 1, ChatID: 789, Text: "oops"}))
+
+	require.NoError(t, service.MarkDeleted(ctx, 789, 1))
+	saved, err := repo.GetMessage(ctx, 789, 1)
+	require.NoError(t, err)
+	assert.True(t, saved.Deleted)
+	assert.Equal(t, "oops", saved.Text)
+
+	// Marking again is a no-op
+	require.NoError(t, service.MarkDeleted(ctx, 789, 1))
+
+	err = service.MarkDeleted(ctx, 789, 2)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
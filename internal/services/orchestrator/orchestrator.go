@@ -2,42 +2,72 @@ package orchestrator
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
+	tmodels "github.com/go-telegram/bot/models"
+	"github.com/kriku/kpukbot/internal/clients/gemini"
 	"github.com/kriku/kpukbot/internal/clients/telegram"
+	"github.com/kriku/kpukbot/internal/config"
 	"github.com/kriku/kpukbot/internal/models"
 	messagesRepo "github.com/kriku/kpukbot/internal/repository/messages"
+	"github.com/kriku/kpukbot/internal/services/chats"
+	"github.com/kriku/kpukbot/internal/services/media"
+	"github.com/kriku/kpukbot/internal/services/messages"
 	"github.com/kriku/kpukbot/internal/services/response"
 	"github.com/kriku/kpukbot/internal/services/threading"
+	"github.com/kriku/kpukbot/internal/services/usage"
 	"github.com/kriku/kpukbot/internal/services/users"
+	"github.com/kriku/kpukbot/internal/strategies"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// budgetNotice is posted once per budget period when a chat runs out of its LLM budget
+const budgetNotice = "This chat has used up its AI budget for now, I'll stay quiet until it resets."
+
 // OrchestratorService coordinates the entire message processing pipeline
 type OrchestratorService struct {
-	classifier     *threading.ClassifierService
-	analyzer       *response.AnalyzerService
-	messagesRepo   messagesRepo.MessagesRepository
-	usersService   *users.UsersService
-	telegramClient telegram.MessengerClient
-	logger         *slog.Logger
+	classifier      *threading.ClassifierService
+	analyzer        *response.AnalyzerService
+	messagesRepo    messagesRepo.MessagesRepository
+	messagesService *messages.TelegramMessagesService
+	usersService    *users.UsersService
+	chatsService    *chats.ChatsService
+	usageService    *usage.UsageService
+	mediaService    *media.MediaService
+	telegramClient  telegram.MessengerClient
+	editsConfig     config.MessageEditsConfig
+	logger          *slog.Logger
 }
 
 func NewOrchestratorService(
 	classifier *threading.ClassifierService,
 	analyzer *response.AnalyzerService,
 	messagesRepo messagesRepo.MessagesRepository,
+	messagesService *messages.TelegramMessagesService,
 	usersService *users.UsersService,
+	chatsService *chats.ChatsService,
+	usageService *usage.UsageService,
+	mediaService *media.MediaService,
 	telegramClient telegram.MessengerClient,
+	editsConfig config.MessageEditsConfig,
 	logger *slog.Logger,
 ) *OrchestratorService {
 	return &OrchestratorService{
-		classifier:     classifier,
-		analyzer:       analyzer,
-		messagesRepo:   messagesRepo,
-		usersService:   usersService,
-		telegramClient: telegramClient,
-		logger:         logger.With("service", "orchestrator"),
+		classifier:      classifier,
+		analyzer:        analyzer,
+		messagesRepo:    messagesRepo,
+		messagesService: messagesService,
+		usersService:    usersService,
+		chatsService:    chatsService,
+		usageService:    usageService,
+		mediaService:    mediaService,
+		telegramClient:  telegramClient,
+		editsConfig:     editsConfig,
+		logger:          logger.With("service", "orchestrator"),
 	}
 }
 
@@ -53,9 +83,18 @@ func (s *OrchestratorService) ProcessMessage(ctx context.Context, message *model
 		"chat_id", message.ChatID,
 		"user_id", message.UserID)
 
+	// LLM usage of this message is accounted to its chat and sender
+	scope := gemini.UsageScope{ChatID: message.ChatID, UserID: message.UserID}
+	ctx = gemini.WithUsageScope(ctx, scope)
+
 	// Step 1: Save the incoming message
-	if err := s.messagesRepo.SaveMessage(ctx, *message); err != nil {
-		return fmt.Errorf("failed to save message: %w", err)
+	message, err := s.saveIncomingMessage(ctx, message)
+	if err != nil {
+		return err
+	}
+	if message.Deleted {
+		s.logger.InfoContext(ctx, "Message was deleted meanwhile, skipping", "message_id", message.ID)
+		return nil
 	}
 	s.logger.DebugContext(ctx, "Message saved")
 
@@ -65,8 +104,49 @@ func (s *OrchestratorService) ProcessMessage(ctx context.Context, message *model
 		// Don't fail the entire process if user tracking fails
 	}
 
+	// Step 1.7: Respect the LLM budget of the chat
+	settings, budget := s.checkBudget(ctx, message.ChatID)
+	switch budget.State {
+	case models.BudgetExhausted:
+		s.logger.InfoContext(ctx, "LLM budget exhausted, skipping classification and response",
+			"chat_id", message.ChatID,
+			"period", budget.Period)
+		s.postBudgetNotice(ctx, settings, budget)
+		return nil
+	case models.BudgetNear:
+		s.logger.InfoContext(ctx, "LLM budget nearly used, economizing",
+			"chat_id", message.ChatID,
+			"period", budget.Period)
+		ctx = strategies.WithEconomyMode(ctx)
+	}
+
+	if err := s.telegramClient.SendChatAction(ctx, message.ChatID, tmodels.ChatActionTyping); err != nil {
+		s.logger.WarnContext(ctx, "Failed to send typing action", "error", err)
+	}
+
+	// Step 1.8: Look at attached media. Images are shown to the model, voice messages are
+	// transcribed and shared documents and links are summarized, without them the text has to do
+	if err := s.mediaService.LoadImage(ctx, message); err != nil {
+		s.logger.WarnContext(ctx, "Failed to load image", "message_id", message.ID, "error", err)
+	}
+	if err := s.mediaService.TranscribeVoice(ctx, message); err != nil {
+		s.logger.WarnContext(ctx, "Failed to transcribe voice message", "message_id", message.ID, "error", err)
+	}
+	if message.Voice != nil && message.Text == "" {
+		s.logger.InfoContext(ctx, "Voice message without text, skipping classification and response")
+		return nil
+	}
+	if err := s.mediaService.SummarizeAttachments(ctx, message); err != nil {
+		s.logger.WarnContext(ctx, "Failed to summarize attachments", "message_id", message.ID, "error", err)
+	}
+
 	// Step 2: Classify message into a thread
 	threadMatch, err := s.classifier.ClassifyMessage(ctx, message)
+	if errors.Is(err, gemini.ErrUnavailable) {
+		// The message is saved, stay silent until the model is back
+		s.logger.WarnContext(ctx, "LLM unavailable, skipping classification and response", "error", err)
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("failed to classify message: %w", err)
 	}
@@ -76,6 +156,9 @@ func (s *OrchestratorService) ProcessMessage(ctx context.Context, message *model
 		"thread_theme", threadMatch.Thread.Theme,
 		"probability", threadMatch.Probability)
 
+	scope.ThreadID = threadMatch.Thread.ID
+	ctx = gemini.WithUsageScope(ctx, scope)
+
 	// Step 3: Add message to the thread
 	if err := s.classifier.AddMessageToThread(ctx, threadMatch.Thread, message); err != nil {
 		return fmt.Errorf("failed to add message to thread: %w", err)
@@ -91,6 +174,10 @@ func (s *OrchestratorService) ProcessMessage(ctx context.Context, message *model
 
 	// Step 5: Analyze if response is needed and generate it
 	responseText, err := s.analyzer.AnalyzeAndRespond(ctx, threadMatch.Thread, messages, message)
+	if errors.Is(err, gemini.ErrUnavailable) {
+		s.logger.WarnContext(ctx, "LLM unavailable, skipping response", "error", err)
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("failed to analyze and respond: %w", err)
 	}
@@ -99,12 +186,29 @@ func (s *OrchestratorService) ProcessMessage(ctx context.Context, message *model
 	if responseText != "" {
 		s.logger.InfoContext(ctx, "Sending response", "response_length", len(responseText))
 
-		_, err := s.telegramClient.SendMessage(ctx, message.ChatID, responseText)
-		if err != nil {
+		opts := telegram.SendOptions{
+			Format:           telegram.FormatMarkdown,
+			ReplyToMessageID: message.ID,
+		}
+		sent, err := s.telegramClient.SendMessageWithOptions(ctx, message.ChatID, responseText, opts)
+		if len(sent) == 0 {
 			return fmt.Errorf("failed to send response: %w", err)
 		}
+		if err != nil {
+			// Sending the whole response again would repeat the delivered parts
+			s.logger.WarnContext(ctx, "Response sent partially", "parts_sent", len(sent), "error", err)
+		}
+
+		s.logger.InfoContext(ctx, "Response sent successfully", "parts", len(sent))
+		s.notifyReplied(ctx)
 
-		s.logger.InfoContext(ctx, "Response sent successfully")
+		// Step 7: Keep the reply in the thread history
+		for _, part := range sent {
+			if err := s.saveBotMessage(ctx, threadMatch.Thread, part, message.ID); err != nil {
+				s.logger.WarnContext(ctx, "Failed to save bot response", "error", err)
+				// The response is already delivered
+			}
+		}
 	} else {
 		s.logger.InfoContext(ctx, "No response needed")
 	}
@@ -112,26 +216,172 @@ func (s *OrchestratorService) ProcessMessage(ctx context.Context, message *model
 	return nil
 }
 
+// saveIncomingMessage stores a new message. A message that is already stored comes from a retried
+// update, the stored version is kept with its edits, deletion and the results of earlier attempts,
+// only what is not stored is taken from the update
+func (s *OrchestratorService) saveIncomingMessage(ctx context.Context, message *models.Message) (*models.Message, error) {
+	stored, err := s.messagesRepo.GetMessage(ctx, message.ChatID, message.ID)
+	switch {
+	case status.Code(err) == codes.NotFound:
+		if err := s.messagesRepo.SaveMessage(ctx, *message); err != nil {
+			return nil, fmt.Errorf("failed to save message: %w", err)
+		}
+		return message, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "Message already stored, keeping the stored version", "message_id", message.ID)
+	stored.Document = message.Document
+	stored.Links = message.Links
+	return stored, nil
+}
+
+// ProcessEditedMessage updates the stored text of an edited message and keeps the previous one in
+// its edit history. Edits are never answered, with reprocessing enabled the message is classified
+// again and the summary of its thread is refreshed
+func (s *OrchestratorService) ProcessEditedMessage(ctx context.Context, edited *models.Message, editedAt time.Time) error {
+	s.logger.InfoContext(ctx, "Processing edited message",
+		"message_id", edited.ID,
+		"chat_id", edited.ChatID,
+		"user_id", edited.UserID)
+
+	message, err := s.messagesRepo.GetMessage(ctx, edited.ChatID, edited.ID)
+	switch {
+	case status.Code(err) == codes.NotFound:
+		// The original was sent before the bot joined, there is no history to keep
+		message = edited
+	case err != nil:
+		return fmt.Errorf("failed to get edited message: %w", err)
+	case !message.ApplyEdit(edited, editedAt):
+		s.logger.DebugContext(ctx, "Edit did not change the text", "message_id", edited.ID)
+		return nil
+	}
+
+	if err := s.messagesRepo.SaveMessage(ctx, *message); err != nil {
+		return fmt.Errorf("failed to save edited message: %w", err)
+	}
+	s.logger.DebugContext(ctx, "Edited message saved", "edits", len(message.Edits))
+
+	if !s.editsConfig.Reprocess || message.Deleted || s.BudgetExhausted(ctx, message.ChatID) {
+		return nil
+	}
+
+	ctx = gemini.WithUsageScope(ctx, gemini.UsageScope{ChatID: message.ChatID, UserID: message.UserID})
+	thread, err := s.classifier.ReclassifyMessage(ctx, message)
+	if errors.Is(err, gemini.ErrUnavailable) {
+		s.logger.WarnContext(ctx, "LLM unavailable, skipping reclassification", "error", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reclassify edited message: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "Edited message reclassified", "thread_id", thread.ID, "thread_theme", thread.Theme)
+	return nil
+}
+
+// BudgetExhausted reports whether the chat has used up its LLM budget, scheduled LLM work should skip it
+func (s *OrchestratorService) BudgetExhausted(ctx context.Context, chatID int64) bool {
+	_, budget := s.checkBudget(ctx, chatID)
+	return budget.State == models.BudgetExhausted
+}
+
+// checkBudget returns the settings and budget status of a chat, the budget is not enforced
+// when it cannot be checked
+func (s *OrchestratorService) checkBudget(ctx context.Context, chatID int64) (*models.ChatSettings, models.BudgetStatus) {
+	ok := models.BudgetStatus{State: models.BudgetOK}
+
+	settings, err := s.chatsService.GetChatSettings(ctx, chatID)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Failed to get chat settings, budget not enforced", "chat_id", chatID, "error", err)
+		return nil, ok
+	}
+
+	budget, err := s.usageService.CheckBudget(ctx, settings)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Failed to check budget, budget not enforced", "chat_id", chatID, "error", err)
+		return settings, ok
+	}
+
+	return settings, budget
+}
+
+// postBudgetNotice tells the chat once per budget period that the bot went quiet
+func (s *OrchestratorService) postBudgetNotice(ctx context.Context, settings *models.ChatSettings, budget models.BudgetStatus) {
+	if !settings.BudgetNotice || settings.BudgetNoticePeriod == budget.Period {
+		return
+	}
+
+	// Remember the notice first, a failed send is better than repeating it on every message
+	if err := s.chatsService.SetBudgetNoticePeriod(ctx, settings.ChatID, budget.Period); err != nil {
+		s.logger.WarnContext(ctx, "Failed to save budget notice period", "chat_id", settings.ChatID, "error", err)
+		return
+	}
+
+	opts := telegram.SendOptions{DisableNotification: true}
+	if _, err := s.telegramClient.SendMessageWithOptions(ctx, settings.ChatID, budgetNotice, opts); err != nil {
+		s.logger.WarnContext(ctx, "Failed to send budget notice", "chat_id", settings.ChatID, "error", err)
+	}
+}
+
+// RecordBotMessage stores a message the bot sent on its own, e.g. a scheduled question,
+// and attaches it to the thread it belongs to
+func (s *OrchestratorService) RecordBotMessage(ctx context.Context, sent *tmodels.Message) error {
+	message, err := s.messagesService.SaveBotMessage(ctx, sent, 0)
+	if err != nil {
+		return fmt.Errorf("failed to save bot message: %w", err)
+	}
+
+	ctx = gemini.WithUsageScope(ctx, gemini.UsageScope{ChatID: message.ChatID})
+	threadMatch, err := s.classifier.ClassifyMessage(ctx, message)
+	if err != nil {
+		return fmt.Errorf("failed to classify bot message: %w", err)
+	}
+
+	if err := s.classifier.AddMessageToThread(ctx, threadMatch.Thread, message); err != nil {
+		return fmt.Errorf("failed to add bot message to thread: %w", err)
+	}
+
+	return nil
+}
+
+// saveBotMessage stores a reply of the bot and attaches it to the thread of the message it answers
+func (s *OrchestratorService) saveBotMessage(ctx context.Context, thread *models.Thread, sent *tmodels.Message, replyToMessageID int) error {
+	message, err := s.messagesService.SaveBotMessage(ctx, sent, replyToMessageID)
+	if err != nil {
+		return fmt.Errorf("failed to save bot message: %w", err)
+	}
+
+	if err := s.classifier.AddMessageToThread(ctx, thread, message); err != nil {
+		return fmt.Errorf("failed to add bot message to thread: %w", err)
+	}
+
+	return nil
+}
+
 // getThreadMessages retrieves recent messages from a thread
 func (s *OrchestratorService) getThreadMessages(ctx context.Context, thread *models.Thread) ([]*models.Message, error) {
-	var messages []*models.Message
-
 	// Get last 10 messages from the thread
 	startIdx := len(thread.MessageIDs) - 10
 	if startIdx < 0 {
 		startIdx = 0
 	}
+	ids := thread.MessageIDs[startIdx:]
 
-	for i := startIdx; i < len(thread.MessageIDs); i++ {
-		msgList, err := s.messagesRepo.GetMessage(ctx, int64(thread.MessageIDs[i]))
-		if err != nil {
-			s.logger.WarnContext(ctx, "Failed to get message", "message_id", thread.MessageIDs[i], "error", err)
-			continue
-		}
-		messages = append(messages, msgList...)
+	messages, err := s.messagesRepo.GetMessagesByIDs(ctx, thread.ChatID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thread messages: %w", err)
+	}
+
+	if len(messages) < len(ids) {
+		s.logger.WarnContext(ctx, "Some thread messages are missing",
+			"thread_id", thread.ID,
+			"requested", len(ids),
+			"found", len(messages))
 	}
 
-	return messages, nil
+	return models.WithoutDeleted(messages), nil
 }
 
 // trackUserFromMessage extracts user information from the message and updates the user repository
@@ -0,0 +1,25 @@
+package orchestrator
+
+import "context"
+
+type replyHookKey struct{}
+
+// ReplyHook is called right after the reply to a message is sent
+type ReplyHook func(ctx context.Context) error
+
+// WithReplyHook returns a context whose message processing calls hook once the reply is sent,
+// the handler uses it to remember that a retry of the update must not answer again
+func WithReplyHook(ctx context.Context, hook ReplyHook) context.Context {
+	return context.WithValue(ctx, replyHookKey{}, hook)
+}
+
+// notifyReplied calls the reply hook of the context, if any
+func (s *OrchestratorService) notifyReplied(ctx context.Context) {
+	hook, ok := ctx.Value(replyHookKey{}).(ReplyHook)
+	if !ok {
+		return
+	}
+	if err := hook(ctx); err != nil {
+		s.logger.WarnContext(ctx, "Failed to record reply", "error", err)
+	}
+}
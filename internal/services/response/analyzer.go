@@ -3,6 +3,7 @@ package response
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 
@@ -11,7 +12,6 @@ import (
 	"github.com/kriku/kpukbot/internal/models"
 	"github.com/kriku/kpukbot/internal/prompts"
 	"github.com/kriku/kpukbot/internal/strategies"
-	"google.golang.org/genai"
 )
 
 type AnalyzerService struct {
@@ -44,35 +44,39 @@ func (s *AnalyzerService) AnalyzeAndRespond(
 
 	// First, use LLM to get general assessment
 	prompt := prompts.ResponseAnalysisPrompt(thread, messages, newMessage)
-	config := &genai.GenerateContentConfig{
-		ResponseMIMEType: "application/json",
-		ResponseSchema: &genai.Schema{
-			Type: genai.TypeObject,
-			Properties: map[string]*genai.Schema{
-				"should_respond": {Type: genai.TypeBoolean},
+	req := gemini.Request{
+		Messages: gemini.NewPrompt(prompt),
+		CallSite: "analyzer",
+		Schema: &gemini.Schema{
+			Type: gemini.TypeObject,
+			Properties: map[string]*gemini.Schema{
+				"should_respond": {Type: gemini.TypeBoolean},
 				"confidence": {
-					Type:    genai.TypeNumber,
+					Type:    gemini.TypeNumber,
 					Minimum: &constants.MinimumConfidenceScore,
 					Maximum: &constants.MaximumConfidenceScore,
 				},
 				"reason": {
-					Type:      genai.TypeString,
+					Type:      gemini.TypeString,
 					MaxLength: &constants.MaxAnalysisLength,
 				},
 				"suggested_strategy": {
-					Type: genai.TypeString,
+					Type: gemini.TypeString,
 					Enum: []string{"general", "introduction", "question"},
 				},
 			},
 		},
 	}
 
-	response, err := s.gemini.GenerateContent(ctx, prompt, config)
-
-	s.logger.InfoContext(ctx, "Analyze and respond response", "response", response)
-
+	response, err := s.gemini.GenerateContent(ctx, req)
+	if errors.Is(err, gemini.ErrUnavailable) {
+		s.logger.WarnContext(ctx, "LLM unavailable, skipping response", "error", err)
+		return "", nil
+	}
 	if err != nil {
 		s.logger.WarnContext(ctx, "Failed to get LLM analysis", "error", err)
+	} else {
+		s.logger.DebugContext(ctx, "Analyze and respond response", "response", response)
 	}
 
 	var analysis struct {
@@ -136,8 +140,15 @@ func (s *AnalyzerService) AnalyzeAndRespond(
 		}
 	}
 
+	// Close to the budget only the suggested strategy is worth its model calls
+	remaining := s.strategies
+	if strategies.EconomyMode(ctx) {
+		s.logger.InfoContext(ctx, "Economy mode, skipping other strategies")
+		remaining = nil
+	}
+
 	// Evaluate remaining strategies only if suggested strategy didn't qualify or doesn't exist
-	for _, strategy := range s.strategies {
+	for _, strategy := range remaining {
 		// Skip if this is the suggested strategy we already evaluated
 		if suggestedStrategy != nil && strategy.Name() == analysis.SuggestedStrategy {
 			continue
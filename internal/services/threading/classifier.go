@@ -3,8 +3,10 @@ package threading
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,7 +16,7 @@ import (
 	"github.com/kriku/kpukbot/internal/prompts"
 	messagesRepo "github.com/kriku/kpukbot/internal/repository/messages"
 	threadsRepo "github.com/kriku/kpukbot/internal/repository/threads"
-	"google.golang.org/genai"
+	"github.com/kriku/kpukbot/internal/services/media"
 )
 
 type ClassifierService struct {
@@ -45,9 +47,23 @@ func NewClassifierService(
 func (s *ClassifierService) ClassifyMessage(ctx context.Context, message *models.Message) (*models.ThreadMatch, error) {
 	s.logger.InfoContext(ctx, "Classifying message", "message_id", message.ID, "chat_id", message.ChatID)
 
+	// A retried update keeps the thread its message was classified into before
+	existing, err := s.threadsRepo.GetThreadByMessageID(ctx, message.ChatID, message.ID)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Failed to get thread by message ID", "error", err)
+	}
+	if existing != nil {
+		s.logger.InfoContext(ctx, "Message is already classified", "thread_id", existing.ID)
+		return &models.ThreadMatch{
+			Thread:      existing,
+			Probability: 1.0,
+			Reasoning:   "Message already belongs to the thread",
+		}, nil
+	}
+
 	// Handle replies
 	if message.ReplyToMessageID != 0 {
-		thread, err := s.threadsRepo.GetThreadByMessageID(ctx, message.ReplyToMessageID)
+		thread, err := s.threadsRepo.GetThreadByMessageID(ctx, message.ChatID, message.ReplyToMessageID)
 		if err != nil {
 			s.logger.WarnContext(ctx, "Failed to get thread by reply message ID", "error", err)
 		}
@@ -80,40 +96,41 @@ func (s *ClassifierService) ClassifyMessage(ctx context.Context, message *models
 	// Use LLM to classify the message
 	prompt := prompts.ThreadClassificationPrompt(message, threads)
 
-	config := &genai.GenerateContentConfig{
-		ResponseMIMEType: "application/json",
-		ResponseSchema: &genai.Schema{
-			Type: genai.TypeObject,
-			Properties: map[string]*genai.Schema{
+	req := gemini.Request{
+		Messages: gemini.NewPrompt(prompt, media.MessageMedia(message)...),
+		CallSite: "classifier",
+		Schema: &gemini.Schema{
+			Type: gemini.TypeObject,
+			Properties: map[string]*gemini.Schema{
 				"matches": {
-					Type: genai.TypeArray,
-					Items: &genai.Schema{
-						Type: genai.TypeObject,
-						Properties: map[string]*genai.Schema{
-							"thread_id":   {Type: genai.TypeString},
-							"probability": {Type: genai.TypeNumber},
+					Type: gemini.TypeArray,
+					Items: &gemini.Schema{
+						Type: gemini.TypeObject,
+						Properties: map[string]*gemini.Schema{
+							"thread_id":   {Type: gemini.TypeString},
+							"probability": {Type: gemini.TypeNumber},
 							"reasoning": {
-								Type:      genai.TypeString,
+								Type:      gemini.TypeString,
 								MaxLength: &constants.MaxThreadReasoningLength,
 							},
 						},
 					},
 				},
 				"new_thread_suggestion": {
-					Type: genai.TypeObject,
-					Properties: map[string]*genai.Schema{
+					Type: gemini.TypeObject,
+					Properties: map[string]*gemini.Schema{
 						"theme": {
-							Type:      genai.TypeString,
+							Type:      gemini.TypeString,
 							MaxLength: &constants.MaxThreadThemeLength,
 						},
-						"probability": {Type: genai.TypeNumber},
+						"probability": {Type: gemini.TypeNumber},
 					},
 				},
 			},
 		},
 	}
 
-	response, err := s.gemini.GenerateContent(ctx, prompt, config)
+	response, err := s.gemini.GenerateContent(ctx, req)
 
 	s.logger.InfoContext(ctx, "Analyzer classification response", "response", response)
 
@@ -178,31 +195,28 @@ func (s *ClassifierService) createNewThread(ctx context.Context, message *models
 	messages := []*models.Message{message}
 	prompt := prompts.ThreadSummaryPrompt(messages)
 
-	config := &genai.GenerateContentConfig{
-		ResponseMIMEType: "application/json",
-		ResponseSchema: &genai.Schema{
-			Type: genai.TypeObject,
-			Properties: map[string]*genai.Schema{
+	req := gemini.Request{
+		Messages: gemini.NewPrompt(prompt, media.MessageMedia(message)...),
+		CallSite: "classifier",
+		Schema: &gemini.Schema{
+			Type: gemini.TypeObject,
+			Properties: map[string]*gemini.Schema{
 				"theme": {
-					Type:      genai.TypeString,
+					Type:      gemini.TypeString,
 					MaxLength: &constants.MaxThreadThemeLength,
 				},
 				"summary": {
-					Type:      genai.TypeString,
+					Type:      gemini.TypeString,
 					MaxLength: &constants.MaxThreadSummaryLength,
 				},
 			},
 		},
 	}
 
-	response, err := s.gemini.GenerateContent(ctx, prompt, config)
-
-	s.logger.InfoContext(ctx, "Analyzer create new thread response", "response", response)
-
-	if err != nil {
-		s.logger.WarnContext(ctx, "Failed to generate thread summary", "error", err)
-		// Use fallback
-		response = fmt.Sprintf(`{"theme": "New conversation", "summary": "%s"}`, message.Text[:min(50, len(message.Text))])
+	response, err := s.gemini.GenerateContent(ctx, req)
+	if errors.Is(err, gemini.ErrUnavailable) {
+		// No thread is created without the model, the orchestrator skips the message
+		return nil, fmt.Errorf("failed to generate thread summary: %w", err)
 	}
 
 	var summary struct {
@@ -210,9 +224,21 @@ func (s *ClassifierService) createNewThread(ctx context.Context, message *models
 		Summary string `json:"summary"`
 	}
 
-	if err := json.Unmarshal([]byte(response), &summary); err != nil {
+	if err != nil {
+		s.logger.WarnContext(ctx, "Failed to generate thread summary", "error", err)
+	} else {
+		s.logger.DebugContext(ctx, "Analyzer create new thread response", "response", response)
+		if err := json.Unmarshal([]byte(response), &summary); err != nil {
+			s.logger.WarnContext(ctx, "Failed to parse thread summary response", "error", err)
+		}
+	}
+
+	// Fallback: the message itself names the thread
+	if summary.Theme == "" {
 		summary.Theme = "New conversation"
-		summary.Summary = message.Text[:min(100, len(message.Text))]
+	}
+	if summary.Summary == "" {
+		summary.Summary = prompts.Truncate(message.PromptText(), 100)
 	}
 
 	thread := &models.Thread{
@@ -240,9 +266,18 @@ func (s *ClassifierService) createNewThread(ctx context.Context, message *models
 }
 
 func (s *ClassifierService) AddMessageToThread(ctx context.Context, thread *models.Thread, message *models.Message) error {
-	// Add message ID to thread
-	thread.MessageIDs = append(thread.MessageIDs, message.ID)
-	thread.UpdatedAt = time.Now()
+	// Replies and new threads already contain the message
+	if slices.Contains(thread.MessageIDs, message.ID) {
+		return nil
+	}
+
+	// Add message ID to thread, the stored thread may already have messages of concurrent updates
+	stored, err := s.threadsRepo.AppendMessage(ctx, thread.ID, message.ID)
+	if err != nil {
+		return err
+	}
+	thread.MessageIDs = stored.MessageIDs
+	thread.UpdatedAt = stored.UpdatedAt
 
 	// Update thread summary periodically (every 5 messages)
 	if len(thread.MessageIDs)%5 == 0 {
@@ -251,46 +286,69 @@ func (s *ClassifierService) AddMessageToThread(ctx context.Context, thread *mode
 		}
 	}
 
-	return s.threadsRepo.UpdateThread(ctx, thread)
+	return nil
 }
 
-func (s *ClassifierService) updateThreadSummary(ctx context.Context, thread *models.Thread) error {
-	// Get recent messages from the thread
-	var messages []*models.Message
-	// Get last 10 messages
-	startIdx := max(0, len(thread.MessageIDs)-10)
-	for i := startIdx; i < len(thread.MessageIDs); i++ {
-		msgList, err := s.messagesRepo.GetMessage(ctx, int64(thread.MessageIDs[i]))
+// ReclassifyMessage runs an edited message through classification again. A message that belongs to
+// a thread stays in it and refreshes the thread summary, a message that was never classified, e.g.
+// because the LLM was unavailable, is classified like a new one
+func (s *ClassifierService) ReclassifyMessage(ctx context.Context, message *models.Message) (*models.Thread, error) {
+	thread, err := s.threadsRepo.GetThreadByMessageID(ctx, message.ChatID, message.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thread by message ID: %w", err)
+	}
+
+	if thread == nil {
+		threadMatch, err := s.ClassifyMessage(ctx, message)
 		if err != nil {
-			continue
+			return nil, err
+		}
+		if err := s.AddMessageToThread(ctx, threadMatch.Thread, message); err != nil {
+			return nil, fmt.Errorf("failed to add message to thread: %w", err)
 		}
-		messages = append(messages, msgList...)
+		return threadMatch.Thread, nil
 	}
 
+	if err := s.updateThreadSummary(ctx, thread); err != nil {
+		return nil, fmt.Errorf("failed to update thread summary: %w", err)
+	}
+	return thread, nil
+}
+
+func (s *ClassifierService) updateThreadSummary(ctx context.Context, thread *models.Thread) error {
+	// Get last 10 messages from the thread
+	startIdx := max(0, len(thread.MessageIDs)-10)
+	messages, err := s.messagesRepo.GetMessagesByIDs(ctx, thread.ChatID, thread.MessageIDs[startIdx:])
+	if err != nil {
+		return fmt.Errorf("failed to get thread messages: %w", err)
+	}
+	messages = models.WithoutDeleted(messages)
+
 	if len(messages) == 0 {
 		return nil
 	}
 
 	prompt := prompts.ThreadSummaryPrompt(messages)
 
-	config := &genai.GenerateContentConfig{
-		ResponseMIMEType: "application/json",
-		ResponseSchema: &genai.Schema{
-			Type: genai.TypeObject,
-			Properties: map[string]*genai.Schema{
+	req := gemini.Request{
+		Messages: gemini.NewPrompt(prompt),
+		CallSite: "classifier",
+		Schema: &gemini.Schema{
+			Type: gemini.TypeObject,
+			Properties: map[string]*gemini.Schema{
 				"theme": {
-					Type:      genai.TypeString,
+					Type:      gemini.TypeString,
 					MaxLength: &constants.MaxThreadThemeLength,
 				},
 				"summary": {
-					Type:      genai.TypeString,
+					Type:      gemini.TypeString,
 					MaxLength: &constants.MaxThreadSummaryLength,
 				},
 			},
 		},
 	}
 
-	response, err := s.gemini.GenerateContent(ctx, prompt, config)
+	response, err := s.gemini.GenerateContent(ctx, req)
 
 	s.logger.InfoContext(ctx, "Analyzer update thread summary response", "response", response)
 
@@ -310,7 +368,7 @@ func (s *ClassifierService) updateThreadSummary(ctx context.Context, thread *mod
 	thread.Theme = summary.Theme
 	thread.Summary = summary.Summary
 
-	return nil
+	return s.threadsRepo.UpdateThreadSummary(ctx, thread.ID, thread.Theme, thread.Summary)
 }
 
 func min(a, b int) int {
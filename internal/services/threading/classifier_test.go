@@ -0,0 +1,62 @@
+package threading
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/kriku/kpukbot/internal/clients/gemini"
+	"github.com/kriku/kpukbot/internal/config"
+	"github.com/kriku/kpukbot/internal/models"
+	messagesRepo "github.com/kriku/kpukbot/internal/repository/messages"
+	threadsRepo "github.com/kriku/kpukbot/internal/repository/threads"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLLM answers every request with the same response or error
+type fakeLLM struct {
+	response string
+	err      error
+}
+
+func (f *fakeLLM) GenerateContent(ctx context.Context, req gemini.Request) (string, error) {
+	return f.response, f.err
+}
+
+func (f *fakeLLM) WithProfile(profile config.ModelProfile) gemini.Client { return f }
+func (f *fakeLLM) Close() error                                          { return nil }
+
+func TestClassifierService_NewThread(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	message := &models.Message{ID: 1, ChatID: 100, Text: `He said "hi" \o/`}
+
+	classify := func(llm *fakeLLM) (*models.ThreadMatch, error) {
+		service := NewClassifierService(llm, threadsRepo.NewMemoryThreadsRepository(), messagesRepo.NewMemoryMessagesRepository(), logger)
+		return service.ClassifyMessage(ctx, message)
+	}
+
+	t.Run("summaries come from the model", func(t *testing.T) {
+		match, err := classify(&fakeLLM{response: `{"theme": "Greetings", "summary": "Someone says hi"}`})
+		require.NoError(t, err)
+		assert.Equal(t, "Greetings", match.Thread.Theme)
+		assert.Equal(t, "Someone says hi", match.Thread.Summary)
+	})
+
+	t.Run("failed summaries fall back to the text", func(t *testing.T) {
+		for _, llm := range []*fakeLLM{{err: errors.New("bad request")}, {response: "not json"}} {
+			match, err := classify(llm)
+			require.NoError(t, err)
+			assert.Equal(t, "New conversation", match.Thread.Theme)
+			assert.Equal(t, message.Text, match.Thread.Summary)
+		}
+	})
+
+	t.Run("an unavailable model creates no thread", func(t *testing.T) {
+		_, err := classify(&fakeLLM{err: gemini.ErrUnavailable})
+		assert.ErrorIs(t, err, gemini.ErrUnavailable)
+	})
+}
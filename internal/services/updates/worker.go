@@ -0,0 +1,200 @@
+package updates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	tmodels "github.com/go-telegram/bot/models"
+	"github.com/google/uuid"
+	"github.com/kriku/kpukbot/internal/config"
+	"github.com/kriku/kpukbot/internal/models"
+	updatesRepo "github.com/kriku/kpukbot/internal/repository/updates"
+)
+
+// maxRetryDelay caps the backoff between attempts of an update
+const maxRetryDelay = 10 * time.Minute
+
+// Processor handles the updates taken from the queue
+type Processor interface {
+	// ProcessUpdate processes an update, a returned error is retried
+	ProcessUpdate(ctx context.Context, update *tmodels.Update) error
+	// ProcessFailed is called once an update is moved to the dead letters
+	ProcessFailed(ctx context.Context, update *tmodels.Update, err error)
+}
+
+// Worker queues webhook updates and processes them with a pool of workers
+type Worker struct {
+	queue     updatesRepo.UpdatesRepository
+	processor Processor
+	config    config.UpdateQueueConfig
+	wake      chan struct{}
+	logger    *slog.Logger
+}
+
+// NewWorker creates a worker pool on top of the queue
+func NewWorker(
+	queue updatesRepo.UpdatesRepository,
+	processor Processor,
+	config config.UpdateQueueConfig,
+	logger *slog.Logger,
+) *Worker {
+	return &Worker{
+		queue:     queue,
+		processor: processor,
+		config:    config,
+		wake:      make(chan struct{}, 1),
+		logger:    logger.With("service", "update_worker"),
+	}
+}
+
+// Enqueue stores an update for the workers
+func (w *Worker) Enqueue(ctx context.Context, update *tmodels.Update) error {
+	payload, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("failed to encode update: %w", err)
+	}
+
+	queued := models.QueuedUpdate{
+		ID:       uuid.NewString(),
+		UpdateID: update.ID,
+		ChatID:   models.UpdateChatID(update),
+		Payload:  payload,
+	}
+	if err := w.queue.Enqueue(ctx, queued); err != nil {
+		return err
+	}
+
+	// Wake an idle worker of this instance instead of waiting for the next poll
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Run processes queued updates with the configured number of workers until ctx is done.
+// Updates in flight are finished before Run returns
+func (w *Worker) Run(ctx context.Context) {
+	w.logger.InfoContext(ctx, "Starting update workers", "workers", w.config.Workers)
+
+	var wg sync.WaitGroup
+	for range max(w.config.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+	wg.Wait()
+
+	w.logger.InfoContext(ctx, "Update workers stopped")
+}
+
+func (w *Worker) loop(ctx context.Context) {
+	for ctx.Err() == nil {
+		processed, err := w.ProcessNext(ctx)
+		if err != nil {
+			w.logger.WarnContext(ctx, "Failed to take update from the queue", "error", err)
+		}
+		if processed {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-w.wake:
+		case <-time.After(w.config.PollInterval):
+		}
+	}
+}
+
+// ProcessNext leases and processes one update, it reports whether there was one
+func (w *Worker) ProcessNext(ctx context.Context) (bool, error) {
+	leased, err := w.queue.Lease(ctx, 1, w.config.VisibilityTimeout)
+	if err != nil {
+		return false, err
+	}
+	if len(leased) == 0 {
+		return false, nil
+	}
+
+	// A leased update is finished even when the worker is asked to stop
+	w.process(context.WithoutCancel(ctx), leased[0])
+	return true, nil
+}
+
+func (w *Worker) process(ctx context.Context, queued *models.QueuedUpdate) {
+	ctx, cancel := context.WithTimeout(ctx, w.config.VisibilityTimeout)
+	defer cancel()
+
+	var update tmodels.Update
+	if err := json.Unmarshal(queued.Payload, &update); err != nil {
+		w.deadLetter(ctx, queued, nil, fmt.Errorf("failed to decode update: %w", err))
+		return
+	}
+
+	// Processing ends before the lease does, the update is acked or rescheduled before another
+	// worker can lease it
+	processCtx, cancelProcess := context.WithTimeout(ctx, processingTimeout(w.config.VisibilityTimeout))
+	err := w.processor.ProcessUpdate(processCtx, &update)
+	cancelProcess()
+	if err == nil {
+		if err := w.queue.Ack(ctx, queued.ID); err != nil {
+			w.logger.WarnContext(ctx, "Failed to ack update", "update_id", queued.UpdateID, "error", err)
+		}
+		return
+	}
+
+	if queued.Attempts >= w.config.MaxAttempts {
+		w.deadLetter(ctx, queued, &update, err)
+		return
+	}
+
+	delay := retryDelay(w.config.RetryDelay, queued.Attempts)
+	w.logger.WarnContext(ctx, "Update failed, retrying",
+		"update_id", queued.UpdateID,
+		"attempt", queued.Attempts,
+		"delay", delay,
+		"error", err)
+
+	if err := w.queue.Retry(ctx, queued.ID, delay, err.Error()); err != nil {
+		// The update comes back once its visibility timeout passes
+		w.logger.WarnContext(ctx, "Failed to schedule retry", "update_id", queued.UpdateID, "error", err)
+	}
+}
+
+func (w *Worker) deadLetter(ctx context.Context, queued *models.QueuedUpdate, update *tmodels.Update, cause error) {
+	w.logger.ErrorContext(ctx, "Update failed, moving to dead letters",
+		"update_id", queued.UpdateID,
+		"attempts", queued.Attempts,
+		"error", cause)
+
+	if err := w.queue.DeadLetter(ctx, queued.ID, cause.Error()); err != nil {
+		w.logger.ErrorContext(ctx, "Failed to dead letter update", "update_id", queued.UpdateID, "error", err)
+		return
+	}
+
+	if update != nil {
+		w.processor.ProcessFailed(ctx, update, cause)
+	}
+}
+
+// processingTimeout is the time an update may be processed within its lease, the rest of the lease
+// is left for acking or rescheduling it
+func processingTimeout(visibilityTimeout time.Duration) time.Duration {
+	return visibilityTimeout * 4 / 5
+}
+
+// retryDelay doubles the base delay for every failed attempt
+func retryDelay(base time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
@@ -0,0 +1,157 @@
+package updates
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	tmodels "github.com/go-telegram/bot/models"
+	"github.com/kriku/kpukbot/internal/config"
+	"github.com/kriku/kpukbot/internal/models"
+	updatesRepo "github.com/kriku/kpukbot/internal/repository/updates"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProcessor fails the first failures calls of every update
+type fakeProcessor struct {
+	mu        sync.Mutex
+	failures  int
+	calls     map[int64]int
+	failed    []int64
+	processed []int64
+}
+
+func (p *fakeProcessor) ProcessUpdate(ctx context.Context, update *tmodels.Update) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls[update.ID]++
+	if p.calls[update.ID] <= p.failures {
+		return errors.New("boom")
+	}
+	p.processed = append(p.processed, update.ID)
+	return nil
+}
+
+func (p *fakeProcessor) ProcessFailed(ctx context.Context, update *tmodels.Update, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failed = append(p.failed, update.ID)
+}
+
+func newTestWorker(failures int) (*Worker, *fakeProcessor, updatesRepo.UpdatesRepository) {
+	queue := updatesRepo.NewMemoryUpdatesRepository()
+	processor := &fakeProcessor{failures: failures, calls: make(map[int64]int)}
+	worker := NewWorker(queue, processor, config.UpdateQueueConfig{
+		Workers:           2,
+		PollInterval:      10 * time.Millisecond,
+		VisibilityTimeout: time.Minute,
+		MaxAttempts:       3,
+	}, slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+	return worker, processor, queue
+}
+
+func TestWorker_ProcessNext(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("processed updates are acked", func(t *testing.T) {
+		worker, processor, _ := newTestWorker(0)
+		require.NoError(t, worker.Enqueue(ctx, &tmodels.Update{ID: 1, Message: &tmodels.Message{Chat: tmodels.Chat{ID: 100}}}))
+
+		processed, err := worker.ProcessNext(ctx)
+		require.NoError(t, err)
+		assert.True(t, processed)
+		assert.Equal(t, []int64{1}, processor.processed)
+
+		processed, err = worker.ProcessNext(ctx)
+		require.NoError(t, err)
+		assert.False(t, processed)
+	})
+
+	t.Run("failed updates are retried", func(t *testing.T) {
+		worker, processor, _ := newTestWorker(2)
+		require.NoError(t, worker.Enqueue(ctx, &tmodels.Update{ID: 1}))
+
+		for range 3 {
+			processed, err := worker.ProcessNext(ctx)
+			require.NoError(t, err)
+			assert.True(t, processed)
+		}
+		assert.Equal(t, 3, processor.calls[1])
+		assert.Equal(t, []int64{1}, processor.processed)
+		assert.Empty(t, processor.failed)
+	})
+
+	t.Run("updates failing every attempt become dead letters", func(t *testing.T) {
+		worker, processor, queue := newTestWorker(10)
+		require.NoError(t, worker.Enqueue(ctx, &tmodels.Update{ID: 1}))
+
+		for range 3 {
+			_, err := worker.ProcessNext(ctx)
+			require.NoError(t, err)
+		}
+		processed, err := worker.ProcessNext(ctx)
+		require.NoError(t, err)
+		assert.False(t, processed)
+
+		assert.Equal(t, []int64{1}, processor.failed)
+		deadLetters, err := queue.GetDeadLetters(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, deadLetters, 1)
+		assert.Equal(t, "boom", deadLetters[0].LastError)
+		assert.Equal(t, 3, deadLetters[0].Attempts)
+	})
+
+	t.Run("undecodable updates become dead letters right away", func(t *testing.T) {
+		worker, processor, queue := newTestWorker(0)
+		require.NoError(t, queue.Enqueue(ctx, models.QueuedUpdate{ID: "bad", Payload: []byte("{")}))
+
+		_, err := worker.ProcessNext(ctx)
+		require.NoError(t, err)
+
+		deadLetters, err := queue.GetDeadLetters(ctx, 10)
+		require.NoError(t, err)
+		assert.Len(t, deadLetters, 1)
+		assert.Empty(t, processor.failed)
+	})
+}
+
+func TestWorker_Run(t *testing.T) {
+	worker, processor, _ := newTestWorker(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		worker.Run(ctx)
+		close(done)
+	}()
+
+	for i := range 10 {
+		require.NoError(t, worker.Enqueue(ctx, &tmodels.Update{ID: int64(i)}))
+	}
+
+	assert.Eventually(t, func() bool {
+		processor.mu.Lock()
+		defer processor.mu.Unlock()
+		return len(processor.processed) == 10
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+func TestProcessingTimeout(t *testing.T) {
+	assert.Equal(t, 4*time.Minute, processingTimeout(5*time.Minute))
+	assert.Less(t, processingTimeout(time.Minute), time.Minute)
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, time.Second, retryDelay(time.Second, 1))
+	assert.Equal(t, 4*time.Second, retryDelay(time.Second, 3))
+	assert.Equal(t, maxRetryDelay, retryDelay(time.Second, 30))
+}
@@ -0,0 +1,64 @@
+package usage
+
+import (
+	"context"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/models"
+)
+
+// CheckBudget compares the usage of a chat in the current day and month with its budgets.
+// An exhausted budget wins over one that is only near its limit
+func (s *UsageService) CheckBudget(ctx context.Context, settings *models.ChatSettings) (models.BudgetStatus, error) {
+	status := models.BudgetStatus{State: models.BudgetOK}
+	if !settings.HasBudget() {
+		return status, nil
+	}
+
+	nearRatio := settings.BudgetNearRatio
+	if nearRatio <= 0 {
+		nearRatio = models.DefaultBudgetNearRatio
+	}
+
+	// check raises the status when used is close to or over limit, zero limits are unlimited
+	check := func(used, limit float64, period string) {
+		if limit <= 0 {
+			return
+		}
+		state := models.BudgetOK
+		switch {
+		case used >= limit:
+			state = models.BudgetExhausted
+		case used >= limit*nearRatio:
+			state = models.BudgetNear
+		}
+		if state > status.State {
+			status = models.BudgetStatus{State: state, Period: period}
+		}
+	}
+
+	now := s.now().UTC()
+
+	if settings.DailyTokenBudget > 0 || settings.DailyCostBudgetUSD > 0 {
+		daily, err := s.GetChatTotals(ctx, settings.ChatID, now, now)
+		if err != nil {
+			return status, err
+		}
+		day := now.Format(models.UsageDayLayout)
+		check(float64(daily.TotalTokens), float64(settings.DailyTokenBudget), day)
+		check(daily.CostUSD, settings.DailyCostBudgetUSD, day)
+	}
+
+	if settings.MonthlyTokenBudget > 0 || settings.MonthlyCostBudgetUSD > 0 {
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		monthly, err := s.GetChatTotals(ctx, settings.ChatID, monthStart, now)
+		if err != nil {
+			return status, err
+		}
+		month := now.Format(models.UsageMonthLayout)
+		check(float64(monthly.TotalTokens), float64(settings.MonthlyTokenBudget), month)
+		check(monthly.CostUSD, settings.MonthlyCostBudgetUSD, month)
+	}
+
+	return status, nil
+}
@@ -0,0 +1,86 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/clients/gemini"
+	"github.com/kriku/kpukbot/internal/config"
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/repository/usage"
+)
+
+// UsageService accounts LLM token usage and its estimated cost per chat
+type UsageService struct {
+	repository usage.UsageRepository
+	config     *config.Config
+	now        func() time.Time
+	logger     *slog.Logger
+}
+
+// NewUsageService creates a new usage service
+func NewUsageService(repository usage.UsageRepository, config *config.Config, logger *slog.Logger) *UsageService {
+	return &UsageService{
+		repository: repository,
+		config:     config,
+		now:        time.Now,
+		logger:     logger.With("service", "usage"),
+	}
+}
+
+// RecordUsage implements gemini.UsageRecorder, the call is attributed to the usage scope of the context.
+// Accounting failures are logged and never fail the LLM call
+func (s *UsageService) RecordUsage(ctx context.Context, u gemini.Usage) {
+	scope, _ := gemini.UsageScopeFrom(ctx)
+
+	record := models.LLMUsage{
+		ChatID:         scope.ChatID,
+		UserID:         scope.UserID,
+		ThreadID:       scope.ThreadID,
+		CallSite:       u.CallSite,
+		Model:          u.Model,
+		PromptTokens:   u.PromptTokens,
+		ResponseTokens: u.ResponseTokens,
+		TotalTokens:    u.TotalTokens,
+		CostUSD:        s.config.Cost(u.Model, u.PromptTokens, u.ResponseTokens),
+		CreatedAt:      s.now(),
+	}
+
+	s.logger.DebugContext(ctx, "LLM usage",
+		"chat_id", record.ChatID,
+		"call_site", record.CallSite,
+		"model", record.Model,
+		"total_tokens", record.TotalTokens,
+		"cost_usd", record.CostUSD)
+
+	// The request context may be cancelled right after the call returns
+	if err := s.repository.AddUsage(context.WithoutCancel(ctx), record); err != nil {
+		s.logger.WarnContext(ctx, "Failed to record LLM usage", "chat_id", record.ChatID, "error", err)
+	}
+}
+
+// GetChatUsage returns the daily usage of a chat between two days, both inclusive
+func (s *UsageService) GetChatUsage(ctx context.Context, chatID int64, from, to time.Time) ([]*models.DailyUsage, error) {
+	usage, err := s.repository.GetDailyUsage(ctx, chatID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat usage: %w", err)
+	}
+	return usage, nil
+}
+
+// GetChatTotals sums the usage of a chat between two days, both inclusive
+func (s *UsageService) GetChatTotals(ctx context.Context, chatID int64, from, to time.Time) (models.UsageTotals, error) {
+	var totals models.UsageTotals
+
+	usage, err := s.GetChatUsage(ctx, chatID, from, to)
+	if err != nil {
+		return totals, err
+	}
+
+	for _, u := range usage {
+		totals.Add(u)
+	}
+	return totals, nil
+}
@@ -0,0 +1,128 @@
+package usage
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/clients/gemini"
+	"github.com/kriku/kpukbot/internal/config"
+	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/repository/usage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageService_RecordUsage(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	cfg := &config.Config{ModelPricing: map[string]config.ModelPrice{
+		"gemini-2.5-flash": {InputPerMillion: 0.30, OutputPerMillion: 2.50},
+	}}
+
+	service := NewUsageService(usage.NewMemoryUsageRepository(), cfg, logger)
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+
+	scoped := gemini.WithUsageScope(ctx, gemini.UsageScope{ChatID: 1, UserID: 7, ThreadID: "thread-1"})
+	service.RecordUsage(scoped, gemini.Usage{
+		Model:          "gemini-2.5-flash",
+		CallSite:       "general",
+		PromptTokens:   1_000_000,
+		ResponseTokens: 100_000,
+		TotalTokens:    1_100_000,
+	})
+	service.RecordUsage(scoped, gemini.Usage{Model: "local-model", CallSite: "classifier", TotalTokens: 50})
+
+	// Calls without a scope are kept under chat 0
+	service.RecordUsage(ctx, gemini.Usage{Model: "gemini-2.5-flash", TotalTokens: 10})
+
+	daily, err := service.GetChatUsage(ctx, 1, now, now)
+	require.NoError(t, err)
+	require.Len(t, daily, 2)
+	for _, u := range daily {
+		assert.Equal(t, int64(7), u.UserID)
+		assert.Equal(t, "thread-1", u.ThreadID)
+	}
+
+	totals, err := service.GetChatTotals(ctx, 1, now, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), totals.Calls)
+	assert.Equal(t, int64(1_100_050), totals.TotalTokens)
+	assert.InDelta(t, 0.30+0.25, totals.CostUSD, 1e-9) // Unknown models cost nothing
+
+	unscoped, err := service.GetChatUsage(ctx, 0, now, now)
+	require.NoError(t, err)
+	assert.Len(t, unscoped, 1)
+}
+
+func TestUsageService_CheckBudget(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	cfg := &config.Config{ModelPricing: map[string]config.ModelPrice{
+		"gemini-2.5-flash": {InputPerMillion: 1, OutputPerMillion: 1},
+	}}
+
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	newService := func(t *testing.T) *UsageService {
+		service := NewUsageService(usage.NewMemoryUsageRepository(), cfg, logger)
+		service.now = func() time.Time { return now }
+
+		// 900 tokens today and 1000 earlier this month
+		scoped := gemini.WithUsageScope(ctx, gemini.UsageScope{ChatID: 1})
+		service.RecordUsage(scoped, gemini.Usage{Model: "gemini-2.5-flash", PromptTokens: 900, TotalTokens: 900})
+		service.now = func() time.Time { return now.AddDate(0, 0, -5) }
+		service.RecordUsage(scoped, gemini.Usage{Model: "gemini-2.5-flash", PromptTokens: 1000, TotalTokens: 1000})
+		service.now = func() time.Time { return now }
+		return service
+	}
+
+	tests := []struct {
+		name     string
+		settings models.ChatSettings
+		want     models.BudgetStatus
+	}{
+		{
+			name: "no budget",
+			want: models.BudgetStatus{State: models.BudgetOK},
+		},
+		{
+			name:     "daily tokens within budget",
+			settings: models.ChatSettings{DailyTokenBudget: 2000},
+			want:     models.BudgetStatus{State: models.BudgetOK},
+		},
+		{
+			name:     "daily tokens near budget",
+			settings: models.ChatSettings{DailyTokenBudget: 1000},
+			want:     models.BudgetStatus{State: models.BudgetNear, Period: "2025-03-10"},
+		},
+		{
+			name:     "custom near ratio",
+			settings: models.ChatSettings{DailyTokenBudget: 1000, BudgetNearRatio: 0.95},
+			want:     models.BudgetStatus{State: models.BudgetOK},
+		},
+		{
+			name:     "monthly tokens exhausted",
+			settings: models.ChatSettings{DailyTokenBudget: 1000, MonthlyTokenBudget: 1900},
+			want:     models.BudgetStatus{State: models.BudgetExhausted, Period: "2025-03"},
+		},
+		{
+			name:     "daily cost exhausted",
+			settings: models.ChatSettings{DailyCostBudgetUSD: 0.0009},
+			want:     models.BudgetStatus{State: models.BudgetExhausted, Period: "2025-03-10"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := tt.settings
+			settings.ChatID = 1
+
+			status, err := newService(t).CheckBudget(ctx, &settings)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, status)
+		})
+	}
+}
@@ -13,7 +13,6 @@ import (
 	"github.com/kriku/kpukbot/internal/prompts"
 	"github.com/kriku/kpukbot/internal/services/messages"
 	"github.com/kriku/kpukbot/internal/services/users"
-	"google.golang.org/genai"
 )
 
 type AssessmentStrategy struct {
@@ -123,22 +122,23 @@ func (s *AssessmentStrategy) evaluateShouldRespondWithLLM(ctx context.Context, t
 	// Create evaluation prompt using centralized template
 	prompt := prompts.AssessmentShouldRespondPrompt(thread, conversationContext, newMessage, user)
 
-	config := &genai.GenerateContentConfig{
-		SystemInstruction: genai.NewContentFromText("Analyze the conversation to determine if the user's message should trigger assessment response. Be precise.", genai.RoleModel),
-		ResponseMIMEType:  "application/json",
-		ResponseSchema: &genai.Schema{
-			Type: genai.TypeObject,
-			Properties: map[string]*genai.Schema{
+	req := gemini.Request{
+		SystemInstruction: "Analyze the conversation to determine if the user's message should trigger assessment response. Be precise.",
+		Messages:          gemini.NewPrompt(prompt),
+		CallSite:          s.Name(),
+		Schema: &gemini.Schema{
+			Type: gemini.TypeObject,
+			Properties: map[string]*gemini.Schema{
 				"should_respond": {
-					Type: genai.TypeBoolean,
+					Type: gemini.TypeBoolean,
 				},
 				"confidence": {
-					Type:    genai.TypeNumber,
+					Type:    gemini.TypeNumber,
 					Minimum: &constants.MinimumConfidenceScore,
 					Maximum: &constants.MaximumConfidenceScore,
 				},
 				"reason": {
-					Type:      genai.TypeString,
+					Type:      gemini.TypeString,
 					MaxLength: &constants.MaxAnalysisLength,
 				},
 			},
@@ -147,7 +147,7 @@ func (s *AssessmentStrategy) evaluateShouldRespondWithLLM(ctx context.Context, t
 	}
 
 	// Use Gemini to evaluate
-	response, err := s.gemini.GenerateContent(ctx, prompt, config)
+	response, err := s.gemini.GenerateContent(ctx, req)
 	if err != nil {
 		return false, 0.0, fmt.Errorf("failed to evaluate with LLM: %w", err)
 	}
@@ -202,9 +202,9 @@ func (s *AssessmentStrategy) buildConversationHistory(messages []*models.Message
 
 	// Add previous messages
 	for _, msg := range messages {
-		role := "user"
+		role := gemini.RoleUser
 		if msg.IsBot {
-			role = "model"
+			role = gemini.RoleModel
 		}
 
 		history = append(history, gemini.Message{
@@ -215,7 +215,7 @@ func (s *AssessmentStrategy) buildConversationHistory(messages []*models.Message
 
 	// Add the new user message
 	history = append(history, gemini.Message{
-		Role:    "user",
+		Role:    gemini.RoleUser,
 		Content: newMessage.Text,
 	})
 
@@ -239,7 +239,7 @@ func (s *AssessmentStrategy) assessUserAnswer(ctx context.Context, user *models.
 	var conversationContext strings.Builder
 	for _, msg := range conversationHistory {
 		sender := "User"
-		if msg.Role == "model" {
+		if msg.Role == gemini.RoleModel {
 			sender = "Bot"
 		}
 		conversationContext.WriteString(fmt.Sprintf("%s: %s\n", sender, msg.Content))
@@ -252,26 +252,27 @@ func (s *AssessmentStrategy) assessUserAnswer(ctx context.Context, user *models.
 		conversationContext.String(),
 	)
 
-	config := &genai.GenerateContentConfig{
-		SystemInstruction: genai.NewContentFromText("Assess the user's response quality and provide constructive feedback. Return valid JSON with score, feedback, and optional follow-up question.", genai.RoleModel),
-		ResponseMIMEType:  "application/json",
-		ResponseSchema: &genai.Schema{
-			Type: genai.TypeObject,
-			Properties: map[string]*genai.Schema{
+	req := gemini.Request{
+		SystemInstruction: "Assess the user's response quality and provide constructive feedback. Return valid JSON with score, feedback, and optional follow-up question.",
+		Messages:          gemini.NewPrompt(fullPrompt),
+		CallSite:          s.Name(),
+		Schema: &gemini.Schema{
+			Type: gemini.TypeObject,
+			Properties: map[string]*gemini.Schema{
 				"score": {
-					Type:    genai.TypeNumber,
+					Type:    gemini.TypeNumber,
 					Minimum: &constants.MinimumConfidenceScore,
 					Maximum: &constants.MaximumConfidenceScore,
 				},
 				"feedback": {
-					Type:      genai.TypeString,
+					Type:      gemini.TypeString,
 					MaxLength: &constants.MaxAssessmentFeedbackLength,
 				},
 				"follow_up_needed": {
-					Type: genai.TypeBoolean,
+					Type: gemini.TypeBoolean,
 				},
 				"follow_up_question": {
-					Type:      genai.TypeString,
+					Type:      gemini.TypeString,
 					MaxLength: &constants.MaxAnalysisLength,
 				},
 			},
@@ -280,7 +281,7 @@ func (s *AssessmentStrategy) assessUserAnswer(ctx context.Context, user *models.
 	}
 
 	// Use Gemini to generate assessment
-	response, err := s.gemini.GenerateContent(ctx, fullPrompt, config)
+	response, err := s.gemini.GenerateContent(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate assessment: %w", err)
 	}
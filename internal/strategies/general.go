@@ -7,18 +7,20 @@ import (
 	"github.com/kriku/kpukbot/internal/clients/gemini"
 	"github.com/kriku/kpukbot/internal/models"
 	"github.com/kriku/kpukbot/internal/prompts"
-	"google.golang.org/genai"
+	"github.com/kriku/kpukbot/internal/services/media"
 )
 
 type GeneralStrategy struct {
-	gemini gemini.Client
-	logger *slog.Logger
+	gemini  gemini.Client
+	economy gemini.Client // Cheaper model used in economy mode
+	logger  *slog.Logger
 }
 
-func NewGeneralStrategy(gemini gemini.Client, logger *slog.Logger) *GeneralStrategy {
+func NewGeneralStrategy(gemini gemini.Client, economy gemini.Client, logger *slog.Logger) *GeneralStrategy {
 	return &GeneralStrategy{
-		gemini: gemini,
-		logger: logger.With("strategy", "general"),
+		gemini:  gemini,
+		economy: economy,
+		logger:  logger.With("strategy", "general"),
 	}
 }
 
@@ -39,12 +41,20 @@ func (s *GeneralStrategy) ShouldRespond(ctx context.Context, thread *models.Thre
 func (s *GeneralStrategy) GenerateResponse(ctx context.Context, thread *models.Thread, messages []*models.Message, newMessage *models.Message) (string, error) {
 	prompt := prompts.GeneralResponsePrompt(thread, messages, newMessage)
 
-	config := &genai.GenerateContentConfig{
-		SystemInstruction: genai.NewContentFromText("The maximum length of the answer is 4096 characters.", genai.RoleModel),
-		ResponseMIMEType:  "text/plain",
+	req := gemini.Request{
+		SystemInstruction: "The maximum length of the answer is 4096 characters.",
+		Messages:          gemini.NewPrompt(prompt, media.MessageMedia(newMessage)...),
+		CallSite:          s.Name(),
 	}
 
-	response, err := s.gemini.GenerateContent(ctx, prompt, config)
+	client := s.gemini
+	if EconomyMode(ctx) {
+		// The image description in the prompt has to do
+		client = s.economy
+		req.Messages = gemini.NewPrompt(prompt)
+	}
+
+	response, err := client.GenerateContent(ctx, req)
 
 	s.logger.InfoContext(ctx, "General response", "response", response)
 
@@ -10,7 +10,6 @@ import (
 	"github.com/kriku/kpukbot/internal/prompts"
 	"github.com/kriku/kpukbot/internal/services/chats"
 	"github.com/kriku/kpukbot/internal/services/users"
-	"google.golang.org/genai"
 )
 
 type IntroductionStrategy struct {
@@ -41,22 +40,23 @@ func (s *IntroductionStrategy) ShouldRespond(ctx context.Context, thread *models
 	// Use LLM to analyze if the message is an introduction
 	prompt := prompts.IntroductionAnalysisPrompt(newMessage)
 
-	config := &genai.GenerateContentConfig{
-		SystemInstruction: genai.NewContentFromText("Analyze the message to determine if it's a user introduction. Be precise and return valid JSON.", genai.RoleModel),
-		ResponseMIMEType:  "application/json",
-		ResponseSchema: &genai.Schema{
-			Type: genai.TypeObject,
-			Properties: map[string]*genai.Schema{
+	req := gemini.Request{
+		SystemInstruction: "Analyze the message to determine if it's a user introduction. Be precise and return valid JSON.",
+		Messages:          gemini.NewPrompt(prompt),
+		CallSite:          s.Name(),
+		Schema: &gemini.Schema{
+			Type: gemini.TypeObject,
+			Properties: map[string]*gemini.Schema{
 				"is_introduction": {
-					Type: genai.TypeBoolean,
+					Type: gemini.TypeBoolean,
 				},
 				"confidence": {
-					Type:    genai.TypeNumber,
+					Type:    gemini.TypeNumber,
 					Minimum: &constants.MinimumConfidenceScore,
 					Maximum: &constants.MaximumConfidenceScore,
 				},
 				"reasoning": {
-					Type:      genai.TypeString,
+					Type:      gemini.TypeString,
 					MaxLength: &constants.MaxAnalysisLength,
 				},
 			},
@@ -64,7 +64,7 @@ func (s *IntroductionStrategy) ShouldRespond(ctx context.Context, thread *models
 		},
 	}
 
-	response, err := s.gemini.GenerateContent(ctx, prompt, config)
+	response, err := s.gemini.GenerateContent(ctx, req)
 
 	s.logger.InfoContext(ctx, "Analyze introduction should respond strategy", "response", response)
 
@@ -131,27 +131,28 @@ func (s *IntroductionStrategy) GenerateResponse(ctx context.Context, thread *mod
 func (s *IntroductionStrategy) extractUserInformation(ctx context.Context, message *models.Message) (*models.UserInformation, error) {
 	prompt := prompts.UserInformationExtractionPrompt(message)
 
-	config := &genai.GenerateContentConfig{
-		SystemInstruction: genai.NewContentFromText("Extract user information in JSON format. Be precise and only extract explicitly mentioned information.", genai.RoleModel),
-		ResponseMIMEType:  "application/json",
-		ResponseSchema: &genai.Schema{
-			Type: genai.TypeObject,
-			Properties: map[string]*genai.Schema{
+	req := gemini.Request{
+		SystemInstruction: "Extract user information in JSON format. Be precise and only extract explicitly mentioned information.",
+		Messages:          gemini.NewPrompt(prompt),
+		CallSite:          s.Name(),
+		Schema: &gemini.Schema{
+			Type: gemini.TypeObject,
+			Properties: map[string]*gemini.Schema{
 				"bio": {
-					Type:      genai.TypeString,
+					Type:      gemini.TypeString,
 					MaxLength: &constants.MaxUserBioLength,
 				},
 				"interests": {
-					Type: genai.TypeArray,
-					Items: &genai.Schema{
-						Type:      genai.TypeString,
+					Type: gemini.TypeArray,
+					Items: &gemini.Schema{
+						Type:      gemini.TypeString,
 						MaxLength: &constants.MaxUserInterestLength,
 					},
 				},
 				"hobbies": {
-					Type: genai.TypeArray,
-					Items: &genai.Schema{
-						Type:      genai.TypeString,
+					Type: gemini.TypeArray,
+					Items: &gemini.Schema{
+						Type:      gemini.TypeString,
 						MaxLength: &constants.MaxUserHobbyLength,
 					},
 				},
@@ -159,7 +160,7 @@ func (s *IntroductionStrategy) extractUserInformation(ctx context.Context, messa
 		},
 	}
 
-	response, err := s.gemini.GenerateContent(ctx, prompt, config)
+	response, err := s.gemini.GenerateContent(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -236,12 +237,13 @@ func (s *IntroductionStrategy) updateUserProfile(ctx context.Context, message *m
 func (s *IntroductionStrategy) generateConfirmationResponse(ctx context.Context, message *models.Message, userInfo *models.UserInformation) (string, error) {
 	prompt := prompts.IntroductionConfirmationPrompt(message, userInfo)
 
-	config := &genai.GenerateContentConfig{
-		SystemInstruction: genai.NewContentFromText("Generate a warm, friendly confirmation message. Keep it concise but personal. Maximum 300 characters.", genai.RoleModel),
-		ResponseMIMEType:  "text/plain",
+	req := gemini.Request{
+		SystemInstruction: "Generate a warm, friendly confirmation message. Keep it concise but personal. Maximum 300 characters.",
+		Messages:          gemini.NewPrompt(prompt),
+		CallSite:          s.Name(),
 	}
 
-	response, err := s.gemini.GenerateContent(ctx, prompt, config)
+	response, err := s.gemini.GenerateContent(ctx, req)
 	if err != nil {
 		return "", err
 	}
@@ -3,37 +3,39 @@ package strategies
 import (
 	"context"
 	"log/slog"
+	"strconv"
+	"strings"
 
+	tmodels "github.com/go-telegram/bot/models"
 	"github.com/kriku/kpukbot/internal/clients/gemini"
 	"github.com/kriku/kpukbot/internal/models"
 	"github.com/kriku/kpukbot/internal/prompts"
+	"github.com/kriku/kpukbot/internal/services/callbacks"
 	"github.com/kriku/kpukbot/internal/services/chats"
-	"github.com/kriku/kpukbot/internal/services/messages"
 	"github.com/kriku/kpukbot/internal/services/users"
-	"google.golang.org/genai"
 )
 
+// questionCallbackPrefix is the callback prefix of the buttons sent with questions
+const questionCallbackPrefix = "question"
+
 type QuestionStrategy struct {
-	gemini         gemini.Client
-	userService    *users.UsersService
-	chatService    *chats.ChatsService
-	messageService *messages.TelegramMessagesService
-	logger         *slog.Logger
+	gemini      gemini.Client
+	userService *users.UsersService
+	chatService *chats.ChatsService
+	logger      *slog.Logger
 }
 
 func NewQuestionStrategy(
 	gemini gemini.Client,
 	userService *users.UsersService,
 	chatService *chats.ChatsService,
-	messageService *messages.TelegramMessagesService,
 	logger *slog.Logger,
 ) *QuestionStrategy {
 	return &QuestionStrategy{
-		gemini:         gemini,
-		userService:    userService,
-		chatService:    chatService,
-		messageService: messageService,
-		logger:         logger.With("strategy", "question"),
+		gemini:      gemini,
+		userService: userService,
+		chatService: chatService,
+		logger:      logger.With("strategy", "question"),
 	}
 }
 
@@ -101,16 +103,71 @@ func (s *QuestionStrategy) AskQuestionToUser(ctx context.Context, chatID int64)
 	return question, queueEntry.UserID, nil
 }
 
+// QuestionKeyboard returns the buttons sent with a question to a user
+func (s *QuestionStrategy) QuestionKeyboard(userID int64) *tmodels.InlineKeyboardMarkup {
+	return &tmodels.InlineKeyboardMarkup{
+		InlineKeyboard: [][]tmodels.InlineKeyboardButton{{
+			callbacks.Button("Skip my question", questionCallbackPrefix, "skip:"+strconv.FormatInt(userID, 10)),
+		}},
+	}
+}
+
+// RegisterCallbacks registers the handler of the question buttons
+func (s *QuestionStrategy) RegisterCallbacks(router *callbacks.CallbackRouter) {
+	router.Handle(questionCallbackPrefix, s.handleCallback)
+}
+
+// handleCallback lets the asked user skip their question, the data is "skip:<user ID>"
+func (s *QuestionStrategy) handleCallback(ctx context.Context, req *callbacks.Request) (string, error) {
+	action, value, _ := strings.Cut(req.Data, ":")
+	userID, err := strconv.ParseInt(value, 10, 64)
+	if action != "skip" || err != nil {
+		return "", nil
+	}
+
+	if req.Query.From.ID != userID {
+		return "Only the asked user can skip this question.", nil
+	}
+
+	chat, err := s.chatService.GetChat(ctx, req.ChatID())
+	if err != nil {
+		return "", err
+	}
+
+	asked := false
+	for _, entry := range chat.QuestionQueue {
+		if entry.UserID == userID && entry.Status == models.QueueStatusAsking {
+			asked = true
+			break
+		}
+	}
+	if !asked {
+		return "This question is no longer open.", nil
+	}
+
+	if err := s.chatService.SkipUser(ctx, req.ChatID(), userID, "skipped by user"); err != nil {
+		return "", err
+	}
+
+	if err := req.EditKeyboard(ctx, nil); err != nil {
+		// The question is skipped, only the button stays
+		s.logger.WarnContext(ctx, "Failed to remove question buttons", "error", err)
+	}
+
+	return "Your question is skipped.", nil
+}
+
 // generateQuestionForUser creates a personalized question based on user's interests and hobbies
 func (s *QuestionStrategy) generateQuestionForUser(ctx context.Context, user *models.User) (string, error) {
 	prompt := prompts.QuestionGenerationPrompt(user)
 
-	config := &genai.GenerateContentConfig{
-		SystemInstruction: genai.NewContentFromText("Generate an engaging, thoughtful question based on the user's interests and hobbies. Keep it conversational and interesting. Maximum 300 characters.", genai.RoleModel),
-		ResponseMIMEType:  "text/plain",
+	req := gemini.Request{
+		SystemInstruction: "Generate an engaging, thoughtful question based on the user's interests and hobbies. Keep it conversational and interesting. Maximum 300 characters.",
+		Messages:          gemini.NewPrompt(prompt),
+		CallSite:          s.Name(),
 	}
 
-	response, err := s.gemini.GenerateContent(ctx, prompt, config)
+	response, err := s.gemini.GenerateContent(ctx, req)
 	if err != nil {
 		return "", err
 	}
@@ -123,8 +180,3 @@ func (s *QuestionStrategy) generateQuestionForUser(ctx context.Context, user *mo
 
 	return response, nil
 }
-
-// SaveQuestionAsMessage saves a question as a bot message to maintain conversation history
-func (s *QuestionStrategy) SaveQuestionAsMessage(ctx context.Context, chatID int64, messageID int, questionText string) error {
-	return s.messageService.SaveBotMessage(ctx, chatID, messageID, questionText)
-}
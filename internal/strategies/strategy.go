@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/kriku/kpukbot/internal/models"
+	"github.com/kriku/kpukbot/internal/services/callbacks"
 )
 
 // ResponseStrategy defines the interface for different response strategies
@@ -22,6 +23,12 @@ type ResponseStrategy interface {
 	Priority() int
 }
 
+// CallbackStrategy is implemented by strategies that send inline keyboards
+type CallbackStrategy interface {
+	// RegisterCallbacks registers the handlers of the buttons the strategy sends
+	RegisterCallbacks(router *callbacks.CallbackRouter)
+}
+
 // StrategyResult holds the result of a strategy evaluation
 type StrategyResult struct {
 	Strategy      ResponseStrategy
@@ -30,3 +37,17 @@ type StrategyResult struct {
 	Response      string
 	Error         error
 }
+
+type economyModeKey struct{}
+
+// WithEconomyMode marks the context of a chat that is close to its LLM budget,
+// strategies should keep their model calls cheap
+func WithEconomyMode(ctx context.Context) context.Context {
+	return context.WithValue(ctx, economyModeKey{}, true)
+}
+
+// EconomyMode reports whether the context is marked with WithEconomyMode
+func EconomyMode(ctx context.Context) bool {
+	economy, _ := ctx.Value(economyModeKey{}).(bool)
+	return economy
+}
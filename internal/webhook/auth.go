@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/config"
+)
+
+// Headers of authenticated requests
+const (
+	TelegramSecretHeader   = "X-Telegram-Bot-Api-Secret-Token"
+	TriggerTimestampHeader = "X-Kpukbot-Timestamp" // Unix seconds, part of the signed payload
+	TriggerSignatureHeader = "X-Kpukbot-Signature" // sha256=<hex HMAC of "<timestamp>.<body>">
+)
+
+// MaxTriggerSkew is how far the timestamp of a signed trigger may be from now, older requests are replays
+const MaxTriggerSkew = 5 * time.Minute
+
+var (
+	// ErrSecretMissing is returned for updates when no secret token is configured and insecure
+	// webhooks are not allowed
+	ErrSecretMissing = errors.New("webhook secret token is not configured")
+	// ErrTriggersDisabled is returned when neither a trigger token nor an HMAC secret is configured
+	ErrTriggersDisabled = errors.New("triggers are disabled")
+	// ErrUnauthorized is returned for missing or invalid credentials
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
+// VerifyTelegramSecret checks the secret token Telegram sends with every update. Without a
+// configured secret updates are rejected, unless insecure webhooks are explicitly allowed
+func VerifyTelegramSecret(req *http.Request, c config.WebhookConfig) error {
+	if c.SecretToken == "" {
+		if c.Insecure {
+			return nil
+		}
+		return ErrSecretMissing
+	}
+	if !equal(req.Header.Get(TelegramSecretHeader), c.SecretToken) {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// VerifyTrigger authenticates a trigger request by its bearer token or HMAC signature of body
+func VerifyTrigger(req *http.Request, body []byte, c config.WebhookConfig, now time.Time) error {
+	if c.TriggerToken == "" && c.TriggerHMACSecret == "" {
+		return ErrTriggersDisabled
+	}
+
+	if token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok && c.TriggerToken != "" {
+		if equal(token, c.TriggerToken) {
+			return nil
+		}
+		return ErrUnauthorized
+	}
+
+	if signature := req.Header.Get(TriggerSignatureHeader); signature != "" && c.TriggerHMACSecret != "" {
+		return verifySignature(req.Header.Get(TriggerTimestampHeader), signature, body, c.TriggerHMACSecret, now)
+	}
+
+	return ErrUnauthorized
+}
+
+// Sign returns the TriggerSignatureHeader value of a trigger body sent at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func verifySignature(timestampHeader, signature string, body []byte, secret string, now time.Time) error {
+	timestamp, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return ErrUnauthorized
+	}
+
+	skew := now.Sub(time.Unix(timestamp, 0))
+	if skew > MaxTriggerSkew || skew < -MaxTriggerSkew {
+		return ErrUnauthorized
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body))) {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// equal compares secrets in constant time
+func equal(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
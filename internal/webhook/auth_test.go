@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kriku/kpukbot/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyTelegramSecret(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	assert.ErrorIs(t, VerifyTelegramSecret(req, config.WebhookConfig{}), ErrSecretMissing, "no secret configured")
+	assert.NoError(t, VerifyTelegramSecret(req, config.WebhookConfig{Insecure: true}), "insecure webhooks allowed")
+
+	c := config.WebhookConfig{SecretToken: "s3cret"}
+	assert.ErrorIs(t, VerifyTelegramSecret(req, c), ErrUnauthorized)
+
+	req.Header.Set(TelegramSecretHeader, "wrong")
+	assert.ErrorIs(t, VerifyTelegramSecret(req, c), ErrUnauthorized)
+
+	req.Header.Set(TelegramSecretHeader, "s3cret")
+	assert.NoError(t, VerifyTelegramSecret(req, c))
+}
+
+func TestVerifyTrigger(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{}`)
+	c := config.WebhookConfig{TriggerToken: "token", TriggerHMACSecret: "key"}
+
+	signed := func(secret string, timestamp time.Time, body []byte) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/trigger/question", nil)
+		req.Header.Set(TriggerTimestampHeader, strconv.FormatInt(timestamp.Unix(), 10))
+		req.Header.Set(TriggerSignatureHeader, Sign(secret, timestamp.Unix(), body))
+		return req
+	}
+	bearer := func(token string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/trigger/question", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req
+	}
+
+	tests := []struct {
+		name    string
+		req     *http.Request
+		config  config.WebhookConfig
+		wantErr error
+	}{
+		{"disabled", bearer("token"), config.WebhookConfig{}, ErrTriggersDisabled},
+		{"no credentials", httptest.NewRequest(http.MethodPost, "/trigger/question", nil), c, ErrUnauthorized},
+		{"bearer token", bearer("token"), c, nil},
+		{"wrong bearer token", bearer("other"), c, ErrUnauthorized},
+		{"bearer without configured token", bearer("token"), config.WebhookConfig{TriggerHMACSecret: "key"}, ErrUnauthorized},
+		{"signature", signed("key", now, body), c, nil},
+		{"signature within skew", signed("key", now.Add(-4*time.Minute), body), c, nil},
+		{"wrong key", signed("other", now, body), c, ErrUnauthorized},
+		{"other body", signed("key", now, []byte(`{"x":1}`)), c, ErrUnauthorized},
+		{"replayed", signed("key", now.Add(-10*time.Minute), body), c, ErrUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyTrigger(tt.req, body, tt.config, now)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}